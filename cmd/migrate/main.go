@@ -0,0 +1,105 @@
+// migrate — миграции схемы PostgreSQL.
+//
+//	go run ./cmd/migrate up        # применить недостающие миграции
+//	go run ./cmd/migrate status    # показать применённые и ожидающие
+//
+// Сервер применяет миграции сам при старте (MIGRATE_ON_START=true); команда
+// нужна, чтобы накатить схему отдельным шагом деплоя или проверить её.
+// Код выхода: 0 — схема актуальна, 1 — status нашёл ожидающие, изменённые
+// или неизвестные миграции, 2 — ошибка.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fangimal/ITK/internal/config"
+	"github.com/fangimal/ITK/internal/migrations"
+)
+
+const (
+	exitOK      = 0
+	exitPending = 1
+	exitError   = 2
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Использование: %s up|status\n", os.Args[0])
+	}
+	flag.Parse()
+	if flag.NArg() != 1 || (flag.Arg(0) != "up" && flag.Arg(0) != "status") {
+		flag.Usage()
+		return exitError
+	}
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, config.Load().PostgresDSN())
+	if err != nil {
+		log.Printf("❌ Ошибка подключения к БД: %v", err)
+		return exitError
+	}
+	defer conn.Close(ctx)
+
+	if flag.Arg(0) == "up" {
+		return up(ctx, conn)
+	}
+	return status(ctx, conn)
+}
+
+func up(ctx context.Context, conn *pgx.Conn) int {
+	applied, err := migrations.Up(ctx, conn)
+	for _, m := range applied {
+		log.Printf("📜 Применена миграция %s", m)
+	}
+	if err != nil {
+		log.Printf("❌ Ошибка миграции: %v", err)
+		return exitError
+	}
+	if len(applied) == 0 {
+		log.Println("✅ Схема актуальна, применять нечего")
+	}
+	return exitOK
+}
+
+func status(ctx context.Context, conn *pgx.Conn) int {
+	statuses, err := migrations.GetStatus(ctx, conn)
+	if err != nil {
+		log.Printf("❌ Ошибка чтения истории миграций: %v", err)
+		return exitError
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MIGRATION\tSTATUS\tAPPLIED AT")
+	code := exitOK
+	for _, s := range statuses {
+		state, appliedAt := "applied", ""
+		if s.AppliedAt != nil {
+			appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		switch {
+		case s.AppliedAt == nil:
+			state, code = "pending", exitPending
+		case s.Modified:
+			state, code = "modified", exitPending
+		case s.Unknown:
+			state, code = "unknown", exitPending
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Migration, state, appliedAt)
+	}
+	if err := w.Flush(); err != nil {
+		log.Printf("❌ Ошибка вывода: %v", err)
+		return exitError
+	}
+	return code
+}
@@ -0,0 +1,80 @@
+// reconcile — сверка wallets.balance с журналом операций.
+//
+//	go run ./cmd/reconcile                         # только отчёт
+//	go run ./cmd/reconcile --fix --reason="..."    # записать корректировки
+//
+// Отчёт печатается в stdout в JSON. Код выхода: 0 — расхождений нет,
+// 1 — найдены неисправленные расхождения или отрицательные балансы, 2 — ошибка.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/fangimal/ITK/internal/config"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/fangimal/ITK/internal/repository"
+)
+
+const (
+	exitOK    = 0
+	exitDrift = 1
+	exitError = 2
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	var opts model.ReconcileOptions
+	flag.BoolVar(&opts.Fix, "fix", false, "записать корректировки ADJUSTMENT_IN/ADJUSTMENT_OUT для расхождений")
+	flag.StringVar(&opts.Reason, "reason", "", "причина корректировки (обязательна с --fix)")
+	flag.IntVar(&opts.BatchSize, "batch-size", model.DefaultReconcileBatchSize, "сколько кошельков читать за один запрос")
+	flag.Parse()
+
+	if opts.Fix && opts.Reason == "" {
+		log.Println("❌ --fix требует --reason")
+		return exitError
+	}
+	if opts.BatchSize <= 0 {
+		log.Println("❌ --batch-size должен быть положительным")
+		return exitError
+	}
+
+	cfg := config.Load()
+	if cfg.Storage != config.StoragePostgres {
+		log.Printf("❌ Сверка работает только с STORAGE=%s", config.StoragePostgres)
+		return exitError
+	}
+
+	repo, err := repository.NewPostgresWalletRepository(cfg)
+	if err != nil {
+		log.Printf("❌ Ошибка подключения к БД: %v", err)
+		return exitError
+	}
+	defer repo.Close()
+
+	report, err := repo.Reconcile(context.Background(), opts)
+	if err != nil {
+		log.Printf("❌ Ошибка сверки: %v", err)
+		return exitError
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Printf("❌ Ошибка вывода отчёта: %v", err)
+		return exitError
+	}
+
+	if report.DriftDetected {
+		log.Printf("⚠️ Обнаружены расхождения: %d (исправлено %d)", len(report.Mismatches), len(report.Fixed))
+		return exitDrift
+	}
+	log.Printf("✅ Проверено кошельков: %d, расхождений нет", report.WalletsScanned)
+	return exitOK
+}
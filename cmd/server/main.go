@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -11,7 +13,11 @@ import (
 
 	"github.com/fangimal/ITK/internal/config"
 	"github.com/fangimal/ITK/internal/handlers"
+	"github.com/fangimal/ITK/internal/migrations"
+	"github.com/fangimal/ITK/internal/model"
 	"github.com/fangimal/ITK/internal/repository"
+	"github.com/fangimal/ITK/internal/webhook"
+	"github.com/jackc/pgx/v5"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -20,30 +26,81 @@ const (
 	operation       = "/api/v1/wallet"                     // POST — операция
 	getBalance      = "/api/v1/wallets/:uuid"              // GET — баланс
 	getTransactions = "/api/v1/wallets/:uuid/transactions" // GET — аудит
+	getStatement    = "/api/v1/wallets/:uuid/statement"    // GET — выписка за период (CSV / JSON Lines)
+	transfer        = "/api/v1/transfers"                  // POST — перевод между кошельками
+	ledgerCheck     = "/api/v1/admin/ledger/check"         // GET — сверка главной книги
+	ledgerEntry     = "/api/v1/admin/ledger/entries/:id"   // GET — запись журнала с проводками
+	reconcile       = "/api/v1/admin/reconcile"            // GET — сверка балансов, POST — сверка с исправлением
+	createHold      = "/api/v1/holds"                      // POST — блокировка средств
+	getHold         = "/api/v1/holds/:id"                  // GET — холд
+	captureHold     = "/api/v1/holds/:id/capture"          // POST — списание (полное или частичное)
+	voidHold        = "/api/v1/holds/:id/void"             // POST — отмена
+
+	freezeWallet        = "/api/v1/admin/wallets/:uuid/freeze"         // POST — заморозка кошелька
+	unfreezeWallet      = "/api/v1/admin/wallets/:uuid/unfreeze"       // POST — разморозка
+	closeWallet         = "/api/v1/admin/wallets/:uuid/close"          // POST — закрытие (только пустого кошелька)
+	walletStatusHistory = "/api/v1/admin/wallets/:uuid/status-history" // GET — журнал смены статусов
+
+	overdraftLimit   = "/api/v1/admin/wallets/:uuid/overdraft"         // POST — кредитная линия кошелька
+	overdraftHistory = "/api/v1/admin/wallets/:uuid/overdraft-history" // GET — журнал изменений лимита
+
+	fxRates       = "/api/v1/admin/fx/rates"        // POST — курс одного направления
+	fxRatesImport = "/api/v1/admin/fx/rates/import" // POST — импорт курсов из CSV
+	fxRatesList   = "/api/v1/fx/rates"              // GET — текущие курсы
+	fxQuotes      = "/api/v1/fx/quotes"             // POST — котировка обмена
+	fxQuote       = "/api/v1/fx/quotes/:id"         // GET — котировка
+	fxExecute     = "/api/v1/fx/quotes/:id/execute" // POST — исполнение котировки
+
+	feeRules = "/api/v1/admin/fees/rules"     // POST — правило комиссии, GET — список
+	feeRule  = "/api/v1/admin/fees/rules/:id" // DELETE — удаление правила
+
+	limitPolicies = "/api/v1/admin/limits"     // POST — политика лимитов на списания, GET — список
+	limitPolicy   = "/api/v1/admin/limits/:id" // DELETE — удаление политики
+
+	reverseTransaction = "/api/v1/transactions/:id/reverse" // POST — возврат по операции (полный или частичный)
+	operationsBatch    = "/api/v1/operations:batch"         // POST — пакет операций (atomic / independent), см. newHandler
+
+	walletByExternalID       = "/api/v1/wallets/by-external/:id" // GET — кошелёк по externalId (?ownerId=...)
+	walletByExternalIDPrefix = "/api/v1/wallets/by-external/"    // префикс для ServeMux, см. newHandler
+
+	webhookSubscriptions = "/api/v1/webhooks/subscriptions"            // POST — подписка, GET — список
+	webhookSubscription  = "/api/v1/webhooks/subscriptions/:id"        // DELETE — отписка
+	webhookDeliveries    = "/api/v1/webhooks/deliveries"               // GET — доставки (?status=DEAD)
+	webhookRedeliver     = "/api/v1/webhooks/deliveries/:id/redeliver" // POST — переотправка
 )
 
 func main() {
 	cfg := config.Load()
 
-	// Подключаемся к БД
-	repo, err := repository.NewPostgresWalletRepository(cfg)
+	// Подключаемся к хранилищу
+	repo, closeRepo, err := newRepository(cfg)
 	if err != nil {
 		log.Fatalf("❌ Ошибка подключения к БД: %v", err)
 	}
-	defer repo.Close()
+	defer closeRepo()
 
-	router := httprouter.New()
-	walletHandler := handlers.NewWalletHandler(repo)
+	// Операции по сверхгорячим кошелькам — микропакетами
+	if len(cfg.CoalesceWallets) > 0 {
+		repo = repository.NewCoalescingRepository(repo, cfg)
+		log.Printf("🧺 Микропакеты для %d кошельков: окно %s, до %d операций", len(cfg.CoalesceWallets), cfg.CoalesceWindow, cfg.CoalesceMaxBatch)
+	}
 
-	// Регистрируем обработчики с логированием
-	router.POST(createWallet, logRequest(walletHandler.CreateWallet))
-	router.POST(operation, logRequest(walletHandler.Operation))
-	router.GET(getBalance, logRequest(walletHandler.GetBalance))
-	router.GET(getTransactions, logRequest(walletHandler.GetTransactions))
+	// Фоновые задачи живут, пока работает сервер
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	go purgeIdempotencyKeys(bgCtx, repo, time.Hour)
+	go webhook.NewDispatcher(repo, cfg).Run(bgCtx)
+	go expireHolds(bgCtx, repo, time.Minute)
+	go snapshotBalances(bgCtx, repo, time.Hour)
+
+	if cfg.AdminToken == "" {
+		log.Printf("⚠️ ADMIN_TOKEN не задан — админские маршруты /api/v1/admin/* отключены")
+	}
 
 	srv := &http.Server{
 		Addr:    ":" + cfg.AppPort,
-		Handler: router,
+		Handler: newHandler(handlers.NewWalletHandler(repo, cfg), cfg.AdminToken),
 	}
 
 	// Graceful shutdown
@@ -64,6 +121,123 @@ func main() {
 	log.Println("✅ Сервер остановлен корректно")
 }
 
+// newRepository выбирает хранилище по STORAGE: postgres (по умолчанию) или memory
+func newRepository(cfg *config.Config) (repository.WalletRepository, func(), error) {
+	switch cfg.Storage {
+	case config.StoragePostgres:
+		if cfg.MigrateOnStart {
+			if err := migrateSchema(cfg); err != nil {
+				return nil, nil, err
+			}
+		}
+		repo, err := repository.NewPostgresWalletRepository(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		return repo, repo.Close, nil
+	case config.StorageMemory:
+		log.Println("⚠️ STORAGE=memory: данные хранятся в памяти и пропадут при перезапуске")
+		repo := repository.NewMemoryWalletRepository(cfg)
+		return repo, repo.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown STORAGE %q, expected %s or %s", cfg.Storage, config.StoragePostgres, config.StorageMemory)
+	}
+}
+
+// migrateSchema применяет недостающие миграции схемы. Реплики, стартующие
+// одновременно, ждут друг друга на advisory lock внутри migrations.Up.
+func migrateSchema(cfg *config.Config) error {
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, cfg.PostgresDSN())
+	if err != nil {
+		return fmt.Errorf("connect for migrations: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	applied, err := migrations.Up(ctx, conn)
+	for _, m := range applied {
+		log.Printf("📜 Применена миграция %s", m)
+	}
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	return nil
+}
+
+// newHandler — маршруты API. Их же поднимают e2e-тесты, поэтому таблица
+// маршрутов одна.
+//
+// Часть путей httprouter не различает, их разбирает ServeMux раньше основного
+// роутера: статический сегмент by-external нельзя поставить рядом с параметром
+// :uuid, поэтому /api/v1/wallets/by-external/ отдаётся роутеру lookup, а
+// ":batch" в /api/v1/operations:batch httprouter считал бы параметром
+func newHandler(walletHandler *handlers.WalletHandler, adminToken string) http.Handler {
+	router := httprouter.New()
+
+	// Регистрируем обработчики с логированием
+	router.POST(createWallet, logRequest(walletHandler.CreateWallet))
+	router.GET(createWallet, logRequest(walletHandler.ListWallets))
+	router.POST(operation, logRequest(walletHandler.Operation))
+	router.GET(getBalance, logRequest(walletHandler.GetBalance))
+	router.GET(getTransactions, logRequest(walletHandler.GetTransactions))
+	router.GET(getStatement, logRequest(walletHandler.Statement))
+	router.POST(transfer, logRequest(walletHandler.Transfer))
+	router.POST(createHold, logRequest(walletHandler.CreateHold))
+	router.GET(getHold, logRequest(walletHandler.GetHold))
+	router.POST(captureHold, logRequest(walletHandler.CaptureHold))
+	router.POST(voidHold, logRequest(walletHandler.VoidHold))
+	router.POST(reverseTransaction, logRequest(walletHandler.ReverseTransaction))
+	router.GET(fxRatesList, logRequest(walletHandler.ListFXRates))
+	router.POST(fxQuotes, logRequest(walletHandler.CreateFXQuote))
+	router.GET(fxQuote, logRequest(walletHandler.GetFXQuote))
+	router.POST(fxExecute, logRequest(walletHandler.ExecuteFXQuote))
+	router.POST(webhookSubscriptions, logRequest(walletHandler.CreateSubscription))
+	router.GET(webhookSubscriptions, logRequest(walletHandler.ListSubscriptions))
+	router.DELETE(webhookSubscription, logRequest(walletHandler.DeleteSubscription))
+	router.GET(webhookDeliveries, logRequest(walletHandler.ListDeliveries))
+	router.POST(webhookRedeliver, logRequest(walletHandler.Redeliver))
+
+	// Админские маршруты /api/v1/admin/* — только при заданном ADMIN_TOKEN
+	// и только с ним в заголовке, см. requireAdmin
+	if adminToken != "" {
+		admin := func(handler httprouter.Handle) httprouter.Handle {
+			return logRequest(requireAdmin(adminToken, handler))
+		}
+		router.GET(ledgerCheck, admin(walletHandler.CheckLedger))
+		router.GET(ledgerEntry, admin(walletHandler.GetJournalEntry))
+		router.GET(reconcile, admin(walletHandler.Reconcile))
+		router.POST(reconcile, admin(walletHandler.ReconcileFix))
+		router.POST(freezeWallet, admin(walletHandler.FreezeWallet))
+		router.POST(unfreezeWallet, admin(walletHandler.UnfreezeWallet))
+		router.POST(closeWallet, admin(walletHandler.CloseWallet))
+		router.GET(walletStatusHistory, admin(walletHandler.GetWalletStatusHistory))
+		router.POST(overdraftLimit, admin(walletHandler.SetOverdraftLimit))
+		router.GET(overdraftHistory, admin(walletHandler.GetOverdraftHistory))
+		router.POST(fxRates, admin(walletHandler.UpsertFXRate))
+		router.POST(fxRatesImport, admin(walletHandler.ImportFXRates))
+		router.POST(feeRules, admin(walletHandler.UpsertFeeRule))
+		router.GET(feeRules, admin(walletHandler.ListFeeRules))
+		router.DELETE(feeRule, admin(walletHandler.DeleteFeeRule))
+		router.POST(limitPolicies, admin(walletHandler.UpsertLimitPolicy))
+		router.GET(limitPolicies, admin(walletHandler.ListLimitPolicies))
+		router.DELETE(limitPolicy, admin(walletHandler.DeleteLimitPolicy))
+	}
+
+	// Поиск по externalId — на отдельном роутере, см. newHandler
+	lookup := httprouter.New()
+	lookup.GET(walletByExternalID, logRequest(walletHandler.GetWalletByExternalID))
+
+	batch := logRequest(walletHandler.BatchOperations)
+
+	mux := http.NewServeMux()
+	mux.Handle(walletByExternalIDPrefix, lookup)
+	mux.HandleFunc(http.MethodPost+" "+operationsBatch, func(w http.ResponseWriter, r *http.Request) {
+		batch(w, r, nil)
+	})
+	mux.Handle("/", router)
+	return mux
+}
+
 // logRequest — middleware для логирования
 func logRequest(handler httprouter.Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
@@ -71,3 +245,91 @@ func logRequest(handler httprouter.Handle) httprouter.Handle {
 		handler(w, r, ps)
 	}
 }
+
+// requireAdmin — middleware админских маршрутов: пропускает только запросы
+// с заголовком Authorization: Bearer <ADMIN_TOKEN>
+func requireAdmin(token string, handler httprouter.Handle) httprouter.Handle {
+	expected := []byte("Bearer " + token)
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, `{"error":"admin token required"}`, http.StatusUnauthorized)
+			return
+		}
+		handler(w, r, ps)
+	}
+}
+
+// purgeIdempotencyKeys — периодическая очистка просроченных Idempotency-Key
+func purgeIdempotencyKeys(ctx context.Context, repo repository.WalletRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := repo.PurgeExpiredIdempotencyKeys(ctx)
+			if err != nil {
+				log.Printf("⚠️ Очистка ключей идемпотентности: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("🧹 Удалено просроченных ключей идемпотентности: %d", n)
+			}
+		}
+	}
+}
+
+// expireHolds — периодический перевод просроченных холдов в EXPIRED.
+// Доступный баланс учитывает срок холда и без этой задачи; она нужна,
+// чтобы статус холда в БД соответствовал действительности.
+func expireHolds(ctx context.Context, repo repository.WalletRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := repo.ExpireHolds(ctx)
+			if err != nil {
+				log.Printf("⚠️ Истечение холдов: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("⌛ Истекло холдов: %d", n)
+			}
+		}
+	}
+}
+
+// snapshotBalances — периодические снимки балансов на начало суток (UTC) для
+// запросов ?asOf=...: с ними баланс считается от снимка, а не с начала журнала.
+// Повторный запуск в те же сутки ничего не пишет.
+func snapshotBalances(ctx context.Context, repo repository.WalletRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			at := model.BalanceSnapshotTime(time.Now())
+			// Снимок ждёт незавершённые транзакции; зависшая не должна копить запуски
+			runCtx, cancel := context.WithTimeout(ctx, interval)
+			n, err := repo.SnapshotBalances(runCtx, at)
+			cancel()
+			if err != nil {
+				log.Printf("⚠️ Снимки балансов: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("📸 Снимки балансов на %s: %d", at.Format(time.RFC3339), n)
+			}
+		}
+	}
+}
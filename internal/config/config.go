@@ -1,19 +1,57 @@
 package config
 
 import (
+	"fmt"
+	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
+
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// Варианты STORAGE
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory" // без БД: данные живут до перезапуска процесса
 )
 
 type Config struct {
 	AppPort   string
+	Storage   string
 	DBHost    string
 	DBPort    string
 	DBUser    string
 	DBPass    string
 	DBName    string
 	DBSSLMode string
+
+	MigrateOnStart bool // накатывать миграции схемы при старте сервера
+
+	AdminToken string // Bearer-токен для /api/v1/admin/*; пусто — админские маршруты не регистрируются
+
+	IdempotencyTTL time.Duration // сколько хранится Idempotency-Key
+	HoldTTL        time.Duration // срок холда, если в запросе не указан ttlSeconds
+
+	FreezeBlocksCredits bool // замороженный кошелёк не принимает и зачисления
+
+	CoalesceWallets  []uuid.UUID   // кошельки, операции по которым проводятся микропакетами; пусто — режим выключен
+	CoalesceWindow   time.Duration // сколько копится микропакет
+	CoalesceMaxBatch int           // микропакет уходит сразу, набрав столько операций
+
+	FXQuoteTTL time.Duration  // сколько действует зафиксированный курс котировки
+	FXRounding model.Rounding // округление суммы зачисления при обмене
+
+	WebhookPollInterval time.Duration // как часто диспетчер ищет новые события
+	WebhookTimeout      time.Duration // таймаут одного запроса к подписчику
+	WebhookBackoff      time.Duration // задержка перед первым повтором, дальше удваивается
+	WebhookMaxAttempts  int           // после стольких неудач доставка уходит в DEAD
+
+	WebhookAllowedTargets []string // хосты, IP и сети (CIDR), куда можно слать вебхуки, даже если адрес внутренний
 }
 
 func Load() *Config {
@@ -22,18 +60,135 @@ func Load() *Config {
 
 	return &Config{
 		AppPort:   getEnv("APP_PORT", "8080"),
+		Storage:   getEnv("STORAGE", StoragePostgres),
 		DBHost:    getEnv("DB_HOST", "localhost"),
 		DBPort:    getEnv("DB_PORT", "5433"),
 		DBUser:    getEnv("DB_USER", "wallet_user"),
 		DBPass:    getEnv("DB_PASSWORD", "secure_password_123"),
 		DBName:    getEnv("DB_NAME", "wallet_db"),
 		DBSSLMode: getEnv("DB_SSLMODE", "disable"),
+
+		MigrateOnStart: getBool("MIGRATE_ON_START", true),
+
+		AdminToken: os.Getenv("ADMIN_TOKEN"),
+
+		IdempotencyTTL: getDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		HoldTTL:        getDuration("HOLD_TTL", 24*time.Hour),
+
+		FreezeBlocksCredits: getBool("FREEZE_BLOCKS_CREDITS", false),
+
+		CoalesceWallets:  getUUIDs("COALESCE_WALLETS"),
+		CoalesceWindow:   getDuration("COALESCE_WINDOW", 2*time.Millisecond),
+		CoalesceMaxBatch: getInt("COALESCE_MAX_BATCH", 100),
+
+		FXQuoteTTL: getDuration("FX_QUOTE_TTL", 30*time.Second),
+		FXRounding: getRounding("FX_ROUNDING", model.RoundDown),
+
+		WebhookPollInterval: getDuration("WEBHOOK_POLL_INTERVAL", time.Second),
+		WebhookTimeout:      getDuration("WEBHOOK_TIMEOUT", 5*time.Second),
+		WebhookBackoff:      getDuration("WEBHOOK_BACKOFF", 5*time.Second),
+		WebhookMaxAttempts:  getInt("WEBHOOK_MAX_ATTEMPTS", 10),
+
+		WebhookAllowedTargets: getList("WEBHOOK_ALLOWED_TARGETS"),
 	}
 }
 
+// PostgresDSN — строка подключения к PostgreSQL
+func (c *Config) PostgresDSN() string {
+	return fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		c.DBHost, c.DBPort, c.DBUser, c.DBPass, c.DBName, c.DBSSLMode,
+	)
+}
+
 func getEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
 		return value
 	}
 	return fallback
 }
+
+// getDuration читает длительность в формате time.ParseDuration ("24h", "30m")
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("⚠️ Некорректное значение %s=%q, используется %s", key, value, fallback)
+		return fallback
+	}
+	return d
+}
+
+// getInt читает положительное целое
+func getInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("⚠️ Некорректное значение %s=%q, используется %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// getBool читает флаг в формате strconv.ParseBool ("true", "1", "false")
+func getBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("⚠️ Некорректное значение %s=%q, используется %t", key, value, fallback)
+		return fallback
+	}
+	return b
+}
+
+// getRounding читает правило округления: DOWN, HALF_UP или HALF_EVEN
+func getRounding(key string, fallback model.Rounding) model.Rounding {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	r, ok := model.ParseRounding(value)
+	if !ok {
+		log.Printf("⚠️ Некорректное значение %s=%q, используется %s", key, value, fallback)
+		return fallback
+	}
+	return r
+}
+
+// getList читает список через запятую, пустые значения пропускаются
+func getList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getUUIDs читает список UUID через запятую; некорректные значения пропускаются
+func getUUIDs(key string) []uuid.UUID {
+	var ids []uuid.UUID
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			log.Printf("⚠️ Некорректный UUID в %s: %q, пропущен", key, value)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -1,14 +1,77 @@
 package errors
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
-	WalletNotFound    = errors.New("wallet not found")
-	InsufficientFunds = errors.New("insufficient funds")
-	InvalidAmount     = errors.New("amount must be positive")
-	InvalidOperation  = errors.New("invalid operation type")
+	WalletNotFound       = errors.New("wallet not found")
+	InsufficientFunds    = errors.New("insufficient funds")
+	InvalidAmount        = errors.New("amount must be positive")
+	InvalidOperation     = errors.New("invalid operation type")
+	InvalidCursor        = errors.New("invalid cursor")
+	SameWallet           = errors.New("source and destination wallets must differ")
+	IdempotencyKeyReused = errors.New("idempotency key reused with different payload")
+	UnbalancedEntry      = errors.New("journal entry does not balance")
+	EntryNotFound        = errors.New("journal entry not found")
+	ReasonRequired       = errors.New("reason is required")
+	SubscriptionNotFound = errors.New("webhook subscription not found")
+	DeliveryNotFound     = errors.New("webhook delivery not found")
+	InvalidWebhookURL    = errors.New("invalid webhook url")
+	ForbiddenWebhookURL  = errors.New("webhook url points to a forbidden address")
+	HoldNotFound         = errors.New("hold not found")
+	HoldNotActive        = errors.New("hold is not active")
+	WalletFrozen         = errors.New("wallet is frozen")
+	WalletClosed         = errors.New("wallet is closed")
+	InvalidTransition    = errors.New("invalid wallet status transition")
+	WalletNotEmpty       = errors.New("wallet has funds or active holds")
+	UnsupportedCurrency  = errors.New("unsupported currency")
+	CurrencyMismatch     = errors.New("currency does not match wallet")
+	SameCurrency         = errors.New("wallets have the same currency")
+	InvalidRate          = errors.New("invalid exchange rate")
+	RateNotFound         = errors.New("exchange rate not found")
+	QuoteNotFound        = errors.New("quote not found")
+	QuoteNotOpen         = errors.New("quote is not open")
+	InvalidWalletType    = errors.New("invalid wallet type")
+	InvalidFeeRule       = errors.New("invalid fee rule")
+	FeeRuleNotFound      = errors.New("fee rule not found")
+	InvalidOverdraft     = errors.New("overdraft limit must not be negative")
+	OverdraftInUse       = errors.New("wallet debt exceeds overdraft limit")
+	InvalidLimitPolicy   = errors.New("invalid limit policy")
+	LimitPolicyNotFound  = errors.New("limit policy not found")
+	LimitExceeded        = errors.New("limit exceeded")
+	TransactionNotFound  = errors.New("transaction not found")
+	NotReversible        = errors.New("transaction cannot be reversed")
+	AlreadyReversed      = errors.New("transaction is already fully reversed")
+	InvalidMetadata      = errors.New("invalid operation metadata")
+	DuplicateExternalRef = errors.New("external reference already used for this wallet")
+	InvalidWalletOwner   = errors.New("invalid wallet owner, external id or labels")
+	ExternalIDConflict   = errors.New("external id is already used by a wallet with other currency or type")
+	InvalidBatch         = errors.New("invalid batch")
+	BatchAborted         = errors.New("batch aborted: another operation failed")
+	PreconditionFailed   = errors.New("wallet has changed: If-Match does not match current ETag")
+	MigrationModified    = errors.New("applied migration has been modified")
+	SnapshotInFuture     = errors.New("balance snapshot time must be in the past")
 )
 
+// LimitError — нарушен лимит на списания: какой (Limit), его значение,
+// сколько уже использовано и сколько запрошено. errors.Is(err, LimitExceeded) — true
+type LimitError struct {
+	Limit     string
+	Max       int64
+	Used      int64
+	Requested int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s max %d, used %d, requested %d", LimitExceeded, e.Limit, e.Max, e.Used, e.Requested)
+}
+
+func (e *LimitError) Unwrap() error {
+	return LimitExceeded
+}
+
 // Is — для поддержки errors.Is()
 func Is(target, err error) bool {
 	return errors.Is(err, target)
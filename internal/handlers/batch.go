@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	myerrors "github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/julienschmidt/httprouter"
+)
+
+// batchItemResponse — итог одной операции пакета: код и тело ответа,
+// которые вернул бы на неё POST /api/v1/wallet
+type batchItemResponse struct {
+	Index  int                    `json:"index"`
+	Status int                    `json:"status"`
+	Result *model.OperationResult `json:"result,omitempty"`
+	Error  any                    `json:"error,omitempty"`
+}
+
+// batchResponse — тело ответа POST /api/v1/operations:batch
+type batchResponse struct {
+	Mode      model.BatchMode     `json:"mode"`
+	Committed bool                `json:"committed"` // false — атомарный пакет откачен целиком
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+	Items     []batchItemResponse `json:"items"`
+}
+
+// batchOperationsHandler — POST /api/v1/operations:batch
+// Тело: {"mode": "atomic" | "independent", "operations": [{...как в POST /api/v1/wallet}]}
+func (h *WalletHandler) BatchOperations(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req model.BatchRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"invalid JSON: %v"}`, err), http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Некорректная операция — ошибка всего запроса, а не отказ по ней
+	for i := range req.Operations {
+		if err := normalizeOperation(&req.Operations[i]); err != nil {
+			writeError(w, fmt.Sprintf("operations[%d]: %v", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	outcomes, err := h.repo.ApplyBatch(r.Context(), req.Mode, req.Operations)
+	if err != nil {
+		if errors.Is(err, myerrors.InvalidBatch) {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	resp := batchResponse{Mode: req.Mode, Items: make([]batchItemResponse, len(outcomes))}
+	for i, outcome := range outcomes {
+		item := batchItemResponse{Index: i, Status: http.StatusOK}
+		if outcome.Err != nil {
+			item.Status, item.Error = operationFailure(outcome.Err)
+			resp.Failed++
+		} else {
+			result := outcome.Result
+			item.Result = &result
+			resp.Succeeded++
+		}
+		resp.Items[i] = item
+	}
+	resp.Committed = req.Mode == model.BatchIndependent || resp.Failed == 0
+
+	log.Printf("📦 Пакет %s: %d операций, проведено %d, отклонено %d", req.Mode, len(outcomes), resp.Succeeded, resp.Failed)
+	if !resp.Committed {
+		writeJSONStatus(w, http.StatusUnprocessableEntity, resp)
+		return
+	}
+	writeJSON(w, resp)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	myerrors "github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// feeRuleRequest — тело POST /api/v1/admin/fees/rules
+type feeRuleRequest struct {
+	Operation  model.FeeOperation `json:"operation"`
+	Currency   model.Currency     `json:"currency"`
+	WalletType model.WalletType   `json:"walletType"`
+	Kind       model.FeeKind      `json:"kind"`
+	Fixed      int64              `json:"fixed"`
+	Percent    string             `json:"percent"`
+	MinFee     int64              `json:"minFee"`
+	MaxFee     int64              `json:"maxFee"`
+	Tiers      []model.FeeTier    `json:"tiers"`
+}
+
+// upsertFeeRuleHandler — POST /api/v1/admin/fees/rules
+// Правило с той же операцией, валютой и типом кошелька заменяется
+func (h *WalletHandler) UpsertFeeRule(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req feeRuleRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule, err := h.repo.UpsertFeeRule(r.Context(), model.FeeRule{
+		Operation:  req.Operation,
+		Currency:   req.Currency,
+		WalletType: req.WalletType,
+		Kind:       req.Kind,
+		Fixed:      req.Fixed,
+		Percent:    req.Percent,
+		MinFee:     req.MinFee,
+		MaxFee:     req.MaxFee,
+		Tiers:      req.Tiers,
+	})
+	if err != nil {
+		if errors.Is(err, myerrors.InvalidFeeRule) {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	log.Printf("💸 Правило комиссии %s %s/%s: %s", rule.Operation, rule.Currency, rule.WalletType, rule.Kind)
+	writeJSON(w, rule)
+}
+
+// listFeeRulesHandler — GET /api/v1/admin/fees/rules
+func (h *WalletHandler) ListFeeRules(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rules, err := h.repo.ListFeeRules(r.Context())
+	if err != nil {
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"items": rules})
+}
+
+// deleteFeeRuleHandler — DELETE /api/v1/admin/fees/rules/:id
+func (h *WalletHandler) DeleteFeeRule(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := uuid.Parse(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid UUID"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repo.DeleteFeeRule(r.Context(), id); err != nil {
+		if errors.Is(err, myerrors.FeeRuleNotFound) {
+			http.Error(w, `{"error":"fee rule not found"}`, http.StatusNotFound)
+			return
+		}
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
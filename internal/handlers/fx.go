@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	myerrors "github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxRatesCSVSize — предел тела импорта курсов
+const maxRatesCSVSize = 1 << 20
+
+// fxRateRequest — тело POST /api/v1/admin/fx/rates
+type fxRateRequest struct {
+	Base  model.Currency `json:"base"`
+	Quote model.Currency `json:"quote"`
+	Rate  string         `json:"rate"`
+}
+
+// upsertFXRateHandler — POST /api/v1/admin/fx/rates
+// Создаёт или обновляет курс одного направления
+func (h *WalletHandler) UpsertFXRate(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req fxRateRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rates, err := h.repo.UpsertFXRates(r.Context(), []model.FXRate{{Base: req.Base, Quote: req.Quote, Rate: req.Rate}})
+	if err != nil {
+		writeFXError(w, err)
+		return
+	}
+	writeJSON(w, rates[0])
+}
+
+// importFXRatesHandler — POST /api/v1/admin/fx/rates/import
+// Тело — CSV с заголовком base,quote,rate; файл применяется целиком или не применяется
+func (h *WalletHandler) ImportFXRates(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rates, err := model.ParseRatesCSV(http.MaxBytesReader(w, r.Body, maxRatesCSVSize))
+	if err != nil {
+		writeError(w, "invalid CSV: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	saved, err := h.repo.UpsertFXRates(r.Context(), rates)
+	if err != nil {
+		writeFXError(w, err)
+		return
+	}
+	log.Printf("💱 Импортировано курсов: %d", len(saved))
+	writeJSON(w, map[string]any{"items": saved})
+}
+
+// listFXRatesHandler — GET /api/v1/fx/rates
+func (h *WalletHandler) ListFXRates(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	rates, err := h.repo.ListFXRates(r.Context())
+	if err != nil {
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"items": rates})
+}
+
+// createFXQuoteHandler — POST /api/v1/fx/quotes
+// Фиксирует курс и суммы обмена на FX_QUOTE_TTL
+func (h *WalletHandler) CreateFXQuote(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req model.QuoteRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Amount <= 0 {
+		http.Error(w, `{"error":"amount must be positive integer"}`, http.StatusBadRequest)
+		return
+	}
+
+	quote, err := h.repo.CreateFXQuote(r.Context(), req, 0)
+	if err != nil {
+		writeFXError(w, err)
+		return
+	}
+	writeJSONStatus(w, http.StatusCreated, quote)
+}
+
+// getFXQuoteHandler — GET /api/v1/fx/quotes/:id
+func (h *WalletHandler) GetFXQuote(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	quoteID, err := uuid.Parse(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid UUID"}`, http.StatusBadRequest)
+		return
+	}
+
+	quote, err := h.repo.GetFXQuote(r.Context(), quoteID)
+	if err != nil {
+		writeFXError(w, err)
+		return
+	}
+	writeJSON(w, quote)
+}
+
+// executeFXQuoteHandler — POST /api/v1/fx/quotes/:id/execute
+// Списание и зачисление по зафиксированному курсу в одной транзакции
+func (h *WalletHandler) ExecuteFXQuote(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	quoteID, err := uuid.Parse(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid UUID"}`, http.StatusBadRequest)
+		return
+	}
+
+	quote, err := h.repo.ExecuteFXQuote(r.Context(), quoteID)
+	if err != nil {
+		writeFXError(w, err)
+		return
+	}
+	writeJSON(w, quote)
+}
+
+// writeFXError — общие коды ответа для курсов и котировок
+func writeFXError(w http.ResponseWriter, err error) {
+	if writeWalletStatusError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, myerrors.WalletNotFound):
+		http.Error(w, `{"error":"wallet not found"}`, http.StatusNotFound)
+	case errors.Is(err, myerrors.QuoteNotFound):
+		http.Error(w, `{"error":"quote not found"}`, http.StatusNotFound)
+	case errors.Is(err, myerrors.QuoteNotOpen):
+		http.Error(w, `{"error":"quote is not open"}`, http.StatusConflict)
+	case errors.Is(err, myerrors.RateNotFound):
+		http.Error(w, `{"error":"exchange rate not found"}`, http.StatusUnprocessableEntity)
+	case errors.Is(err, myerrors.InsufficientFunds):
+		http.Error(w, `{"error":"insufficient funds"}`, http.StatusUnprocessableEntity)
+	case errors.Is(err, myerrors.SameWallet):
+		http.Error(w, `{"error":"cannot exchange to the same wallet"}`, http.StatusBadRequest)
+	case errors.Is(err, myerrors.SameCurrency):
+		http.Error(w, `{"error":"wallets have the same currency, use transfer"}`, http.StatusBadRequest)
+	case errors.Is(err, myerrors.InvalidRate):
+		writeError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, myerrors.InvalidAmount):
+		http.Error(w, `{"error":"amount is too small to exchange"}`, http.StatusBadRequest)
+	default:
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+	}
+}
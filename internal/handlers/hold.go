@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	myerrors "github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// createHoldHandler — POST /api/v1/holds
+// Блокирует сумму на кошельке: доступный баланс уменьшается, баланс — нет
+func (h *WalletHandler) CreateHold(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req model.HoldRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"invalid JSON: %v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	if req.Amount <= 0 {
+		http.Error(w, `{"error":"amount must be positive integer"}`, http.StatusBadRequest)
+		return
+	}
+	if req.TTLSeconds < 0 {
+		http.Error(w, `{"error":"ttlSeconds must not be negative"}`, http.StatusBadRequest)
+		return
+	}
+	// 0 — срок по умолчанию из HOLD_TTL
+	ttl := time.Duration(req.TTLSeconds) * time.Second
+
+	hold, err := h.repo.CreateHold(r.Context(), req.WalletID, req.Amount, ttl)
+	if err != nil {
+		writeHoldError(w, err)
+		return
+	}
+	writeJSONStatus(w, http.StatusCreated, hold)
+}
+
+// getHoldHandler — GET /api/v1/holds/:id
+func (h *WalletHandler) GetHold(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	holdID, err := uuid.Parse(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid UUID"}`, http.StatusBadRequest)
+		return
+	}
+
+	hold, err := h.repo.GetHold(r.Context(), holdID)
+	if err != nil {
+		writeHoldError(w, err)
+		return
+	}
+	writeJSON(w, hold)
+}
+
+// captureHoldHandler — POST /api/v1/holds/:id/capture
+// Тело {"amount": N} необязательно: без него списывается весь холд
+func (h *WalletHandler) CaptureHold(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	holdID, err := uuid.Parse(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid UUID"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req model.CaptureRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, fmt.Sprintf(`{"error":"invalid JSON: %v"}`, err), http.StatusBadRequest)
+		return
+	}
+	if req.Amount < 0 {
+		http.Error(w, `{"error":"amount must be positive integer"}`, http.StatusBadRequest)
+		return
+	}
+
+	hold, err := h.repo.CaptureHold(r.Context(), holdID, req.Amount)
+	if err != nil {
+		writeHoldError(w, err)
+		return
+	}
+	writeJSON(w, hold)
+}
+
+// voidHoldHandler — POST /api/v1/holds/:id/void
+func (h *WalletHandler) VoidHold(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	holdID, err := uuid.Parse(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid UUID"}`, http.StatusBadRequest)
+		return
+	}
+
+	hold, err := h.repo.VoidHold(r.Context(), holdID)
+	if err != nil {
+		writeHoldError(w, err)
+		return
+	}
+	writeJSON(w, hold)
+}
+
+// writeHoldError — общие коды ответа для операций с холдами
+func writeHoldError(w http.ResponseWriter, err error) {
+	if writeWalletStatusError(w, err) || writeLimitError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, myerrors.WalletNotFound):
+		http.Error(w, `{"error":"wallet not found"}`, http.StatusNotFound)
+	case errors.Is(err, myerrors.HoldNotFound):
+		http.Error(w, `{"error":"hold not found"}`, http.StatusNotFound)
+	case errors.Is(err, myerrors.HoldNotActive):
+		http.Error(w, `{"error":"hold is not active"}`, http.StatusConflict)
+	case errors.Is(err, myerrors.InsufficientFunds):
+		http.Error(w, `{"error":"insufficient funds"}`, http.StatusUnprocessableEntity)
+	case errors.Is(err, myerrors.InvalidAmount):
+		http.Error(w, `{"error":"capture amount exceeds hold amount"}`, http.StatusBadRequest)
+	default:
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	myerrors "github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// ledgerCheckHandler — GET /api/v1/admin/ledger/check
+// Сверка главной книги: записи сбалансированы, балансы кошельков совпадают с проводками
+func (h *WalletHandler) CheckLedger(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	report, err := h.repo.CheckLedger(r.Context())
+	if err != nil {
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, report)
+}
+
+// ledgerEntryHandler — GET /api/v1/admin/ledger/entries/:id
+func (h *WalletHandler) GetJournalEntry(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	entryID, err := uuid.Parse(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid UUID"}`, http.StatusBadRequest)
+		return
+	}
+
+	entry, err := h.repo.GetJournalEntry(r.Context(), entryID)
+	if err != nil {
+		if errors.Is(err, myerrors.EntryNotFound) {
+			http.Error(w, `{"error":"journal entry not found"}`, http.StatusNotFound)
+			return
+		}
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, entry)
+}
+
+// reconcileHandler — GET /api/v1/admin/reconcile?batchSize=N
+// Сверка балансов с журналом операций, только чтение
+func (h *WalletHandler) Reconcile(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var opts model.ReconcileOptions
+	if raw := r.URL.Query().Get("batchSize"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			http.Error(w, `{"error":"batchSize must be a positive integer"}`, http.StatusBadRequest)
+			return
+		}
+		opts.BatchSize = n
+	}
+	h.reconcile(w, r, opts)
+}
+
+// reconcileFixHandler — POST /api/v1/admin/reconcile
+// Тело: {"fix": true, "reason": "...", "batchSize": N}. С fix расхождения
+// закрываются корректировками ADJUSTMENT_IN/ADJUSTMENT_OUT
+func (h *WalletHandler) ReconcileFix(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var opts model.ReconcileOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		http.Error(w, `{"error":"invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+	if opts.BatchSize < 0 {
+		http.Error(w, `{"error":"batchSize must be a positive integer"}`, http.StatusBadRequest)
+		return
+	}
+	h.reconcile(w, r, opts)
+}
+
+func (h *WalletHandler) reconcile(w http.ResponseWriter, r *http.Request, opts model.ReconcileOptions) {
+	report, err := h.repo.Reconcile(r.Context(), opts)
+	if err != nil {
+		if errors.Is(err, myerrors.ReasonRequired) {
+			http.Error(w, `{"error":"reason is required to fix drift"}`, http.StatusBadRequest)
+			return
+		}
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	if report.DriftDetected {
+		log.Printf("⚠️ Сверка: расхождений %d, исправлено %d", len(report.Mismatches), len(report.Fixed))
+	}
+	writeJSON(w, report)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	myerrors "github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// limitPolicyRequest — тело POST /api/v1/admin/limits
+type limitPolicyRequest struct {
+	WalletID                *uuid.UUID       `json:"walletId"`
+	WalletType              model.WalletType `json:"walletType"`
+	MaxSingle               int64            `json:"maxSingle"`
+	DailyWithdrawal         int64            `json:"dailyWithdrawal"`
+	MonthlyWithdrawal       int64            `json:"monthlyWithdrawal"`
+	MaxOperations           int64            `json:"maxOperations"`
+	OperationsWindowSeconds int64            `json:"operationsWindowSeconds"`
+}
+
+// limitExceededResponse — тело 422 при нарушении лимита
+type limitExceededResponse struct {
+	Error     string `json:"error"`
+	Code      string `json:"code"`
+	Limit     string `json:"limit"`
+	Max       int64  `json:"max"`
+	Used      int64  `json:"used"`
+	Requested int64  `json:"requested"`
+}
+
+// writeLimitError — ответ LIMIT_EXCEEDED с указанием нарушенного лимита;
+// false — ошибка не про лимиты
+func writeLimitError(w http.ResponseWriter, err error) bool {
+	body, ok := limitExceeded(err)
+	if ok {
+		writeJSONStatus(w, http.StatusUnprocessableEntity, body)
+	}
+	return ok
+}
+
+// limitExceeded — тело ответа LIMIT_EXCEEDED; false — ошибка не про лимиты
+func limitExceeded(err error) (limitExceededResponse, bool) {
+	var limitErr *myerrors.LimitError
+	if !errors.As(err, &limitErr) {
+		return limitExceededResponse{}, false
+	}
+	return limitExceededResponse{
+		Error:     "limit exceeded",
+		Code:      "LIMIT_EXCEEDED",
+		Limit:     limitErr.Limit,
+		Max:       limitErr.Max,
+		Used:      limitErr.Used,
+		Requested: limitErr.Requested,
+	}, true
+}
+
+// upsertLimitPolicyHandler — POST /api/v1/admin/limits
+// Политика для того же кошелька (или того же типа кошелька) заменяется
+func (h *WalletHandler) UpsertLimitPolicy(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req limitPolicyRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	policy, err := h.repo.UpsertLimitPolicy(r.Context(), model.LimitPolicy{
+		WalletID:                req.WalletID,
+		WalletType:              req.WalletType,
+		MaxSingle:               req.MaxSingle,
+		DailyWithdrawal:         req.DailyWithdrawal,
+		MonthlyWithdrawal:       req.MonthlyWithdrawal,
+		MaxOperations:           req.MaxOperations,
+		OperationsWindowSeconds: req.OperationsWindowSeconds,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, myerrors.InvalidLimitPolicy):
+			writeError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, myerrors.WalletNotFound):
+			http.Error(w, `{"error":"wallet not found"}`, http.StatusNotFound)
+		default:
+			log.Printf("DB error: %v", err)
+			http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		}
+		return
+	}
+	log.Printf("🚦 Политика лимитов %s обновлена", policy.ID)
+	writeJSON(w, policy)
+}
+
+// listLimitPoliciesHandler — GET /api/v1/admin/limits
+func (h *WalletHandler) ListLimitPolicies(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	policies, err := h.repo.ListLimitPolicies(r.Context())
+	if err != nil {
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"items": policies})
+}
+
+// deleteLimitPolicyHandler — DELETE /api/v1/admin/limits/:id
+func (h *WalletHandler) DeleteLimitPolicy(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := uuid.Parse(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid UUID"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repo.DeleteLimitPolicy(r.Context(), id); err != nil {
+		if errors.Is(err, myerrors.LimitPolicyNotFound) {
+			http.Error(w, `{"error":"limit policy not found"}`, http.StatusNotFound)
+			return
+		}
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
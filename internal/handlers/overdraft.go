@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	myerrors "github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// setOverdraftLimitHandler — POST /api/v1/admin/wallets/:uuid/overdraft
+// Тело: {"limit": 100000, "reason": "..."}. Лимит 0 отключает кредитную линию
+func (h *WalletHandler) SetOverdraftLimit(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	walletID, err := uuid.Parse(ps.ByName("uuid"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid UUID"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req model.OverdraftRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+
+	change, err := h.repo.SetOverdraftLimit(r.Context(), walletID, req.Limit, req.Reason)
+	if err != nil {
+		if writeWalletStatusError(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, myerrors.WalletNotFound):
+			http.Error(w, `{"error":"wallet not found"}`, http.StatusNotFound)
+		case errors.Is(err, myerrors.ReasonRequired):
+			http.Error(w, `{"error":"reason is required"}`, http.StatusBadRequest)
+		case errors.Is(err, myerrors.InvalidOverdraft):
+			http.Error(w, `{"error":"overdraft limit must not be negative"}`, http.StatusBadRequest)
+		case errors.Is(err, myerrors.OverdraftInUse):
+			writeError(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("DB error: %v", err)
+			http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	log.Printf("💳 Кошелёк %s: кредитный лимит %d → %d (%s)", walletID, change.OldLimit, change.NewLimit, change.Reason)
+	writeJSON(w, change)
+}
+
+// overdraftHistoryHandler — GET /api/v1/admin/wallets/:uuid/overdraft-history
+func (h *WalletHandler) GetOverdraftHistory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	walletID, err := uuid.Parse(ps.ByName("uuid"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid UUID"}`, http.StatusBadRequest)
+		return
+	}
+
+	history, err := h.repo.GetOverdraftHistory(r.Context(), walletID)
+	if err != nil {
+		if errors.Is(err, myerrors.WalletNotFound) {
+			http.Error(w, `{"error":"wallet not found"}`, http.StatusNotFound)
+			return
+		}
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"items": history})
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// writeJSON — ответ 200 с телом в JSON
+func writeJSON(w http.ResponseWriter, v any) {
+	writeJSONStatus(w, http.StatusOK, v)
+}
+
+// writeJSONStatus — ответ с произвольным кодом и телом в JSON
+func writeJSONStatus(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("write response: %v", err)
+	}
+}
+
+// writeError — ошибка вида {"error":"..."}; сообщение экранируется,
+// поэтому сюда можно передавать текст ошибок валидации
+func writeError(w http.ResponseWriter, msg string, code int) {
+	body, _ := json.Marshal(map[string]string{"error": msg})
+	http.Error(w, string(body), code)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	myerrors "github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// reverseTransactionHandler — POST /api/v1/transactions/:id/reverse
+// Тело {"amount": N, "reason": "..."} необязательно: без amount возвращается весь остаток
+func (h *WalletHandler) ReverseTransaction(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	transactionID, err := uuid.Parse(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid UUID"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req model.ReversalRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, fmt.Sprintf(`{"error":"invalid JSON: %v"}`, err), http.StatusBadRequest)
+		return
+	}
+	if req.Amount < 0 {
+		http.Error(w, `{"error":"amount must be positive integer"}`, http.StatusBadRequest)
+		return
+	}
+
+	reversal, err := h.repo.ReverseTransaction(r.Context(), transactionID, req.Amount, req.Reason)
+	if err != nil {
+		if writeWalletStatusError(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, myerrors.TransactionNotFound):
+			http.Error(w, `{"error":"transaction not found"}`, http.StatusNotFound)
+		case errors.Is(err, myerrors.NotReversible):
+			writeError(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, myerrors.AlreadyReversed):
+			http.Error(w, `{"error":"transaction already fully reversed"}`, http.StatusConflict)
+		case errors.Is(err, myerrors.InvalidAmount):
+			writeError(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, myerrors.InsufficientFunds):
+			http.Error(w, `{"error":"insufficient funds"}`, http.StatusUnprocessableEntity)
+		default:
+			log.Printf("DB error: %v", err)
+			http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	log.Printf("↩️ Возврат %d по операции %s (всего возвращено %d)", reversal.Amount, transactionID, reversal.ReversedAmount)
+	writeJSONStatus(w, http.StatusCreated, reversal)
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	myerrors "github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// statementCSVHeader — колонки CSV-выписки; суммы в минорных единицах
+var statementCSVHeader = []string{"type", "time", "transaction_id", "operation_type", "amount", "fee", "balance_delta", "balance", "currency", "external_ref", "description"}
+
+// statementHandler — GET /api/v1/wallets/:uuid/statement?from=&to=&format=csv|jsonl
+// Выписка за период [from, to) потоком: остаток на начало, операции с остатком после каждой, остаток на конец
+func (h *WalletHandler) Statement(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	walletID, err := uuid.Parse(ps.ByName("uuid"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid UUID"}`, http.StatusBadRequest)
+		return
+	}
+	from, to, format, err := parseStatementQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sw := &statementWriter{w: w, format: format, filename: fmt.Sprintf("statement-%s-%s-%s.%s",
+		walletID, from.UTC().Format("20060102T150405Z"), to.UTC().Format("20060102T150405Z"), format)}
+	err = h.repo.Statement(r.Context(), walletID, from, to, sw.Write)
+	if err == nil {
+		err = sw.Flush()
+	}
+	if err == nil {
+		return
+	}
+
+	if sw.started {
+		// Ответ уже идёт: код не поменять, выписка остаётся без строки CLOSING
+		log.Printf("⚠️ Выписка %s оборвана: %v", walletID, err)
+		return
+	}
+	if errors.Is(err, myerrors.WalletNotFound) {
+		http.Error(w, `{"error":"wallet not found"}`, http.StatusNotFound)
+		return
+	}
+	log.Printf("DB error: %v", err)
+	http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+}
+
+// parseStatementQuery — период [from, to) и формат выписки
+func parseStatementQuery(q url.Values) (time.Time, time.Time, model.StatementFormat, error) {
+	var from, to time.Time
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"from", &from},
+		{"to", &to},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			return from, to, "", fmt.Errorf("%s is required", p.name)
+		}
+		ts, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return from, to, "", fmt.Errorf("invalid %s: expected RFC 3339 timestamp", p.name)
+		}
+		*p.dst = ts
+	}
+	if !from.Before(to) {
+		return from, to, "", fmt.Errorf("from must be before to")
+	}
+	// Остаток на будущий момент ещё может измениться
+	if to.After(time.Now()) {
+		return from, to, "", fmt.Errorf("to must not be in the future")
+	}
+
+	format := model.StatementFormat(q.Get("format"))
+	switch format {
+	case "":
+		format = model.StatementCSV
+	case model.StatementCSV, model.StatementJSONL:
+	default:
+		return from, to, "", fmt.Errorf("format must be %s or %s", model.StatementCSV, model.StatementJSONL)
+	}
+	return from, to, format, nil
+}
+
+// statementWriter пишет строки выписки в ответ по мере поступления. Заголовки
+// ответа уходят с первой строкой: до неё ошибка ещё может стать кодом 404/500.
+type statementWriter struct {
+	w        http.ResponseWriter
+	format   model.StatementFormat
+	filename string
+	started  bool
+
+	buf *bufio.Writer
+	csv *csv.Writer
+	enc *json.Encoder
+}
+
+func (s *statementWriter) Write(line model.StatementLine) error {
+	if !s.started {
+		s.start()
+	}
+	if s.format == model.StatementJSONL {
+		return s.enc.Encode(line)
+	}
+	return s.csv.Write(statementCSVRecord(line))
+}
+
+func (s *statementWriter) start() {
+	contentType := "text/csv; charset=utf-8"
+	if s.format == model.StatementJSONL {
+		contentType = "application/x-ndjson"
+	}
+	s.w.Header().Set("Content-Type", contentType)
+	s.w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, s.filename))
+	s.w.WriteHeader(http.StatusOK)
+	s.started = true
+
+	s.buf = bufio.NewWriter(s.w)
+	if s.format == model.StatementJSONL {
+		s.enc = json.NewEncoder(s.buf)
+		return
+	}
+	s.csv = csv.NewWriter(s.buf)
+	// Ошибку записи заголовка вернёт следующий Write или Flush
+	_ = s.csv.Write(statementCSVHeader)
+}
+
+// Flush дописывает в ответ то, что осталось в буферах
+func (s *statementWriter) Flush() error {
+	if s.csv != nil {
+		s.csv.Flush()
+		if err := s.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if s.buf != nil {
+		return s.buf.Flush()
+	}
+	return nil
+}
+
+// statementCSVRecord — строка выписки в колонках statementCSVHeader
+func statementCSVRecord(line model.StatementLine) []string {
+	record := []string{string(line.Type), line.Time.UTC().Format(time.RFC3339Nano), "", "", "", "", "",
+		strconv.FormatInt(line.Balance, 10), string(line.Currency), "", ""}
+	if t := line.Transaction; t != nil {
+		record[2] = t.ID.String()
+		record[3] = string(t.OperationType)
+		record[4] = strconv.FormatInt(t.Amount, 10)
+		record[5] = strconv.FormatInt(t.Fee, 10)
+		record[6] = strconv.FormatInt(t.BalanceDelta(), 10)
+		record[9] = csvText(t.ExternalRef)
+		record[10] = csvText(t.Description)
+	}
+	return record
+}
+
+// csvText — текст клиента для ячейки CSV. Excel и другие табличные редакторы
+// считают ячейку, начинающуюся с =, +, -, @, табуляции или возврата каретки,
+// формулой (CSV injection); апостроф в начале заставляет показать её как текст
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	myerrors "github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/julienschmidt/httprouter"
+)
+
+// transfersHandler — POST /api/v1/transfers
+func (h *WalletHandler) Transfer(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req model.TransferRequest
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf(`{"error":"invalid JSON: %v"}`, err), http.StatusBadRequest)
+		return
+	}
+
+	if req.Amount <= 0 {
+		http.Error(w, `{"error":"amount must be positive integer"}`, http.StatusBadRequest)
+		return
+	}
+	if req.FromWalletID == req.ToWalletID {
+		http.Error(w, `{"error":"source and destination wallets must differ"}`, http.StatusBadRequest)
+		return
+	}
+
+	transfer, err := h.repo.Transfer(r.Context(), req.FromWalletID, req.ToWalletID, req.Amount)
+	if err != nil {
+		if errors.Is(err, myerrors.WalletNotFound) {
+			http.Error(w, `{"error":"wallet not found"}`, http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, myerrors.InsufficientFunds) {
+			http.Error(w, `{"error":"insufficient funds"}`, http.StatusUnprocessableEntity)
+			return
+		}
+		if writeLimitError(w, err) {
+			return
+		}
+		if errors.Is(err, myerrors.SameWallet) {
+			http.Error(w, `{"error":"source and destination wallets must differ"}`, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, myerrors.CurrencyMismatch) {
+			writeError(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if writeWalletStatusError(w, err) {
+			return
+		}
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, transfer)
+}
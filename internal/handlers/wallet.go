@@ -4,36 +4,73 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/fangimal/ITK/internal/config"
 	myerrors "github.com/fangimal/ITK/internal/errors"
 	"github.com/fangimal/ITK/internal/model"
 	"github.com/fangimal/ITK/internal/repository"
+	"github.com/fangimal/ITK/internal/webhook"
 	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
 )
 
 type WalletHandler struct {
-	repo repository.WalletRepository
+	repo           repository.WalletRepository
+	webhookTargets *webhook.TargetPolicy // допустимые адреса подписчиков вебхуков
 }
 
-func NewWalletHandler(repo repository.WalletRepository) *WalletHandler {
+func NewWalletHandler(repo repository.WalletRepository, cfg *config.Config) *WalletHandler {
 
-	return &WalletHandler{repo: repo}
+	return &WalletHandler{repo: repo, webhookTargets: webhook.NewTargetPolicy(cfg.WebhookAllowedTargets)}
 }
 
 // === Обработчики ===
 
+// createWalletHandler — POST /api/v1/wallets
+// Тело {"currency": "KZT", "walletType": "BUSINESS"} необязательно: без него кошелёк рублёвый, PERSONAL.
+// С ownerId/externalId повторный запрос возвращает уже созданный кошелёк (Idempotent-Replayed: true)
 func (h *WalletHandler) CreateWallet(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	id, err := h.repo.CreateWallet(r.Context())
+	var req model.CreateWalletRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, fmt.Sprintf(`{"error":"invalid JSON: %v"}`, err), http.StatusBadRequest)
+		return
+	}
+	req = req.WithDefaults()
+
+	wallet, err := h.repo.CreateWallet(r.Context(), req)
 	if err != nil {
+		if errors.Is(err, myerrors.UnsupportedCurrency) {
+			writeError(w, fmt.Sprintf("unsupported currency %q", req.Currency), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, myerrors.InvalidWalletType) {
+			writeError(w, fmt.Sprintf("invalid walletType %q, expected PERSONAL or BUSINESS", req.WalletType), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, myerrors.InvalidWalletOwner) {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, myerrors.ExternalIDConflict) {
+			writeError(w, err.Error(), http.StatusConflict)
+			return
+		}
 		http.Error(w, `{"error":"failed to create wallet"}`, http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"walletId":"%s"}`, id)
+	if wallet.Replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	writeJSON(w, wallet)
 }
 
 // walletHandler — POST /api/v1/wallet
@@ -49,37 +86,88 @@ func (h *WalletHandler) Operation(w http.ResponseWriter, r *http.Request, _ http
 		return
 	}
 
-	// Валидация amount > 0
-	if op.Amount <= 0 {
-		http.Error(w, `{"error":"amount must be positive integer"}`, http.StatusBadRequest)
+	if err := normalizeOperation(&op); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	isDeposit := op.OperationType == model.OperationDeposit
+	// Повтор запроса с тем же Idempotency-Key не проводит операцию второй раз;
+	// с If-Match операция проводится, только если кошелёк не менялся с чтения баланса
+	opts := model.OperationOptions{IdempotencyKey: r.Header.Get("Idempotency-Key"), IfMatch: r.Header.Get("If-Match")}
+	if len(opts.IdempotencyKey) > model.MaxIdempotencyKeyLength {
+		http.Error(w, `{"error":"Idempotency-Key is too long"}`, http.StatusBadRequest)
+		return
+	}
 
-	err := h.repo.UpdateBalance(r.Context(), op.WalletID, op.Amount, isDeposit)
+	result, err := h.repo.ApplyOperation(r.Context(), op, opts)
 	if err != nil {
-		if errors.Is(err, myerrors.WalletNotFound) {
-			http.Error(w, `{"error":"wallet not found"}`, http.StatusNotFound)
-			return
+		status, body := operationFailure(err)
+		writeJSONStatus(w, status, body)
+		return
+	}
+
+	if result.Replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	writeJSON(w, result)
+}
+
+// normalizeOperation проверяет тело операции и переводит сумму
+// в основных единицах ("10.50") в минорные по ISO 4217
+func normalizeOperation(op *model.WalletOperation) error {
+	if op.Currency != "" && !op.Currency.IsSupported() {
+		return fmt.Errorf("unsupported currency %q", op.Currency)
+	}
+	if op.Value != "" {
+		if op.Amount != 0 || op.Currency == "" {
+			return fmt.Errorf("value requires currency and excludes amount")
 		}
-		if errors.Is(err, myerrors.InsufficientFunds) {
-			http.Error(w, `{"error":"insufficient funds"}`, http.StatusUnprocessableEntity) // 422
-			return
+		amount, err := op.Currency.ParseMinorUnits(op.Value)
+		if err != nil {
+			return err
 		}
-		log.Printf("DB error: %v", err)
-		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
-		return
+		// Тот же запрос в минорных единицах даёт тот же отпечаток Idempotency-Key
+		op.Amount, op.Value = amount, ""
 	}
 
-	// Готово — логика будет тут позже
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{
-		"walletId": "%s",
-		"operationType": "%s",
-		"amount": %d,
-		"status": "accepted"
-	}`, op.WalletID, op.OperationType, op.Amount)
+	// Валидация amount > 0
+	if op.Amount <= 0 {
+		return fmt.Errorf("amount must be positive integer")
+	}
+	return nil
+}
+
+// operationFailure — код и тело ответа на ошибку операции; общие для
+// POST /api/v1/wallet и элементов пакета POST /api/v1/operations:batch
+func operationFailure(err error) (int, any) {
+	if body, ok := limitExceeded(err); ok {
+		return http.StatusUnprocessableEntity, body
+	}
+	if status, msg, ok := walletStatusFailure(err); ok {
+		return status, map[string]string{"error": msg}
+	}
+	status, msg := http.StatusInternalServerError, "internal server error"
+	switch {
+	case errors.Is(err, myerrors.WalletNotFound):
+		status, msg = http.StatusNotFound, "wallet not found"
+	case errors.Is(err, myerrors.InsufficientFunds):
+		status, msg = http.StatusUnprocessableEntity, "insufficient funds"
+	case errors.Is(err, myerrors.IdempotencyKeyReused):
+		status, msg = http.StatusUnprocessableEntity, "idempotency key reused with different payload"
+	case errors.Is(err, myerrors.CurrencyMismatch):
+		status, msg = http.StatusUnprocessableEntity, err.Error()
+	case errors.Is(err, myerrors.InvalidMetadata):
+		status, msg = http.StatusBadRequest, err.Error()
+	case errors.Is(err, myerrors.DuplicateExternalRef):
+		status, msg = http.StatusConflict, err.Error()
+	case errors.Is(err, myerrors.BatchAborted):
+		status, msg = http.StatusFailedDependency, err.Error()
+	case errors.Is(err, myerrors.PreconditionFailed):
+		status, msg = http.StatusPreconditionFailed, err.Error()
+	default:
+		log.Printf("DB error: %v", err)
+	}
+	return status, map[string]string{"error": msg}
 }
 
 // walletsHandler — GET /api/v1/wallets/:uuid
@@ -91,6 +179,12 @@ func (h *WalletHandler) GetBalance(w http.ResponseWriter, r *http.Request, ps ht
 		return
 	}
 
+	// ?asOf=... — баланс по журналу на момент времени, без холдов и ETag
+	if v := r.URL.Query().Get("asOf"); v != "" {
+		h.getBalanceAsOf(w, r, walletID, v)
+		return
+	}
+
 	balance, err := h.repo.GetBalance(r.Context(), walletID)
 	if err != nil {
 		if err.Error() == fmt.Sprintf("wallet not found: %s", walletID) {
@@ -101,14 +195,136 @@ func (h *WalletHandler) GetBalance(w http.ResponseWriter, r *http.Request, ps ht
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{
-		"walletId": "%s",
-		"balance": %d
-	}`, walletID, balance)
+	// Поллеры с If-None-Match получают 304 без тела, пока кошелёк не изменился
+	etag := balance.ETag()
+	w.Header().Set("ETag", etag)
+	if model.ETagMatches(r.Header.Get("If-None-Match"), etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, balance)
 }
 
+// getBalanceAsOf — GET /api/v1/wallets/:uuid?asOf=<RFC 3339>
+func (h *WalletHandler) getBalanceAsOf(w http.ResponseWriter, r *http.Request, walletID uuid.UUID, v string) {
+	asOf, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		writeError(w, "invalid asOf: expected RFC 3339 timestamp", http.StatusBadRequest)
+		return
+	}
+	// Будущий баланс ещё может измениться — отвечать на него нечем
+	if asOf.After(time.Now()) {
+		writeError(w, "asOf must not be in the future", http.StatusBadRequest)
+		return
+	}
+
+	balance, err := h.repo.GetBalanceAsOf(r.Context(), walletID, asOf)
+	if err != nil {
+		if errors.Is(err, myerrors.WalletNotFound) {
+			writeError(w, "wallet not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("DB error: %v", err)
+		writeError(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, balance)
+}
+
+// transactionsHandler — GET /api/v1/wallets/:uuid/transactions
 func (h *WalletHandler) GetTransactions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprint(w, `[]`)
+	walletID, err := uuid.Parse(ps.ByName("uuid"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid UUID"}`, http.StatusBadRequest)
+		return
+	}
+
+	filter, err := parseTransactionFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.repo.GetTransactions(r.Context(), walletID, filter)
+	if err != nil {
+		if errors.Is(err, myerrors.WalletNotFound) {
+			http.Error(w, `{"error":"wallet not found"}`, http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, myerrors.InvalidCursor) {
+			http.Error(w, `{"error":"invalid cursor"}`, http.StatusBadRequest)
+			return
+		}
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, page)
+}
+
+// parseTransactionFilter разбирает query-параметры истории:
+// operationType, externalRef, minAmount, maxAmount, from, to (RFC 3339), cursor, limit
+func parseTransactionFilter(q url.Values) (model.TransactionFilter, error) {
+	filter := model.TransactionFilter{Cursor: q.Get("cursor"), ExternalRef: q.Get("externalRef")}
+
+	if v := q.Get("operationType"); v != "" {
+		opType := model.OperationType(v)
+		if !opType.IsKnown() {
+			return filter, fmt.Errorf("invalid operationType: %q", v)
+		}
+		filter.OperationType = opType
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **int64
+	}{
+		{"minAmount", &filter.MinAmount},
+		{"maxAmount", &filter.MaxAmount},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s: %q", p.name, v)
+		}
+		*p.dst = &n
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		return filter, fmt.Errorf("minAmount must not exceed maxAmount")
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{
+		{"from", &filter.From},
+		{"to", &filter.To},
+	} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		ts, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s: expected RFC 3339 timestamp", p.name)
+		}
+		*p.dst = &ts
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return filter, fmt.Errorf("from must be before to")
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > model.MaxTransactionsLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", model.MaxTransactionsLimit)
+		}
+		filter.Limit = limit
+	}
+
+	return filter, nil
 }
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	myerrors "github.com/fangimal/ITK/internal/errors"
+	"github.com/julienschmidt/httprouter"
+)
+
+// listWalletsHandler — GET /api/v1/wallets?ownerId=...
+func (h *WalletHandler) ListWallets(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ownerID := r.URL.Query().Get("ownerId")
+	if ownerID == "" {
+		http.Error(w, `{"error":"ownerId is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	wallets, err := h.repo.ListWallets(r.Context(), ownerID)
+	if err != nil {
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"items": wallets})
+}
+
+// walletByExternalIDHandler — GET /api/v1/wallets/by-external/:id?ownerId=...
+// Без ownerId ищет среди кошельков без владельца
+func (h *WalletHandler) GetWalletByExternalID(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	wallet, err := h.repo.GetWalletByExternalID(r.Context(), r.URL.Query().Get("ownerId"), ps.ByName("id"))
+	if err != nil {
+		if errors.Is(err, myerrors.WalletNotFound) {
+			http.Error(w, `{"error":"wallet not found"}`, http.StatusNotFound)
+			return
+		}
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, wallet)
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	myerrors "github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// freezeWalletHandler — POST /api/v1/admin/wallets/:uuid/freeze
+// Тело: {"reason": "..."}. Замороженный кошелёк не даёт списывать средства
+func (h *WalletHandler) FreezeWallet(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	h.changeWalletStatus(w, r, ps, model.WalletFrozen)
+}
+
+// unfreezeWalletHandler — POST /api/v1/admin/wallets/:uuid/unfreeze
+func (h *WalletHandler) UnfreezeWallet(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	h.changeWalletStatus(w, r, ps, model.WalletActive)
+}
+
+// closeWalletHandler — POST /api/v1/admin/wallets/:uuid/close
+// Закрыть можно только кошелёк с нулевым балансом и без действующих холдов
+func (h *WalletHandler) CloseWallet(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	h.changeWalletStatus(w, r, ps, model.WalletClosed)
+}
+
+func (h *WalletHandler) changeWalletStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params, to model.WalletStatus) {
+	walletID, err := uuid.Parse(ps.ByName("uuid"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid UUID"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req model.StatusChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid JSON"}`, http.StatusBadRequest)
+		return
+	}
+
+	change, err := h.repo.ChangeWalletStatus(r.Context(), walletID, to, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, myerrors.WalletNotFound):
+			http.Error(w, `{"error":"wallet not found"}`, http.StatusNotFound)
+		case errors.Is(err, myerrors.ReasonRequired):
+			http.Error(w, `{"error":"reason is required"}`, http.StatusBadRequest)
+		case errors.Is(err, myerrors.InvalidTransition), errors.Is(err, myerrors.WalletNotEmpty):
+			writeError(w, err.Error(), http.StatusConflict)
+		default:
+			log.Printf("DB error: %v", err)
+			http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	log.Printf("🧊 Кошелёк %s: %s → %s (%s)", walletID, change.FromStatus, change.ToStatus, change.Reason)
+	writeJSON(w, change)
+}
+
+// walletStatusHistoryHandler — GET /api/v1/admin/wallets/:uuid/status-history
+func (h *WalletHandler) GetWalletStatusHistory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	walletID, err := uuid.Parse(ps.ByName("uuid"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid UUID"}`, http.StatusBadRequest)
+		return
+	}
+
+	history, err := h.repo.GetWalletStatusHistory(r.Context(), walletID)
+	if err != nil {
+		if errors.Is(err, myerrors.WalletNotFound) {
+			http.Error(w, `{"error":"wallet not found"}`, http.StatusNotFound)
+			return
+		}
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"items": history})
+}
+
+// writeWalletStatusError — ответ на операцию с замороженным (423) или
+// закрытым (410) кошельком; false — ошибка не про статус кошелька
+func writeWalletStatusError(w http.ResponseWriter, err error) bool {
+	status, msg, ok := walletStatusFailure(err)
+	if ok {
+		writeError(w, msg, status)
+	}
+	return ok
+}
+
+// walletStatusFailure — код и текст ошибки для замороженного или закрытого кошелька
+func walletStatusFailure(err error) (int, string, bool) {
+	switch {
+	case errors.Is(err, myerrors.WalletFrozen):
+		return http.StatusLocked, "wallet is frozen", true
+	case errors.Is(err, myerrors.WalletClosed):
+		return http.StatusGone, "wallet is closed", true
+	}
+	return 0, "", false
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	myerrors "github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/fangimal/ITK/internal/webhook"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+)
+
+// createSubscriptionRequest — тело POST /api/v1/webhooks/subscriptions
+type createSubscriptionRequest struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"` // пусто — сгенерировать
+}
+
+// createSubscriptionHandler — POST /api/v1/webhooks/subscriptions
+// Секрет подписи возвращается только в этом ответе
+func (h *WalletHandler) CreateSubscription(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var req createSubscriptionRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Адрес во внутренней сети (localhost, 169.254.169.254, 10.0.0.0/8...)
+	// разрешён, только если он есть в WEBHOOK_ALLOWED_TARGETS
+	if err := h.webhookTargets.CheckURL(r.Context(), req.URL); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Secret == "" {
+		req.Secret = webhook.NewSecret()
+	}
+
+	sub, err := h.repo.CreateSubscription(r.Context(), model.WebhookSubscription{URL: req.URL, Secret: req.Secret})
+	if err != nil {
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	writeJSONStatus(w, http.StatusCreated, sub)
+}
+
+// listSubscriptionsHandler — GET /api/v1/webhooks/subscriptions
+func (h *WalletHandler) ListSubscriptions(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	subs, err := h.repo.ListSubscriptions(r.Context())
+	if err != nil {
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"items": subs})
+}
+
+// deleteSubscriptionHandler — DELETE /api/v1/webhooks/subscriptions/:id
+func (h *WalletHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := uuid.Parse(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid UUID"}`, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repo.DeleteSubscription(r.Context(), id); err != nil {
+		if errors.Is(err, myerrors.SubscriptionNotFound) {
+			http.Error(w, `{"error":"subscription not found"}`, http.StatusNotFound)
+			return
+		}
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listDeliveriesHandler — GET /api/v1/webhooks/deliveries?status=DEAD&subscriptionId=...&limit=N
+func (h *WalletHandler) ListDeliveries(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var filter model.DeliveryFilter
+	q := r.URL.Query()
+
+	if raw := q.Get("status"); raw != "" {
+		status, ok := model.ParseDeliveryStatus(raw)
+		if !ok {
+			http.Error(w, `{"error":"status must be PENDING, DELIVERED or DEAD"}`, http.StatusBadRequest)
+			return
+		}
+		filter.Status = status
+	}
+	if raw := q.Get("subscriptionId"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			http.Error(w, `{"error":"invalid subscriptionId"}`, http.StatusBadRequest)
+			return
+		}
+		filter.SubscriptionID = &id
+	}
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			http.Error(w, `{"error":"limit must be a positive integer"}`, http.StatusBadRequest)
+			return
+		}
+		filter.Limit = n
+	}
+
+	deliveries, err := h.repo.ListDeliveries(r.Context(), filter)
+	if err != nil {
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]any{"items": deliveries})
+}
+
+// redeliverHandler — POST /api/v1/webhooks/deliveries/:id/redeliver
+// Возвращает доставку (обычно DEAD) в очередь с полным запасом попыток
+func (h *WalletHandler) Redeliver(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id, err := uuid.Parse(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, `{"error":"invalid UUID"}`, http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := h.repo.Redeliver(r.Context(), id, time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, myerrors.DeliveryNotFound) {
+			http.Error(w, `{"error":"delivery not found"}`, http.StatusNotFound)
+			return
+		}
+		log.Printf("DB error: %v", err)
+		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	writeJSONStatus(w, http.StatusAccepted, delivery)
+}
@@ -0,0 +1,245 @@
+// Package migrations — версионированные миграции схемы PostgreSQL.
+//
+// Миграции — файлы sql/NNNN_name.sql, встроенные в бинарник. Up применяет
+// ещё не применённые по возрастанию версии, каждую в своей транзакции, и
+// записывает их в schema_migrations с контрольной суммой. Параллельные Up
+// (несколько реплик при старте) выстраиваются на advisory lock. Применённую
+// миграцию менять нельзя: расхождение контрольной суммы — ошибка, изменения
+// схемы оформляются новой миграцией.
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fangimal/ITK/internal/errors"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// advisoryLockKey — ключ pg_advisory_lock, под которым идёт Up («ITK» в ASCII).
+// Один на все версии сервиса: иначе старая и новая реплика не увидят друг друга.
+const advisoryLockKey int64 = 0x49544B
+
+// fileName — NNNN_name.sql: версия и имя миграции
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.sql$`)
+
+// Migration — одна миграция схемы
+type Migration struct {
+	Version  int
+	Name     string
+	SQL      string
+	Checksum string // sha256 текста SQL, hex
+}
+
+// String — имя файла без расширения, например 0001_init
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Status — состояние миграции в базе
+type Status struct {
+	Migration
+
+	AppliedAt *time.Time // nil — ещё не применена
+	Modified  bool       // файл изменён после применения
+	Unknown   bool       // применена, но такого файла нет — база новее бинарника
+}
+
+// All — встроенные миграции по возрастанию версии
+func All() ([]Migration, error) {
+	return load(files, "sql")
+}
+
+// load читает миграции из каталога dir
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	var migrations []Migration
+	seen := make(map[int]string)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		m := fileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migration file %q: expected NNNN_name.sql", e.Name())
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration file %q: invalid version", e.Name())
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migration files %q and %q have the same version", other, e.Name())
+		}
+		seen[version] = e.Name()
+
+		sql, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %q: %w", e.Name(), err)
+		}
+		sum := sha256.Sum256(sql)
+		migrations = append(migrations, Migration{
+			Version:  version,
+			Name:     m[2],
+			SQL:      string(sql),
+			Checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// appliedMigration — строка schema_migrations
+type appliedMigration struct {
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+const createHistorySQL = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		checksum   TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`
+
+// Up применяет ещё не применённые миграции и возвращает их. Соединение
+// нужно отдельное, не из пула: advisory lock держится на уровне сессии.
+func Up(ctx context.Context, conn *pgx.Conn) ([]Migration, error) {
+	migrations, err := All()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, advisoryLockKey); err != nil {
+		return nil, fmt.Errorf("advisory lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, advisoryLockKey)
+
+	if _, err := conn.Exec(ctx, createHistorySQL); err != nil {
+		return nil, fmt.Errorf("create schema_migrations: %w", err)
+	}
+	// История читается под блокировкой: другая реплика могла успеть всё применить
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range migrations {
+		a, ok := applied[m.Version]
+		if ok {
+			if a.checksum != m.Checksum {
+				return done, fmt.Errorf("%w: %s", errors.MigrationModified, m)
+			}
+			continue
+		}
+		if err := apply(ctx, conn, m); err != nil {
+			return done, err
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// apply выполняет миграцию и запись о ней в одной транзакции
+func apply(ctx context.Context, conn *pgx.Conn, m Migration) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, m.SQL); err != nil {
+		return fmt.Errorf("migration %s: %w", m, err)
+	}
+	sqlQuery := `INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, sqlQuery, m.Version, m.Name, m.Checksum); err != nil {
+		return fmt.Errorf("record migration %s: %w", m, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit migration %s: %w", m, err)
+	}
+	return nil
+}
+
+// GetStatus — все миграции, известные бинарнику или базе, по возрастанию версии
+func GetStatus(ctx context.Context, conn *pgx.Conn) ([]Status, error) {
+	migrations, err := All()
+	if err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	if err := conn.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("check schema_migrations: %w", err)
+	}
+	applied := make(map[int]appliedMigration)
+	if exists {
+		if applied, err = appliedMigrations(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]Status, 0, len(migrations))
+	for _, m := range migrations {
+		s := Status{Migration: m}
+		if a, ok := applied[m.Version]; ok {
+			s.AppliedAt = &a.appliedAt
+			s.Modified = a.checksum != m.Checksum
+			delete(applied, m.Version)
+		}
+		statuses = append(statuses, s)
+	}
+	for version, a := range applied {
+		statuses = append(statuses, Status{
+			Migration: Migration{Version: version, Name: a.name, Checksum: a.checksum},
+			AppliedAt: &a.appliedAt,
+			Unknown:   true,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+func appliedMigrations(ctx context.Context, conn *pgx.Conn) (map[int]appliedMigration, error) {
+	rows, err := conn.Query(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("select schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, fmt.Errorf("scan schema_migrations: %w", err)
+		}
+		applied[version] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("select schema_migrations: %w", err)
+	}
+	return applied, nil
+}
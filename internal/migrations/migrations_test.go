@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("Sorted by version", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"sql/0010_tenth.sql":  {Data: []byte("SELECT 10;")},
+			"sql/0002_second.sql": {Data: []byte("SELECT 2;")},
+			"sql/0001_init.sql":   {Data: []byte("SELECT 1;")},
+		}
+		migrations, err := load(fsys, "sql")
+		require.NoError(t, err)
+		require.Len(t, migrations, 3)
+		assert.Equal(t, []string{"0001_init", "0002_second", "0010_tenth"},
+			[]string{migrations[0].String(), migrations[1].String(), migrations[2].String()})
+		assert.Equal(t, "SELECT 2;", migrations[1].SQL)
+	})
+
+	t.Run("Checksum follows content", func(t *testing.T) {
+		a, err := load(fstest.MapFS{"sql/0001_init.sql": {Data: []byte("SELECT 1;")}}, "sql")
+		require.NoError(t, err)
+		b, err := load(fstest.MapFS{"sql/0001_init.sql": {Data: []byte("SELECT 1;")}}, "sql")
+		require.NoError(t, err)
+		c, err := load(fstest.MapFS{"sql/0001_init.sql": {Data: []byte("SELECT 1; ")}}, "sql")
+		require.NoError(t, err)
+
+		assert.Len(t, a[0].Checksum, 64)
+		assert.Equal(t, a[0].Checksum, b[0].Checksum)
+		assert.NotEqual(t, a[0].Checksum, c[0].Checksum)
+	})
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"Bad file name": {"sql/init.sql": {Data: []byte("SELECT 1;")}},
+		"Zero version":  {"sql/0000_init.sql": {Data: []byte("SELECT 1;")}},
+		"Same version": {
+			"sql/0001_init.sql":  {Data: []byte("SELECT 1;")},
+			"sql/001_other.sql":  {Data: []byte("SELECT 1;")},
+			"sql/0002_later.sql": {Data: []byte("SELECT 2;")},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := load(fsys, "sql")
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("Embedded migrations", func(t *testing.T) {
+		migrations, err := All()
+		require.NoError(t, err)
+		require.NotEmpty(t, migrations)
+		for i, m := range migrations {
+			assert.Equal(t, i+1, m.Version, "migration versions go without gaps: %s", m)
+		}
+	})
+}
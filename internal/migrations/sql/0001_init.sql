@@ -1,3 +1,8 @@
+-- Исходная схема — бывший docker/db-init/01-init.sql без изменений. Объекты
+-- создаются с IF NOT EXISTS: на базе, поднятой этим init-скриптом, миграция
+-- ничего не меняет и только записывается в schema_migrations. Всё, что
+-- появилось в схеме позже, — в следующих миграциях.
+
 -- Создаём расширение для UUID (требуется явно)
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 
@@ -0,0 +1,2 @@
+-- История кошелька: WHERE wallet_id = ? ORDER BY created_at DESC, id DESC (курсорная пагинация)
+CREATE INDEX IF NOT EXISTS idx_transactions_wallet_created ON transactions(wallet_id, created_at DESC, id DESC);
@@ -0,0 +1,8 @@
+-- Переводы между кошельками: пара TRANSFER_OUT/TRANSFER_IN с общим transfer_id
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_operation_type_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_operation_type_check
+    CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW', 'TRANSFER_OUT', 'TRANSFER_IN'));
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS transfer_id UUID;  -- общий для TRANSFER_OUT/TRANSFER_IN одного перевода
+
+CREATE INDEX IF NOT EXISTS idx_transactions_transfer_id ON transactions(transfer_id) WHERE transfer_id IS NOT NULL;
@@ -0,0 +1,10 @@
+-- Ключи идемпотентности POST /api/v1/wallet (заголовок Idempotency-Key)
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key         TEXT PRIMARY KEY,
+    fingerprint TEXT NOT NULL,   -- sha256 тела запроса
+    response    JSONB,           -- сохранённый ответ, пишется в одной транзакции с операцией
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at  TIMESTAMPTZ NOT NULL
+    );
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
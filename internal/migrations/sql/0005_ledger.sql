@@ -0,0 +1,81 @@
+-- Главная книга (double-entry): каждая операция — запись журнала с проводками,
+-- сумма которых равна нулю. Баланс кошелька (wallets.balance) меняется только
+-- проводками; балансы системных счетов считаются по postings.
+CREATE TABLE IF NOT EXISTS ledger_system_accounts (
+    code        TEXT PRIMARY KEY,
+    description TEXT NOT NULL
+    );
+
+INSERT INTO ledger_system_accounts (code, description) VALUES
+    ('EXTERNAL_CASH_IN',  'Внешний источник пополнений'),
+    ('EXTERNAL_CASH_OUT', 'Внешний получатель выводов'),
+    ('FEES',              'Удержанные комиссии')
+ON CONFLICT (code) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id         UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    entry_type TEXT NOT NULL,  -- DEPOSIT / WITHDRAW / TRANSFER
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+
+CREATE TABLE IF NOT EXISTS postings (
+    id             BIGSERIAL PRIMARY KEY,
+    entry_id       UUID NOT NULL REFERENCES journal_entries(id) ON DELETE CASCADE,
+    wallet_id      UUID REFERENCES wallets(id) ON DELETE CASCADE,
+    system_account TEXT REFERENCES ledger_system_accounts(code),
+    amount         BIGINT NOT NULL CHECK (amount <> 0),  -- > 0 увеличивает баланс счёта
+    CHECK ((wallet_id IS NULL) <> (system_account IS NULL))  -- ровно один счёт
+    );
+
+CREATE INDEX IF NOT EXISTS idx_postings_entry_id ON postings(entry_id);
+CREATE INDEX IF NOT EXISTS idx_postings_wallet_id ON postings(wallet_id) WHERE wallet_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_postings_system_account ON postings(system_account) WHERE system_account IS NOT NULL;
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS entry_id UUID;  -- запись главной книги (journal_entries)
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_entry_id_fkey;
+ALTER TABLE transactions ADD CONSTRAINT transactions_entry_id_fkey
+    FOREIGN KEY (entry_id) REFERENCES journal_entries(id);
+
+-- Сбалансированность записи проверяется при коммите: к этому моменту
+-- все проводки записи уже вставлены
+CREATE OR REPLACE FUNCTION check_journal_entry_balanced() RETURNS trigger AS $$
+BEGIN
+    IF (SELECT COALESCE(SUM(amount), 0) FROM postings WHERE entry_id = NEW.entry_id) <> 0 THEN
+        RAISE EXCEPTION 'journal entry % does not balance', NEW.entry_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_postings_balanced ON postings;
+CREATE CONSTRAINT TRIGGER trg_postings_balanced
+    AFTER INSERT ON postings
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION check_journal_entry_balanced();
+
+-- Операции, проведённые до появления главной книги (в исходной схеме — только
+-- DEPOSIT и WITHDRAW), получают записи задним числом с теми же проводками, что
+-- и новые: иначе проводки кошелька не сойдутся с его балансом
+CREATE TEMPORARY TABLE legacy_entries ON COMMIT DROP AS
+    SELECT id AS transaction_id, wallet_id, operation_type, amount, created_at,
+           uuid_generate_v4() AS entry_id
+    FROM transactions
+    WHERE entry_id IS NULL AND operation_type IN ('DEPOSIT', 'WITHDRAW');
+
+INSERT INTO journal_entries (id, entry_type, created_at)
+SELECT entry_id, operation_type, created_at FROM legacy_entries;
+
+INSERT INTO postings (entry_id, wallet_id, amount)
+SELECT entry_id, wallet_id, CASE WHEN operation_type = 'DEPOSIT' THEN amount ELSE -amount END
+FROM legacy_entries;
+
+INSERT INTO postings (entry_id, system_account, amount)
+SELECT entry_id,
+       CASE WHEN operation_type = 'DEPOSIT' THEN 'EXTERNAL_CASH_IN' ELSE 'EXTERNAL_CASH_OUT' END,
+       CASE WHEN operation_type = 'DEPOSIT' THEN -amount ELSE amount END
+FROM legacy_entries;
+
+UPDATE transactions t
+SET entry_id = l.entry_id
+FROM legacy_entries l
+WHERE t.id = l.transaction_id;
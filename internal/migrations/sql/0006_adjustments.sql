@@ -0,0 +1,10 @@
+-- Корректировки сверки балансов (ADJUSTMENT_IN/ADJUSTMENT_OUT) против счёта ADJUSTMENTS
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_operation_type_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_operation_type_check
+    CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW', 'TRANSFER_OUT', 'TRANSFER_IN', 'ADJUSTMENT_IN', 'ADJUSTMENT_OUT'));
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reason TEXT;  -- причина корректировки (ADJUSTMENT_IN/ADJUSTMENT_OUT)
+
+INSERT INTO ledger_system_accounts (code, description) VALUES
+    ('ADJUSTMENTS', 'Корректировки сверки балансов')
+ON CONFLICT (code) DO NOTHING;
@@ -0,0 +1,36 @@
+-- Transactional outbox: события пишутся в транзакции операции,
+-- диспетчер раскладывает их по подпискам и доставляет webhook'ами
+CREATE TABLE IF NOT EXISTS outbox_events (
+    id            UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    event_type    TEXT NOT NULL,  -- wallet.balance_changed
+    wallet_id     UUID NOT NULL REFERENCES wallets(id) ON DELETE CASCADE,
+    payload       JSONB NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    dispatched_at TIMESTAMPTZ     -- когда созданы доставки подписчикам
+    );
+
+CREATE INDEX IF NOT EXISTS idx_outbox_events_pending ON outbox_events(created_at, id) WHERE dispatched_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id         UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    url        TEXT NOT NULL,
+    secret     TEXT NOT NULL,  -- ключ HMAC-SHA256 подписи
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id               UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    event_id         UUID NOT NULL REFERENCES outbox_events(id) ON DELETE CASCADE,
+    subscription_id  UUID NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    status           TEXT NOT NULL CHECK (status IN ('PENDING', 'DELIVERED', 'DEAD')),
+    attempts         INT NOT NULL DEFAULT 0,
+    next_attempt_at  TIMESTAMPTZ NOT NULL,
+    last_status_code INT,
+    last_error       TEXT,
+    delivered_at     TIMESTAMPTZ,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (event_id, subscription_id)
+    );
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'PENDING';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_status ON webhook_deliveries(status, created_at DESC);
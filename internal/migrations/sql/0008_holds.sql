@@ -0,0 +1,24 @@
+-- Холды: блокировка части баланса до списания (capture) или отмены (void).
+-- Доступный баланс = wallets.balance − SUM(amount) действующих холдов
+CREATE TABLE IF NOT EXISTS holds (
+    id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    wallet_id       UUID NOT NULL REFERENCES wallets(id) ON DELETE CASCADE,
+    amount          BIGINT NOT NULL CHECK (amount > 0),
+    captured_amount BIGINT NOT NULL DEFAULT 0 CHECK (captured_amount >= 0 AND captured_amount <= amount),
+    status          TEXT NOT NULL CHECK (status IN ('ACTIVE', 'CAPTURED', 'VOIDED', 'EXPIRED')),
+    expires_at      TIMESTAMPTZ NOT NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+
+CREATE INDEX IF NOT EXISTS idx_holds_wallet_active ON holds(wallet_id) WHERE status = 'ACTIVE';
+CREATE INDEX IF NOT EXISTS idx_holds_expires_active ON holds(expires_at) WHERE status = 'ACTIVE';
+
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_operation_type_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_operation_type_check
+    CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW', 'TRANSFER_OUT', 'TRANSFER_IN', 'ADJUSTMENT_IN', 'ADJUSTMENT_OUT', 'CAPTURE'));
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS hold_id UUID;  -- списанный холд (CAPTURE)
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_hold_id_fkey;
+ALTER TABLE transactions ADD CONSTRAINT transactions_hold_id_fkey
+    FOREIGN KEY (hold_id) REFERENCES holds(id);
@@ -0,0 +1,14 @@
+-- Статусы кошельков: заморозка, разморозка, закрытие
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'ACTIVE' CHECK (status IN ('ACTIVE', 'FROZEN', 'CLOSED'));
+
+-- Журнал смены статусов кошельков с обязательной причиной
+CREATE TABLE IF NOT EXISTS wallet_status_history (
+    id          UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    wallet_id   UUID NOT NULL REFERENCES wallets(id) ON DELETE CASCADE,
+    from_status TEXT NOT NULL,
+    to_status   TEXT NOT NULL,
+    reason      TEXT NOT NULL CHECK (reason <> ''),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+
+CREATE INDEX IF NOT EXISTS idx_wallet_status_history_wallet ON wallet_status_history(wallet_id, created_at);
@@ -0,0 +1,6 @@
+-- Валюта кошелька (ISO 4217). Баланс хранится в минорных единицах валюты
+-- (копейки, тиыны, центы — целое!); существующие кошельки — рублёвые
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'RUB' CHECK (currency ~ '^[A-Z]{3}$');
+
+-- Все проводки записи — в одной валюте
+ALTER TABLE journal_entries ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'RUB';
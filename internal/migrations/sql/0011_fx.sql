@@ -0,0 +1,41 @@
+-- Обмен валют между кошельками по зафиксированной котировке: пара FX_OUT/FX_IN
+-- и по записи журнала в каждой валюте против счёта FX_POSITION
+INSERT INTO ledger_system_accounts (code, description) VALUES
+    ('FX_POSITION', 'Валютная позиция: обмен между кошельками')
+ON CONFLICT (code) DO NOTHING;
+
+-- Курсы обмена: сколько единиц quote за одну единицу base (в основных единицах валют)
+CREATE TABLE IF NOT EXISTS fx_rates (
+    base       TEXT NOT NULL CHECK (base ~ '^[A-Z]{3}$'),
+    quote      TEXT NOT NULL CHECK (quote ~ '^[A-Z]{3}$'),
+    rate       NUMERIC NOT NULL CHECK (rate > 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (base, quote)
+    );
+
+-- Котировки: курс и обе суммы фиксируются при создании и действуют до expires_at
+CREATE TABLE IF NOT EXISTS fx_quotes (
+    id             UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    from_wallet_id UUID NOT NULL REFERENCES wallets(id) ON DELETE CASCADE,
+    to_wallet_id   UUID NOT NULL REFERENCES wallets(id) ON DELETE CASCADE,
+    from_currency  TEXT NOT NULL,
+    to_currency    TEXT NOT NULL,
+    rate           NUMERIC NOT NULL CHECK (rate > 0),
+    rounding       TEXT NOT NULL,
+    source_amount  BIGINT NOT NULL CHECK (source_amount > 0),
+    target_amount  BIGINT NOT NULL CHECK (target_amount > 0),
+    status         TEXT NOT NULL CHECK (status IN ('OPEN', 'EXECUTED', 'EXPIRED')),
+    expires_at     TIMESTAMPTZ NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    executed_at    TIMESTAMPTZ
+    );
+
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_operation_type_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_operation_type_check
+    CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW', 'TRANSFER_OUT', 'TRANSFER_IN', 'ADJUSTMENT_IN', 'ADJUSTMENT_OUT', 'CAPTURE', 'FX_OUT', 'FX_IN'));
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS quote_id UUID;     -- исполненная котировка (FX_OUT/FX_IN)
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fx_rate NUMERIC;   -- курс обмена на момент исполнения
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_quote_id_fkey;
+ALTER TABLE transactions ADD CONSTRAINT transactions_quote_id_fkey
+    FOREIGN KEY (quote_id) REFERENCES fx_quotes(id);
@@ -0,0 +1,23 @@
+-- Тип кошелька: от него зависят комиссии
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS wallet_type TEXT NOT NULL DEFAULT 'PERSONAL' CHECK (wallet_type IN ('PERSONAL', 'BUSINESS'));
+
+-- Комиссия сверх amount, списана той же записью журнала
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fee BIGINT NOT NULL DEFAULT 0 CHECK (fee >= 0);
+
+-- Правила комиссий. Пустые currency/wallet_type подходят к любым; из подходящих
+-- выбирается самое точное. Одна строка на операцию, валюту и тип кошелька
+CREATE TABLE IF NOT EXISTS fee_rules (
+    id          UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    operation   TEXT NOT NULL CHECK (operation IN ('WITHDRAW', 'TRANSFER')),
+    currency    TEXT NOT NULL DEFAULT '',
+    wallet_type TEXT NOT NULL DEFAULT '',
+    kind        TEXT NOT NULL CHECK (kind IN ('FIXED', 'PERCENT', 'TIERED')),
+    fixed       BIGINT NOT NULL DEFAULT 0 CHECK (fixed >= 0),
+    percent     NUMERIC CHECK (percent > 0 AND percent <= 100),
+    min_fee     BIGINT NOT NULL DEFAULT 0 CHECK (min_fee >= 0),
+    max_fee     BIGINT NOT NULL DEFAULT 0 CHECK (max_fee >= 0),  -- 0 — без ограничения
+    tiers       JSONB NOT NULL DEFAULT '[]',  -- [{"upTo": 100000, "fixed": 0, "percent": "1"}, ...]
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (operation, currency, wallet_type)
+    );
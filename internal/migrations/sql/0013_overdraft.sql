@@ -0,0 +1,20 @@
+-- Кредитная линия кошелька, в минорных единицах
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS overdraft_limit BIGINT NOT NULL DEFAULT 0 CHECK (overdraft_limit >= 0);
+
+-- Баланс не ниже кредитной линии — в том числе для UPDATE в обход сервиса.
+-- На базе с отрицательными балансами миграция не пройдёт: их сначала
+-- нужно разобрать (reconcile) или выдать кошелькам кредитную линию
+ALTER TABLE wallets DROP CONSTRAINT IF EXISTS wallets_balance_within_overdraft;
+ALTER TABLE wallets ADD CONSTRAINT wallets_balance_within_overdraft CHECK (balance >= -overdraft_limit);
+
+-- Журнал изменений кредитного лимита кошельков с обязательной причиной
+CREATE TABLE IF NOT EXISTS wallet_overdraft_history (
+    id         UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    wallet_id  UUID NOT NULL REFERENCES wallets(id) ON DELETE CASCADE,
+    old_limit  BIGINT NOT NULL,
+    new_limit  BIGINT NOT NULL CHECK (new_limit >= 0),
+    reason     TEXT NOT NULL CHECK (reason <> ''),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+
+CREATE INDEX IF NOT EXISTS idx_wallet_overdraft_history_wallet ON wallet_overdraft_history(wallet_id, created_at);
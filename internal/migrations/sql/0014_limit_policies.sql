@@ -0,0 +1,18 @@
+-- Лимиты на списания (WITHDRAW, TRANSFER_OUT, CAPTURE): для кошелька или для всех кошельков типа.
+-- Политика кошелька важнее политики типа; 0 — без ограничения
+CREATE TABLE IF NOT EXISTS limit_policies (
+    id                        UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    wallet_id                 UUID REFERENCES wallets(id) ON DELETE CASCADE,
+    wallet_type               TEXT CHECK (wallet_type IN ('PERSONAL', 'BUSINESS')),
+    max_single                BIGINT NOT NULL DEFAULT 0 CHECK (max_single >= 0),
+    daily_withdrawal          BIGINT NOT NULL DEFAULT 0 CHECK (daily_withdrawal >= 0),    -- за календарный день UTC
+    monthly_withdrawal        BIGINT NOT NULL DEFAULT 0 CHECK (monthly_withdrawal >= 0),  -- за календарный месяц UTC
+    max_operations            BIGINT NOT NULL DEFAULT 0 CHECK (max_operations >= 0),
+    operations_window_seconds BIGINT NOT NULL DEFAULT 0 CHECK (operations_window_seconds >= 0),  -- скользящее окно для max_operations
+    created_at                TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at                TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((wallet_id IS NULL) <> (wallet_type IS NULL))  -- ровно одна область действия
+    );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_limit_policies_wallet ON limit_policies(wallet_id) WHERE wallet_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_limit_policies_wallet_type ON limit_policies(wallet_type) WHERE wallet_type IS NOT NULL;
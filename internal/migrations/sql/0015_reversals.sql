@@ -0,0 +1,12 @@
+-- Частичные и полные сторно: REVERSAL_IN/REVERSAL_OUT ссылаются на исходную операцию
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_operation_type_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_operation_type_check
+    CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW', 'TRANSFER_OUT', 'TRANSFER_IN', 'ADJUSTMENT_IN', 'ADJUSTMENT_OUT', 'CAPTURE', 'FX_OUT', 'FX_IN', 'REVERSAL_IN', 'REVERSAL_OUT'));
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reverses_id UUID REFERENCES transactions(id);  -- сторнируемая операция
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS reversed_amount BIGINT NOT NULL DEFAULT 0;      -- сколько из amount уже возвращено
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_reversed_within_amount;
+ALTER TABLE transactions ADD CONSTRAINT transactions_reversed_within_amount
+    CHECK (reversed_amount >= 0 AND reversed_amount <= amount);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_reverses_id ON transactions(reverses_id) WHERE reverses_id IS NOT NULL;
@@ -0,0 +1,7 @@
+-- Внешняя ссылка, описание и теги операций
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS external_ref TEXT CHECK (char_length(external_ref) <= 128);  -- внешняя ссылка (ID заказа), уникальна в пределах кошелька
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS description TEXT CHECK (char_length(description) <= 1024);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS tags JSONB CHECK (jsonb_typeof(tags) = 'object');  -- теги ключ → значение
+
+-- Поиск по внешней ссылке и защита от повторного проведения того же заказа
+CREATE UNIQUE INDEX IF NOT EXISTS idx_transactions_wallet_external_ref ON transactions(wallet_id, external_ref) WHERE external_ref IS NOT NULL;
@@ -0,0 +1,8 @@
+-- Владелец во внешней системе, внешний ID и метки кошелька
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS owner_id TEXT CHECK (char_length(owner_id) <= 128);  -- у владельца может быть несколько кошельков
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS external_id TEXT CHECK (char_length(external_id) <= 128);  -- уникален среди кошельков владельца, см. индекс ниже
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS labels JSONB CHECK (jsonb_typeof(labels) = 'object');  -- метки ключ → значение
+
+CREATE INDEX IF NOT EXISTS idx_wallets_owner_id ON wallets(owner_id, created_at) WHERE owner_id IS NOT NULL;
+-- Пространство externalId — владелец; кошельки без владельца делят общее пространство
+CREATE UNIQUE INDEX IF NOT EXISTS idx_wallets_owner_external_id ON wallets((COALESCE(owner_id, '')), external_id) WHERE external_id IS NOT NULL;
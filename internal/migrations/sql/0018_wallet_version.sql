@@ -0,0 +1,15 @@
+-- Версия кошелька для оптимистичной блокировки (ETag / If-Match): растёт при
+-- любом изменении строки, каким бы путём ни шла запись
+ALTER TABLE wallets ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION bump_wallet_version() RETURNS trigger AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS wallets_bump_version ON wallets;
+CREATE TRIGGER wallets_bump_version
+    BEFORE UPDATE ON wallets
+    FOR EACH ROW EXECUTE FUNCTION bump_wallet_version();
@@ -0,0 +1,13 @@
+-- Снимки балансов для запросов на момент времени (GET /api/v1/wallets/:uuid?asOf=...).
+-- Снимок — баланс кошелька по всем операциям с created_at <= as_of; запрос
+-- досчитывает от последнего снимка не позже asOf, а не с начала журнала.
+-- Пишутся фоновой задачей на начало суток (UTC) и только для кошельков,
+-- у которых после предыдущего снимка были операции.
+CREATE TABLE IF NOT EXISTS balance_snapshots (
+    wallet_id           UUID NOT NULL REFERENCES wallets(id) ON DELETE CASCADE,
+    as_of               TIMESTAMPTZ NOT NULL,
+    balance             BIGINT NOT NULL,
+    last_transaction_id UUID NOT NULL REFERENCES transactions(id),  -- последняя операция, вошедшая в снимок
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (wallet_id, as_of)
+);
@@ -0,0 +1,6 @@
+-- created_at операции — момент вставки строки, а не начала транзакции (NOW()).
+-- Строка вставляется после блокировки кошелька, поэтому транзакция, начатая
+-- до момента снимка балансов и дождавшаяся блокировки после него, получит
+-- created_at тоже после него — иначе снимок не смог бы её дождаться
+-- (см. SnapshotBalances).
+ALTER TABLE transactions ALTER COLUMN created_at SET DEFAULT clock_timestamp();
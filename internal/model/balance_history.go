@@ -0,0 +1,24 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HistoricalBalance — ответ GET /api/v1/wallets/:uuid?asOf=...: баланс по
+// журналу операций с createdAt не позже AsOf
+type HistoricalBalance struct {
+	WalletID          uuid.UUID  `json:"walletId"`
+	Balance           int64      `json:"balance"`
+	Currency          Currency   `json:"currency"`
+	AsOf              time.Time  `json:"asOf"`
+	LastTransactionID *uuid.UUID `json:"lastTransactionId,omitempty"` // nil — до AsOf операций не было
+}
+
+// BalanceSnapshotTime — на какой момент делать снимок балансов в момент now:
+// последнее начало суток (UTC). Операции, которые к этому моменту ещё не
+// зафиксированы, SnapshotBalances дожидается сам.
+func BalanceSnapshotTime(now time.Time) time.Time {
+	return DayStart(now)
+}
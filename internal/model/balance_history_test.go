@@ -0,0 +1,20 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBalanceSnapshotTime(t *testing.T) {
+	midnight := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, midnight.AddDate(0, 0, -1), BalanceSnapshotTime(midnight.Add(-time.Microsecond)))
+	assert.Equal(t, midnight, BalanceSnapshotTime(midnight.Add(time.Microsecond)))
+	assert.Equal(t, midnight, BalanceSnapshotTime(midnight.Add(23*time.Hour)))
+
+	// Сутки — по UTC, в каком бы поясе ни было время
+	msk := time.FixedZone("MSK", 3*60*60)
+	assert.Equal(t, midnight, BalanceSnapshotTime(time.Date(2026, 3, 1, 2, 0, 0, 0, msk).Add(24*time.Hour)))
+}
@@ -0,0 +1,38 @@
+package model
+
+import "fmt"
+
+// MaxBatchOperations — сколько операций принимает один POST /api/v1/operations:batch
+const MaxBatchOperations = 1000
+
+// BatchMode — как проводится пакет операций
+type BatchMode string
+
+const (
+	BatchAtomic      BatchMode = "atomic"      // все операции одной транзакцией: либо все, либо ни одной
+	BatchIndependent BatchMode = "independent" // каждая операция проводится или отклоняется сама по себе
+)
+
+// BatchRequest — тело POST /api/v1/operations:batch
+type BatchRequest struct {
+	Mode       BatchMode         `json:"mode"`
+	Operations []WalletOperation `json:"operations"`
+}
+
+// Validate — режим известен, операций от 1 до MaxBatchOperations
+func (b BatchRequest) Validate() error {
+	if b.Mode != BatchAtomic && b.Mode != BatchIndependent {
+		return fmt.Errorf("mode must be %s or %s", BatchAtomic, BatchIndependent)
+	}
+	if len(b.Operations) == 0 || len(b.Operations) > MaxBatchOperations {
+		return fmt.Errorf("operations must contain 1 to %d items", MaxBatchOperations)
+	}
+	return nil
+}
+
+// BatchOutcome — итог одной операции пакета: результат либо ошибка
+// из той же таксономии, что у ApplyOperation
+type BatchOutcome struct {
+	Result OperationResult
+	Err    error
+}
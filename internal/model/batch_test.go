@@ -0,0 +1,17 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchRequest_Validate(t *testing.T) {
+	one := []WalletOperation{{OperationType: OperationDeposit, Amount: 1}}
+	assert.NoError(t, BatchRequest{Mode: BatchAtomic, Operations: one}.Validate())
+	assert.NoError(t, BatchRequest{Mode: BatchIndependent, Operations: one}.Validate())
+	assert.Error(t, BatchRequest{Operations: one}.Validate())
+	assert.Error(t, BatchRequest{Mode: "best-effort", Operations: one}.Validate())
+	assert.Error(t, BatchRequest{Mode: BatchAtomic}.Validate())
+	assert.Error(t, BatchRequest{Mode: BatchAtomic, Operations: make([]WalletOperation, MaxBatchOperations+1)}.Validate())
+}
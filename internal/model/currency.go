@@ -0,0 +1,70 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Currency — буквенный код валюты ISO 4217
+type Currency string
+
+// DefaultCurrency — валюта кошелька, если при создании она не указана.
+// Все кошельки, созданные до появления валют, — рублёвые.
+const DefaultCurrency Currency = "RUB"
+
+// minorUnits — число знаков после запятой (minor unit) по ISO 4217:
+// копейки, тиыны и центы — 2 знака, иена — 0, динары — 3
+var minorUnits = map[Currency]int{
+	"RUB": 2,
+	"KZT": 2,
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"CNY": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"BHD": 3,
+	"KWD": 3,
+}
+
+// IsSupported — валюта есть в справочнике minorUnits
+func (c Currency) IsSupported() bool {
+	_, ok := minorUnits[c]
+	return ok
+}
+
+// Exponent — число знаков после запятой; суммы хранятся в 10^-Exponent основной единицы
+func (c Currency) Exponent() int {
+	return minorUnits[c]
+}
+
+var decimalAmount = regexp.MustCompile(`^(\d+)(?:\.(\d+))?$`)
+
+// ParseMinorUnits переводит сумму в основных единицах ("10.50") в минорные (1050).
+// Знаков после точки не больше, чем допускает валюта: "10.5" JPY или "1.005" USD — ошибка.
+func (c Currency) ParseMinorUnits(value string) (int64, error) {
+	if !c.IsSupported() {
+		return 0, fmt.Errorf("unsupported currency %q", c)
+	}
+	m := decimalAmount.FindStringSubmatch(value)
+	if m == nil {
+		return 0, fmt.Errorf("invalid value %q, expected decimal like 10.50", value)
+	}
+	whole, frac := m[1], m[2]
+	exp := c.Exponent()
+	if len(frac) > exp {
+		return 0, fmt.Errorf("%s allows at most %d decimal places, got %q", c, exp, value)
+	}
+
+	digits := strings.TrimLeft(whole+frac+strings.Repeat("0", exp-len(frac)), "0")
+	if digits == "" {
+		return 0, nil
+	}
+	amount, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("value %q is out of range", value)
+	}
+	return amount, nil
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurrency_ParseMinorUnits(t *testing.T) {
+	tests := []struct {
+		currency  Currency
+		value     string
+		expected  int64
+		expectErr bool
+	}{
+		{currency: "RUB", value: "10.50", expected: 1050},
+		{currency: "RUB", value: "10.5", expected: 1050},
+		{currency: "KZT", value: "7", expected: 700},
+		{currency: "USD", value: "0.01", expected: 1},
+		{currency: "JPY", value: "1500", expected: 1500},
+		{currency: "KWD", value: "1.005", expected: 1005},
+		{currency: "USD", value: "1.005", expectErr: true},
+		{currency: "JPY", value: "10.5", expectErr: true},
+		{currency: "USD", value: "-1", expectErr: true},
+		{currency: "USD", value: "1e3", expectErr: true},
+		{currency: "USD", value: ".5", expectErr: true},
+		{currency: "USD", value: "100000000000000000000", expectErr: true},
+		{currency: "XXX", value: "1", expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.currency)+" "+tt.value, func(t *testing.T) {
+			got, err := tt.currency.ParseMinorUnits(tt.value)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestCurrency_IsSupported(t *testing.T) {
+	for _, c := range []Currency{"RUB", "KZT", "USD"} {
+		assert.True(t, c.IsSupported(), c)
+	}
+	assert.False(t, Currency("rub").IsSupported())
+	assert.False(t, Currency("").IsSupported())
+	assert.Equal(t, 0, Currency("JPY").Exponent())
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ETag — тег представления баланса для ETag, If-Match и If-None-Match.
+// Кроме версии кошелька в нём сумма холдов: холды меняют доступный баланс,
+// не трогая строку кошелька, а истёкший холд перестаёт учитываться сам по себе.
+func (b WalletBalance) ETag() string {
+	return WalletETag(b.Version, b.Held)
+}
+
+// WalletETag — ETag кошелька версии version с холдами на сумму held
+func WalletETag(version, held int64) string {
+	return fmt.Sprintf(`"%d-%d"`, version, held)
+}
+
+// ETagMatches — совпадает ли etag с одним из тегов заголовка (RFC 9110, 13.1).
+// If-Match сравнивает строго (weak = false): слабые теги W/"..." не совпадают
+// ни с чем; If-None-Match — слабо, без учёта префикса W/. "*" совпадает с любым тегом.
+func ETagMatches(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag != "" && tag == etag {
+			return true
+		}
+	}
+	return false
+}
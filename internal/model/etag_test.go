@@ -0,0 +1,31 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETagMatches(t *testing.T) {
+	etag := WalletBalance{Version: 7, Held: 300}.ETag()
+	assert.Equal(t, `"7-300"`, etag)
+
+	tests := []struct {
+		header string
+		weak   bool
+		want   bool
+	}{
+		{``, false, false},
+		{`"7-300"`, false, true},
+		{`"6-300"`, false, false},
+		{`"6-300", "7-300"`, false, true},
+		{`*`, false, true},
+		{`W/"7-300"`, false, false},
+		{`W/"7-300"`, true, true},
+		{`"7-0"`, true, false},
+		{`7-300`, true, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ETagMatches(tt.header, etag, tt.weak), "header %s, weak %t", tt.header, tt.weak)
+	}
+}
@@ -0,0 +1,211 @@
+package model
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FeeOperation — операция, к которой применяется правило комиссии
+type FeeOperation string
+
+const (
+	FeeOnWithdraw FeeOperation = "WITHDRAW"
+	FeeOnTransfer FeeOperation = "TRANSFER" // платит отправитель
+)
+
+// FeeKind — способ расчёта комиссии
+type FeeKind string
+
+const (
+	FeeFixed   FeeKind = "FIXED"   // фиксированная сумма
+	FeePercent FeeKind = "PERCENT" // процент от суммы, с необязательными MinFee/MaxFee
+	FeeTiered  FeeKind = "TIERED"  // ступени по сумме операции
+)
+
+// FeeTier — ступень тарифа: действует для сумм до UpTo включительно
+// (0 — без верхней границы, только у последней ступени)
+type FeeTier struct {
+	UpTo    int64  `json:"upTo"`
+	Fixed   int64  `json:"fixed"`
+	Percent string `json:"percent,omitempty"`
+}
+
+// FeeRule — правило комиссии. Выбирается по операции, валюте и типу кошелька;
+// пустые Currency и WalletType подходят к любым, точное совпадение важнее.
+// Суммы — в минорных единицах валюты кошелька, Percent — десятичная строка ("1.5").
+type FeeRule struct {
+	ID         uuid.UUID    `json:"id"`
+	Operation  FeeOperation `json:"operation"`
+	Currency   Currency     `json:"currency,omitempty"`
+	WalletType WalletType   `json:"walletType,omitempty"`
+	Kind       FeeKind      `json:"kind"`
+	Fixed      int64        `json:"fixed,omitempty"`
+	Percent    string       `json:"percent,omitempty"`
+	MinFee     int64        `json:"minFee,omitempty"`
+	MaxFee     int64        `json:"maxFee,omitempty"` // 0 — без ограничения
+	Tiers      []FeeTier    `json:"tiers,omitempty"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	UpdatedAt  time.Time    `json:"updatedAt"`
+}
+
+// Validate — правило согласовано со своим Kind
+func (r FeeRule) Validate() error {
+	switch r.Operation {
+	case FeeOnWithdraw, FeeOnTransfer:
+	default:
+		return fmt.Errorf("invalid operation %q, expected WITHDRAW or TRANSFER", r.Operation)
+	}
+	if r.Currency != "" && !r.Currency.IsSupported() {
+		return fmt.Errorf("unsupported currency %q", r.Currency)
+	}
+	if r.WalletType != "" && !r.WalletType.IsValid() {
+		return fmt.Errorf("invalid walletType %q", r.WalletType)
+	}
+	if r.Fixed < 0 || r.MinFee < 0 || r.MaxFee < 0 {
+		return fmt.Errorf("fee amounts must not be negative")
+	}
+
+	switch r.Kind {
+	case FeeFixed:
+		if r.Fixed == 0 || r.Percent != "" || len(r.Tiers) > 0 {
+			return fmt.Errorf("FIXED rule requires only fixed > 0")
+		}
+	case FeePercent:
+		if err := validatePercent(r.Percent); err != nil {
+			return err
+		}
+		if len(r.Tiers) > 0 {
+			return fmt.Errorf("PERCENT rule must not have tiers")
+		}
+		if r.MaxFee > 0 && r.MinFee > r.MaxFee {
+			return fmt.Errorf("minFee %d exceeds maxFee %d", r.MinFee, r.MaxFee)
+		}
+	case FeeTiered:
+		if r.Fixed != 0 || r.Percent != "" || r.MinFee != 0 || r.MaxFee != 0 {
+			return fmt.Errorf("TIERED rule is configured only by tiers")
+		}
+		return validateTiers(r.Tiers)
+	default:
+		return fmt.Errorf("invalid kind %q, expected FIXED, PERCENT or TIERED", r.Kind)
+	}
+	return nil
+}
+
+func validateTiers(tiers []FeeTier) error {
+	if len(tiers) == 0 {
+		return fmt.Errorf("TIERED rule requires tiers")
+	}
+	for i, tier := range tiers {
+		last := i == len(tiers)-1
+		switch {
+		case last && tier.UpTo != 0:
+			return fmt.Errorf("last tier must have upTo 0 (no upper bound)")
+		case !last && tier.UpTo <= 0:
+			return fmt.Errorf("tier %d: upTo must be positive", i+1)
+		case i > 0 && !last && tier.UpTo <= tiers[i-1].UpTo:
+			return fmt.Errorf("tier %d: upTo must increase", i+1)
+		case tier.Fixed < 0:
+			return fmt.Errorf("tier %d: fixed must not be negative", i+1)
+		}
+		if tier.Percent != "" {
+			if err := validatePercent(tier.Percent); err != nil {
+				return fmt.Errorf("tier %d: %w", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validatePercent(s string) error {
+	p, err := parseRate(s)
+	if err != nil {
+		return fmt.Errorf("invalid percent %q", s)
+	}
+	if p.Sign() <= 0 || p.Cmp(big.NewRat(100, 1)) > 0 {
+		return fmt.Errorf("percent must be in (0, 100], got %q", s)
+	}
+	return nil
+}
+
+// Compute — комиссия с суммы amount. Процент округляется по HALF_UP
+// до минорной единицы, затем применяются MinFee/MaxFee.
+func (r FeeRule) Compute(amount int64) (int64, error) {
+	switch r.Kind {
+	case FeeFixed:
+		return r.Fixed, nil
+	case FeePercent:
+		fee, err := percentOf(amount, r.Percent)
+		if err != nil {
+			return 0, err
+		}
+		if fee < r.MinFee {
+			fee = r.MinFee
+		}
+		if r.MaxFee > 0 && fee > r.MaxFee {
+			fee = r.MaxFee
+		}
+		return fee, nil
+	case FeeTiered:
+		for _, tier := range r.Tiers {
+			if tier.UpTo != 0 && amount > tier.UpTo {
+				continue
+			}
+			fee, err := percentOf(amount, tier.Percent)
+			if err != nil {
+				return 0, err
+			}
+			return tier.Fixed + fee, nil
+		}
+	}
+	return 0, fmt.Errorf("fee rule %s: cannot compute %s fee for %d", r.ID, r.Kind, amount)
+}
+
+// percentOf — percent процентов от amount; пустой percent — 0
+func percentOf(amount int64, percent string) (int64, error) {
+	if percent == "" {
+		return 0, nil
+	}
+	p, err := parseRate(percent)
+	if err != nil {
+		return 0, err
+	}
+	x := new(big.Rat).Mul(new(big.Rat).SetInt64(amount), p)
+	x.Quo(x, big.NewRat(100, 1))
+	fee := RoundHalfUp.round(x)
+	if !fee.IsInt64() {
+		return 0, fmt.Errorf("fee is out of range")
+	}
+	return fee.Int64(), nil
+}
+
+// specificity — насколько точно правило подходит: валюта важнее типа кошелька
+func (r FeeRule) specificity() int {
+	s := 0
+	if r.Currency != "" {
+		s += 2
+	}
+	if r.WalletType != "" {
+		s++
+	}
+	return s
+}
+
+// SelectFeeRule — самое точное правило для операции; false — комиссии нет
+func SelectFeeRule(rules []FeeRule, op FeeOperation, currency Currency, walletType WalletType) (FeeRule, bool) {
+	var best FeeRule
+	found := false
+	for _, rule := range rules {
+		if rule.Operation != op ||
+			(rule.Currency != "" && rule.Currency != currency) ||
+			(rule.WalletType != "" && rule.WalletType != walletType) {
+			continue
+		}
+		if !found || rule.specificity() > best.specificity() {
+			best, found = rule, true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,90 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeeRule_Compute(t *testing.T) {
+	tiered := FeeRule{Operation: FeeOnWithdraw, Kind: FeeTiered, Tiers: []FeeTier{
+		{UpTo: 10000, Fixed: 100},
+		{UpTo: 100000, Percent: "1"},
+		{UpTo: 0, Fixed: 500, Percent: "0.5"},
+	}}
+	tests := []struct {
+		name     string
+		rule     FeeRule
+		amount   int64
+		expected int64
+	}{
+		{name: "fixed", rule: FeeRule{Kind: FeeFixed, Fixed: 150}, amount: 1, expected: 150},
+		{name: "percent", rule: FeeRule{Kind: FeePercent, Percent: "1.5"}, amount: 10000, expected: 150},
+		{name: "percent rounds half up", rule: FeeRule{Kind: FeePercent, Percent: "1.5"}, amount: 1010, expected: 15},
+		{name: "percent min cap", rule: FeeRule{Kind: FeePercent, Percent: "1", MinFee: 50, MaxFee: 1000}, amount: 100, expected: 50},
+		{name: "percent max cap", rule: FeeRule{Kind: FeePercent, Percent: "1", MinFee: 50, MaxFee: 1000}, amount: 1000000, expected: 1000},
+		{name: "percent within caps", rule: FeeRule{Kind: FeePercent, Percent: "1", MinFee: 50, MaxFee: 1000}, amount: 20000, expected: 200},
+		{name: "tier upper bound inclusive", rule: tiered, amount: 10000, expected: 100},
+		{name: "second tier", rule: tiered, amount: 10001, expected: 100},
+		{name: "second tier percent", rule: tiered, amount: 50000, expected: 500},
+		{name: "last tier", rule: tiered, amount: 200000, expected: 1500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Operation = FeeOnWithdraw
+			require.NoError(t, tt.rule.Validate())
+			fee, err := tt.rule.Compute(tt.amount)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, fee)
+		})
+	}
+}
+
+func TestFeeRule_Validate(t *testing.T) {
+	invalid := []FeeRule{
+		{Operation: "DEPOSIT", Kind: FeeFixed, Fixed: 1},
+		{Operation: FeeOnWithdraw, Kind: "FLAT", Fixed: 1},
+		{Operation: FeeOnWithdraw, Kind: FeeFixed},
+		{Operation: FeeOnWithdraw, Kind: FeeFixed, Fixed: 1, Percent: "1"},
+		{Operation: FeeOnWithdraw, Kind: FeePercent, Percent: "0"},
+		{Operation: FeeOnWithdraw, Kind: FeePercent, Percent: "101"},
+		{Operation: FeeOnWithdraw, Kind: FeePercent, Percent: "1", MinFee: 10, MaxFee: 5},
+		{Operation: FeeOnWithdraw, Kind: FeePercent, Percent: "1", Currency: "XXX"},
+		{Operation: FeeOnWithdraw, Kind: FeePercent, Percent: "1", WalletType: "VIP"},
+		{Operation: FeeOnWithdraw, Kind: FeeTiered},
+		{Operation: FeeOnWithdraw, Kind: FeeTiered, Tiers: []FeeTier{{UpTo: 100, Fixed: 1}}},
+		{Operation: FeeOnWithdraw, Kind: FeeTiered, Tiers: []FeeTier{{UpTo: 100, Fixed: 1}, {UpTo: 50, Fixed: 2}, {Fixed: 3}}},
+		{Operation: FeeOnWithdraw, Kind: FeeTiered, Fixed: 1, Tiers: []FeeTier{{Fixed: 1}}},
+	}
+	for _, rule := range invalid {
+		assert.Error(t, rule.Validate(), "%+v", rule)
+	}
+	assert.NoError(t, FeeRule{Operation: FeeOnTransfer, Kind: FeeTiered, Tiers: []FeeTier{{Fixed: 0}}}.Validate())
+}
+
+func TestSelectFeeRule(t *testing.T) {
+	fallback := FeeRule{Operation: FeeOnWithdraw, Kind: FeeFixed, Fixed: 1}
+	rub := FeeRule{Operation: FeeOnWithdraw, Currency: "RUB", Kind: FeeFixed, Fixed: 2}
+	business := FeeRule{Operation: FeeOnWithdraw, WalletType: WalletBusiness, Kind: FeeFixed, Fixed: 3}
+	rubBusiness := FeeRule{Operation: FeeOnWithdraw, Currency: "RUB", WalletType: WalletBusiness, Kind: FeeFixed, Fixed: 4}
+	transfer := FeeRule{Operation: FeeOnTransfer, Kind: FeeFixed, Fixed: 5}
+	rules := []FeeRule{rubBusiness, business, transfer, rub, fallback}
+
+	rule, ok := SelectFeeRule(rules, FeeOnWithdraw, "RUB", WalletBusiness)
+	require.True(t, ok)
+	assert.Equal(t, int64(4), rule.Fixed)
+
+	// Валюта точнее типа кошелька
+	rule, _ = SelectFeeRule(rules, FeeOnWithdraw, "RUB", WalletPersonal)
+	assert.Equal(t, int64(2), rule.Fixed)
+	rule, _ = SelectFeeRule(rules, FeeOnWithdraw, "USD", WalletBusiness)
+	assert.Equal(t, int64(3), rule.Fixed)
+	rule, _ = SelectFeeRule(rules, FeeOnWithdraw, "USD", WalletPersonal)
+	assert.Equal(t, int64(1), rule.Fixed)
+	rule, _ = SelectFeeRule(rules, FeeOnTransfer, "USD", WalletPersonal)
+	assert.Equal(t, int64(5), rule.Fixed)
+
+	_, ok = SelectFeeRule([]FeeRule{rub}, FeeOnWithdraw, "USD", WalletPersonal)
+	assert.False(t, ok)
+}
@@ -0,0 +1,199 @@
+package model
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FXRate — курс обмена: 1 единица Base стоит Rate единиц Quote (в основных единицах).
+// Курс задаётся для направления: USD→KZT и KZT→USD — разные строки.
+type FXRate struct {
+	Base      Currency  `json:"base"`
+	Quote     Currency  `json:"quote"`
+	Rate      string    `json:"rate"` // десятичная строка, "520.15"
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+var decimalRate = regexp.MustCompile(`^\d+(\.\d+)?$`)
+
+// Validate — поддерживаемые разные валюты и положительный десятичный курс
+func (r FXRate) Validate() error {
+	if !r.Base.IsSupported() {
+		return fmt.Errorf("unsupported currency %q", r.Base)
+	}
+	if !r.Quote.IsSupported() {
+		return fmt.Errorf("unsupported currency %q", r.Quote)
+	}
+	if r.Base == r.Quote {
+		return fmt.Errorf("base and quote currencies must differ")
+	}
+	rate, err := parseRate(r.Rate)
+	if err != nil {
+		return err
+	}
+	if rate.Sign() <= 0 {
+		return fmt.Errorf("rate must be positive, got %q", r.Rate)
+	}
+	return nil
+}
+
+func parseRate(s string) (*big.Rat, error) {
+	if !decimalRate.MatchString(s) {
+		return nil, fmt.Errorf("invalid rate %q, expected decimal like 520.15", s)
+	}
+	rate, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid rate %q", s)
+	}
+	return rate, nil
+}
+
+// ParseRatesCSV читает курсы из CSV с заголовком base,quote,rate
+func ParseRatesCSV(r io.Reader) ([]FXRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if strings.Join(header, ",") != "base,quote,rate" {
+		return nil, fmt.Errorf("unexpected header %q, expected base,quote,rate", strings.Join(header, ","))
+	}
+
+	var rates []FXRate
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		rate := FXRate{Base: Currency(record[0]), Quote: Currency(record[1]), Rate: record[2]}
+		if err := rate.Validate(); err != nil {
+			line, _ := reader.FieldPos(0)
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rates = append(rates, rate)
+	}
+	if len(rates) == 0 {
+		return nil, fmt.Errorf("no rates in CSV")
+	}
+	return rates, nil
+}
+
+// Rounding — правило округления суммы зачисления до минорной единицы валюты
+type Rounding string
+
+const (
+	RoundDown     Rounding = "DOWN"      // отбросить остаток: клиент никогда не получает больше курса
+	RoundHalfUp   Rounding = "HALF_UP"   // 0.5 и больше — вверх
+	RoundHalfEven Rounding = "HALF_EVEN" // банковское: 0.5 — к чётному
+)
+
+// ParseRounding — правило округления из конфигурации
+func ParseRounding(s string) (Rounding, bool) {
+	switch r := Rounding(strings.ToUpper(s)); r {
+	case RoundDown, RoundHalfUp, RoundHalfEven:
+		return r, true
+	}
+	return "", false
+}
+
+// round округляет неотрицательное x до целого
+func (r Rounding) round(x *big.Rat) *big.Int {
+	q, m := new(big.Int).QuoRem(x.Num(), x.Denom(), new(big.Int))
+	if r == RoundDown || m.Sign() == 0 {
+		return q
+	}
+	// Сравниваем удвоенный остаток со знаменателем: < — меньше половины, = — ровно половина
+	switch new(big.Int).Lsh(m, 1).Cmp(x.Denom()) {
+	case 1:
+		return q.Add(q, big.NewInt(1))
+	case 0:
+		if r == RoundHalfUp || q.Bit(0) == 1 {
+			return q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+// ConvertAmount переводит amount минорных единиц from в минорные единицы to по курсу rate:
+// amount × rate × 10^(exp(to) − exp(from)), округлённое по правилу rounding
+func ConvertAmount(amount int64, from, to Currency, rate string, rounding Rounding) (int64, error) {
+	r, err := parseRate(rate)
+	if err != nil {
+		return 0, err
+	}
+	x := new(big.Rat).Mul(new(big.Rat).SetInt64(amount), r)
+	shift := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(to.Exponent()-from.Exponent()))), nil)
+	if to.Exponent() >= from.Exponent() {
+		x.Mul(x, new(big.Rat).SetInt(shift))
+	} else {
+		x.Quo(x, new(big.Rat).SetInt(shift))
+	}
+
+	result := rounding.round(x)
+	if !result.IsInt64() {
+		return 0, fmt.Errorf("converted amount is out of range")
+	}
+	return result.Int64(), nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// QuoteStatus — состояние котировки
+type QuoteStatus string
+
+const (
+	QuoteOpen     QuoteStatus = "OPEN"     // курс зафиксирован, можно исполнить до ExpiresAt
+	QuoteExecuted QuoteStatus = "EXECUTED" // обмен проведён
+	QuoteExpired  QuoteStatus = "EXPIRED"  // срок истёк, нужна новая котировка
+)
+
+// QuoteRequest — тело POST /api/v1/fx/quotes. Amount — сколько списать
+// с кошелька-источника, в минорных единицах его валюты
+type QuoteRequest struct {
+	FromWalletID uuid.UUID `json:"fromWalletId"`
+	ToWalletID   uuid.UUID `json:"toWalletId"`
+	Amount       int64     `json:"amount"`
+}
+
+// FXQuote — котировка обмена с зафиксированным курсом и суммами
+type FXQuote struct {
+	ID           uuid.UUID   `json:"id"`
+	FromWalletID uuid.UUID   `json:"fromWalletId"`
+	ToWalletID   uuid.UUID   `json:"toWalletId"`
+	FromCurrency Currency    `json:"fromCurrency"`
+	ToCurrency   Currency    `json:"toCurrency"`
+	Rate         string      `json:"rate"`
+	Rounding     Rounding    `json:"rounding"`
+	SourceAmount int64       `json:"sourceAmount"` // спишется с FromWalletID
+	TargetAmount int64       `json:"targetAmount"` // зачислится на ToWalletID
+	Status       QuoteStatus `json:"status"`
+	ExpiresAt    time.Time   `json:"expiresAt"`
+	CreatedAt    time.Time   `json:"createdAt"`
+	ExecutedAt   *time.Time  `json:"executedAt,omitempty"`
+}
+
+// EffectiveStatus — статус с учётом срока: открытая котировка после ExpiresAt считается истёкшей
+func (q FXQuote) EffectiveStatus(now time.Time) QuoteStatus {
+	if q.Status == QuoteOpen && !now.Before(q.ExpiresAt) {
+		return QuoteExpired
+	}
+	return q.Status
+}
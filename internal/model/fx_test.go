@@ -0,0 +1,81 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertAmount(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   int64
+		from, to Currency
+		rate     string
+		rounding Rounding
+		expected int64
+	}{
+		{name: "exact", amount: 10000, from: "USD", to: "RUB", rate: "92.5", rounding: RoundDown, expected: 925000},
+		{name: "down", amount: 12345, from: "RUB", to: "USD", rate: "0.0105", rounding: RoundDown, expected: 129},
+		{name: "half up below half", amount: 12345, from: "RUB", to: "USD", rate: "0.0105", rounding: RoundHalfUp, expected: 130},
+		{name: "half up exact half", amount: 5, from: "USD", to: "RUB", rate: "0.5", rounding: RoundHalfUp, expected: 3},
+		{name: "half even exact half to even", amount: 5, from: "USD", to: "RUB", rate: "0.5", rounding: RoundHalfEven, expected: 2},
+		{name: "half even exact half to odd", amount: 7, from: "USD", to: "RUB", rate: "0.5", rounding: RoundHalfEven, expected: 4},
+		{name: "to zero exponent", amount: 1050, from: "USD", to: "JPY", rate: "150", rounding: RoundDown, expected: 1575},
+		{name: "from zero exponent", amount: 1575, from: "JPY", to: "USD", rate: "0.0066", rounding: RoundHalfUp, expected: 1040},
+		{name: "three digit exponent", amount: 1000, from: "KZT", to: "KWD", rate: "0.0006", rounding: RoundDown, expected: 6},
+		{name: "too small", amount: 1, from: "KZT", to: "USD", rate: "0.0019", rounding: RoundDown, expected: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ConvertAmount(tt.amount, tt.from, tt.to, tt.rate, tt.rounding)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+
+	_, err := ConvertAmount(100, "USD", "RUB", "1e2", RoundDown)
+	assert.Error(t, err)
+}
+
+func TestFXRate_Validate(t *testing.T) {
+	assert.NoError(t, FXRate{Base: "USD", Quote: "KZT", Rate: "520.15"}.Validate())
+	assert.Error(t, FXRate{Base: "USD", Quote: "USD", Rate: "1"}.Validate())
+	assert.Error(t, FXRate{Base: "USD", Quote: "XXX", Rate: "1"}.Validate())
+	assert.Error(t, FXRate{Base: "USD", Quote: "KZT", Rate: "0"}.Validate())
+	assert.Error(t, FXRate{Base: "USD", Quote: "KZT", Rate: "-1"}.Validate())
+	assert.Error(t, FXRate{Base: "USD", Quote: "KZT", Rate: ""}.Validate())
+}
+
+func TestParseRatesCSV(t *testing.T) {
+	rates, err := ParseRatesCSV(strings.NewReader("base,quote,rate\nUSD,KZT,520.15\nKZT,USD,0.0019\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []FXRate{
+		{Base: "USD", Quote: "KZT", Rate: "520.15"},
+		{Base: "KZT", Quote: "USD", Rate: "0.0019"},
+	}, rates)
+
+	for _, input := range []string{
+		"",
+		"base,quote,rate\n",
+		"from,to,rate\nUSD,KZT,1\n",
+		"base,quote,rate\nUSD,KZT\n",
+		"base,quote,rate\nUSD,KZT,1\nUSD,XXX,1\n",
+	} {
+		_, err := ParseRatesCSV(strings.NewReader(input))
+		assert.Error(t, err, input)
+	}
+}
+
+func TestFXQuote_EffectiveStatus(t *testing.T) {
+	now := time.Now()
+	quote := FXQuote{Status: QuoteOpen, ExpiresAt: now.Add(time.Second)}
+	assert.Equal(t, QuoteOpen, quote.EffectiveStatus(now))
+	assert.Equal(t, QuoteExpired, quote.EffectiveStatus(now.Add(time.Second)))
+
+	quote.Status = QuoteExecuted
+	assert.Equal(t, QuoteExecuted, quote.EffectiveStatus(now.Add(time.Hour)))
+}
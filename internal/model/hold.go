@@ -0,0 +1,52 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HoldStatus — состояние холда
+type HoldStatus string
+
+const (
+	HoldActive   HoldStatus = "ACTIVE"   // средства заблокированы
+	HoldCaptured HoldStatus = "CAPTURED" // списано CapturedAmount, остаток разблокирован
+	HoldVoided   HoldStatus = "VOIDED"   // отменён, средства разблокированы
+	HoldExpired  HoldStatus = "EXPIRED"  // истёк TTL, средства разблокированы
+)
+
+// HoldRequest — тело POST /api/v1/holds
+type HoldRequest struct {
+	WalletID   uuid.UUID `json:"walletId"`
+	Amount     int64     `json:"amount"`
+	TTLSeconds int64     `json:"ttlSeconds"` // 0 — HOLD_TTL из конфигурации
+}
+
+// CaptureRequest — тело POST /api/v1/holds/:id/capture
+type CaptureRequest struct {
+	Amount int64 `json:"amount"` // 0 — вся сумма холда
+}
+
+// Hold — блокировка части баланса до подтверждения заказа.
+// Холд уменьшает доступный баланс, но не баланс главной книги:
+// деньги уходят с кошелька только при capture.
+type Hold struct {
+	ID             uuid.UUID  `json:"id"`
+	WalletID       uuid.UUID  `json:"walletId"`
+	Amount         int64      `json:"amount"`
+	CapturedAmount int64      `json:"capturedAmount"`
+	Status         HoldStatus `json:"status"`
+	ExpiresAt      time.Time  `json:"expiresAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+// EffectiveStatus — ACTIVE-холд с истёкшим сроком уже ничего не блокирует,
+// даже если фоновая задача ещё не перевела его в EXPIRED
+func (h Hold) EffectiveStatus(now time.Time) HoldStatus {
+	if h.Status == HoldActive && !h.ExpiresAt.After(now) {
+		return HoldExpired
+	}
+	return h.Status
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SystemAccount — системный счёт главной книги: деньги, которые находятся
+// вне кошельков клиентов
+type SystemAccount string
+
+const (
+	AccountExternalCashIn  SystemAccount = "EXTERNAL_CASH_IN"  // источник пополнений
+	AccountExternalCashOut SystemAccount = "EXTERNAL_CASH_OUT" // получатель выводов
+	AccountFees            SystemAccount = "FEES"              // удержанные комиссии
+	AccountAdjustments     SystemAccount = "ADJUSTMENTS"       // корректировки сверки
+	AccountFXPosition      SystemAccount = "FX_POSITION"       // валютная позиция: обмены проходят через неё
+)
+
+// SystemAccounts — все системные счета
+var SystemAccounts = []SystemAccount{AccountExternalCashIn, AccountExternalCashOut, AccountFees, AccountAdjustments, AccountFXPosition}
+
+// Типы записей журнала (journal_entries.entry_type)
+const (
+	EntryDeposit    = "DEPOSIT"
+	EntryWithdraw   = "WITHDRAW"
+	EntryTransfer   = "TRANSFER"
+	EntryAdjustment = "ADJUSTMENT"
+	EntryCapture    = "CAPTURE"
+	EntryFX         = "FX" // две записи на обмен — по одной в каждой валюте
+	EntryReversal   = "REVERSAL"
+)
+
+// LedgerAccount — счёт главной книги: кошелёк либо системный счёт
+type LedgerAccount struct {
+	WalletID *uuid.UUID    `json:"walletId,omitempty"`
+	System   SystemAccount `json:"system,omitempty"`
+}
+
+func WalletAccount(walletID uuid.UUID) LedgerAccount {
+	return LedgerAccount{WalletID: &walletID}
+}
+
+func SystemLedgerAccount(code SystemAccount) LedgerAccount {
+	return LedgerAccount{System: code}
+}
+
+// Posting — проводка: изменение баланса одного счёта.
+// Amount > 0 увеличивает баланс счёта, Amount < 0 — уменьшает.
+// Сумма проводок одной записи журнала всегда равна нулю.
+type Posting struct {
+	Account LedgerAccount `json:"account"`
+	Amount  int64         `json:"amount"`
+}
+
+// JournalEntry — запись журнала главной книги. Все проводки записи —
+// в одной валюте, поэтому запись сбалансирована в пределах этой валюты.
+type JournalEntry struct {
+	ID        uuid.UUID `json:"id"`
+	EntryType string    `json:"entryType"`
+	Currency  Currency  `json:"currency"`
+	Postings  []Posting `json:"postings"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// AccountBalance — баланс счёта: сохранённый (только у кошельков)
+// и вычисленный по проводкам. Системные счета ведутся отдельно по каждой
+// валюте; у счёта без проводок Currency пуста.
+type AccountBalance struct {
+	Account     LedgerAccount `json:"account"`
+	Currency    Currency      `json:"currency,omitempty"`
+	Balance     int64         `json:"balance"`
+	PostingsSum int64         `json:"postingsSum"`
+}
+
+// LedgerReport — результат сверки главной книги
+type LedgerReport struct {
+	Balanced          bool             `json:"balanced"`
+	UnbalancedEntries []uuid.UUID      `json:"unbalancedEntries"` // записи, проводки которых не дают ноль
+	WalletMismatches  []AccountBalance `json:"walletMismatches"`  // кошельки, где balance ≠ сумме проводок
+	SystemAccounts    []AccountBalance `json:"systemAccounts"`
+}
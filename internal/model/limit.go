@@ -0,0 +1,162 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LimitKind — какой лимит нарушен (поле limit в ответе LIMIT_EXCEEDED)
+type LimitKind string
+
+const (
+	LimitMaxSingle         LimitKind = "MAX_SINGLE"         // сумма одной операции
+	LimitDailyWithdrawal   LimitKind = "DAILY_WITHDRAWAL"   // сумма списаний за календарный день (UTC)
+	LimitMonthlyWithdrawal LimitKind = "MONTHLY_WITHDRAWAL" // сумма списаний за календарный месяц (UTC)
+	LimitOperationCount    LimitKind = "OPERATION_COUNT"    // число списаний за скользящее окно
+)
+
+// LimitedOperationTypes — исходящие операции журнала, на которые действуют лимиты:
+// деньги уходят из кошелька к другому владельцу или из сервиса. FX_OUT лимитами
+// не учитывается: при обмене средства остаются в сервисе, на кошельке в другой
+// валюте, и их списание оттуда ограничивают лимиты того кошелька. Не учитываются
+// и исправления журнала — ADJUSTMENT_OUT и REVERSAL_OUT.
+var LimitedOperationTypes = []OperationType{OperationWithdraw, OperationTransferOut, OperationCapture}
+
+// LimitedAmount — сколько строка журнала расходует из DailyWithdrawal и MonthlyWithdrawal:
+// сумма вместе с комиссией за вычетом возвращённого. Возврат освобождает лимит того
+// окна, в котором прошла исходная операция; комиссия не возвращается и остаётся в счёте.
+func (t Transaction) LimitedAmount() int64 {
+	return t.Amount + t.Fee - t.ReversedAmount
+}
+
+// IsLimited — операция учитывается лимитами на списания
+func (ot OperationType) IsLimited() bool {
+	for _, t := range LimitedOperationTypes {
+		if t == ot {
+			return true
+		}
+	}
+	return false
+}
+
+// LimitPolicy — лимиты на списания кошелька. Задаётся либо для кошелька (WalletID),
+// либо для всех кошельков типа (WalletType); политика кошелька важнее политики типа.
+// Суммы — в минорных единицах валюты кошелька, 0 — без ограничения.
+type LimitPolicy struct {
+	ID                      uuid.UUID  `json:"id"`
+	WalletID                *uuid.UUID `json:"walletId,omitempty"`
+	WalletType              WalletType `json:"walletType,omitempty"`
+	MaxSingle               int64      `json:"maxSingle,omitempty"`
+	DailyWithdrawal         int64      `json:"dailyWithdrawal,omitempty"`
+	MonthlyWithdrawal       int64      `json:"monthlyWithdrawal,omitempty"`
+	MaxOperations           int64      `json:"maxOperations,omitempty"`
+	OperationsWindowSeconds int64      `json:"operationsWindowSeconds,omitempty"`
+	CreatedAt               time.Time  `json:"createdAt"`
+	UpdatedAt               time.Time  `json:"updatedAt"`
+}
+
+// Validate — задана ровно одна область действия и хотя бы один лимит
+func (p LimitPolicy) Validate() error {
+	if (p.WalletID == nil) == (p.WalletType == "") {
+		return fmt.Errorf("exactly one of walletId and walletType is required")
+	}
+	if p.WalletType != "" && !p.WalletType.IsValid() {
+		return fmt.Errorf("invalid walletType %q", p.WalletType)
+	}
+	if p.MaxSingle < 0 || p.DailyWithdrawal < 0 || p.MonthlyWithdrawal < 0 || p.MaxOperations < 0 || p.OperationsWindowSeconds < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	if (p.MaxOperations > 0) != (p.OperationsWindowSeconds > 0) {
+		return fmt.Errorf("maxOperations and operationsWindowSeconds are set together")
+	}
+	if p.MaxSingle == 0 && p.DailyWithdrawal == 0 && p.MonthlyWithdrawal == 0 && p.MaxOperations == 0 {
+		return fmt.Errorf("at least one limit is required")
+	}
+	return nil
+}
+
+// NeedsHistory — для проверки нужны суммы и число прошлых списаний
+func (p LimitPolicy) NeedsHistory() bool {
+	return p.DailyWithdrawal > 0 || p.MonthlyWithdrawal > 0 || p.MaxOperations > 0
+}
+
+// OperationsWindow — длина скользящего окна для MaxOperations
+func (p LimitPolicy) OperationsWindow() time.Duration {
+	return time.Duration(p.OperationsWindowSeconds) * time.Second
+}
+
+// LimitUsage — списания кошелька, уже учтённые лимитами
+type LimitUsage struct {
+	Daily      int64 // сумма с начала дня, см. Transaction.LimitedAmount
+	Monthly    int64 // сумма с начала месяца
+	Operations int64 // число списаний в окне OperationsWindow; возвраты его не уменьшают
+}
+
+// Add — учесть списание amount (с комиссией), проведённое в момент at, относительно момента now
+func (u *LimitUsage) Add(p LimitPolicy, amount int64, at, now time.Time) {
+	if !at.Before(DayStart(now)) {
+		u.Daily += amount
+	}
+	if !at.Before(MonthStart(now)) {
+		u.Monthly += amount
+	}
+	if p.MaxOperations > 0 && at.After(now.Add(-p.OperationsWindow())) {
+		u.Operations++
+	}
+}
+
+// LimitViolation — какой лимит не пропускает списание amount
+type LimitViolation struct {
+	Limit     LimitKind
+	Max       int64
+	Used      int64
+	Requested int64
+}
+
+// Check — первый нарушенный лимит либо nil. MaxSingle ограничивает сумму операции,
+// дневной и месячный лимиты — всё, что уходит с кошелька, то есть сумму с комиссией fee
+func (p LimitPolicy) Check(u LimitUsage, amount, fee int64) *LimitViolation {
+	debit := amount + fee
+	switch {
+	case p.MaxSingle > 0 && amount > p.MaxSingle:
+		return &LimitViolation{Limit: LimitMaxSingle, Max: p.MaxSingle, Requested: amount}
+	case p.DailyWithdrawal > 0 && u.Daily+debit > p.DailyWithdrawal:
+		return &LimitViolation{Limit: LimitDailyWithdrawal, Max: p.DailyWithdrawal, Used: u.Daily, Requested: debit}
+	case p.MonthlyWithdrawal > 0 && u.Monthly+debit > p.MonthlyWithdrawal:
+		return &LimitViolation{Limit: LimitMonthlyWithdrawal, Max: p.MonthlyWithdrawal, Used: u.Monthly, Requested: debit}
+	case p.MaxOperations > 0 && u.Operations+1 > p.MaxOperations:
+		return &LimitViolation{Limit: LimitOperationCount, Max: p.MaxOperations, Used: u.Operations, Requested: 1}
+	}
+	return nil
+}
+
+// SelectLimitPolicy — политика кошелька, а если её нет — политика его типа
+func SelectLimitPolicy(policies []LimitPolicy, walletID uuid.UUID, walletType WalletType) (LimitPolicy, bool) {
+	var byType *LimitPolicy
+	for i, p := range policies {
+		if p.WalletID != nil && *p.WalletID == walletID {
+			return p, true
+		}
+		if p.WalletID == nil && p.WalletType == walletType {
+			byType = &policies[i]
+		}
+	}
+	if byType == nil {
+		return LimitPolicy{}, false
+	}
+	return *byType, true
+}
+
+// DayStart — начало календарного дня (UTC), с которого считается DailyWithdrawal
+func DayStart(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// MonthStart — начало календарного месяца (UTC), с которого считается MonthlyWithdrawal
+func MonthStart(t time.Time) time.Time {
+	y, m, _ := t.UTC().Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitPolicy_Validate(t *testing.T) {
+	walletID := uuid.New()
+	valid := []LimitPolicy{
+		{WalletType: WalletPersonal, MaxSingle: 1000},
+		{WalletID: &walletID, DailyWithdrawal: 5000, MonthlyWithdrawal: 50000},
+		{WalletType: WalletBusiness, MaxOperations: 10, OperationsWindowSeconds: 60},
+	}
+	for _, p := range valid {
+		assert.NoError(t, p.Validate(), "%+v", p)
+	}
+
+	invalid := []LimitPolicy{
+		{MaxSingle: 1000},
+		{WalletID: &walletID, WalletType: WalletPersonal, MaxSingle: 1000},
+		{WalletType: "VIP", MaxSingle: 1000},
+		{WalletType: WalletPersonal, MaxSingle: -1},
+		{WalletType: WalletPersonal, MaxOperations: 10},
+		{WalletType: WalletPersonal, OperationsWindowSeconds: 60},
+		{WalletType: WalletPersonal},
+	}
+	for _, p := range invalid {
+		assert.Error(t, p.Validate(), "%+v", p)
+	}
+}
+
+func TestLimitPolicy_Check(t *testing.T) {
+	p := LimitPolicy{MaxSingle: 1000, DailyWithdrawal: 1500, MonthlyWithdrawal: 3000, MaxOperations: 3, OperationsWindowSeconds: 60}
+
+	assert.Nil(t, p.Check(LimitUsage{}, 1000, 0))
+	assert.Equal(t, &LimitViolation{Limit: LimitMaxSingle, Max: 1000, Requested: 1001}, p.Check(LimitUsage{}, 1001, 0))
+	assert.Equal(t, &LimitViolation{Limit: LimitDailyWithdrawal, Max: 1500, Used: 600, Requested: 1000},
+		p.Check(LimitUsage{Daily: 600, Monthly: 600}, 1000, 0))
+	assert.Equal(t, LimitMonthlyWithdrawal, p.Check(LimitUsage{Monthly: 2500}, 600, 0).Limit)
+	assert.Nil(t, p.Check(LimitUsage{Operations: 2}, 1, 0))
+	assert.Equal(t, &LimitViolation{Limit: LimitOperationCount, Max: 3, Used: 3, Requested: 1}, p.Check(LimitUsage{Operations: 3}, 1, 0))
+
+	// Комиссия входит в дневной и месячный лимиты, но не в MaxSingle
+	assert.Nil(t, p.Check(LimitUsage{}, 1000, 500))
+	assert.Equal(t, &LimitViolation{Limit: LimitDailyWithdrawal, Max: 1500, Used: 400, Requested: 1110},
+		p.Check(LimitUsage{Daily: 400}, 1000, 110))
+
+	// Нулевые лимиты не ограничивают
+	assert.Nil(t, LimitPolicy{MaxSingle: 10}.Check(LimitUsage{Daily: 1 << 40, Operations: 1 << 20}, 10, 0))
+}
+
+func TestLimitUsage_Add(t *testing.T) {
+	p := LimitPolicy{DailyWithdrawal: 1, MaxOperations: 5, OperationsWindowSeconds: 3600}
+	now := time.Date(2025, 3, 5, 0, 30, 0, 0, time.UTC)
+
+	var u LimitUsage
+	u.Add(p, 100, now.Add(-10*time.Minute), now)  // сегодня, в окне
+	u.Add(p, 200, now.Add(-50*time.Minute), now)  // вчера, в окне
+	u.Add(p, 400, now.Add(-49*time.Hour), now)    // этот месяц, вне окна
+	u.Add(p, 800, now.Add(-24*10*time.Hour), now) // прошлый месяц
+
+	assert.Equal(t, LimitUsage{Daily: 100, Monthly: 700, Operations: 2}, u)
+}
+
+func TestTransaction_LimitedAmount(t *testing.T) {
+	assert.Equal(t, int64(1010), Transaction{Amount: 1000, Fee: 10}.LimitedAmount())
+	// Возврат освобождает сумму, но не комиссию
+	assert.Equal(t, int64(410), Transaction{Amount: 1000, Fee: 10, ReversedAmount: 600}.LimitedAmount())
+	assert.Equal(t, int64(10), Transaction{Amount: 1000, Fee: 10, ReversedAmount: 1000}.LimitedAmount())
+}
+
+func TestSelectLimitPolicy(t *testing.T) {
+	walletID, otherID := uuid.New(), uuid.New()
+	byType := LimitPolicy{ID: uuid.New(), WalletType: WalletBusiness, MaxSingle: 100}
+	byWallet := LimitPolicy{ID: uuid.New(), WalletID: &walletID, MaxSingle: 500}
+	policies := []LimitPolicy{byType, byWallet}
+
+	p, ok := SelectLimitPolicy(policies, walletID, WalletBusiness)
+	require.True(t, ok)
+	assert.Equal(t, byWallet.ID, p.ID)
+
+	p, ok = SelectLimitPolicy(policies, otherID, WalletBusiness)
+	require.True(t, ok)
+	assert.Equal(t, byType.ID, p.ID)
+
+	_, ok = SelectLimitPolicy(policies, otherID, WalletPersonal)
+	assert.False(t, ok)
+}
@@ -0,0 +1,51 @@
+package model
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Ограничения на метаданные операции (длины — в символах); теговые — и для меток кошелька
+const (
+	MaxExternalRefLength = 128
+	MaxDescriptionLength = 1024
+	MaxTags              = 20
+	MaxTagKeyLength      = 64
+	MaxTagValueLength    = 256
+)
+
+// Metadata — метаданные операции: внешняя ссылка, описание и теги.
+// Встраивается в WalletOperation и Transaction, в JSON поля лежат на верхнем уровне
+type Metadata struct {
+	ExternalRef string            `json:"externalRef,omitempty"` // например, ID заказа; уникальна в пределах кошелька
+	Description string            `json:"description,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+// Validate — размеры полей в пределах ограничений
+func (m Metadata) Validate() error {
+	if utf8.RuneCountInString(m.ExternalRef) > MaxExternalRefLength {
+		return fmt.Errorf("externalRef must not exceed %d characters", MaxExternalRefLength)
+	}
+	if utf8.RuneCountInString(m.Description) > MaxDescriptionLength {
+		return fmt.Errorf("description must not exceed %d characters", MaxDescriptionLength)
+	}
+	return validatePairs("tag", m.Tags)
+}
+
+// validatePairs — теги операции или метки кошелька: не больше MaxTags пар,
+// длины ключей и значений в пределах MaxTagKeyLength и MaxTagValueLength
+func validatePairs(kind string, pairs map[string]string) error {
+	if len(pairs) > MaxTags {
+		return fmt.Errorf("at most %d %ss are allowed", MaxTags, kind)
+	}
+	for k, v := range pairs {
+		if k == "" || utf8.RuneCountInString(k) > MaxTagKeyLength {
+			return fmt.Errorf("%s key must be 1 to %d characters", kind, MaxTagKeyLength)
+		}
+		if utf8.RuneCountInString(v) > MaxTagValueLength {
+			return fmt.Errorf("%s %q: value must not exceed %d characters", kind, k, MaxTagValueLength)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadata_Validate(t *testing.T) {
+	assert.NoError(t, Metadata{}.Validate())
+	assert.NoError(t, Metadata{
+		ExternalRef: strings.Repeat("з", MaxExternalRefLength), // символы, а не байты
+		Description: "оплата заказа",
+		Tags:        map[string]string{"channel": "web", "empty": ""},
+	}.Validate())
+
+	assert.Error(t, Metadata{ExternalRef: strings.Repeat("x", MaxExternalRefLength+1)}.Validate())
+	assert.Error(t, Metadata{Description: strings.Repeat("x", MaxDescriptionLength+1)}.Validate())
+	assert.Error(t, Metadata{Tags: map[string]string{"": "v"}}.Validate())
+	assert.Error(t, Metadata{Tags: map[string]string{strings.Repeat("k", MaxTagKeyLength+1): "v"}}.Validate())
+	assert.Error(t, Metadata{Tags: map[string]string{"k": strings.Repeat("v", MaxTagValueLength+1)}}.Validate())
+
+	tags := map[string]string{}
+	for i := 0; i <= MaxTags; i++ {
+		tags[fmt.Sprintf("k%d", i)] = "v"
+	}
+	assert.Error(t, Metadata{Tags: tags}.Validate())
+}
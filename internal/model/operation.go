@@ -0,0 +1,43 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+const OperationStatusAccepted = "accepted"
+
+// MaxIdempotencyKeyLength — ограничение на длину заголовка Idempotency-Key
+const MaxIdempotencyKeyLength = 255
+
+// OperationOptions — параметры проведения операции помимо её тела
+type OperationOptions struct {
+	// IdempotencyKey — значение заголовка Idempotency-Key; пусто — без идемпотентности
+	IdempotencyKey string
+	// IfMatch — значение заголовка If-Match; операция проводится, только если ETag кошелька совпадает
+	IfMatch string
+}
+
+// OperationResult — результат операции, он же тело ответа POST /api/v1/wallet.
+// Для идемпотентных запросов сохраняется в БД и отдаётся повторно.
+type OperationResult struct {
+	WalletID      uuid.UUID     `json:"walletId"`
+	OperationType OperationType `json:"operationType"`
+	Amount        int64         `json:"amount"`
+	Fee           int64         `json:"fee"` // комиссия, списанная сверх Amount
+	Currency      Currency      `json:"currency,omitempty"`
+	Status        string        `json:"status"`
+
+	Replayed bool `json:"-"` // ответ взят из сохранённого по Idempotency-Key
+}
+
+// Fingerprint — отпечаток тела операции: один Idempotency-Key
+// нельзя использовать с другим содержимым запроса
+func (op WalletOperation) Fingerprint() string {
+	data, _ := json.Marshal(op) // поля фиксированы, ключи тегов json сортирует — порядок детерминирован
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OverdraftRequest — тело POST /api/v1/admin/wallets/:uuid/overdraft
+type OverdraftRequest struct {
+	Limit  int64  `json:"limit"` // в минорных единицах; 0 — без кредитной линии
+	Reason string `json:"reason"`
+}
+
+// OverdraftChange — запись журнала изменений кредитного лимита кошелька
+type OverdraftChange struct {
+	ID        uuid.UUID `json:"id"`
+	WalletID  uuid.UUID `json:"walletId"`
+	OldLimit  int64     `json:"oldLimit"`
+	NewLimit  int64     `json:"newLimit"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CreditAvailable — неиспользованная часть кредитной линии: пока доступный
+// баланс (balance − held) не ушёл в минус, свободен весь лимит
+func CreditAvailable(available, limit int64) int64 {
+	if available >= 0 {
+		return limit
+	}
+	return limit + available
+}
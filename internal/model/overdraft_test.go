@@ -0,0 +1,15 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreditAvailable(t *testing.T) {
+	assert.Equal(t, int64(500), CreditAvailable(100, 500))
+	assert.Equal(t, int64(500), CreditAvailable(0, 500))
+	assert.Equal(t, int64(200), CreditAvailable(-300, 500))
+	assert.Zero(t, CreditAvailable(-500, 500))
+	assert.Zero(t, CreditAvailable(100, 0))
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const DefaultReconcileBatchSize = 500
+
+// ReconcileOptions — параметры сверки балансов с журналом операций
+type ReconcileOptions struct {
+	BatchSize int    `json:"batchSize"` // сколько кошельков читать за один запрос
+	Fix       bool   `json:"fix"`       // записать корректировки для расхождений
+	Reason    string `json:"reason"`    // причина корректировки, обязательна при Fix
+}
+
+// WalletSummary — кошелёк в отчёте сверки
+type WalletSummary struct {
+	WalletID uuid.UUID `json:"walletId"`
+	Balance  int64     `json:"balance"`
+}
+
+// ReconcileMismatch — баланс не совпадает с суммой операций журнала.
+// Drift = Balance − LogSum
+type ReconcileMismatch struct {
+	WalletID    uuid.UUID `json:"walletId"`
+	Balance     int64     `json:"balance"`
+	LogSum      int64     `json:"logSum"`
+	Drift       int64     `json:"drift"`
+	PostingsSum int64     `json:"postingsSum"` // сумма проводок главной книги по кошельку
+}
+
+// ReconcileFix — записанная корректировка
+type ReconcileFix struct {
+	WalletID      uuid.UUID  `json:"walletId"`
+	TransactionID uuid.UUID  `json:"transactionId"`
+	EntryID       *uuid.UUID `json:"entryId,omitempty"` // нет, если главная книга уже сходилась с балансом
+	Amount        int64      `json:"amount"`            // со знаком: > 0 — ADJUSTMENT_IN
+	Reason        string     `json:"reason"`
+}
+
+// ReconcileReport — результат сверки
+type ReconcileReport struct {
+	StartedAt      time.Time           `json:"startedAt"`
+	FinishedAt     time.Time           `json:"finishedAt"`
+	WalletsScanned int                 `json:"walletsScanned"`
+	Mismatches     []ReconcileMismatch `json:"mismatches"`
+	NoHistory      []WalletSummary     `json:"noHistory"`
+	Fixed          []ReconcileFix      `json:"fixed"`
+	DriftDetected  bool                `json:"driftDetected"` // см. HasDrift
+}
+
+// HasDrift — остались ли расхождения после сверки (исправленные не считаются).
+// Баланс ниже кредитной линии сверка не ищет: его не пропускает ограничение
+// wallets_balance_within_overdraft (миграция 0013_overdraft)
+func (r ReconcileReport) HasDrift() bool {
+	return len(r.Mismatches) > len(r.Fixed)
+}
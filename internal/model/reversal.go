@@ -0,0 +1,37 @@
+package model
+
+import "github.com/google/uuid"
+
+// ReversalRequest — тело POST /api/v1/transactions/:id/reverse.
+// Amount 0 — вернуть весь остаток исходной операции
+type ReversalRequest struct {
+	Amount int64  `json:"amount"`
+	Reason string `json:"reason"`
+}
+
+// Reversal — проведённый возврат: компенсирующие строки журнала (по одной,
+// у перевода — по одной на каждую ногу) и сколько всего возвращено по исходной операции
+type Reversal struct {
+	OriginalID     uuid.UUID     `json:"originalId"`
+	Amount         int64         `json:"amount"`
+	ReversedAmount int64         `json:"reversedAmount"`
+	Transactions   []Transaction `json:"transactions"`
+}
+
+// ReversalType — компенсирующая операция для строки журнала: возврат списания
+// зачисляет, сторно зачисления списывает. Корректировки, обмен валют
+// и сами возвраты не сторнируются
+func ReversalType(original OperationType) (OperationType, bool) {
+	switch original {
+	case OperationDeposit, OperationTransferIn:
+		return OperationReversalOut, true
+	case OperationWithdraw, OperationCapture, OperationTransferOut:
+		return OperationReversalIn, true
+	}
+	return "", false
+}
+
+// Reversible — сколько из Amount ещё можно вернуть
+func (t Transaction) Reversible() int64 {
+	return t.Amount - t.ReversedAmount
+}
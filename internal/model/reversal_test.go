@@ -0,0 +1,26 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReversalType(t *testing.T) {
+	for original, expected := range map[OperationType]OperationType{
+		OperationDeposit:     OperationReversalOut,
+		OperationTransferIn:  OperationReversalOut,
+		OperationWithdraw:    OperationReversalIn,
+		OperationCapture:     OperationReversalIn,
+		OperationTransferOut: OperationReversalIn,
+	} {
+		got, ok := ReversalType(original)
+		assert.True(t, ok, original)
+		assert.Equal(t, expected, got, original)
+		assert.Equal(t, -original.Sign(), got.Sign(), original)
+	}
+	for _, original := range []OperationType{OperationAdjustmentIn, OperationFXOut, OperationReversalIn, OperationReversalOut} {
+		_, ok := ReversalType(original)
+		assert.False(t, ok, original)
+	}
+}
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// StatementLineType — вид строки выписки
+type StatementLineType string
+
+const (
+	StatementOpening   StatementLineType = "OPENING"   // остаток на начало периода
+	StatementOperation StatementLineType = "OPERATION" // операция и остаток после неё
+	StatementClosing   StatementLineType = "CLOSING"   // остаток на конец периода
+)
+
+// StatementFormat — формат выгрузки выписки (?format=)
+type StatementFormat string
+
+const (
+	StatementCSV   StatementFormat = "csv"
+	StatementJSONL StatementFormat = "jsonl" // JSON Lines: объект StatementLine на строку
+)
+
+// StatementLine — строка выписки GET /api/v1/wallets/:uuid/statement.
+// Выписка за период [from, to) — строка OPENING, операции периода от старых
+// к новым и строка CLOSING; выписка без CLOSING оборвана.
+type StatementLine struct {
+	Type     StatementLineType `json:"type"`
+	Time     time.Time         `json:"time"`    // OPENING — from, CLOSING — to, OPERATION — createdAt операции
+	Balance  int64             `json:"balance"` // остаток после строки
+	Currency Currency          `json:"currency"`
+
+	Transaction *Transaction `json:"transaction,omitempty"` // только у OPERATION
+}
@@ -0,0 +1,59 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultTransactionsLimit = 50  // размер страницы истории по умолчанию
+	MaxTransactionsLimit     = 200 // верхняя граница limit
+)
+
+// Transaction — запись журнала операций (таблица transactions)
+type Transaction struct {
+	ID            uuid.UUID     `json:"id"`
+	WalletID      uuid.UUID     `json:"walletId"`
+	OperationType OperationType `json:"operationType"`
+	Amount        int64         `json:"amount"`
+	Fee           int64         `json:"fee,omitempty"`        // комиссия сверх Amount, списана вместе с операцией
+	TransferID    *uuid.UUID    `json:"transferId,omitempty"` // общий для обеих ног перевода
+	EntryID       *uuid.UUID    `json:"entryId,omitempty"`    // запись главной книги
+	Reason        string        `json:"reason,omitempty"`     // причина корректировки
+	HoldID        *uuid.UUID    `json:"holdId,omitempty"`     // холд, который списала операция CAPTURE
+	QuoteID       *uuid.UUID    `json:"quoteId,omitempty"`    // котировка обмена FX_OUT/FX_IN
+	FXRate        string        `json:"fxRate,omitempty"`     // курс, по которому прошёл обмен
+	CreatedAt     time.Time     `json:"createdAt"`
+
+	ReversesID     *uuid.UUID  `json:"reversesId,omitempty"`     // исходная операция, которую компенсирует REVERSAL_IN/REVERSAL_OUT
+	ReversedAmount int64       `json:"reversedAmount,omitempty"` // сколько из Amount уже возвращено
+	ReversedBy     []uuid.UUID `json:"reversedBy,omitempty"`     // строки REVERSAL_IN/REVERSAL_OUT, которые её компенсируют (только в истории)
+
+	Metadata // externalRef, description, tags операции
+}
+
+// BalanceDelta — как строка журнала изменила баланс кошелька, с учётом комиссии
+func (t Transaction) BalanceDelta() int64 {
+	return t.OperationType.Sign()*t.Amount - t.Fee
+}
+
+// TransactionFilter — параметры выборки истории операций.
+// Нулевые значения полей означают «без фильтра».
+type TransactionFilter struct {
+	OperationType OperationType
+	MinAmount     *int64     // amount >= MinAmount
+	MaxAmount     *int64     // amount <= MaxAmount
+	From          *time.Time // created_at >= From
+	To            *time.Time // created_at < To
+	Cursor        string     // непрозрачный курсор из предыдущей страницы
+	Limit         int
+
+	ExternalRef string // точное совпадение external_ref
+}
+
+// TransactionPage — страница истории, от новых операций к старым
+type TransactionPage struct {
+	Items      []Transaction `json:"items"`
+	NextCursor string        `json:"nextCursor,omitempty"` // пусто — страниц больше нет
+}
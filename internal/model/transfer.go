@@ -0,0 +1,23 @@
+package model
+
+import "github.com/google/uuid"
+
+const TransferStatusCompleted = "completed"
+
+// TransferRequest — входящий запрос на перевод между кошельками
+type TransferRequest struct {
+	FromWalletID uuid.UUID `json:"fromWalletId"`
+	ToWalletID   uuid.UUID `json:"toWalletId"`
+	Amount       int64     `json:"amount"`
+}
+
+// Transfer — проведённый перевод. TransferID связывает строки
+// TRANSFER_OUT и TRANSFER_IN в журнале операций
+type Transfer struct {
+	TransferID   uuid.UUID `json:"transferId"`
+	FromWalletID uuid.UUID `json:"fromWalletId"`
+	ToWalletID   uuid.UUID `json:"toWalletId"`
+	Amount       int64     `json:"amount"`
+	Fee          int64     `json:"fee"` // комиссия отправителя сверх Amount
+	Status       string    `json:"status"`
+}
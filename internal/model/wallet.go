@@ -12,13 +12,133 @@ type OperationType string
 const (
 	OperationDeposit  OperationType = "DEPOSIT"
 	OperationWithdraw OperationType = "WITHDRAW"
+
+	// Ноги перевода между кошельками — пишутся только в журнал, через POST /api/v1/wallet их не создать
+	OperationTransferOut OperationType = "TRANSFER_OUT"
+	OperationTransferIn  OperationType = "TRANSFER_IN"
+
+	// Корректировки сверки (cmd/reconcile --fix): объясняют расхождение журнала с балансом
+	OperationAdjustmentIn  OperationType = "ADJUSTMENT_IN"
+	OperationAdjustmentOut OperationType = "ADJUSTMENT_OUT"
+
+	// Списание ранее заблокированных средств (POST /api/v1/holds/:id/capture)
+	OperationCapture OperationType = "CAPTURE"
+
+	// Ноги обмена валют по котировке (POST /api/v1/fx/quotes/:id/execute)
+	OperationFXOut OperationType = "FX_OUT"
+	OperationFXIn  OperationType = "FX_IN"
+
+	// Возврат по проведённой операции (POST /api/v1/transactions/:id/reverse):
+	// REVERSAL_IN возвращает списание, REVERSAL_OUT сторнирует зачисление
+	OperationReversalIn  OperationType = "REVERSAL_IN"
+	OperationReversalOut OperationType = "REVERSAL_OUT"
 )
 
-// WalletOperation — входящий запрос на изменение баланса
+// CreditOperationTypes — операции журнала, увеличивающие баланс кошелька
+var CreditOperationTypes = []OperationType{OperationDeposit, OperationTransferIn, OperationAdjustmentIn, OperationFXIn, OperationReversalIn}
+
+// DebitOperationTypes — операции журнала, уменьшающие баланс кошелька
+var DebitOperationTypes = []OperationType{OperationWithdraw, OperationTransferOut, OperationAdjustmentOut, OperationCapture, OperationFXOut, OperationReversalOut}
+
+// WalletBalance — ответ GET /api/v1/wallets/:uuid.
+// Balance — деньги на кошельке по главной книге, Available — сколько из них
+// можно потратить: Balance минус действующие холды (Held). С кредитной линией
+// (OverdraftLimit) Balance и Available могут быть отрицательными, а сверх
+// Available можно списать ещё CreditAvailable
+type WalletBalance struct {
+	WalletID  uuid.UUID    `json:"walletId"`
+	Balance   int64        `json:"balance"`
+	Available int64        `json:"available"`
+	Held      int64        `json:"held"`
+	Currency  Currency     `json:"currency"`
+	Status    WalletStatus `json:"status"`
+
+	WalletType WalletType `json:"walletType"`
+
+	OverdraftLimit  int64 `json:"overdraftLimit"`
+	CreditAvailable int64 `json:"creditAvailable"`
+
+	Version int64 `json:"version"` // растёт при каждом изменении кошелька, см. ETag
+}
+
+// WalletOperation — входящий запрос на изменение баланса.
+// Amount — в минорных единицах валюты кошелька (копейки, центы).
+// Вместо него можно передать Value в основных единицах ("10.50") вместе с Currency.
 type WalletOperation struct {
 	WalletID      uuid.UUID     `json:"walletId"`
 	OperationType OperationType `json:"operationType"`
 	Amount        int64         `json:"amount"`
+	Currency      Currency      `json:"currency,omitempty"` // если указана — должна совпадать с валютой кошелька
+	Value         string        `json:"value,omitempty"`
+
+	Metadata // externalRef, description, tags
+}
+
+// CreateWalletRequest — необязательное тело POST /api/v1/wallets
+type CreateWalletRequest struct {
+	Currency   Currency   `json:"currency"`   // пусто — DefaultCurrency
+	WalletType WalletType `json:"walletType"` // пусто — DefaultWalletType
+
+	OwnerID    string            `json:"ownerId,omitempty"`    // владелец, например ID пользователя во внешней системе
+	ExternalID string            `json:"externalId,omitempty"` // уникален среди кошельков владельца
+	Labels     map[string]string `json:"labels,omitempty"`     // например, {"purpose": "bonus"}
+}
+
+// WithDefaults — запрос с заполненными значениями по умолчанию
+func (r CreateWalletRequest) WithDefaults() CreateWalletRequest {
+	if r.Currency == "" {
+		r.Currency = DefaultCurrency
+	}
+	if r.WalletType == "" {
+		r.WalletType = DefaultWalletType
+	}
+	return r
+}
+
+// WalletType — тип кошелька; от него зависят тарифы комиссий
+type WalletType string
+
+const (
+	WalletPersonal WalletType = "PERSONAL"
+	WalletBusiness WalletType = "BUSINESS"
+)
+
+// DefaultWalletType — тип кошелька, если при создании не указан
+const DefaultWalletType = WalletPersonal
+
+// IsValid — известный тип кошелька
+func (t WalletType) IsValid() bool {
+	return t == WalletPersonal || t == WalletBusiness
+}
+
+// ParseOperationType — разбор типа операции из строки (тело запроса, query-параметр)
+func ParseOperationType(s string) (OperationType, error) {
+	switch s {
+	case string(OperationDeposit), string(OperationWithdraw):
+		return OperationType(s), nil
+	default:
+		return "", fmt.Errorf("invalid operationType: %q, expected DEPOSIT or WITHDRAW", s)
+	}
+}
+
+// IsKnown — тип, который может встретиться в журнале transactions
+func (ot OperationType) IsKnown() bool {
+	return ot.Sign() != 0
+}
+
+// Sign — как операция журнала влияет на баланс: +1 зачисление, −1 списание, 0 — неизвестный тип
+func (ot OperationType) Sign() int64 {
+	for _, t := range CreditOperationTypes {
+		if t == ot {
+			return 1
+		}
+	}
+	for _, t := range DebitOperationTypes {
+		if t == ot {
+			return -1
+		}
+	}
+	return 0
 }
 
 func (ot *OperationType) UnmarshalJSON(data []byte) error {
@@ -26,13 +146,12 @@ func (ot *OperationType) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &s); err != nil {
 		return err
 	}
-	switch s {
-	case string(OperationDeposit), string(OperationWithdraw):
-		*ot = OperationType(s)
-		return nil
-	default:
-		return fmt.Errorf("invalid operationType: %q, expected DEPOSIT or WITHDRAW", s)
+	parsed, err := ParseOperationType(s)
+	if err != nil {
+		return err
 	}
+	*ot = parsed
+	return nil
 }
 
 // Custom JSON marshal (опционально, для логов/ответов)
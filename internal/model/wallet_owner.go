@@ -0,0 +1,46 @@
+package model
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Ограничения на владельца и внешний ID кошелька (в символах)
+const (
+	MaxOwnerIDLength    = 128
+	MaxExternalIDLength = 128
+)
+
+// Wallet — реквизиты кошелька без баланса: ответ POST /api/v1/wallets и поиска кошельков
+type Wallet struct {
+	ID         uuid.UUID         `json:"walletId"`
+	Currency   Currency          `json:"currency"`
+	WalletType WalletType        `json:"walletType"`
+	Status     WalletStatus      `json:"status"`
+	OwnerID    string            `json:"ownerId,omitempty"`
+	ExternalID string            `json:"externalId,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	CreatedAt  time.Time         `json:"createdAt"`
+
+	Replayed bool `json:"-"` // кошелёк с этим externalId уже был — вернули существующий
+}
+
+// ValidateOwnership — ownerId, externalId и метки в пределах ограничений
+func (r CreateWalletRequest) ValidateOwnership() error {
+	if utf8.RuneCountInString(r.OwnerID) > MaxOwnerIDLength {
+		return fmt.Errorf("ownerId must not exceed %d characters", MaxOwnerIDLength)
+	}
+	if utf8.RuneCountInString(r.ExternalID) > MaxExternalIDLength {
+		return fmt.Errorf("externalId must not exceed %d characters", MaxExternalIDLength)
+	}
+	return validatePairs("label", r.Labels)
+}
+
+// Matches — повторный запрос с тем же externalId описывает этот же кошелёк
+// (валюта и тип совпадают; метки берутся из первого запроса)
+func (w Wallet) Matches(req CreateWalletRequest) bool {
+	return w.Currency == req.Currency && w.WalletType == req.WalletType
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateWalletRequest_ValidateOwnership(t *testing.T) {
+	assert.NoError(t, CreateWalletRequest{}.ValidateOwnership())
+	assert.NoError(t, CreateWalletRequest{OwnerID: "user-42", ExternalID: "bonus", Labels: map[string]string{"purpose": "bonus"}}.ValidateOwnership())
+	assert.Error(t, CreateWalletRequest{OwnerID: strings.Repeat("x", MaxOwnerIDLength+1)}.ValidateOwnership())
+	assert.Error(t, CreateWalletRequest{ExternalID: strings.Repeat("x", MaxExternalIDLength+1)}.ValidateOwnership())
+	assert.Error(t, CreateWalletRequest{Labels: map[string]string{"": "x"}}.ValidateOwnership())
+}
+
+func TestWallet_Matches(t *testing.T) {
+	w := Wallet{Currency: "RUB", WalletType: WalletPersonal, Labels: map[string]string{"purpose": "main"}}
+	assert.True(t, w.Matches(CreateWalletRequest{Currency: "RUB", WalletType: WalletPersonal}))
+	assert.False(t, w.Matches(CreateWalletRequest{Currency: "USD", WalletType: WalletPersonal}))
+	assert.False(t, w.Matches(CreateWalletRequest{Currency: "RUB", WalletType: WalletBusiness}))
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WalletStatus — состояние кошелька
+type WalletStatus string
+
+const (
+	WalletActive WalletStatus = "ACTIVE" // операции разрешены
+	WalletFrozen WalletStatus = "FROZEN" // списания запрещены (зачисления — по FREEZE_BLOCKS_CREDITS)
+	WalletClosed WalletStatus = "CLOSED" // любые операции запрещены, статус окончательный
+)
+
+// CanTransitionTo — допустимые переходы: ACTIVE ⇄ FROZEN, ACTIVE/FROZEN → CLOSED
+func (s WalletStatus) CanTransitionTo(to WalletStatus) bool {
+	switch to {
+	case WalletFrozen:
+		return s == WalletActive
+	case WalletActive:
+		return s == WalletFrozen
+	case WalletClosed:
+		return s == WalletActive || s == WalletFrozen
+	}
+	return false
+}
+
+// StatusChangeRequest — тело POST /api/v1/admin/wallets/:uuid/{freeze,unfreeze,close}
+type StatusChangeRequest struct {
+	Reason string `json:"reason"`
+}
+
+// WalletStatusChange — запись журнала смены статусов кошелька
+type WalletStatusChange struct {
+	ID         uuid.UUID    `json:"id"`
+	WalletID   uuid.UUID    `json:"walletId"`
+	FromStatus WalletStatus `json:"fromStatus"`
+	ToStatus   WalletStatus `json:"toStatus"`
+	Reason     string       `json:"reason"`
+	CreatedAt  time.Time    `json:"createdAt"`
+}
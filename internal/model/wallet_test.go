@@ -91,3 +91,38 @@ func TestOperationType_MarshalJSON(t *testing.T) {
 	require.NoError(t, err)
 	assert.Contains(t, string(data), `"operationType":"DEPOSIT"`)
 }
+
+func TestWalletOperation_Fingerprint(t *testing.T) {
+	op := WalletOperation{
+		WalletID:      uuid.MustParse("123e4567-e89b-12d3-a456-426614174000"),
+		OperationType: OperationDeposit,
+		Amount:        1000,
+	}
+	same := op
+	other := op
+	other.Amount = 1001
+
+	assert.Equal(t, op.Fingerprint(), same.Fingerprint())
+	assert.NotEqual(t, op.Fingerprint(), other.Fingerprint())
+	assert.Len(t, op.Fingerprint(), 64) // hex sha256
+}
+
+func TestWalletStatus_CanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from, to WalletStatus
+		allowed  bool
+	}{
+		{WalletActive, WalletFrozen, true},
+		{WalletFrozen, WalletActive, true},
+		{WalletActive, WalletClosed, true},
+		{WalletFrozen, WalletClosed, true},
+		{WalletActive, WalletActive, false},
+		{WalletFrozen, WalletFrozen, false},
+		{WalletClosed, WalletActive, false},
+		{WalletClosed, WalletFrozen, false},
+		{WalletClosed, WalletClosed, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.allowed, tt.from.CanTransitionTo(tt.to), "%s → %s", tt.from, tt.to)
+	}
+}
@@ -0,0 +1,118 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Типы событий outbox
+const EventBalanceChanged = "wallet.balance_changed"
+
+const (
+	DefaultDeliveriesLimit = 50
+	MaxDeliveriesLimit     = 200
+)
+
+// BalanceChanged — данные события wallet.balance_changed.
+// OperationType — строка: OperationType при разборе JSON принимает только
+// DEPOSIT/WITHDRAW, а в событиях бывают и TRANSFER_*, и ADJUSTMENT_*
+type BalanceChanged struct {
+	WalletID      uuid.UUID  `json:"walletId"`
+	OperationType string     `json:"operationType"`
+	Amount        int64      `json:"amount"`
+	Fee           int64      `json:"fee,omitempty"`
+	Balance       int64      `json:"balance"` // баланс после операции
+	TransactionID uuid.UUID  `json:"transactionId"`
+	TransferID    *uuid.UUID `json:"transferId,omitempty"`
+}
+
+// NewBalanceChanged — событие по строке журнала операций и балансу после неё
+func NewBalanceChanged(t Transaction, balance int64) BalanceChanged {
+	return BalanceChanged{
+		WalletID:      t.WalletID,
+		OperationType: string(t.OperationType),
+		Amount:        t.Amount,
+		Fee:           t.Fee,
+		Balance:       balance,
+		TransactionID: t.ID,
+		TransferID:    t.TransferID,
+	}
+}
+
+// OutboxEvent — событие, записанное в одной транзакции с изменением баланса.
+// В таком виде оно и уходит подписчикам в теле webhook.
+type OutboxEvent struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	WalletID  uuid.UUID       `json:"walletId"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// WebhookSubscription — URL подписчика на события
+type WebhookSubscription struct {
+	ID        uuid.UUID `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"` // ключ HMAC, отдаётся только при создании
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// DeliveryStatus — состояние доставки события подписчику
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "PENDING"   // ждёт очередной попытки
+	DeliveryDelivered DeliveryStatus = "DELIVERED" // подписчик ответил 2xx
+	DeliveryDead      DeliveryStatus = "DEAD"      // попытки исчерпаны, только ручная переотправка
+)
+
+// ParseDeliveryStatus — статус из строки запроса
+func ParseDeliveryStatus(s string) (DeliveryStatus, bool) {
+	switch status := DeliveryStatus(s); status {
+	case DeliveryPending, DeliveryDelivered, DeliveryDead:
+		return status, true
+	}
+	return "", false
+}
+
+// WebhookDelivery — доставка одного события одному подписчику
+type WebhookDelivery struct {
+	ID             uuid.UUID      `json:"id"`
+	EventID        uuid.UUID      `json:"eventId"`
+	SubscriptionID uuid.UUID      `json:"subscriptionId"`
+	Status         DeliveryStatus `json:"status"`
+	Attempts       int            `json:"attempts"`
+	NextAttemptAt  time.Time      `json:"nextAttemptAt"`
+	LastStatusCode int            `json:"lastStatusCode,omitempty"`
+	LastError      string         `json:"lastError,omitempty"`
+	DeliveredAt    *time.Time     `json:"deliveredAt,omitempty"`
+	CreatedAt      time.Time      `json:"createdAt"`
+}
+
+// DeliveryTask — доставка, взятая диспетчером в работу, вместе с событием и адресатом
+type DeliveryTask struct {
+	Delivery WebhookDelivery
+	Event    OutboxEvent
+	URL      string
+	Secret   string
+}
+
+// DeliveryAttempt — итог попытки доставки. Status и NextAttemptAt
+// вычисляет диспетчер; хранилище только увеличивает счётчик попыток.
+type DeliveryAttempt struct {
+	DeliveryID    uuid.UUID
+	Status        DeliveryStatus
+	StatusCode    int
+	Error         string
+	NextAttemptAt time.Time
+	At            time.Time
+}
+
+// DeliveryFilter — фильтры GET /api/v1/webhooks/deliveries
+type DeliveryFilter struct {
+	Status         DeliveryStatus
+	SubscriptionID *uuid.UUID
+	Limit          int
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// Баланс на момент времени считается по журналу transactions: сумма операций
+// с created_at <= asOf. Чтобы не проходить журнал старого кошелька с начала,
+// фоновая задача раз в сутки пишет снимки балансов (balance_snapshots), и
+// запрос досчитывает только операции после последнего снимка не позже asOf.
+// Среди операций с одинаковым created_at последней считается операция с
+// большим id — тот же порядок, что у истории операций.
+//
+// Снимок нельзя досчитать задним числом: следующий снимок и запросы берут
+// только операции после его as_of. Поэтому операция с created_at <= as_of,
+// зафиксированная после снимка, потерялась бы навсегда. created_at пишется
+// clock_timestamp() при вставке строки, а вставка идёт после блокировки
+// строки кошелька, которая выдаёт транзакции xid. Значит, у каждой такой
+// операции xid появился раньше, чем начался снимок, и снимок дожидается
+// всех транзакций с xid меньше xmax своего начала (waitInFlight).
+
+// snapshotPollInterval — как часто waitInFlight проверяет, завершились ли транзакции
+const snapshotPollInterval = 100 * time.Millisecond
+
+// balanceAtJoinsSQL — соединения для баланса кошелька w по операциям до asOf:
+// s — последний снимок, t — сумма, число и последняя из операций после него.
+// cmp — "<=", чтобы учесть и сам момент asOf, или "<", чтобы не учитывать.
+func balanceAtJoinsSQL(asOf, cmp string) string {
+	return `
+		LEFT JOIN LATERAL (
+			SELECT as_of, balance, last_transaction_id
+			FROM balance_snapshots
+			WHERE wallet_id = w.id AND as_of ` + cmp + ` ` + asOf + `
+			ORDER BY as_of DESC
+			LIMIT 1
+		) s ON true
+		LEFT JOIN LATERAL (
+			SELECT COALESCE(SUM(` + signedAmountSQL() + `), 0)::bigint AS delta, COUNT(*) AS cnt,
+				(array_agg(id ORDER BY created_at DESC, id DESC))[1] AS last_id
+			FROM transactions
+			WHERE wallet_id = w.id
+			  AND created_at > COALESCE(s.as_of, '-infinity')
+			  AND created_at ` + cmp + ` ` + asOf + `
+		) t ON true`
+}
+
+func (r *PostgresWalletRepository) GetBalanceAsOf(ctx context.Context, walletID uuid.UUID, asOf time.Time) (model.HistoricalBalance, error) {
+	hb := model.HistoricalBalance{WalletID: walletID, AsOf: asOf}
+	sqlQuery := `
+		SELECT w.currency, COALESCE(s.balance, 0) + t.delta, COALESCE(t.last_id, s.last_transaction_id)
+		FROM wallets w` + balanceAtJoinsSQL("$2::timestamptz", "<=") + `
+		WHERE w.id = $1`
+	err := r.pool.QueryRow(ctx, sqlQuery, walletID, asOf).Scan(&hb.Currency, &hb.Balance, &hb.LastTransactionID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return hb, fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
+		}
+		return hb, fmt.Errorf("select balance as of: %w", err)
+	}
+	return hb, nil
+}
+
+// SnapshotBalances досчитывает каждый снимок от предыдущего, поэтому журнал
+// целиком проходится только при первом снимке кошелька. Повторный вызов с тем
+// же at ничего не пишет: после уже записанного снимка операций нет.
+func (r *PostgresWalletRepository) SnapshotBalances(ctx context.Context, at time.Time) (int64, error) {
+	if err := r.waitInFlight(ctx, at); err != nil {
+		return 0, err
+	}
+
+	sqlQuery := `
+		INSERT INTO balance_snapshots (wallet_id, as_of, balance, last_transaction_id)
+		SELECT w.id, $1::timestamptz, COALESCE(s.balance, 0) + t.delta, t.last_id
+		FROM wallets w` + balanceAtJoinsSQL("$1::timestamptz", "<=") + `
+		WHERE t.cnt > 0
+		ON CONFLICT (wallet_id, as_of) DO NOTHING`
+	tag, err := r.pool.Exec(ctx, sqlQuery, at)
+	if err != nil {
+		return 0, fmt.Errorf("insert balance snapshots: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// waitInFlight ждёт, пока завершатся транзакции, которые шли к моменту вызова.
+// Момент at должен быть уже в прошлом: операции, начатые после вызова,
+// получат created_at позже него.
+func (r *PostgresWalletRepository) waitInFlight(ctx context.Context, at time.Time) error {
+	var xmax string
+	var past bool
+	err := r.pool.QueryRow(ctx, `SELECT pg_snapshot_xmax(pg_current_snapshot())::text, $1::timestamptz < clock_timestamp()`, at).
+		Scan(&xmax, &past)
+	if err != nil {
+		return fmt.Errorf("select current snapshot: %w", err)
+	}
+	if !past {
+		return fmt.Errorf("%w: %s", errors.SnapshotInFuture, at.Format(time.RFC3339Nano))
+	}
+
+	ticker := time.NewTicker(snapshotPollInterval)
+	defer ticker.Stop()
+	for {
+		// xmin — самый старый xid среди незавершённых транзакций
+		var done bool
+		err := r.pool.QueryRow(ctx, `SELECT pg_snapshot_xmin(pg_current_snapshot()) >= $1::text::xid8`, xmax).Scan(&done)
+		if err != nil {
+			return fmt.Errorf("select current snapshot: %w", err)
+		}
+		if done {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("wait for in-flight transactions: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// Пакет проводится одной транзакцией БД: все его кошельки блокируются заранее,
+// по возрастанию id (как в Transfer), поэтому пакеты с общими кошельками
+// не могут взаимно заблокироваться. В режиме independent каждая операция
+// выполняется в своей точке сохранения и откатывается отдельно.
+
+func validateBatch(mode model.BatchMode, ops []model.WalletOperation) error {
+	if err := (model.BatchRequest{Mode: mode, Operations: ops}).Validate(); err != nil {
+		return fmt.Errorf("%w: %v", errors.InvalidBatch, err)
+	}
+	return nil
+}
+
+// batchWallets — кошельки пакета без повторов
+func batchWallets(ops []model.WalletOperation) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ops))
+	ids := make([]uuid.UUID, 0, len(ops))
+	for _, op := range ops {
+		if !seen[op.WalletID] {
+			seen[op.WalletID] = true
+			ids = append(ids, op.WalletID)
+		}
+	}
+	return ids
+}
+
+// abortBatch — итоги атомарного пакета, в котором операция failed не прошла:
+// остальные операции не проведены
+func abortBatch(outcomes []model.BatchOutcome, failed int) []model.BatchOutcome {
+	for i := range outcomes {
+		if i != failed {
+			outcomes[i] = model.BatchOutcome{Err: errors.BatchAborted}
+		}
+	}
+	return outcomes
+}
+
+func (r *PostgresWalletRepository) ApplyBatch(ctx context.Context, mode model.BatchMode, ops []model.WalletOperation) ([]model.BatchOutcome, error) {
+	if err := validateBatch(mode, ops); err != nil {
+		return nil, err
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// 🔒 Все кошельки пакета — до первой операции; несуществующий кошелёк
+	// станет ошибкой своей операции
+	for _, id := range lockOrder(batchWallets(ops)...) {
+		if _, err := lockWallet(ctx, tx, id); err != nil && !errors.Is(errors.WalletNotFound, err) {
+			return nil, err
+		}
+	}
+
+	outcomes := make([]model.BatchOutcome, len(ops))
+	for i, op := range ops {
+		if mode == model.BatchAtomic {
+			outcomes[i].Result, outcomes[i].Err = r.applyOperation(ctx, tx, op)
+			if outcomes[i].Err != nil {
+				return abortBatch(outcomes, i), nil
+			}
+			continue
+		}
+
+		savepoint, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("savepoint: %w", err)
+		}
+		outcomes[i].Result, outcomes[i].Err = r.applyOperation(ctx, savepoint, op)
+		if outcomes[i].Err != nil {
+			err = savepoint.Rollback(ctx)
+		} else {
+			err = savepoint.Commit(ctx)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("release savepoint: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return outcomes, nil
+}
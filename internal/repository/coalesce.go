@@ -0,0 +1,316 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fangimal/ITK/internal/config"
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// Склейка записи для сверхгорячих кошельков. Каждая операция держит блокировку
+// строки кошелька до коммита, и параллельные операции выстраиваются в очередь, поэтому
+// операции по таким кошелькам копятся в процессе и проводятся микропакетами
+// (ApplyWalletBatch): одна транзакция, одно изменение баланса, строка журнала
+// на каждую операцию. Каждая операция принимается или отклоняется по порядку,
+// с учётом предыдущих операций того же микропакета.
+
+func validateWalletBatch(walletID uuid.UUID, ops []model.WalletOperation) error {
+	if len(ops) == 0 || len(ops) > model.MaxBatchOperations {
+		return fmt.Errorf("%w: from 1 to %d operations expected, got %d", errors.InvalidBatch, model.MaxBatchOperations, len(ops))
+	}
+	for i, op := range ops {
+		if op.WalletID != walletID {
+			return fmt.Errorf("%w: operations[%d] is for wallet %s, not %s", errors.InvalidBatch, i, op.WalletID, walletID)
+		}
+	}
+	return nil
+}
+
+func (r *PostgresWalletRepository) ApplyWalletBatch(ctx context.Context, walletID uuid.UUID, ops []model.WalletOperation) ([]model.BatchOutcome, error) {
+	if err := validateWalletBatch(walletID, ops); err != nil {
+		return nil, err
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	outcomes := make([]model.BatchOutcome, len(ops))
+	wallet, err := lockWallet(ctx, tx, walletID)
+	if errors.Is(errors.WalletNotFound, err) {
+		for i := range outcomes {
+			outcomes[i].Err = err
+		}
+		return outcomes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Холды, правила комиссии и лимиты читаются один раз: под блокировкой
+	// кошелька они не изменятся, а списания микропакета учитываются по ходу
+	held, err := heldAmount(ctx, tx, walletID)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := r.feeRules(ctx, tx, model.FeeOnWithdraw, wallet)
+	if err != nil {
+		return nil, err
+	}
+	policy, usage, limited, err := r.limitUsage(ctx, tx, wallet)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	refs := make(map[string]bool)
+
+	// check — можно ли провести op при текущем балансе; возвращает комиссию
+	check := func(op model.WalletOperation) (int64, error) {
+		if err := validateMetadata(op.Metadata); err != nil {
+			return 0, err
+		}
+		isDeposit := op.OperationType == model.OperationDeposit
+		if err := checkWalletStatus(wallet, !isDeposit, r.freezeBlocksCredits); err != nil {
+			return 0, err
+		}
+		if op.Currency != "" && op.Currency != wallet.currency {
+			return 0, fmt.Errorf("%w: wallet %s, operation %s", errors.CurrencyMismatch, wallet.currency, op.Currency)
+		}
+		if refs[op.ExternalRef] {
+			return 0, fmt.Errorf("%w: %q", errors.DuplicateExternalRef, op.ExternalRef)
+		}
+		if err := checkExternalRef(ctx, tx, walletID, op.ExternalRef); err != nil {
+			return 0, err
+		}
+		if isDeposit {
+			return 0, nil
+		}
+
+		fee, err := feeFor(rules, model.FeeOnWithdraw, wallet, op.Amount)
+		if err != nil {
+			return 0, err
+		}
+		if limited {
+			if err := limitError(policy, usage, op.Amount, fee); err != nil {
+				return 0, err
+			}
+		}
+		if available := wallet.spendable(held); available < op.Amount+fee {
+			return 0, fmt.Errorf("%w: available %d, withdraw %d, fee %d", errors.InsufficientFunds, available, op.Amount, fee)
+		}
+		return fee, nil
+	}
+
+	startBalance := wallet.balance
+	for i, op := range ops {
+		fee, err := check(op)
+		if err != nil {
+			outcomes[i].Err = err
+			continue
+		}
+
+		// Баланс меняется одним UPDATE после цикла, поэтому записи главной книги — без него
+		entryType, postings := operationPostings(op, fee)
+		entryID, err := insertEntry(ctx, tx, entryType, wallet.currency, postings)
+		if err != nil {
+			return nil, err
+		}
+		t := model.Transaction{
+			WalletID:      walletID,
+			OperationType: op.OperationType,
+			Amount:        op.Amount,
+			Fee:           fee,
+			EntryID:       &entryID,
+			Metadata:      op.Metadata,
+		}
+		if t.ID, err = insertTransaction(ctx, tx, t); err != nil {
+			return nil, err
+		}
+		wallet.balance += t.BalanceDelta()
+		if err := insertOutboxEvent(ctx, tx, model.NewBalanceChanged(t, wallet.balance)); err != nil {
+			return nil, err
+		}
+
+		if op.ExternalRef != "" {
+			refs[op.ExternalRef] = true
+		}
+		if limited && op.OperationType.IsLimited() {
+			usage.Add(policy, t.LimitedAmount(), now, now)
+		}
+		outcomes[i].Result = model.OperationResult{
+			WalletID:      walletID,
+			OperationType: op.OperationType,
+			Amount:        op.Amount,
+			Fee:           fee,
+			Currency:      wallet.currency,
+			Status:        model.OperationStatusAccepted,
+		}
+	}
+
+	if delta := wallet.balance - startBalance; delta != 0 {
+		sqlQuery := `
+			UPDATE wallets
+			SET balance = balance + $1, updated_at = NOW()
+			WHERE id = $2`
+		if _, err := tx.Exec(ctx, sqlQuery, delta, walletID); err != nil {
+			return nil, fmt.Errorf("update balance: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return outcomes, nil
+}
+
+// CoalescingRepository — режим записи перед WalletRepository: DEPOSIT/WITHDRAW
+// по кошелькам из COALESCE_WALLETS копятся до COALESCE_WINDOW (или до
+// COALESCE_MAX_BATCH операций) и проводятся одним ApplyWalletBatch. Каждый
+// вызывающий получает свой результат. Остальные операции и кошельки идут
+// в обёрнутое хранилище как есть.
+type CoalescingRepository struct {
+	WalletRepository
+
+	wallets  map[uuid.UUID]bool
+	window   time.Duration
+	maxBatch int
+
+	mu     sync.Mutex
+	queues map[uuid.UUID]*coalesceQueue
+}
+
+// coalescedOp — операция в очереди и канал для её итога
+type coalescedOp struct {
+	op   model.WalletOperation
+	done chan model.BatchOutcome
+}
+
+// coalesceQueue — операции кошелька, ждущие следующего микропакета.
+// Очередь живёт, пока её разбирает горутина run.
+type coalesceQueue struct {
+	pending []coalescedOp
+	full    chan struct{} // набрался полный микропакет — не ждать конца окна
+}
+
+func NewCoalescingRepository(repo WalletRepository, cfg *config.Config) *CoalescingRepository {
+	c := &CoalescingRepository{
+		WalletRepository: repo,
+		wallets:          make(map[uuid.UUID]bool, len(cfg.CoalesceWallets)),
+		window:           cfg.CoalesceWindow,
+		maxBatch:         max(1, min(cfg.CoalesceMaxBatch, model.MaxBatchOperations)),
+		queues:           make(map[uuid.UUID]*coalesceQueue),
+	}
+	for _, id := range cfg.CoalesceWallets {
+		c.wallets[id] = true
+	}
+	return c
+}
+
+func (c *CoalescingRepository) UpdateBalance(ctx context.Context, walletID uuid.UUID, amount int64, isDeposit bool) error {
+	op := model.WalletOperation{WalletID: walletID, OperationType: model.OperationWithdraw, Amount: amount}
+	if isDeposit {
+		op.OperationType = model.OperationDeposit
+	}
+	_, err := c.ApplyOperation(ctx, op, model.OperationOptions{})
+	return err
+}
+
+// ApplyOperation ставит операцию в очередь кошелька и ждёт итога микропакета.
+// Операции с Idempotency-Key не склеиваются: ключ сохраняется в одной
+// транзакции с операцией; с If-Match — тоже: версия может смениться раньше
+// в том же микропакете. Отмена ctx прекращает ожидание, но не снимает
+// операцию, уже попавшую в микропакет.
+func (c *CoalescingRepository) ApplyOperation(ctx context.Context, op model.WalletOperation, opts model.OperationOptions) (model.OperationResult, error) {
+	if opts.IdempotencyKey != "" || opts.IfMatch != "" || !c.wallets[op.WalletID] {
+		return c.WalletRepository.ApplyOperation(ctx, op, opts)
+	}
+
+	item := coalescedOp{op: op, done: make(chan model.BatchOutcome, 1)}
+	c.enqueue(item)
+	select {
+	case outcome := <-item.done:
+		return outcome.Result, outcome.Err
+	case <-ctx.Done():
+		return model.OperationResult{}, ctx.Err()
+	}
+}
+
+// enqueue добавляет операцию в очередь кошелька; первая операция запускает её разбор
+func (c *CoalescingRepository) enqueue(item coalescedOp) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	walletID := item.op.WalletID
+	q, ok := c.queues[walletID]
+	if !ok {
+		q = &coalesceQueue{full: make(chan struct{}, 1)}
+		c.queues[walletID] = q
+		go c.run(walletID, q)
+	}
+	q.pending = append(q.pending, item)
+	if len(q.pending) >= c.maxBatch {
+		select {
+		case q.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run проводит очередь кошелька микропакетами, пока она не опустеет
+func (c *CoalescingRepository) run(walletID uuid.UUID, q *coalesceQueue) {
+	for {
+		c.mu.Lock()
+		ready := len(q.pending) >= c.maxBatch
+		c.mu.Unlock()
+		if !ready {
+			timer := time.NewTimer(c.window)
+			select {
+			case <-timer.C:
+			case <-q.full:
+				timer.Stop()
+			}
+		}
+
+		c.mu.Lock()
+		n := min(len(q.pending), c.maxBatch)
+		batch := append([]coalescedOp(nil), q.pending[:n]...)
+		q.pending = q.pending[n:]
+		c.mu.Unlock()
+
+		c.apply(walletID, batch)
+
+		c.mu.Lock()
+		if len(q.pending) == 0 {
+			delete(c.queues, walletID)
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+	}
+}
+
+// apply проводит микропакет и раздаёт итоги. Контекст — свой: микропакет
+// общий, и отмена одного запроса не должна откатывать операции других.
+func (c *CoalescingRepository) apply(walletID uuid.UUID, batch []coalescedOp) {
+	ops := make([]model.WalletOperation, len(batch))
+	for i, item := range batch {
+		ops[i] = item.op
+	}
+
+	outcomes, err := c.WalletRepository.ApplyWalletBatch(context.Background(), walletID, ops)
+	for i, item := range batch {
+		if err != nil {
+			item.done <- model.BatchOutcome{Err: err}
+			continue
+		}
+		item.done <- outcomes[i]
+	}
+}
@@ -0,0 +1,100 @@
+package repository_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fangimal/ITK/internal/config"
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/fangimal/ITK/internal/repository"
+)
+
+// batchCounter запоминает размеры микропакетов, дошедших до хранилища
+type batchCounter struct {
+	repository.WalletRepository
+
+	mu    sync.Mutex
+	sizes []int
+}
+
+func (c *batchCounter) ApplyWalletBatch(ctx context.Context, walletID uuid.UUID, ops []model.WalletOperation) ([]model.BatchOutcome, error) {
+	c.mu.Lock()
+	c.sizes = append(c.sizes, len(ops))
+	c.mu.Unlock()
+	return c.WalletRepository.ApplyWalletBatch(ctx, walletID, ops)
+}
+
+func (c *batchCounter) batches() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]int(nil), c.sizes...)
+}
+
+func TestCoalescingRepository(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{IdempotencyTTL: time.Hour, CoalesceWindow: 5 * time.Millisecond, CoalesceMaxBatch: 10}
+	counter := &batchCounter{WalletRepository: repository.NewMemoryWalletRepository(cfg)}
+
+	hot, err := counter.CreateWallet(ctx, model.CreateWalletRequest{})
+	require.NoError(t, err)
+	cold, err := counter.CreateWallet(ctx, model.CreateWalletRequest{})
+	require.NoError(t, err)
+	cfg.CoalesceWallets = []uuid.UUID{hot.ID}
+	repo := repository.NewCoalescingRepository(counter, cfg)
+
+	require.NoError(t, repo.UpdateBalance(ctx, hot.ID, 300, true))
+	require.Equal(t, []int{1}, counter.batches())
+
+	// 50 списаний по 10 при балансе 300: ровно 30 проходят, каждый получает свой итог
+	const numGoroutines = 50
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var succeeded, insufficient int
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := repo.UpdateBalance(ctx, hot.ID, 10, false)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(errors.InsufficientFunds, err):
+				insufficient++
+			default:
+				t.Errorf("❌ Неожиданная ошибка: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 30, succeeded)
+	assert.Equal(t, 20, insufficient)
+	balance, err := repo.GetBalance(ctx, hot.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), balance.Balance)
+
+	sizes := counter.batches()[1:]
+	total := 0
+	for _, n := range sizes {
+		assert.LessOrEqual(t, n, cfg.CoalesceMaxBatch)
+		total += n
+	}
+	assert.Equal(t, numGoroutines, total)
+	assert.Less(t, len(sizes), numGoroutines, "операции должны склеиваться в микропакеты")
+
+	// Другие кошельки и операции с Idempotency-Key идут в хранилище напрямую
+	require.NoError(t, repo.UpdateBalance(ctx, cold.ID, 100, true))
+	_, err = repo.ApplyOperation(ctx, model.WalletOperation{WalletID: hot.ID, OperationType: model.OperationDeposit, Amount: 5},
+		model.OperationOptions{IdempotencyKey: "coalesce-bypass"})
+	require.NoError(t, err)
+	assert.Len(t, counter.batches(), len(sizes)+1)
+}
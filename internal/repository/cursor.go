@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fangimal/ITK/internal/errors"
+)
+
+// Курсор истории — позиция последней отданной записи (created_at, id).
+// Для клиента он непрозрачен: base64 от "<created_at>|<id>".
+
+func encodeCursor(createdAt time.Time, id uuid.UUID) string {
+	raw := createdAt.UTC().Format(time.RFC3339Nano) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, fmt.Errorf("%w: %v", errors.InvalidCursor, err)
+	}
+
+	tsPart, idPart, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, uuid.Nil, errors.InvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, tsPart)
+	if err != nil {
+		return time.Time{}, uuid.Nil, fmt.Errorf("%w: %v", errors.InvalidCursor, err)
+	}
+	id, err := uuid.Parse(idPart)
+	if err != nil {
+		return time.Time{}, uuid.Nil, fmt.Errorf("%w: %v", errors.InvalidCursor, err)
+	}
+	return createdAt, id, nil
+}
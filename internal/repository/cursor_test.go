@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fangimal/ITK/internal/errors"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	createdAt := time.Date(2025, 3, 1, 12, 30, 45, 123456000, time.UTC)
+	id := uuid.New()
+
+	gotTime, gotID, err := decodeCursor(encodeCursor(createdAt, id))
+	require.NoError(t, err)
+	assert.True(t, createdAt.Equal(gotTime))
+	assert.Equal(t, id, gotID)
+}
+
+func TestCursor_Invalid(t *testing.T) {
+	for _, cursor := range []string{"!!!", "bm8tc2VwYXJhdG9y", "YWJjfGRlZg"} {
+		_, _, err := decodeCursor(cursor)
+		assert.ErrorIs(t, err, errors.InvalidCursor, cursor)
+	}
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// Комиссии считаются хранилищем под блокировкой кошелька, в той же транзакции,
+// что и операция: сумма комиссии попадает в ту же запись главной книги
+// (кошелёк → FEES) и в ту же строку журнала (transactions.fee).
+
+// withFee добавляет к проводкам зачисление комиссии на системный счёт FEES.
+// Нулевая комиссия проводок не создаёт.
+func withFee(postings []model.Posting, fee int64) []model.Posting {
+	if fee == 0 {
+		return postings
+	}
+	return append(postings, model.Posting{Account: model.SystemLedgerAccount(model.AccountFees), Amount: fee})
+}
+
+// transferPostings — проводки перевода: комиссия списывается с отправителя сверх суммы
+func transferPostings(fromID, toID uuid.UUID, amount, fee int64) []model.Posting {
+	return withFee([]model.Posting{
+		{Account: model.WalletAccount(fromID), Amount: -amount - fee},
+		{Account: model.WalletAccount(toID), Amount: amount},
+	}, fee)
+}
+
+// transferLegs — строки журнала перевода; комиссия — только у исходящей ноги
+func transferLegs(transferID, entryID, fromID, toID uuid.UUID, amount, fee int64) []model.Transaction {
+	return []model.Transaction{
+		{WalletID: fromID, OperationType: model.OperationTransferOut, Amount: amount, Fee: fee, TransferID: &transferID, EntryID: &entryID},
+		{WalletID: toID, OperationType: model.OperationTransferIn, Amount: amount, TransferID: &transferID, EntryID: &entryID},
+	}
+}
+
+func newTransfer(transferID, fromID, toID uuid.UUID, amount, fee int64) model.Transfer {
+	return model.Transfer{
+		TransferID:   transferID,
+		FromWalletID: fromID,
+		ToWalletID:   toID,
+		Amount:       amount,
+		Fee:          fee,
+		Status:       model.TransferStatusCompleted,
+	}
+}
+
+// feeFor — комиссия по самому точному из правил; нет правила — 0
+func feeFor(rules []model.FeeRule, op model.FeeOperation, w lockedWallet, amount int64) (int64, error) {
+	rule, ok := model.SelectFeeRule(rules, op, w.currency, w.walletType)
+	if !ok {
+		return 0, nil
+	}
+	fee, err := rule.Compute(amount)
+	if err != nil {
+		return 0, fmt.Errorf("compute fee: %w", err)
+	}
+	return fee, nil
+}
+
+// computeFee читает подходящие кошельку правила внутри транзакции операции
+func (r *PostgresWalletRepository) computeFee(ctx context.Context, tx pgx.Tx, op model.FeeOperation, w lockedWallet, amount int64) (int64, error) {
+	rules, err := r.feeRules(ctx, tx, op, w)
+	if err != nil {
+		return 0, err
+	}
+	return feeFor(rules, op, w, amount)
+}
+
+// feeRules — правила комиссии, которые могут подойти кошельку w
+func (r *PostgresWalletRepository) feeRules(ctx context.Context, tx pgx.Tx, op model.FeeOperation, w lockedWallet) ([]model.FeeRule, error) {
+	rows, err := tx.Query(ctx, `SELECT `+feeRuleColumns+` FROM fee_rules
+		WHERE operation = $1 AND currency IN ($2, '') AND wallet_type IN ($3, '')`,
+		string(op), string(w.currency), string(w.walletType))
+	if err != nil {
+		return nil, fmt.Errorf("select fee rules: %w", err)
+	}
+	rules, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.FeeRule, error) {
+		return scanFeeRule(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan fee rule: %w", err)
+	}
+	return rules, nil
+}
+
+const feeRuleColumns = `id, operation, currency, wallet_type, kind, fixed, COALESCE(percent::text, ''),
+	min_fee, max_fee, tiers, created_at, updated_at`
+
+func scanFeeRule(row pgx.Row) (model.FeeRule, error) {
+	var rule model.FeeRule
+	var tiers []byte
+	err := row.Scan(&rule.ID, &rule.Operation, &rule.Currency, &rule.WalletType, &rule.Kind, &rule.Fixed, &rule.Percent,
+		&rule.MinFee, &rule.MaxFee, &tiers, &rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		return rule, err
+	}
+	if err := json.Unmarshal(tiers, &rule.Tiers); err != nil {
+		return rule, fmt.Errorf("decode tiers: %w", err)
+	}
+	return rule, nil
+}
+
+func validateFeeRule(rule model.FeeRule) error {
+	if err := rule.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", errors.InvalidFeeRule, err)
+	}
+	return nil
+}
+
+func (r *PostgresWalletRepository) UpsertFeeRule(ctx context.Context, rule model.FeeRule) (model.FeeRule, error) {
+	if err := validateFeeRule(rule); err != nil {
+		return model.FeeRule{}, err
+	}
+	tiers, err := json.Marshal(rule.Tiers)
+	if err != nil {
+		return model.FeeRule{}, fmt.Errorf("encode tiers: %w", err)
+	}
+
+	sqlQuery := `
+		INSERT INTO fee_rules (operation, currency, wallet_type, kind, fixed, percent, min_fee, max_fee, tiers)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, '')::numeric, $7, $8, $9)
+		ON CONFLICT (operation, currency, wallet_type) DO UPDATE SET
+			kind = EXCLUDED.kind, fixed = EXCLUDED.fixed, percent = EXCLUDED.percent,
+			min_fee = EXCLUDED.min_fee, max_fee = EXCLUDED.max_fee, tiers = EXCLUDED.tiers,
+			updated_at = NOW()
+		RETURNING ` + feeRuleColumns
+	saved, err := scanFeeRule(r.pool.QueryRow(ctx, sqlQuery,
+		string(rule.Operation), string(rule.Currency), string(rule.WalletType), string(rule.Kind),
+		rule.Fixed, rule.Percent, rule.MinFee, rule.MaxFee, tiers))
+	if err != nil {
+		return model.FeeRule{}, fmt.Errorf("upsert fee rule: %w", err)
+	}
+	return saved, nil
+}
+
+func (r *PostgresWalletRepository) ListFeeRules(ctx context.Context) ([]model.FeeRule, error) {
+	rows, err := r.pool.Query(ctx, `SELECT `+feeRuleColumns+` FROM fee_rules ORDER BY operation, currency, wallet_type`)
+	if err != nil {
+		return nil, fmt.Errorf("select fee rules: %w", err)
+	}
+	rules, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.FeeRule, error) {
+		return scanFeeRule(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan fee rule: %w", err)
+	}
+	return rules, nil
+}
+
+func (r *PostgresWalletRepository) DeleteFeeRule(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM fee_rules WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete fee rule: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", errors.FeeRuleNotFound, id)
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fangimal/ITK/internal/config"
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// Обмен валют. Котировка фиксирует курс и обе суммы; исполнение проводит
+// две записи главной книги — по одной в каждой валюте — через системный
+// счёт FX_POSITION: кошелёк-источник → FX_POSITION, FX_POSITION → кошелёк-получатель.
+
+// fxRounding — правило округления из конфигурации; не задано — DOWN
+func fxRounding(cfg *config.Config) model.Rounding {
+	if cfg.FXRounding == "" {
+		return model.RoundDown
+	}
+	return cfg.FXRounding
+}
+
+// prepareQuote — общие для хранилищ проверки и расчёт котировки.
+// Курс rate уже найден для пары валют кошельков.
+func prepareQuote(req model.QuoteRequest, from, to model.Currency, rate string, rounding model.Rounding) (model.FXQuote, error) {
+	target, err := model.ConvertAmount(req.Amount, from, to, rate, rounding)
+	if err != nil {
+		return model.FXQuote{}, fmt.Errorf("%w: %v", errors.InvalidAmount, err)
+	}
+	if target <= 0 {
+		return model.FXQuote{}, fmt.Errorf("%w: %d %s converts to zero %s", errors.InvalidAmount, req.Amount, from, to)
+	}
+	return model.FXQuote{
+		FromWalletID: req.FromWalletID,
+		ToWalletID:   req.ToWalletID,
+		FromCurrency: from,
+		ToCurrency:   to,
+		Rate:         rate,
+		Rounding:     rounding,
+		SourceAmount: req.Amount,
+		TargetAmount: target,
+		Status:       model.QuoteOpen,
+	}, nil
+}
+
+// validateQuoteRequest — проверки запроса, не требующие хранилища
+func validateQuoteRequest(req model.QuoteRequest) error {
+	if req.FromWalletID == req.ToWalletID {
+		return errors.SameWallet
+	}
+	if req.Amount <= 0 {
+		return fmt.Errorf("%w: %d", errors.InvalidAmount, req.Amount)
+	}
+	return nil
+}
+
+// fxEntries — проводки обмена: по записи на валюту источника и получателя
+func fxEntries(q model.FXQuote) (source, target []model.Posting) {
+	position := model.SystemLedgerAccount(model.AccountFXPosition)
+	source = []model.Posting{
+		{Account: model.WalletAccount(q.FromWalletID), Amount: -q.SourceAmount},
+		{Account: position, Amount: q.SourceAmount},
+	}
+	target = []model.Posting{
+		{Account: position, Amount: -q.TargetAmount},
+		{Account: model.WalletAccount(q.ToWalletID), Amount: q.TargetAmount},
+	}
+	return source, target
+}
+
+// fxLegs — строки журнала операций обмена; курс записывается в обе
+func fxLegs(q model.FXQuote, sourceEntry, targetEntry uuid.UUID) []model.Transaction {
+	quoteID := q.ID
+	return []model.Transaction{
+		{WalletID: q.FromWalletID, OperationType: model.OperationFXOut, Amount: q.SourceAmount, EntryID: &sourceEntry, QuoteID: &quoteID, FXRate: q.Rate},
+		{WalletID: q.ToWalletID, OperationType: model.OperationFXIn, Amount: q.TargetAmount, EntryID: &targetEntry, QuoteID: &quoteID, FXRate: q.Rate},
+	}
+}
+
+func validateRates(rates []model.FXRate) error {
+	for _, rate := range rates {
+		if err := rate.Validate(); err != nil {
+			return fmt.Errorf("%w: %s/%s: %v", errors.InvalidRate, rate.Base, rate.Quote, err)
+		}
+	}
+	return nil
+}
+
+func (r *PostgresWalletRepository) UpsertFXRates(ctx context.Context, rates []model.FXRate) ([]model.FXRate, error) {
+	if err := validateRates(rates); err != nil {
+		return nil, err
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sqlQuery := `
+		INSERT INTO fx_rates (base, quote, rate)
+		VALUES ($1, $2, $3::numeric)
+		ON CONFLICT (base, quote) DO UPDATE SET rate = EXCLUDED.rate, updated_at = NOW()
+		RETURNING base, quote, rate::text, updated_at`
+	saved := make([]model.FXRate, 0, len(rates))
+	for _, rate := range rates {
+		var s model.FXRate
+		err := tx.QueryRow(ctx, sqlQuery, string(rate.Base), string(rate.Quote), rate.Rate).
+			Scan(&s.Base, &s.Quote, &s.Rate, &s.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("upsert rate: %w", err)
+		}
+		saved = append(saved, s)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return saved, nil
+}
+
+func (r *PostgresWalletRepository) ListFXRates(ctx context.Context) ([]model.FXRate, error) {
+	rows, err := r.pool.Query(ctx, `SELECT base, quote, rate::text, updated_at FROM fx_rates ORDER BY base, quote`)
+	if err != nil {
+		return nil, fmt.Errorf("select rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := []model.FXRate{}
+	for rows.Next() {
+		var rate model.FXRate
+		if err := rows.Scan(&rate.Base, &rate.Quote, &rate.Rate, &rate.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan rate: %w", err)
+		}
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
+
+const quoteColumns = `id, from_wallet_id, to_wallet_id, from_currency, to_currency, rate::text, rounding,
+	source_amount, target_amount, status, expires_at, created_at, executed_at`
+
+func scanQuote(row pgx.Row) (model.FXQuote, error) {
+	var q model.FXQuote
+	err := row.Scan(&q.ID, &q.FromWalletID, &q.ToWalletID, &q.FromCurrency, &q.ToCurrency, &q.Rate, &q.Rounding,
+		&q.SourceAmount, &q.TargetAmount, &q.Status, &q.ExpiresAt, &q.CreatedAt, &q.ExecutedAt)
+	return q, err
+}
+
+// walletCurrency — валюта кошелька без блокировки: она не меняется
+func (r *PostgresWalletRepository) walletCurrency(ctx context.Context, walletID uuid.UUID) (model.Currency, error) {
+	var currency model.Currency
+	err := r.pool.QueryRow(ctx, `SELECT currency FROM wallets WHERE id = $1`, walletID).Scan(&currency)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
+		}
+		return "", fmt.Errorf("select currency: %w", err)
+	}
+	return currency, nil
+}
+
+func (r *PostgresWalletRepository) CreateFXQuote(ctx context.Context, req model.QuoteRequest, ttl time.Duration) (model.FXQuote, error) {
+	if ttl <= 0 {
+		ttl = r.fxQuoteTTL
+	}
+	if err := validateQuoteRequest(req); err != nil {
+		return model.FXQuote{}, err
+	}
+
+	from, err := r.walletCurrency(ctx, req.FromWalletID)
+	if err != nil {
+		return model.FXQuote{}, err
+	}
+	to, err := r.walletCurrency(ctx, req.ToWalletID)
+	if err != nil {
+		return model.FXQuote{}, err
+	}
+	if from == to {
+		return model.FXQuote{}, fmt.Errorf("%w: %s", errors.SameCurrency, from)
+	}
+
+	var rate string
+	err = r.pool.QueryRow(ctx, `SELECT rate::text FROM fx_rates WHERE base = $1 AND quote = $2`, string(from), string(to)).Scan(&rate)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return model.FXQuote{}, fmt.Errorf("%w: %s/%s", errors.RateNotFound, from, to)
+		}
+		return model.FXQuote{}, fmt.Errorf("select rate: %w", err)
+	}
+
+	q, err := prepareQuote(req, from, to, rate, r.fxRounding)
+	if err != nil {
+		return model.FXQuote{}, err
+	}
+
+	sqlQuery := `
+		INSERT INTO fx_quotes (from_wallet_id, to_wallet_id, from_currency, to_currency, rate, rounding,
+			source_amount, target_amount, status, expires_at)
+		VALUES ($1, $2, $3, $4, $5::numeric, $6, $7, $8, $9, NOW() + $10::bigint * INTERVAL '1 millisecond')
+		RETURNING ` + quoteColumns
+	quote, err := scanQuote(r.pool.QueryRow(ctx, sqlQuery,
+		q.FromWalletID, q.ToWalletID, string(q.FromCurrency), string(q.ToCurrency), q.Rate, string(q.Rounding),
+		q.SourceAmount, q.TargetAmount, string(q.Status), ttl.Milliseconds()))
+	if err != nil {
+		return model.FXQuote{}, fmt.Errorf("insert quote: %w", err)
+	}
+	return quote, nil
+}
+
+func (r *PostgresWalletRepository) GetFXQuote(ctx context.Context, quoteID uuid.UUID) (model.FXQuote, error) {
+	quote, err := scanQuote(r.pool.QueryRow(ctx, `SELECT `+quoteColumns+` FROM fx_quotes WHERE id = $1`, quoteID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return quote, fmt.Errorf("%w: %s", errors.QuoteNotFound, quoteID)
+		}
+		return quote, fmt.Errorf("select quote: %w", err)
+	}
+	quote.Status = quote.EffectiveStatus(time.Now())
+	return quote, nil
+}
+
+func (r *PostgresWalletRepository) ExecuteFXQuote(ctx context.Context, quoteID uuid.UUID) (model.FXQuote, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return model.FXQuote{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var fromID, toID uuid.UUID
+	err = tx.QueryRow(ctx, `SELECT from_wallet_id, to_wallet_id FROM fx_quotes WHERE id = $1`, quoteID).Scan(&fromID, &toID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return model.FXQuote{}, fmt.Errorf("%w: %s", errors.QuoteNotFound, quoteID)
+		}
+		return model.FXQuote{}, fmt.Errorf("select quote: %w", err)
+	}
+
+	// 🔒 Как в Transfer: кошельки в фиксированном порядке, затем котировка
+	wallets := make(map[uuid.UUID]lockedWallet, 2)
+	for _, id := range lockOrder(fromID, toID) {
+		wallet, err := lockWallet(ctx, tx, id)
+		if err != nil {
+			return model.FXQuote{}, err
+		}
+		if err := checkWalletStatus(wallet, id == fromID, r.freezeBlocksCredits); err != nil {
+			return model.FXQuote{}, err
+		}
+		wallets[id] = wallet
+	}
+	q, err := scanQuote(tx.QueryRow(ctx, `SELECT `+quoteColumns+` FROM fx_quotes WHERE id = $1 FOR UPDATE`, quoteID))
+	if err != nil {
+		return model.FXQuote{}, fmt.Errorf("lock quote: %w", err)
+	}
+	if status := q.EffectiveStatus(time.Now()); status != model.QuoteOpen {
+		return model.FXQuote{}, fmt.Errorf("%w: %s is %s", errors.QuoteNotOpen, quoteID, status)
+	}
+
+	held, err := heldAmount(ctx, tx, fromID)
+	if err != nil {
+		return model.FXQuote{}, err
+	}
+	if available := wallets[fromID].spendable(held); available < q.SourceAmount {
+		return model.FXQuote{}, fmt.Errorf("%w: available %d, exchange %d", errors.InsufficientFunds, available, q.SourceAmount)
+	}
+
+	sourcePostings, targetPostings := fxEntries(q)
+	sourceEntry, err := postEntry(ctx, tx, model.EntryFX, q.FromCurrency, sourcePostings)
+	if err != nil {
+		return model.FXQuote{}, err
+	}
+	targetEntry, err := postEntry(ctx, tx, model.EntryFX, q.ToCurrency, targetPostings)
+	if err != nil {
+		return model.FXQuote{}, err
+	}
+	for _, leg := range fxLegs(q, sourceEntry, targetEntry) {
+		if leg.ID, err = insertTransaction(ctx, tx, leg); err != nil {
+			return model.FXQuote{}, err
+		}
+		newBalance := wallets[leg.WalletID].balance + leg.OperationType.Sign()*leg.Amount
+		if err := insertOutboxEvent(ctx, tx, model.NewBalanceChanged(leg, newBalance)); err != nil {
+			return model.FXQuote{}, err
+		}
+	}
+
+	sqlQuery := `
+		UPDATE fx_quotes
+		SET status = $2, executed_at = NOW()
+		WHERE id = $1
+		RETURNING ` + quoteColumns
+	q, err = scanQuote(tx.QueryRow(ctx, sqlQuery, quoteID, string(model.QuoteExecuted)))
+	if err != nil {
+		return model.FXQuote{}, fmt.Errorf("update quote: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return model.FXQuote{}, fmt.Errorf("commit: %w", err)
+	}
+	return q, nil
+}
@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// Холды блокируют часть баланса, не трогая главную книгу:
+// доступно = wallets.balance − сумма действующих холдов. Холд создаётся
+// и списывается под блокировкой строки кошелька, поэтому проверка
+// доступного баланса в applyOperation/Transfer видит все холды.
+
+// heldAmountSQL — сумма действующих холдов кошелька $1. Истёкшие
+// по времени холды не учитываются, даже если ExpireHolds ещё не отработал.
+const heldAmountSQL = `
+	SELECT COALESCE(SUM(amount), 0)
+	FROM holds
+	WHERE wallet_id = $1 AND status = 'ACTIVE' AND expires_at > NOW()`
+
+const holdColumns = `id, wallet_id, amount, captured_amount, status, expires_at, created_at, updated_at`
+
+// heldAmount — сумма действующих холдов внутри транзакции
+func heldAmount(ctx context.Context, tx pgx.Tx, walletID uuid.UUID) (int64, error) {
+	var held int64
+	if err := tx.QueryRow(ctx, heldAmountSQL, walletID).Scan(&held); err != nil {
+		return 0, fmt.Errorf("select held amount: %w", err)
+	}
+	return held, nil
+}
+
+func scanHold(row pgx.Row) (model.Hold, error) {
+	var h model.Hold
+	err := row.Scan(&h.ID, &h.WalletID, &h.Amount, &h.CapturedAmount, &h.Status, &h.ExpiresAt, &h.CreatedAt, &h.UpdatedAt)
+	return h, err
+}
+
+// CreateHold блокирует amount на кошельке на время ttl
+func (r *PostgresWalletRepository) CreateHold(ctx context.Context, walletID uuid.UUID, amount int64, ttl time.Duration) (model.Hold, error) {
+	if ttl <= 0 {
+		ttl = r.holdTTL
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return model.Hold{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// 🔒 Под блокировкой кошелька доступный баланс не изменится до коммита
+	wallet, err := lockWallet(ctx, tx, walletID)
+	if err != nil {
+		return model.Hold{}, err
+	}
+	if err := checkWalletStatus(wallet, true, r.freezeBlocksCredits); err != nil {
+		return model.Hold{}, err
+	}
+	// Холд, который заведомо не пройдёт лимиты при списании, не создаётся.
+	// Комиссия известна только при списании, там лимиты проверяются с ней
+	if err := r.checkLimits(ctx, tx, wallet, amount, 0); err != nil {
+		return model.Hold{}, err
+	}
+	held, err := heldAmount(ctx, tx, walletID)
+	if err != nil {
+		return model.Hold{}, err
+	}
+	if available := wallet.spendable(held); available < amount {
+		return model.Hold{}, fmt.Errorf("%w: available %d, hold %d", errors.InsufficientFunds, available, amount)
+	}
+
+	sqlQuery := `
+		INSERT INTO holds (wallet_id, amount, status, expires_at)
+		VALUES ($1, $2, $3, NOW() + $4::bigint * INTERVAL '1 millisecond')
+		RETURNING ` + holdColumns
+	hold, err := scanHold(tx.QueryRow(ctx, sqlQuery, walletID, amount, string(model.HoldActive), ttl.Milliseconds()))
+	if err != nil {
+		return model.Hold{}, fmt.Errorf("insert hold: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return model.Hold{}, fmt.Errorf("commit: %w", err)
+	}
+	return hold, nil
+}
+
+func (r *PostgresWalletRepository) GetHold(ctx context.Context, holdID uuid.UUID) (model.Hold, error) {
+	hold, err := scanHold(r.pool.QueryRow(ctx, `SELECT `+holdColumns+` FROM holds WHERE id = $1`, holdID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return hold, fmt.Errorf("%w: %s", errors.HoldNotFound, holdID)
+		}
+		return hold, fmt.Errorf("select hold: %w", err)
+	}
+	hold.Status = hold.EffectiveStatus(time.Now())
+	return hold, nil
+}
+
+// CaptureHold списывает заблокированные средства: операция CAPTURE в журнале
+// и запись главной книги кошелёк → EXTERNAL_CASH_OUT с комиссией на FEES, как у WITHDRAW
+func (r *PostgresWalletRepository) CaptureHold(ctx context.Context, holdID uuid.UUID, amount int64) (model.Hold, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return model.Hold{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var walletID uuid.UUID
+	err = tx.QueryRow(ctx, `SELECT wallet_id FROM holds WHERE id = $1`, holdID).Scan(&walletID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return model.Hold{}, fmt.Errorf("%w: %s", errors.HoldNotFound, holdID)
+		}
+		return model.Hold{}, fmt.Errorf("select hold: %w", err)
+	}
+
+	// 🔒 Порядок блокировок как в CreateHold: сначала кошелёк, потом холд
+	wallet, err := lockWallet(ctx, tx, walletID)
+	if err != nil {
+		return model.Hold{}, err
+	}
+	if err := checkWalletStatus(wallet, true, r.freezeBlocksCredits); err != nil {
+		return model.Hold{}, err
+	}
+	hold, err := scanHold(tx.QueryRow(ctx, `SELECT `+holdColumns+` FROM holds WHERE id = $1 FOR UPDATE`, holdID))
+	if err != nil {
+		return model.Hold{}, fmt.Errorf("lock hold: %w", err)
+	}
+
+	if status := hold.EffectiveStatus(time.Now()); status != model.HoldActive {
+		return model.Hold{}, fmt.Errorf("%w: %s is %s", errors.HoldNotActive, holdID, status)
+	}
+	if amount == 0 {
+		amount = hold.Amount
+	}
+	if amount < 0 || amount > hold.Amount {
+		return model.Hold{}, fmt.Errorf("%w: capture %d of hold %d", errors.InvalidAmount, amount, hold.Amount)
+	}
+
+	// Комиссия — по правилам WITHDRAW, сверх списываемой суммы. Холд при списании
+	// освобождается, поэтому сумма с комиссией должна уместиться в доступный
+	// баланс без учёта этого холда
+	fee, err := r.computeFee(ctx, tx, model.FeeOnWithdraw, wallet, amount)
+	if err != nil {
+		return model.Hold{}, err
+	}
+	// Лимиты проверяются ещё раз: после создания холда могли пройти другие списания
+	if err := r.checkLimits(ctx, tx, wallet, amount, fee); err != nil {
+		return model.Hold{}, err
+	}
+	held, err := heldAmount(ctx, tx, walletID)
+	if err != nil {
+		return model.Hold{}, err
+	}
+	if available := wallet.spendable(held - hold.Amount); available < amount+fee {
+		return model.Hold{}, fmt.Errorf("%w: available %d, capture %d, fee %d", errors.InsufficientFunds, available, amount, fee)
+	}
+
+	entryType, postings := captureEntry(walletID, amount, fee)
+	entryID, err := postEntry(ctx, tx, entryType, wallet.currency, postings)
+	if err != nil {
+		return model.Hold{}, err
+	}
+	t := model.Transaction{
+		WalletID:      walletID,
+		OperationType: model.OperationCapture,
+		Amount:        amount,
+		Fee:           fee,
+		EntryID:       &entryID,
+		HoldID:        &holdID,
+	}
+	if t.ID, err = insertTransaction(ctx, tx, t); err != nil {
+		return model.Hold{}, err
+	}
+	if err := insertOutboxEvent(ctx, tx, model.NewBalanceChanged(t, wallet.balance-amount-fee)); err != nil {
+		return model.Hold{}, err
+	}
+
+	sqlQuery := `
+		UPDATE holds
+		SET status = $2, captured_amount = $3, updated_at = NOW()
+		WHERE id = $1
+		RETURNING ` + holdColumns
+	hold, err = scanHold(tx.QueryRow(ctx, sqlQuery, holdID, string(model.HoldCaptured), amount))
+	if err != nil {
+		return model.Hold{}, fmt.Errorf("update hold: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return model.Hold{}, fmt.Errorf("commit: %w", err)
+	}
+	return hold, nil
+}
+
+// VoidHold отменяет действующий холд
+func (r *PostgresWalletRepository) VoidHold(ctx context.Context, holdID uuid.UUID) (model.Hold, error) {
+	sqlQuery := `
+		UPDATE holds
+		SET status = $2, updated_at = NOW()
+		WHERE id = $1 AND status = 'ACTIVE' AND expires_at > NOW()
+		RETURNING ` + holdColumns
+	hold, err := scanHold(r.pool.QueryRow(ctx, sqlQuery, holdID, string(model.HoldVoided)))
+	if err == nil {
+		return hold, nil
+	}
+	if err != pgx.ErrNoRows {
+		return hold, fmt.Errorf("void hold: %w", err)
+	}
+
+	// Холда нет либо он уже не действует
+	existing, err := r.GetHold(ctx, holdID)
+	if err != nil {
+		return existing, err
+	}
+	return existing, fmt.Errorf("%w: %s is %s", errors.HoldNotActive, holdID, existing.Status)
+}
+
+func (r *PostgresWalletRepository) ExpireHolds(ctx context.Context) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `
+		UPDATE holds
+		SET status = $1, updated_at = NOW()
+		WHERE status = 'ACTIVE' AND expires_at <= NOW()`, string(model.HoldExpired))
+	if err != nil {
+		return 0, fmt.Errorf("expire holds: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// captureEntry — проводки CAPTURE: те же, что у WITHDRAW, комиссия — на FEES
+func captureEntry(walletID uuid.UUID, amount, fee int64) (string, []model.Posting) {
+	return model.EntryCapture, withFee([]model.Posting{
+		{Account: model.WalletAccount(walletID), Amount: -amount - fee},
+		{Account: model.SystemLedgerAccount(model.AccountExternalCashOut), Amount: amount},
+	}, fee)
+}
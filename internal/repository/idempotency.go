@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// claimIdempotencyKey занимает ключ в рамках транзакции tx.
+//
+// Новый (или просроченный) ключ вставляется и остаётся заблокированным до
+// коммита: параллельный запрос с тем же ключом ждёт на ON CONFLICT и затем
+// видит уже сохранённый ответ. Если ключ жив, возвращается replay = true и
+// сохранённый ответ — либо IdempotencyKeyReused, когда отпечаток не совпал.
+func (r *PostgresWalletRepository) claimIdempotencyKey(ctx context.Context, tx pgx.Tx, key, fingerprint string) (model.OperationResult, bool, error) {
+	sqlQuery := `
+		INSERT INTO idempotency_keys (key, fingerprint, expires_at)
+		VALUES ($1, $2, NOW() + $3::bigint * INTERVAL '1 millisecond')
+		ON CONFLICT (key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint,
+		    response    = NULL,
+		    created_at  = NOW(),
+		    expires_at  = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= NOW()
+		RETURNING key`
+
+	var claimed string
+	err := tx.QueryRow(ctx, sqlQuery, key, fingerprint, r.idempotencyTTL.Milliseconds()).Scan(&claimed)
+	if err == nil {
+		return model.OperationResult{}, false, nil
+	}
+	if err != pgx.ErrNoRows {
+		return model.OperationResult{}, false, fmt.Errorf("claim idempotency key: %w", err)
+	}
+
+	// Ключ уже использован и ещё не истёк
+	var storedFingerprint string
+	var response []byte
+	sqlQuery = `SELECT fingerprint, response FROM idempotency_keys WHERE key = $1`
+	if err := tx.QueryRow(ctx, sqlQuery, key).Scan(&storedFingerprint, &response); err != nil {
+		return model.OperationResult{}, false, fmt.Errorf("select idempotency key: %w", err)
+	}
+	if storedFingerprint != fingerprint {
+		return model.OperationResult{}, false, fmt.Errorf("%w: %s", errors.IdempotencyKeyReused, key)
+	}
+
+	var result model.OperationResult
+	if err := json.Unmarshal(response, &result); err != nil {
+		return model.OperationResult{}, false, fmt.Errorf("decode stored response: %w", err)
+	}
+	result.Replayed = true
+	return result, true, nil
+}
+
+func saveIdempotentResponse(ctx context.Context, tx pgx.Tx, key string, result model.OperationResult) error {
+	response, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("encode response: %w", err)
+	}
+	sqlQuery := `UPDATE idempotency_keys SET response = $2 WHERE key = $1`
+	if _, err := tx.Exec(ctx, sqlQuery, key, response); err != nil {
+		return fmt.Errorf("save idempotent response: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpiredIdempotencyKeys удаляет просроченные ключи и возвращает их число
+func (r *PostgresWalletRepository) PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("purge idempotency keys: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// Главная книга (double-entry). Любое движение денег — запись journal_entries
+// с проводками postings, сумма которых равна нулю. Баланс кошелька хранится
+// в wallets.balance и меняется только проводками; балансы системных счетов
+// не хранятся, а считаются по postings — так пополнения разных кошельков
+// не выстраиваются в очередь за одной строкой EXTERNAL_CASH_IN.
+
+// validatePostings — запись должна затрагивать минимум два счёта и давать ноль
+func validatePostings(postings []model.Posting) error {
+	if len(postings) < 2 {
+		return fmt.Errorf("%w: need at least two postings", errors.UnbalancedEntry)
+	}
+	var sum int64
+	for _, p := range postings {
+		if p.Amount == 0 {
+			return fmt.Errorf("%w: zero posting", errors.UnbalancedEntry)
+		}
+		if (p.Account.WalletID == nil) == (p.Account.System == "") {
+			return fmt.Errorf("%w: posting must reference exactly one account", errors.UnbalancedEntry)
+		}
+		sum += p.Amount
+	}
+	if sum != 0 {
+		return fmt.Errorf("%w: postings sum to %d", errors.UnbalancedEntry, sum)
+	}
+	return nil
+}
+
+// postEntry записывает запись журнала и применяет проводки к балансам
+// кошельков. Строки кошельков к этому моменту уже должны быть заблокированы.
+func postEntry(ctx context.Context, tx pgx.Tx, entryType string, currency model.Currency, postings []model.Posting) (uuid.UUID, error) {
+	entryID, err := insertEntry(ctx, tx, entryType, currency, postings)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	for _, p := range postings {
+		if p.Account.WalletID == nil {
+			continue
+		}
+		sqlQuery := `
+			UPDATE wallets
+			SET balance = balance + $1, updated_at = NOW()
+			WHERE id = $2`
+		if _, err := tx.Exec(ctx, sqlQuery, p.Amount, *p.Account.WalletID); err != nil {
+			return uuid.Nil, fmt.Errorf("update balance: %w", err)
+		}
+	}
+	return entryID, nil
+}
+
+// insertEntry записывает запись журнала с проводками, не трогая балансы.
+// Напрямую используется корректировками сверки, когда баланс уже верен,
+// а главная книга его догоняет, и микропакетами ApplyWalletBatch, которые
+// меняют баланс одним UPDATE на все операции.
+func insertEntry(ctx context.Context, tx pgx.Tx, entryType string, currency model.Currency, postings []model.Posting) (uuid.UUID, error) {
+	if err := validatePostings(postings); err != nil {
+		return uuid.Nil, err
+	}
+
+	var entryID uuid.UUID
+	sqlQuery := `INSERT INTO journal_entries (entry_type, currency) VALUES ($1, $2) RETURNING id`
+	if err := tx.QueryRow(ctx, sqlQuery, entryType, string(currency)).Scan(&entryID); err != nil {
+		return uuid.Nil, fmt.Errorf("insert journal entry: %w", err)
+	}
+
+	for _, p := range postings {
+		var system *string
+		if p.Account.System != "" {
+			code := string(p.Account.System)
+			system = &code
+		}
+
+		sqlQuery = `
+			INSERT INTO postings (entry_id, wallet_id, system_account, amount)
+			VALUES ($1, $2, $3, $4)`
+		if _, err := tx.Exec(ctx, sqlQuery, entryID, p.Account.WalletID, system, p.Amount); err != nil {
+			return uuid.Nil, fmt.Errorf("insert posting: %w", err)
+		}
+	}
+	return entryID, nil
+}
+
+// GetJournalEntry возвращает запись журнала со всеми проводками
+func (r *PostgresWalletRepository) GetJournalEntry(ctx context.Context, entryID uuid.UUID) (model.JournalEntry, error) {
+	entry := model.JournalEntry{ID: entryID}
+
+	sqlQuery := `SELECT entry_type, currency, created_at FROM journal_entries WHERE id = $1`
+	err := r.pool.QueryRow(ctx, sqlQuery, entryID).Scan(&entry.EntryType, &entry.Currency, &entry.CreatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return entry, fmt.Errorf("%w: %s", errors.EntryNotFound, entryID)
+		}
+		return entry, fmt.Errorf("select journal entry: %w", err)
+	}
+
+	sqlQuery = `
+		SELECT wallet_id, system_account, amount
+		FROM postings
+		WHERE entry_id = $1
+		ORDER BY id`
+	rows, err := r.pool.Query(ctx, sqlQuery, entryID)
+	if err != nil {
+		return entry, fmt.Errorf("select postings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p model.Posting
+		var system *string
+		if err := rows.Scan(&p.Account.WalletID, &system, &p.Amount); err != nil {
+			return entry, fmt.Errorf("scan posting: %w", err)
+		}
+		if system != nil {
+			p.Account.System = model.SystemAccount(*system)
+		}
+		entry.Postings = append(entry.Postings, p)
+	}
+	return entry, rows.Err()
+}
+
+// CheckLedger сверяет главную книгу: каждая запись сбалансирована,
+// а wallets.balance совпадает с суммой проводок по кошельку
+func (r *PostgresWalletRepository) CheckLedger(ctx context.Context) (model.LedgerReport, error) {
+	report := model.LedgerReport{
+		UnbalancedEntries: []uuid.UUID{},
+		WalletMismatches:  []model.AccountBalance{},
+		SystemAccounts:    []model.AccountBalance{},
+	}
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT entry_id
+		FROM postings
+		GROUP BY entry_id
+		HAVING SUM(amount) <> 0`)
+	if err != nil {
+		return report, fmt.Errorf("select unbalanced entries: %w", err)
+	}
+	report.UnbalancedEntries, err = pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return report, fmt.Errorf("read unbalanced entries: %w", err)
+	}
+
+	rows, err = r.pool.Query(ctx, `
+		SELECT w.id, w.balance, COALESCE(p.total, 0)
+		FROM wallets w
+		LEFT JOIN (
+			SELECT wallet_id, SUM(amount) AS total
+			FROM postings
+			WHERE wallet_id IS NOT NULL
+			GROUP BY wallet_id
+		) p ON p.wallet_id = w.id
+		WHERE w.balance <> COALESCE(p.total, 0)
+		ORDER BY w.id`)
+	if err != nil {
+		return report, fmt.Errorf("select wallet mismatches: %w", err)
+	}
+	for rows.Next() {
+		var walletID uuid.UUID
+		var b model.AccountBalance
+		if err := rows.Scan(&walletID, &b.Balance, &b.PostingsSum); err != nil {
+			rows.Close()
+			return report, fmt.Errorf("scan wallet mismatch: %w", err)
+		}
+		b.Account = model.WalletAccount(walletID)
+		report.WalletMismatches = append(report.WalletMismatches, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("read wallet mismatches: %w", err)
+	}
+
+	// Системные счета — в разрезе валют: складывать рубли с тенге бессмысленно
+	rows, err = r.pool.Query(ctx, `
+		SELECT a.code, e.currency, COALESCE(SUM(p.amount), 0)
+		FROM ledger_system_accounts a
+		LEFT JOIN postings p ON p.system_account = a.code
+		LEFT JOIN journal_entries e ON e.id = p.entry_id
+		GROUP BY a.code, e.currency
+		ORDER BY a.code, e.currency`)
+	if err != nil {
+		return report, fmt.Errorf("select system accounts: %w", err)
+	}
+	for rows.Next() {
+		var code string
+		var currency *string
+		var b model.AccountBalance
+		if err := rows.Scan(&code, &currency, &b.PostingsSum); err != nil {
+			rows.Close()
+			return report, fmt.Errorf("scan system account: %w", err)
+		}
+		b.Account = model.SystemLedgerAccount(model.SystemAccount(code))
+		if currency != nil {
+			b.Currency = model.Currency(*currency)
+		}
+		b.Balance = b.PostingsSum // у системных счетов баланс и есть сумма проводок
+		report.SystemAccounts = append(report.SystemAccounts, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("read system accounts: %w", err)
+	}
+
+	report.Balanced = len(report.UnbalancedEntries) == 0 && len(report.WalletMismatches) == 0
+	return report, nil
+}
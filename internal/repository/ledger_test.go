@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+func TestValidatePostings(t *testing.T) {
+	wallet := model.WalletAccount(uuid.New())
+	cashIn := model.SystemLedgerAccount(model.AccountExternalCashIn)
+
+	tests := []struct {
+		name     string
+		postings []model.Posting
+		valid    bool
+	}{
+		{
+			name:     "balanced deposit",
+			postings: []model.Posting{{Account: wallet, Amount: 100}, {Account: cashIn, Amount: -100}},
+			valid:    true,
+		},
+		{
+			name:     "does not sum to zero",
+			postings: []model.Posting{{Account: wallet, Amount: 100}, {Account: cashIn, Amount: -99}},
+		},
+		{
+			name:     "single posting",
+			postings: []model.Posting{{Account: wallet, Amount: 0}},
+		},
+		{
+			name:     "zero posting",
+			postings: []model.Posting{{Account: wallet, Amount: 0}, {Account: cashIn, Amount: 0}},
+		},
+		{
+			name: "posting without account",
+			postings: []model.Posting{
+				{Account: wallet, Amount: 100},
+				{Account: model.LedgerAccount{}, Amount: -100},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePostings(tt.postings)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, errors.UnbalancedEntry)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// Лимиты на списания проверяются хранилищем под блокировкой кошелька, по истории
+// transactions: параллельные запросы к одному кошельку выстраиваются в очередь
+// на блокировке и видят списания друг друга. Суммы считаются с комиссией и за
+// вычетом возвратов, см. model.Transaction.LimitedAmount.
+
+// limitError — нарушение лимита как ошибка LIMIT_EXCEEDED; nil, если лимиты не нарушены
+func limitError(policy model.LimitPolicy, usage model.LimitUsage, amount, fee int64) error {
+	v := policy.Check(usage, amount, fee)
+	if v == nil {
+		return nil
+	}
+	return &errors.LimitError{Limit: string(v.Limit), Max: v.Max, Used: v.Used, Requested: v.Requested}
+}
+
+// limitedOperationsSQL — список LimitedOperationTypes для IN (...)
+func limitedOperationsSQL() string {
+	types := make([]string, len(model.LimitedOperationTypes))
+	for i, t := range model.LimitedOperationTypes {
+		types[i] = "'" + string(t) + "'"
+	}
+	return strings.Join(types, ", ")
+}
+
+// checkLimits — пропускают ли лимиты кошелька списание amount с комиссией fee. Вызывается
+// после lockWallet: политика и история читаются внутри транзакции операции.
+func (r *PostgresWalletRepository) checkLimits(ctx context.Context, tx pgx.Tx, w lockedWallet, amount, fee int64) error {
+	policy, usage, ok, err := r.limitUsage(ctx, tx, w)
+	if err != nil || !ok {
+		return err
+	}
+	return limitError(policy, usage, amount, fee)
+}
+
+// limitUsage — политика лимитов кошелька и списания, уже учтённые ею;
+// ok = false — политики нет
+func (r *PostgresWalletRepository) limitUsage(ctx context.Context, tx pgx.Tx, w lockedWallet) (model.LimitPolicy, model.LimitUsage, bool, error) {
+	var usage model.LimitUsage
+	policy, err := scanLimitPolicy(tx.QueryRow(ctx, `SELECT `+limitPolicyColumns+` FROM limit_policies
+		WHERE wallet_id = $1 OR wallet_type = $2
+		ORDER BY wallet_id IS NULL
+		LIMIT 1`, w.id, string(w.walletType)))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return policy, usage, false, nil
+		}
+		return policy, usage, false, fmt.Errorf("select limit policy: %w", err)
+	}
+
+	if policy.NeedsHistory() {
+		// Границы окон считает PostgreSQL: created_at пишется его же часами.
+		// Сумма — как model.Transaction.LimitedAmount
+		sqlQuery := `
+			SELECT
+				COALESCE(SUM(amount + fee - reversed_amount) FILTER (WHERE created_at >= date_trunc('day', NOW(), 'UTC')), 0),
+				COALESCE(SUM(amount + fee - reversed_amount) FILTER (WHERE created_at >= date_trunc('month', NOW(), 'UTC')), 0),
+				COUNT(*) FILTER (WHERE $2::bigint > 0 AND created_at > NOW() - $2::bigint * INTERVAL '1 second')
+			FROM transactions
+			WHERE wallet_id = $1
+			  AND operation_type IN (` + limitedOperationsSQL() + `)
+			  AND created_at >= LEAST(date_trunc('month', NOW(), 'UTC'), NOW() - $2::bigint * INTERVAL '1 second')`
+		err := tx.QueryRow(ctx, sqlQuery, w.id, policy.OperationsWindowSeconds).Scan(&usage.Daily, &usage.Monthly, &usage.Operations)
+		if err != nil {
+			return policy, usage, false, fmt.Errorf("select limit usage: %w", err)
+		}
+	}
+	return policy, usage, true, nil
+}
+
+const limitPolicyColumns = `id, wallet_id, COALESCE(wallet_type, ''), max_single, daily_withdrawal, monthly_withdrawal,
+	max_operations, operations_window_seconds, created_at, updated_at`
+
+func scanLimitPolicy(row pgx.Row) (model.LimitPolicy, error) {
+	var p model.LimitPolicy
+	err := row.Scan(&p.ID, &p.WalletID, &p.WalletType, &p.MaxSingle, &p.DailyWithdrawal, &p.MonthlyWithdrawal,
+		&p.MaxOperations, &p.OperationsWindowSeconds, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+func validateLimitPolicy(p model.LimitPolicy) error {
+	if err := p.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", errors.InvalidLimitPolicy, err)
+	}
+	return nil
+}
+
+// UpsertLimitPolicy создаёт политику или заменяет политику той же области действия
+func (r *PostgresWalletRepository) UpsertLimitPolicy(ctx context.Context, p model.LimitPolicy) (model.LimitPolicy, error) {
+	if err := validateLimitPolicy(p); err != nil {
+		return model.LimitPolicy{}, err
+	}
+
+	conflict := `(wallet_type) WHERE wallet_type IS NOT NULL`
+	var walletType *string
+	if p.WalletID != nil {
+		var exists bool
+		if err := r.pool.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM wallets WHERE id = $1)`, *p.WalletID).Scan(&exists); err != nil {
+			return model.LimitPolicy{}, fmt.Errorf("check wallet: %w", err)
+		}
+		if !exists {
+			return model.LimitPolicy{}, fmt.Errorf("%w: %s", errors.WalletNotFound, *p.WalletID)
+		}
+		conflict = `(wallet_id) WHERE wallet_id IS NOT NULL`
+	} else {
+		t := string(p.WalletType)
+		walletType = &t
+	}
+
+	sqlQuery := `
+		INSERT INTO limit_policies (wallet_id, wallet_type, max_single, daily_withdrawal, monthly_withdrawal,
+			max_operations, operations_window_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT ` + conflict + ` DO UPDATE SET
+			max_single = EXCLUDED.max_single, daily_withdrawal = EXCLUDED.daily_withdrawal,
+			monthly_withdrawal = EXCLUDED.monthly_withdrawal, max_operations = EXCLUDED.max_operations,
+			operations_window_seconds = EXCLUDED.operations_window_seconds, updated_at = NOW()
+		RETURNING ` + limitPolicyColumns
+	saved, err := scanLimitPolicy(r.pool.QueryRow(ctx, sqlQuery, p.WalletID, walletType, p.MaxSingle,
+		p.DailyWithdrawal, p.MonthlyWithdrawal, p.MaxOperations, p.OperationsWindowSeconds))
+	if err != nil {
+		return model.LimitPolicy{}, fmt.Errorf("upsert limit policy: %w", err)
+	}
+	return saved, nil
+}
+
+func (r *PostgresWalletRepository) ListLimitPolicies(ctx context.Context) ([]model.LimitPolicy, error) {
+	rows, err := r.pool.Query(ctx, `SELECT `+limitPolicyColumns+` FROM limit_policies
+		ORDER BY wallet_type NULLS LAST, wallet_id`)
+	if err != nil {
+		return nil, fmt.Errorf("select limit policies: %w", err)
+	}
+	policies, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.LimitPolicy, error) {
+		return scanLimitPolicy(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan limit policy: %w", err)
+	}
+	return policies, nil
+}
+
+func (r *PostgresWalletRepository) DeleteLimitPolicy(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM limit_policies WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete limit policy: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", errors.LimitPolicyNotFound, id)
+	}
+	return nil
+}
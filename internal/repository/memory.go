@@ -0,0 +1,1641 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/fangimal/ITK/internal/config"
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// MemoryWalletRepository — хранилище в памяти процесса (STORAGE=memory).
+// Семантика та же, что у PostgresWalletRepository; для разработки и быстрых тестов.
+// Все операции сериализуются одним мьютексом — это и есть «транзакция».
+type MemoryWalletRepository struct {
+	mu             sync.Mutex
+	wallets        map[uuid.UUID]*memoryWallet
+	transactions   map[uuid.UUID][]model.Transaction // журнал по кошелькам, в порядке записи
+	idempotency    map[string]memoryIdempotencyKey
+	entries        map[uuid.UUID]model.JournalEntry // главная книга
+	holds          map[uuid.UUID]*model.Hold
+	statusHistory  map[uuid.UUID][]model.WalletStatusChange
+	outbox         []memoryOutboxEvent
+	subscriptions  map[uuid.UUID]model.WebhookSubscription
+	deliveries     map[uuid.UUID]*model.WebhookDelivery
+	idempotencyTTL time.Duration
+	holdTTL        time.Duration
+	lastTS         time.Time // последняя выданная метка времени, см. tick
+
+	freezeBlocksCredits bool
+
+	fxRates    map[fxPair]model.FXRate
+	fxQuotes   map[uuid.UUID]*model.FXQuote
+	fxQuoteTTL time.Duration
+	fxRounding model.Rounding
+
+	feeRules map[uuid.UUID]model.FeeRule
+
+	overdraftHistory map[uuid.UUID][]model.OverdraftChange
+	limitPolicies    map[uuid.UUID]model.LimitPolicy
+
+	balanceSnapshots map[uuid.UUID][]memoryBalanceSnapshot // по возрастанию asOf
+}
+
+type memoryWallet struct {
+	balance   int64
+	currency  model.Currency
+	status    model.WalletStatus
+	createdAt time.Time
+	updatedAt time.Time
+
+	walletType model.WalletType
+
+	overdraftLimit int64
+
+	ownerID    string
+	externalID string
+	labels     map[string]string
+
+	version int64 // как wallets.version: растёт при каждом изменении кошелька
+}
+
+// touch — кошелёк изменился; аналог триггера wallets_bump_version
+func (w *memoryWallet) touch(ts time.Time) {
+	w.updatedAt = ts
+	w.version++
+}
+
+type memoryOutboxEvent struct {
+	event      model.OutboxEvent
+	dispatched bool
+}
+
+type memoryIdempotencyKey struct {
+	fingerprint string
+	response    model.OperationResult
+	expiresAt   time.Time
+}
+
+func NewMemoryWalletRepository(cfg *config.Config) *MemoryWalletRepository {
+	return &MemoryWalletRepository{
+		wallets:             make(map[uuid.UUID]*memoryWallet),
+		transactions:        make(map[uuid.UUID][]model.Transaction),
+		idempotency:         make(map[string]memoryIdempotencyKey),
+		entries:             make(map[uuid.UUID]model.JournalEntry),
+		holds:               make(map[uuid.UUID]*model.Hold),
+		statusHistory:       make(map[uuid.UUID][]model.WalletStatusChange),
+		subscriptions:       make(map[uuid.UUID]model.WebhookSubscription),
+		deliveries:          make(map[uuid.UUID]*model.WebhookDelivery),
+		idempotencyTTL:      cfg.IdempotencyTTL,
+		holdTTL:             cfg.HoldTTL,
+		freezeBlocksCredits: cfg.FreezeBlocksCredits,
+
+		fxRates:    make(map[fxPair]model.FXRate),
+		fxQuotes:   make(map[uuid.UUID]*model.FXQuote),
+		fxQuoteTTL: cfg.FXQuoteTTL,
+		fxRounding: fxRounding(cfg),
+
+		feeRules: make(map[uuid.UUID]model.FeeRule),
+
+		overdraftHistory: make(map[uuid.UUID][]model.OverdraftChange),
+		limitPolicies:    make(map[uuid.UUID]model.LimitPolicy),
+
+		balanceSnapshots: make(map[uuid.UUID][]memoryBalanceSnapshot),
+	}
+}
+
+// Close — для симметрии с PostgresWalletRepository
+func (r *MemoryWalletRepository) Close() {}
+
+// currentTime — текущее время с точностью PostgreSQL (микросекунды)
+func currentTime() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// tick — метка времени для новой записи, строго больше предыдущей: в памяти
+// операции идут быстрее микросекунды, а порядок истории должен быть стабильным.
+// Вызывается под r.mu.
+func (r *MemoryWalletRepository) tick() time.Time {
+	ts := currentTime()
+	if !ts.After(r.lastTS) {
+		ts = r.lastTS.Add(time.Microsecond)
+	}
+	r.lastTS = ts
+	return ts
+}
+
+func (r *MemoryWalletRepository) CreateWallet(ctx context.Context, req model.CreateWalletRequest) (model.Wallet, error) {
+	req, err := validateCreateWallet(req)
+	if err != nil {
+		return model.Wallet{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req.ExternalID != "" {
+		if existing, ok := r.walletByExternalID(req.OwnerID, req.ExternalID); ok {
+			return replayedWallet(existing, req)
+		}
+	}
+
+	id := uuid.New()
+	ts := r.tick()
+	r.wallets[id] = &memoryWallet{currency: req.Currency, status: model.WalletActive, createdAt: ts, updatedAt: ts, walletType: req.WalletType,
+		ownerID: req.OwnerID, externalID: req.ExternalID, labels: req.Labels, version: 1}
+	return r.wallet(id), nil
+}
+
+func (r *MemoryWalletRepository) GetBalance(ctx context.Context, walletID uuid.UUID) (model.WalletBalance, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.wallets[walletID]
+	if !ok {
+		return model.WalletBalance{WalletID: walletID}, fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
+	}
+	held := r.heldAmount(walletID)
+	return model.WalletBalance{
+		WalletID:        walletID,
+		Balance:         w.balance,
+		Available:       w.balance - held,
+		Held:            held,
+		Currency:        w.currency,
+		Status:          w.status,
+		WalletType:      w.walletType,
+		OverdraftLimit:  w.overdraftLimit,
+		CreditAvailable: model.CreditAvailable(w.balance-held, w.overdraftLimit),
+		Version:         w.version,
+	}, nil
+}
+
+func (r *MemoryWalletRepository) UpdateBalance(ctx context.Context, walletID uuid.UUID, amount int64, isDeposit bool) error {
+	op := model.WalletOperation{WalletID: walletID, OperationType: model.OperationWithdraw, Amount: amount}
+	if isDeposit {
+		op.OperationType = model.OperationDeposit
+	}
+	_, err := r.ApplyOperation(ctx, op, model.OperationOptions{})
+	return err
+}
+
+func (r *MemoryWalletRepository) ApplyOperation(ctx context.Context, op model.WalletOperation, opts model.OperationOptions) (model.OperationResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fingerprint := op.Fingerprint()
+	if opts.IdempotencyKey != "" {
+		if stored, ok := r.idempotency[opts.IdempotencyKey]; ok && stored.expiresAt.After(currentTime()) {
+			if stored.fingerprint != fingerprint {
+				return model.OperationResult{}, fmt.Errorf("%w: %s", errors.IdempotencyKeyReused, opts.IdempotencyKey)
+			}
+			result := stored.response
+			result.Replayed = true
+			return result, nil
+		}
+	}
+
+	if _, ok := r.wallets[op.WalletID]; ok && opts.IfMatch != "" {
+		if err := checkPrecondition(r.locked(op.WalletID), r.heldAmount(op.WalletID), opts.IfMatch); err != nil {
+			return model.OperationResult{}, err
+		}
+	}
+	result, err := r.applyOperation(op)
+	if err != nil {
+		return model.OperationResult{}, err
+	}
+	if opts.IdempotencyKey != "" {
+		r.idempotency[opts.IdempotencyKey] = memoryIdempotencyKey{
+			fingerprint: fingerprint,
+			response:    result,
+			expiresAt:   r.lastTS.Add(r.idempotencyTTL),
+		}
+	}
+	return result, nil
+}
+
+// applyOperation — аналог applyOperation для PostgreSQL. Вызывается под r.mu;
+// до первого изменения состояния только проверяет, поэтому ошибка ничего не меняет.
+func (r *MemoryWalletRepository) applyOperation(op model.WalletOperation) (model.OperationResult, error) {
+	w, ok := r.wallets[op.WalletID]
+	if !ok {
+		return model.OperationResult{}, fmt.Errorf("%w: %s", errors.WalletNotFound, op.WalletID)
+	}
+	if err := r.checkStatus(op.WalletID, op.OperationType != model.OperationDeposit); err != nil {
+		return model.OperationResult{}, err
+	}
+	if op.Currency != "" && op.Currency != w.currency {
+		return model.OperationResult{}, fmt.Errorf("%w: wallet %s, operation %s", errors.CurrencyMismatch, w.currency, op.Currency)
+	}
+	if err := validateMetadata(op.Metadata); err != nil {
+		return model.OperationResult{}, err
+	}
+	if op.ExternalRef != "" {
+		for _, t := range r.transactions[op.WalletID] {
+			if t.ExternalRef == op.ExternalRef {
+				return model.OperationResult{}, fmt.Errorf("%w: %q", errors.DuplicateExternalRef, op.ExternalRef)
+			}
+		}
+	}
+
+	var fee int64
+	if op.OperationType != model.OperationDeposit {
+		var err error
+		if fee, err = feeFor(r.listFeeRules(), model.FeeOnWithdraw, r.locked(op.WalletID), op.Amount); err != nil {
+			return model.OperationResult{}, err
+		}
+		if err := r.checkLimits(op.WalletID, op.Amount, fee); err != nil {
+			return model.OperationResult{}, err
+		}
+		if available := r.locked(op.WalletID).spendable(r.heldAmount(op.WalletID)); available < op.Amount+fee {
+			return model.OperationResult{}, fmt.Errorf("%w: available %d, withdraw %d, fee %d", errors.InsufficientFunds, available, op.Amount, fee)
+		}
+	}
+
+	ts := r.tick()
+	entryType, postings := operationPostings(op, fee)
+	entryID, err := r.postEntry(entryType, w.currency, postings, ts)
+	if err != nil {
+		return model.OperationResult{}, err
+	}
+	t := r.appendTransaction(model.Transaction{
+		WalletID:      op.WalletID,
+		OperationType: op.OperationType,
+		Amount:        op.Amount,
+		Fee:           fee,
+		EntryID:       &entryID,
+		Metadata:      op.Metadata,
+	}, ts)
+	r.appendOutboxEvent(model.NewBalanceChanged(t, w.balance), ts)
+
+	return model.OperationResult{
+		WalletID:      op.WalletID,
+		OperationType: op.OperationType,
+		Amount:        op.Amount,
+		Fee:           fee,
+		Currency:      w.currency,
+		Status:        model.OperationStatusAccepted,
+	}, nil
+}
+
+func (r *MemoryWalletRepository) Transfer(ctx context.Context, fromID, toID uuid.UUID, amount int64) (model.Transfer, error) {
+	if fromID == toID {
+		return model.Transfer{}, errors.SameWallet
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	from, ok := r.wallets[fromID]
+	if !ok {
+		return model.Transfer{}, fmt.Errorf("%w: %s", errors.WalletNotFound, fromID)
+	}
+	to, ok := r.wallets[toID]
+	if !ok {
+		return model.Transfer{}, fmt.Errorf("%w: %s", errors.WalletNotFound, toID)
+	}
+	if err := r.checkStatus(fromID, true); err != nil {
+		return model.Transfer{}, err
+	}
+	if err := r.checkStatus(toID, false); err != nil {
+		return model.Transfer{}, err
+	}
+	if from.currency != to.currency {
+		return model.Transfer{}, fmt.Errorf("%w: %s → %s", errors.CurrencyMismatch, from.currency, to.currency)
+	}
+	fee, err := feeFor(r.listFeeRules(), model.FeeOnTransfer, r.locked(fromID), amount)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	if err := r.checkLimits(fromID, amount, fee); err != nil {
+		return model.Transfer{}, err
+	}
+	if available := r.locked(fromID).spendable(r.heldAmount(fromID)); available < amount+fee {
+		return model.Transfer{}, fmt.Errorf("%w: available %d, transfer %d, fee %d", errors.InsufficientFunds, available, amount, fee)
+	}
+
+	ts := r.tick()
+	entryID, err := r.postEntry(model.EntryTransfer, from.currency, transferPostings(fromID, toID, amount, fee), ts)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+
+	transferID := uuid.New()
+	for _, leg := range transferLegs(transferID, entryID, fromID, toID, amount, fee) {
+		leg = r.appendTransaction(leg, ts)
+		r.appendOutboxEvent(model.NewBalanceChanged(leg, r.wallets[leg.WalletID].balance), ts)
+	}
+	return newTransfer(transferID, fromID, toID, amount, fee), nil
+}
+
+// appendTransaction дописывает операцию в журнал; ID и время проставляются здесь,
+// как их проставила бы БД
+func (r *MemoryWalletRepository) appendTransaction(t model.Transaction, ts time.Time) model.Transaction {
+	t.ID = uuid.New()
+	t.CreatedAt = ts
+	r.transactions[t.WalletID] = append(r.transactions[t.WalletID], t)
+	return t
+}
+
+// appendOutboxEvent — аналог insertOutboxEvent. Вызывается под r.mu.
+func (r *MemoryWalletRepository) appendOutboxEvent(data model.BalanceChanged, ts time.Time) {
+	payload, _ := json.Marshal(data) // только простые поля, ошибки быть не может
+	r.outbox = append(r.outbox, memoryOutboxEvent{event: model.OutboxEvent{
+		ID:        uuid.New(),
+		Type:      model.EventBalanceChanged,
+		WalletID:  data.WalletID,
+		Data:      payload,
+		CreatedAt: ts,
+	}})
+}
+
+// postEntry — аналог postEntry для PostgreSQL: запись журнала и изменение
+// балансов кошельков. Вызывается под r.mu.
+func (r *MemoryWalletRepository) postEntry(entryType string, currency model.Currency, postings []model.Posting, ts time.Time) (uuid.UUID, error) {
+	if err := validatePostings(postings); err != nil {
+		return uuid.Nil, err
+	}
+	for _, p := range postings {
+		if p.Account.WalletID == nil {
+			continue
+		}
+		if _, ok := r.wallets[*p.Account.WalletID]; !ok {
+			return uuid.Nil, fmt.Errorf("%w: %s", errors.WalletNotFound, *p.Account.WalletID)
+		}
+	}
+
+	entry := model.JournalEntry{
+		ID:        uuid.New(),
+		EntryType: entryType,
+		Currency:  currency,
+		Postings:  append([]model.Posting(nil), postings...),
+		CreatedAt: ts,
+	}
+	for _, p := range postings {
+		if p.Account.WalletID != nil {
+			w := r.wallets[*p.Account.WalletID]
+			w.balance += p.Amount
+			w.touch(ts)
+		}
+	}
+	r.entries[entry.ID] = entry
+	return entry.ID, nil
+}
+
+func (r *MemoryWalletRepository) GetJournalEntry(ctx context.Context, entryID uuid.UUID) (model.JournalEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[entryID]
+	if !ok {
+		return model.JournalEntry{ID: entryID}, fmt.Errorf("%w: %s", errors.EntryNotFound, entryID)
+	}
+	entry.Postings = append([]model.Posting(nil), entry.Postings...)
+	return entry, nil
+}
+
+func (r *MemoryWalletRepository) CheckLedger(ctx context.Context) (model.LedgerReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := model.LedgerReport{
+		UnbalancedEntries: []uuid.UUID{},
+		WalletMismatches:  []model.AccountBalance{},
+		SystemAccounts:    []model.AccountBalance{},
+	}
+
+	walletSums := make(map[uuid.UUID]int64)
+	systemSums := make(map[model.SystemAccount]map[model.Currency]int64)
+	for id, entry := range r.entries {
+		var sum int64
+		for _, p := range entry.Postings {
+			sum += p.Amount
+			if p.Account.WalletID != nil {
+				walletSums[*p.Account.WalletID] += p.Amount
+				continue
+			}
+			if systemSums[p.Account.System] == nil {
+				systemSums[p.Account.System] = make(map[model.Currency]int64)
+			}
+			systemSums[p.Account.System][entry.Currency] += p.Amount
+		}
+		if sum != 0 {
+			report.UnbalancedEntries = append(report.UnbalancedEntries, id)
+		}
+	}
+
+	for id, w := range r.wallets {
+		if w.balance != walletSums[id] {
+			report.WalletMismatches = append(report.WalletMismatches, model.AccountBalance{
+				Account:     model.WalletAccount(id),
+				Balance:     w.balance,
+				PostingsSum: walletSums[id],
+			})
+		}
+	}
+	sort.Slice(report.WalletMismatches, func(i, j int) bool {
+		a, b := report.WalletMismatches[i].Account.WalletID, report.WalletMismatches[j].Account.WalletID
+		return bytes.Compare(a[:], b[:]) < 0
+	})
+
+	codes := append([]model.SystemAccount(nil), model.SystemAccounts...)
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	for _, code := range codes {
+		// Как LEFT JOIN в PostgreSQL: счёт без проводок — одна строка без валюты
+		if len(systemSums[code]) == 0 {
+			report.SystemAccounts = append(report.SystemAccounts, model.AccountBalance{Account: model.SystemLedgerAccount(code)})
+			continue
+		}
+		currencies := make([]model.Currency, 0, len(systemSums[code]))
+		for c := range systemSums[code] {
+			currencies = append(currencies, c)
+		}
+		sort.Slice(currencies, func(i, j int) bool { return currencies[i] < currencies[j] })
+		for _, c := range currencies {
+			report.SystemAccounts = append(report.SystemAccounts, model.AccountBalance{
+				Account:     model.SystemLedgerAccount(code),
+				Currency:    c,
+				Balance:     systemSums[code][c],
+				PostingsSum: systemSums[code][c],
+			})
+		}
+	}
+
+	report.Balanced = len(report.UnbalancedEntries) == 0 && len(report.WalletMismatches) == 0
+	return report, nil
+}
+
+// Reconcile — аналог Reconcile для PostgreSQL. Кошельки обходятся в порядке id
+// под одной блокировкой, поэтому BatchSize здесь ни на что не влияет.
+func (r *MemoryWalletRepository) Reconcile(ctx context.Context, opts model.ReconcileOptions) (model.ReconcileReport, error) {
+	if opts.Fix && strings.TrimSpace(opts.Reason) == "" {
+		return model.ReconcileReport{}, errors.ReasonRequired
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := newReconcileReport()
+
+	postingsSums := make(map[uuid.UUID]int64)
+	for _, entry := range r.entries {
+		for _, p := range entry.Postings {
+			if p.Account.WalletID != nil {
+				postingsSums[*p.Account.WalletID] += p.Amount
+			}
+		}
+	}
+
+	ids := make([]uuid.UUID, 0, len(r.wallets))
+	for id := range r.wallets {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return bytes.Compare(ids[i][:], ids[j][:]) < 0 })
+
+	for _, id := range ids {
+		rr := reconcileRow{
+			walletID:    id,
+			balance:     r.wallets[id].balance,
+			logCount:    int64(len(r.transactions[id])),
+			postingsSum: postingsSums[id],
+		}
+		for _, t := range r.transactions[id] {
+			rr.logSum += t.BalanceDelta()
+		}
+
+		if !classifyReconcileRow(&report, rr) || !opts.Fix {
+			continue
+		}
+
+		ts := r.tick()
+		drift := rr.balance - rr.logSum
+		fix := model.ReconcileFix{WalletID: id, Amount: drift, Reason: opts.Reason}
+		if ledgerDrift := rr.balance - rr.postingsSum; ledgerDrift != 0 {
+			// Баланс не трогаем: главная книга догоняет его
+			entry := model.JournalEntry{
+				ID:        uuid.New(),
+				EntryType: model.EntryAdjustment,
+				Currency:  r.wallets[id].currency,
+				Postings:  adjustmentPostings(id, ledgerDrift),
+				CreatedAt: ts,
+			}
+			r.entries[entry.ID] = entry
+			fix.EntryID = &entry.ID
+		}
+		t := r.appendTransaction(adjustmentTransaction(id, drift, fix.EntryID, opts.Reason), ts)
+		fix.TransactionID = t.ID
+		report.Fixed = append(report.Fixed, fix)
+	}
+
+	finishReconcileReport(&report)
+	return report, nil
+}
+
+func (r *MemoryWalletRepository) GetTransactions(ctx context.Context, walletID uuid.UUID, filter model.TransactionFilter) (model.TransactionPage, error) {
+	page := model.TransactionPage{Items: []model.Transaction{}}
+
+	var (
+		cursorTime time.Time
+		cursorID   uuid.UUID
+	)
+	if filter.Cursor != "" {
+		var err error
+		if cursorTime, cursorID, err = decodeCursor(filter.Cursor); err != nil {
+			return page, err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.wallets[walletID]; !ok {
+		return page, fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
+	}
+
+	for _, t := range r.transactions[walletID] {
+		if filter.OperationType != "" && t.OperationType != filter.OperationType {
+			continue
+		}
+		if filter.ExternalRef != "" && t.ExternalRef != filter.ExternalRef {
+			continue
+		}
+		if filter.MinAmount != nil && t.Amount < *filter.MinAmount {
+			continue
+		}
+		if filter.MaxAmount != nil && t.Amount > *filter.MaxAmount {
+			continue
+		}
+		if filter.From != nil && t.CreatedAt.Before(*filter.From) {
+			continue
+		}
+		if filter.To != nil && !t.CreatedAt.Before(*filter.To) {
+			continue
+		}
+		if filter.Cursor != "" && !transactionBefore(t, cursorTime, cursorID) {
+			continue
+		}
+		page.Items = append(page.Items, t)
+	}
+
+	// Тот же порядок, что ORDER BY created_at DESC, id DESC
+	sort.Slice(page.Items, func(i, j int) bool {
+		return transactionBefore(page.Items[j], page.Items[i].CreatedAt, page.Items[i].ID)
+	})
+
+	limit := normalizeLimit(filter.Limit)
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	r.fillReversedBy(page.Items)
+	return page, nil
+}
+
+// fillReversedBy — аналог fillReversedBy для PostgreSQL: возвраты ищутся по
+// всему журналу, у перевода нога возврата — в журнале другого кошелька.
+// Вызывается под r.mu.
+func (r *MemoryWalletRepository) fillReversedBy(items []model.Transaction) {
+	reversed := make(map[uuid.UUID]bool)
+	for _, t := range items {
+		if t.ReversedAmount > 0 {
+			reversed[t.ID] = true
+		}
+	}
+	if len(reversed) == 0 {
+		return
+	}
+
+	var reversals []model.Transaction
+	for _, transactions := range r.transactions {
+		for _, t := range transactions {
+			if t.ReversesID != nil && reversed[*t.ReversesID] {
+				reversals = append(reversals, t)
+			}
+		}
+	}
+	// Тот же порядок, что ORDER BY created_at, id
+	sort.Slice(reversals, func(i, j int) bool {
+		return transactionBefore(reversals[i], reversals[j].CreatedAt, reversals[j].ID)
+	})
+	reversedBy := make(map[uuid.UUID][]uuid.UUID, len(reversed))
+	for _, t := range reversals {
+		reversedBy[*t.ReversesID] = append(reversedBy[*t.ReversesID], t.ID)
+	}
+	for i := range items {
+		items[i].ReversedBy = reversedBy[items[i].ID]
+	}
+}
+
+// transactionBefore — (t.CreatedAt, t.ID) < (createdAt, id), как сравнение строк в SQL
+func transactionBefore(t model.Transaction, createdAt time.Time, id uuid.UUID) bool {
+	if !t.CreatedAt.Equal(createdAt) {
+		return t.CreatedAt.Before(createdAt)
+	}
+	return bytes.Compare(t.ID[:], id[:]) < 0
+}
+
+func (r *MemoryWalletRepository) PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	ts := currentTime()
+	for key, stored := range r.idempotency {
+		if !stored.expiresAt.After(ts) {
+			delete(r.idempotency, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// === Холды ===
+
+// heldAmount — сумма действующих холдов кошелька. Вызывается под r.mu.
+func (r *MemoryWalletRepository) heldAmount(walletID uuid.UUID) int64 {
+	now := currentTime()
+	var held int64
+	for _, h := range r.holds {
+		if h.WalletID == walletID && h.EffectiveStatus(now) == model.HoldActive {
+			held += h.Amount
+		}
+	}
+	return held
+}
+
+func (r *MemoryWalletRepository) CreateHold(ctx context.Context, walletID uuid.UUID, amount int64, ttl time.Duration) (model.Hold, error) {
+	if ttl <= 0 {
+		ttl = r.holdTTL
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.wallets[walletID]; !ok {
+		return model.Hold{}, fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
+	}
+	if err := r.checkStatus(walletID, true); err != nil {
+		return model.Hold{}, err
+	}
+	if err := r.checkLimits(walletID, amount, 0); err != nil {
+		return model.Hold{}, err
+	}
+	if available := r.locked(walletID).spendable(r.heldAmount(walletID)); available < amount {
+		return model.Hold{}, fmt.Errorf("%w: available %d, hold %d", errors.InsufficientFunds, available, amount)
+	}
+
+	ts := r.tick()
+	hold := &model.Hold{
+		ID:        uuid.New(),
+		WalletID:  walletID,
+		Amount:    amount,
+		Status:    model.HoldActive,
+		ExpiresAt: ts.Add(ttl),
+		CreatedAt: ts,
+		UpdatedAt: ts,
+	}
+	r.holds[hold.ID] = hold
+	return *hold, nil
+}
+
+func (r *MemoryWalletRepository) GetHold(ctx context.Context, holdID uuid.UUID) (model.Hold, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, ok := r.holds[holdID]
+	if !ok {
+		return model.Hold{}, fmt.Errorf("%w: %s", errors.HoldNotFound, holdID)
+	}
+	hold := *h
+	hold.Status = hold.EffectiveStatus(currentTime())
+	return hold, nil
+}
+
+func (r *MemoryWalletRepository) CaptureHold(ctx context.Context, holdID uuid.UUID, amount int64) (model.Hold, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, ok := r.holds[holdID]
+	if !ok {
+		return model.Hold{}, fmt.Errorf("%w: %s", errors.HoldNotFound, holdID)
+	}
+	if status := h.EffectiveStatus(currentTime()); status != model.HoldActive {
+		return model.Hold{}, fmt.Errorf("%w: %s is %s", errors.HoldNotActive, holdID, status)
+	}
+	if amount == 0 {
+		amount = h.Amount
+	}
+	if amount < 0 || amount > h.Amount {
+		return model.Hold{}, fmt.Errorf("%w: capture %d of hold %d", errors.InvalidAmount, amount, h.Amount)
+	}
+	if err := r.checkStatus(h.WalletID, true); err != nil {
+		return model.Hold{}, err
+	}
+	w := r.wallets[h.WalletID]
+	fee, err := feeFor(r.listFeeRules(), model.FeeOnWithdraw, r.locked(h.WalletID), amount)
+	if err != nil {
+		return model.Hold{}, err
+	}
+	if err := r.checkLimits(h.WalletID, amount, fee); err != nil {
+		return model.Hold{}, err
+	}
+	if available := r.locked(h.WalletID).spendable(r.heldAmount(h.WalletID) - h.Amount); available < amount+fee {
+		return model.Hold{}, fmt.Errorf("%w: available %d, capture %d, fee %d", errors.InsufficientFunds, available, amount, fee)
+	}
+
+	ts := r.tick()
+	entryType, postings := captureEntry(h.WalletID, amount, fee)
+	entryID, err := r.postEntry(entryType, w.currency, postings, ts)
+	if err != nil {
+		return model.Hold{}, err
+	}
+	id := holdID
+	t := r.appendTransaction(model.Transaction{
+		WalletID:      h.WalletID,
+		OperationType: model.OperationCapture,
+		Amount:        amount,
+		Fee:           fee,
+		EntryID:       &entryID,
+		HoldID:        &id,
+	}, ts)
+	r.appendOutboxEvent(model.NewBalanceChanged(t, w.balance), ts)
+
+	h.Status = model.HoldCaptured
+	h.CapturedAmount = amount
+	h.UpdatedAt = ts
+	return *h, nil
+}
+
+func (r *MemoryWalletRepository) VoidHold(ctx context.Context, holdID uuid.UUID) (model.Hold, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, ok := r.holds[holdID]
+	if !ok {
+		return model.Hold{}, fmt.Errorf("%w: %s", errors.HoldNotFound, holdID)
+	}
+	if status := h.EffectiveStatus(currentTime()); status != model.HoldActive {
+		hold := *h
+		hold.Status = status
+		return hold, fmt.Errorf("%w: %s is %s", errors.HoldNotActive, holdID, status)
+	}
+	h.Status = model.HoldVoided
+	h.UpdatedAt = r.tick()
+	return *h, nil
+}
+
+func (r *MemoryWalletRepository) ExpireHolds(ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := currentTime()
+	var n int64
+	for _, h := range r.holds {
+		if h.Status == model.HoldActive && !h.ExpiresAt.After(now) {
+			h.Status = model.HoldExpired
+			h.UpdatedAt = r.tick()
+			n++
+		}
+	}
+	return n, nil
+}
+
+// === Статусы кошельков ===
+
+// locked — кошелёк из r.wallets в виде, который вернул бы lockWallet. Вызывается под r.mu.
+func (r *MemoryWalletRepository) locked(walletID uuid.UUID) lockedWallet {
+	w := r.wallets[walletID]
+	return lockedWallet{id: walletID, balance: w.balance, currency: w.currency, status: w.status, walletType: w.walletType, overdraftLimit: w.overdraftLimit,
+		version: w.version}
+}
+
+// checkStatus — аналог checkWalletStatus для кошелька из r.wallets. Вызывается под r.mu.
+func (r *MemoryWalletRepository) checkStatus(walletID uuid.UUID, debit bool) error {
+	return checkWalletStatus(r.locked(walletID), debit, r.freezeBlocksCredits)
+}
+
+func (r *MemoryWalletRepository) ChangeWalletStatus(ctx context.Context, walletID uuid.UUID, to model.WalletStatus, reason string) (model.WalletStatusChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.wallets[walletID]
+	if !ok {
+		return model.WalletStatusChange{}, fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
+	}
+	if err := validateStatusChange(r.locked(walletID), r.heldAmount(walletID), to, reason); err != nil {
+		return model.WalletStatusChange{}, err
+	}
+
+	ts := r.tick()
+	change := model.WalletStatusChange{
+		ID:         uuid.New(),
+		WalletID:   walletID,
+		FromStatus: w.status,
+		ToStatus:   to,
+		Reason:     reason,
+		CreatedAt:  ts,
+	}
+	w.status = to
+	w.touch(ts)
+	r.statusHistory[walletID] = append(r.statusHistory[walletID], change)
+	return change, nil
+}
+
+func (r *MemoryWalletRepository) GetWalletStatusHistory(ctx context.Context, walletID uuid.UUID) ([]model.WalletStatusChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.wallets[walletID]; !ok {
+		return nil, fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
+	}
+	return append([]model.WalletStatusChange{}, r.statusHistory[walletID]...), nil
+}
+
+// === Кредитные линии ===
+
+func (r *MemoryWalletRepository) SetOverdraftLimit(ctx context.Context, walletID uuid.UUID, limit int64, reason string) (model.OverdraftChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.wallets[walletID]
+	if !ok {
+		return model.OverdraftChange{}, fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
+	}
+	if err := validateOverdraftChange(r.locked(walletID), limit, reason); err != nil {
+		return model.OverdraftChange{}, err
+	}
+
+	ts := r.tick()
+	change := model.OverdraftChange{
+		ID:        uuid.New(),
+		WalletID:  walletID,
+		OldLimit:  w.overdraftLimit,
+		NewLimit:  limit,
+		Reason:    reason,
+		CreatedAt: ts,
+	}
+	w.overdraftLimit = limit
+	w.touch(ts)
+	r.overdraftHistory[walletID] = append(r.overdraftHistory[walletID], change)
+	return change, nil
+}
+
+func (r *MemoryWalletRepository) GetOverdraftHistory(ctx context.Context, walletID uuid.UUID) ([]model.OverdraftChange, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.wallets[walletID]; !ok {
+		return nil, fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
+	}
+	return append([]model.OverdraftChange{}, r.overdraftHistory[walletID]...), nil
+}
+
+// === Лимиты на списания ===
+
+// checkLimits — аналог checkLimits для PostgreSQL. Вызывается под r.mu.
+func (r *MemoryWalletRepository) checkLimits(walletID uuid.UUID, amount, fee int64) error {
+	policies := make([]model.LimitPolicy, 0, len(r.limitPolicies))
+	for _, p := range r.limitPolicies {
+		policies = append(policies, p)
+	}
+	policy, ok := model.SelectLimitPolicy(policies, walletID, r.wallets[walletID].walletType)
+	if !ok {
+		return nil
+	}
+
+	var usage model.LimitUsage
+	now := currentTime()
+	for _, t := range r.transactions[walletID] {
+		if t.OperationType.IsLimited() {
+			usage.Add(policy, t.LimitedAmount(), t.CreatedAt, now)
+		}
+	}
+	return limitError(policy, usage, amount, fee)
+}
+
+func (r *MemoryWalletRepository) UpsertLimitPolicy(ctx context.Context, p model.LimitPolicy) (model.LimitPolicy, error) {
+	if err := validateLimitPolicy(p); err != nil {
+		return model.LimitPolicy{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if p.WalletID != nil {
+		if _, ok := r.wallets[*p.WalletID]; !ok {
+			return model.LimitPolicy{}, fmt.Errorf("%w: %s", errors.WalletNotFound, *p.WalletID)
+		}
+	}
+
+	ts := r.tick()
+	p.ID, p.CreatedAt, p.UpdatedAt = uuid.New(), ts, ts
+	for id, existing := range r.limitPolicies {
+		sameWallet := p.WalletID != nil && existing.WalletID != nil && *existing.WalletID == *p.WalletID
+		sameType := p.WalletID == nil && existing.WalletID == nil && existing.WalletType == p.WalletType
+		if sameWallet || sameType {
+			p.ID, p.CreatedAt = id, existing.CreatedAt
+			break
+		}
+	}
+	r.limitPolicies[p.ID] = p
+	return p, nil
+}
+
+func (r *MemoryWalletRepository) ListLimitPolicies(ctx context.Context) ([]model.LimitPolicy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	policies := make([]model.LimitPolicy, 0, len(r.limitPolicies))
+	for _, p := range r.limitPolicies {
+		policies = append(policies, p)
+	}
+	// Как в PostgreSQL: политики типов, затем политики кошельков
+	sort.Slice(policies, func(i, j int) bool {
+		a, b := policies[i], policies[j]
+		if (a.WalletID == nil) != (b.WalletID == nil) {
+			return a.WalletID == nil
+		}
+		if a.WalletID == nil {
+			return a.WalletType < b.WalletType
+		}
+		return bytes.Compare(a.WalletID[:], b.WalletID[:]) < 0
+	})
+	return policies, nil
+}
+
+func (r *MemoryWalletRepository) DeleteLimitPolicy(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.limitPolicies[id]; !ok {
+		return fmt.Errorf("%w: %s", errors.LimitPolicyNotFound, id)
+	}
+	delete(r.limitPolicies, id)
+	return nil
+}
+
+// === Пакеты операций ===
+
+// memoryBatchSnapshot — то, что меняет applyOperation: кошельки пакета,
+// длины их журналов и outbox. Нужен для отката атомарного пакета
+type memoryBatchSnapshot struct {
+	wallets map[uuid.UUID]memoryWallet
+	journal map[uuid.UUID]int
+	outbox  int
+}
+
+// snapshot — состояние кошельков ids. Вызывается под r.mu.
+func (r *MemoryWalletRepository) snapshot(ids []uuid.UUID) memoryBatchSnapshot {
+	s := memoryBatchSnapshot{wallets: map[uuid.UUID]memoryWallet{}, journal: map[uuid.UUID]int{}, outbox: len(r.outbox)}
+	for _, id := range ids {
+		if w, ok := r.wallets[id]; ok {
+			s.wallets[id] = *w
+			s.journal[id] = len(r.transactions[id])
+		}
+	}
+	return s
+}
+
+// restore откатывает изменения после snapshot вместе с записями главной книги. Вызывается под r.mu.
+func (r *MemoryWalletRepository) restore(s memoryBatchSnapshot) {
+	for id, w := range s.wallets {
+		for _, t := range r.transactions[id][s.journal[id]:] {
+			if t.EntryID != nil {
+				delete(r.entries, *t.EntryID)
+			}
+		}
+		r.transactions[id] = r.transactions[id][:s.journal[id]]
+		*r.wallets[id] = w
+	}
+	r.outbox = r.outbox[:s.outbox]
+}
+
+func (r *MemoryWalletRepository) ApplyBatch(ctx context.Context, mode model.BatchMode, ops []model.WalletOperation) ([]model.BatchOutcome, error) {
+	if err := validateBatch(mode, ops); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	before := r.snapshot(batchWallets(ops))
+	outcomes := make([]model.BatchOutcome, len(ops))
+	for i, op := range ops {
+		outcomes[i].Result, outcomes[i].Err = r.applyOperation(op)
+		if outcomes[i].Err != nil && mode == model.BatchAtomic {
+			r.restore(before)
+			return abortBatch(outcomes, i), nil
+		}
+	}
+	return outcomes, nil
+}
+
+// ApplyWalletBatch — в памяти операции и так проводятся под одной блокировкой
+func (r *MemoryWalletRepository) ApplyWalletBatch(ctx context.Context, walletID uuid.UUID, ops []model.WalletOperation) ([]model.BatchOutcome, error) {
+	if err := validateWalletBatch(walletID, ops); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	outcomes := make([]model.BatchOutcome, len(ops))
+	for i, op := range ops {
+		outcomes[i].Result, outcomes[i].Err = r.applyOperation(op)
+	}
+	return outcomes, nil
+}
+
+// === Владельцы и внешние ID ===
+
+// wallet — кошелёк из r.wallets в виде model.Wallet. Вызывается под r.mu.
+func (r *MemoryWalletRepository) wallet(id uuid.UUID) model.Wallet {
+	w := r.wallets[id]
+	return model.Wallet{ID: id, Currency: w.currency, WalletType: w.walletType, Status: w.status,
+		OwnerID: w.ownerID, ExternalID: w.externalID, Labels: w.labels, CreatedAt: w.createdAt}
+}
+
+// walletByExternalID — аналог уникального индекса по (owner_id, external_id). Вызывается под r.mu.
+func (r *MemoryWalletRepository) walletByExternalID(ownerID, externalID string) (model.Wallet, bool) {
+	for id, w := range r.wallets {
+		if w.ownerID == ownerID && w.externalID == externalID {
+			return r.wallet(id), true
+		}
+	}
+	return model.Wallet{}, false
+}
+
+func (r *MemoryWalletRepository) ListWallets(ctx context.Context, ownerID string) ([]model.Wallet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	wallets := []model.Wallet{}
+	for id, w := range r.wallets {
+		if w.ownerID == ownerID {
+			wallets = append(wallets, r.wallet(id))
+		}
+	}
+	// Метки времени из tick уникальны, так что порядок однозначен
+	sort.Slice(wallets, func(i, j int) bool { return wallets[i].CreatedAt.Before(wallets[j].CreatedAt) })
+	return wallets, nil
+}
+
+func (r *MemoryWalletRepository) GetWalletByExternalID(ctx context.Context, ownerID, externalID string) (model.Wallet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.walletByExternalID(ownerID, externalID)
+	if !ok || externalID == "" {
+		return model.Wallet{}, fmt.Errorf("%w: external id %q", errors.WalletNotFound, externalID)
+	}
+	return w, nil
+}
+
+// === Возвраты ===
+
+// findTransaction — строка журнала по ID: кошелёк и индекс в r.transactions. Вызывается под r.mu.
+func (r *MemoryWalletRepository) findTransaction(match func(model.Transaction) bool) (uuid.UUID, int, bool) {
+	for walletID, txs := range r.transactions {
+		for i, t := range txs {
+			if match(t) {
+				return walletID, i, true
+			}
+		}
+	}
+	return uuid.Nil, 0, false
+}
+
+func (r *MemoryWalletRepository) ReverseTransaction(ctx context.Context, transactionID uuid.UUID, amount int64, reason string) (model.Reversal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	walletID, i, ok := r.findTransaction(func(t model.Transaction) bool { return t.ID == transactionID })
+	if !ok {
+		return model.Reversal{}, fmt.Errorf("%w: %s", errors.TransactionNotFound, transactionID)
+	}
+	legs := []*model.Transaction{&r.transactions[walletID][i]}
+	if original := *legs[0]; isTransferLeg(original) {
+		walletID, i, ok := r.findTransaction(func(t model.Transaction) bool {
+			return t.ID != original.ID && isTransferLeg(t) && *t.TransferID == *original.TransferID
+		})
+		if !ok {
+			return model.Reversal{}, fmt.Errorf("transfer leg of %s not found", transactionID)
+		}
+		legs = append(legs, &r.transactions[walletID][i])
+	}
+	values := make([]model.Transaction, len(legs))
+	for i, leg := range legs {
+		values[i] = *leg
+	}
+
+	amount, err := planReversal(values, amount)
+	if err != nil {
+		return model.Reversal{}, err
+	}
+	for _, leg := range values {
+		if err := checkReversalWallet(r.locked(leg.WalletID), r.heldAmount(leg.WalletID), leg, amount, r.freezeBlocksCredits); err != nil {
+			return model.Reversal{}, err
+		}
+	}
+
+	ts := r.tick()
+	entryID, err := r.postEntry(model.EntryReversal, r.wallets[values[0].WalletID].currency, reversalPostings(values, amount), ts)
+	if err != nil {
+		return model.Reversal{}, err
+	}
+	// Счётчик исходных строк — до appendTransaction: append может переложить срез
+	for _, leg := range legs {
+		leg.ReversedAmount += amount
+	}
+	rows := reversalRows(values, amount, entryID, reason)
+	for i, row := range rows {
+		rows[i] = r.appendTransaction(row, ts)
+		r.appendOutboxEvent(model.NewBalanceChanged(rows[i], r.wallets[row.WalletID].balance), ts)
+	}
+	return model.Reversal{
+		OriginalID:     transactionID,
+		Amount:         amount,
+		ReversedAmount: values[0].ReversedAmount + amount,
+		Transactions:   rows,
+	}, nil
+}
+
+// === Комиссии ===
+
+// listFeeRules — все правила комиссий. Вызывается под r.mu.
+func (r *MemoryWalletRepository) listFeeRules() []model.FeeRule {
+	rules := make([]model.FeeRule, 0, len(r.feeRules))
+	for _, rule := range r.feeRules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		a, b := rules[i], rules[j]
+		if a.Operation != b.Operation {
+			return a.Operation < b.Operation
+		}
+		if a.Currency != b.Currency {
+			return a.Currency < b.Currency
+		}
+		return a.WalletType < b.WalletType
+	})
+	return rules
+}
+
+func (r *MemoryWalletRepository) UpsertFeeRule(ctx context.Context, rule model.FeeRule) (model.FeeRule, error) {
+	if err := validateFeeRule(rule); err != nil {
+		return model.FeeRule{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ts := r.tick()
+	rule.ID, rule.CreatedAt, rule.UpdatedAt = uuid.New(), ts, ts
+	for id, existing := range r.feeRules {
+		if existing.Operation == rule.Operation && existing.Currency == rule.Currency && existing.WalletType == rule.WalletType {
+			rule.ID, rule.CreatedAt = id, existing.CreatedAt
+			break
+		}
+	}
+	rule.Tiers = append([]model.FeeTier(nil), rule.Tiers...)
+	r.feeRules[rule.ID] = rule
+	return rule, nil
+}
+
+func (r *MemoryWalletRepository) ListFeeRules(ctx context.Context) ([]model.FeeRule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.listFeeRules(), nil
+}
+
+func (r *MemoryWalletRepository) DeleteFeeRule(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.feeRules[id]; !ok {
+		return fmt.Errorf("%w: %s", errors.FeeRuleNotFound, id)
+	}
+	delete(r.feeRules, id)
+	return nil
+}
+
+// === Обмен валют ===
+
+// fxPair — ключ курса в r.fxRates
+type fxPair struct {
+	base, quote model.Currency
+}
+
+func (r *MemoryWalletRepository) UpsertFXRates(ctx context.Context, rates []model.FXRate) ([]model.FXRate, error) {
+	if err := validateRates(rates); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	saved := make([]model.FXRate, 0, len(rates))
+	for _, rate := range rates {
+		rate.UpdatedAt = r.tick()
+		r.fxRates[fxPair{rate.Base, rate.Quote}] = rate
+		saved = append(saved, rate)
+	}
+	return saved, nil
+}
+
+func (r *MemoryWalletRepository) ListFXRates(ctx context.Context) ([]model.FXRate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rates := make([]model.FXRate, 0, len(r.fxRates))
+	for _, rate := range r.fxRates {
+		rates = append(rates, rate)
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].Base != rates[j].Base {
+			return rates[i].Base < rates[j].Base
+		}
+		return rates[i].Quote < rates[j].Quote
+	})
+	return rates, nil
+}
+
+func (r *MemoryWalletRepository) CreateFXQuote(ctx context.Context, req model.QuoteRequest, ttl time.Duration) (model.FXQuote, error) {
+	if ttl <= 0 {
+		ttl = r.fxQuoteTTL
+	}
+	if err := validateQuoteRequest(req); err != nil {
+		return model.FXQuote{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	from, ok := r.wallets[req.FromWalletID]
+	if !ok {
+		return model.FXQuote{}, fmt.Errorf("%w: %s", errors.WalletNotFound, req.FromWalletID)
+	}
+	to, ok := r.wallets[req.ToWalletID]
+	if !ok {
+		return model.FXQuote{}, fmt.Errorf("%w: %s", errors.WalletNotFound, req.ToWalletID)
+	}
+	if from.currency == to.currency {
+		return model.FXQuote{}, fmt.Errorf("%w: %s", errors.SameCurrency, from.currency)
+	}
+	rate, ok := r.fxRates[fxPair{from.currency, to.currency}]
+	if !ok {
+		return model.FXQuote{}, fmt.Errorf("%w: %s/%s", errors.RateNotFound, from.currency, to.currency)
+	}
+
+	quote, err := prepareQuote(req, from.currency, to.currency, rate.Rate, r.fxRounding)
+	if err != nil {
+		return model.FXQuote{}, err
+	}
+	ts := r.tick()
+	quote.ID = uuid.New()
+	quote.ExpiresAt = ts.Add(ttl)
+	quote.CreatedAt = ts
+	r.fxQuotes[quote.ID] = &quote
+	return quote, nil
+}
+
+func (r *MemoryWalletRepository) GetFXQuote(ctx context.Context, quoteID uuid.UUID) (model.FXQuote, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	q, ok := r.fxQuotes[quoteID]
+	if !ok {
+		return model.FXQuote{}, fmt.Errorf("%w: %s", errors.QuoteNotFound, quoteID)
+	}
+	quote := *q
+	quote.Status = quote.EffectiveStatus(currentTime())
+	return quote, nil
+}
+
+func (r *MemoryWalletRepository) ExecuteFXQuote(ctx context.Context, quoteID uuid.UUID) (model.FXQuote, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	q, ok := r.fxQuotes[quoteID]
+	if !ok {
+		return model.FXQuote{}, fmt.Errorf("%w: %s", errors.QuoteNotFound, quoteID)
+	}
+	if err := r.checkStatus(q.FromWalletID, true); err != nil {
+		return model.FXQuote{}, err
+	}
+	if err := r.checkStatus(q.ToWalletID, false); err != nil {
+		return model.FXQuote{}, err
+	}
+	if status := q.EffectiveStatus(currentTime()); status != model.QuoteOpen {
+		return model.FXQuote{}, fmt.Errorf("%w: %s is %s", errors.QuoteNotOpen, quoteID, status)
+	}
+	if available := r.locked(q.FromWalletID).spendable(r.heldAmount(q.FromWalletID)); available < q.SourceAmount {
+		return model.FXQuote{}, fmt.Errorf("%w: available %d, exchange %d", errors.InsufficientFunds, available, q.SourceAmount)
+	}
+
+	ts := r.tick()
+	sourcePostings, targetPostings := fxEntries(*q)
+	sourceEntry, err := r.postEntry(model.EntryFX, q.FromCurrency, sourcePostings, ts)
+	if err != nil {
+		return model.FXQuote{}, err
+	}
+	targetEntry, err := r.postEntry(model.EntryFX, q.ToCurrency, targetPostings, ts)
+	if err != nil {
+		return model.FXQuote{}, err
+	}
+	for _, leg := range fxLegs(*q, sourceEntry, targetEntry) {
+		leg = r.appendTransaction(leg, ts)
+		r.appendOutboxEvent(model.NewBalanceChanged(leg, r.wallets[leg.WalletID].balance), ts)
+	}
+
+	q.Status = model.QuoteExecuted
+	q.ExecutedAt = &ts
+	return *q, nil
+}
+
+// === Баланс на момент времени ===
+
+// memoryBalanceSnapshot — строка balance_snapshots
+type memoryBalanceSnapshot struct {
+	asOf              time.Time
+	balance           int64
+	lastTransactionID uuid.UUID
+}
+
+// balanceAt — баланс кошелька по операциям до asOf (inclusive — включая сам asOf)
+// от последнего снимка в том же промежутке; ok = false — после снимка операций
+// не было. Вызывается под r.mu.
+func (r *MemoryWalletRepository) balanceAt(walletID uuid.UUID, asOf time.Time, inclusive bool) (memoryBalanceSnapshot, bool) {
+	before := func(ts time.Time) bool { return ts.Before(asOf) || inclusive && ts.Equal(asOf) }
+
+	var from memoryBalanceSnapshot
+	snapshots := r.balanceSnapshots[walletID]
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if before(snapshots[i].asOf) {
+			from = snapshots[i]
+			break
+		}
+	}
+
+	at := from
+	at.asOf = asOf
+	found := false
+	for _, t := range r.transactions[walletID] {
+		if !t.CreatedAt.After(from.asOf) || !before(t.CreatedAt) {
+			continue
+		}
+		at.balance += t.BalanceDelta()
+		at.lastTransactionID = t.ID
+		found = true
+	}
+	if !found {
+		return from, false
+	}
+	return at, true
+}
+
+func (r *MemoryWalletRepository) GetBalanceAsOf(ctx context.Context, walletID uuid.UUID, asOf time.Time) (model.HistoricalBalance, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hb := model.HistoricalBalance{WalletID: walletID, AsOf: asOf}
+	w, ok := r.wallets[walletID]
+	if !ok {
+		return hb, fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
+	}
+	hb.Currency = w.currency
+
+	b, _ := r.balanceAt(walletID, asOf, true)
+	hb.Balance = b.balance
+	if b.lastTransactionID != uuid.Nil {
+		id := b.lastTransactionID
+		hb.LastTransactionID = &id
+	}
+	return hb, nil
+}
+
+// SnapshotBalances: операции проводятся целиком под r.mu, поэтому незавершённых
+// операций со временем до at здесь не бывает — ждать, как в PostgreSQL, нечего
+func (r *MemoryWalletRepository) SnapshotBalances(ctx context.Context, at time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Следующие операции получат время позже r.lastTS и не раньше текущего
+	if at.After(r.lastTS) && !at.Before(currentTime()) {
+		return 0, fmt.Errorf("%w: %s", errors.SnapshotInFuture, at.Format(time.RFC3339Nano))
+	}
+
+	var n int64
+	for walletID := range r.wallets {
+		b, ok := r.balanceAt(walletID, at, true)
+		if !ok {
+			continue
+		}
+		snapshots := append(r.balanceSnapshots[walletID], b)
+		sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].asOf.Before(snapshots[j].asOf) })
+		r.balanceSnapshots[walletID] = snapshots
+		n++
+	}
+	return n, nil
+}
+
+// Statement собирает выписку под мьютексом, а передаёт после: медленный
+// читатель выписки не должен держать всё хранилище
+func (r *MemoryWalletRepository) Statement(ctx context.Context, walletID uuid.UUID, from, to time.Time, emit func(model.StatementLine) error) error {
+	r.mu.Lock()
+	w, ok := r.wallets[walletID]
+	if !ok {
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
+	}
+	opening, _ := r.balanceAt(walletID, from, false)
+	balance := opening.balance
+	lines := []model.StatementLine{{Type: model.StatementOpening, Time: from, Balance: balance, Currency: w.currency}}
+	for _, t := range r.transactions[walletID] {
+		if t.CreatedAt.Before(from) || !t.CreatedAt.Before(to) {
+			continue
+		}
+		balance += t.BalanceDelta()
+		lines = append(lines, model.StatementLine{Type: model.StatementOperation, Time: t.CreatedAt, Balance: balance, Currency: w.currency, Transaction: &t})
+	}
+	lines = append(lines, model.StatementLine{Type: model.StatementClosing, Time: to, Balance: balance, Currency: w.currency})
+	r.mu.Unlock()
+
+	for _, line := range lines {
+		if err := emit(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// === Webhook ===
+
+func (r *MemoryWalletRepository) CreateSubscription(ctx context.Context, sub model.WebhookSubscription) (model.WebhookSubscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub.ID = uuid.New()
+	sub.CreatedAt = r.tick()
+	r.subscriptions[sub.ID] = sub
+	return sub, nil
+}
+
+func (r *MemoryWalletRepository) ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subs := make([]model.WebhookSubscription, 0, len(r.subscriptions))
+	for _, sub := range r.subscriptions {
+		sub.Secret = ""
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	return subs, nil
+}
+
+func (r *MemoryWalletRepository) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.subscriptions[id]; !ok {
+		return fmt.Errorf("%w: %s", errors.SubscriptionNotFound, id)
+	}
+	delete(r.subscriptions, id)
+	for deliveryID, d := range r.deliveries {
+		if d.SubscriptionID == id {
+			delete(r.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryWalletRepository) FanOutEvents(ctx context.Context, now time.Time, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for i := range r.outbox {
+		if n == limit {
+			break
+		}
+		if r.outbox[i].dispatched {
+			continue
+		}
+		for _, sub := range r.subscriptions {
+			d := &model.WebhookDelivery{
+				ID:             uuid.New(),
+				EventID:        r.outbox[i].event.ID,
+				SubscriptionID: sub.ID,
+				Status:         model.DeliveryPending,
+				NextAttemptAt:  now,
+				CreatedAt:      r.tick(),
+			}
+			r.deliveries[d.ID] = d
+		}
+		r.outbox[i].dispatched = true
+		n++
+	}
+	return n, nil
+}
+
+func (r *MemoryWalletRepository) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.DeliveryTask, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []*model.WebhookDelivery
+	for _, d := range r.deliveries {
+		if d.Status == model.DeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	events := make(map[uuid.UUID]model.OutboxEvent, len(due))
+	for _, e := range r.outbox {
+		events[e.event.ID] = e.event
+	}
+
+	tasks := make([]model.DeliveryTask, 0, len(due))
+	for _, d := range due {
+		d.NextAttemptAt = now.Add(lease)
+		sub := r.subscriptions[d.SubscriptionID]
+		tasks = append(tasks, model.DeliveryTask{
+			Delivery: *d,
+			Event:    events[d.EventID],
+			URL:      sub.URL,
+			Secret:   sub.Secret,
+		})
+	}
+	return tasks, nil
+}
+
+func (r *MemoryWalletRepository) RecordDeliveryAttempt(ctx context.Context, attempt model.DeliveryAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.deliveries[attempt.DeliveryID]
+	if !ok {
+		return fmt.Errorf("%w: %s", errors.DeliveryNotFound, attempt.DeliveryID)
+	}
+	d.Attempts++
+	d.Status = attempt.Status
+	d.LastStatusCode = attempt.StatusCode
+	d.LastError = attempt.Error
+	d.NextAttemptAt = attempt.NextAttemptAt
+	d.DeliveredAt = nil
+	if attempt.Status == model.DeliveryDelivered {
+		at := attempt.At
+		d.DeliveredAt = &at
+	}
+	return nil
+}
+
+func (r *MemoryWalletRepository) ListDeliveries(ctx context.Context, filter model.DeliveryFilter) ([]model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deliveries := []model.WebhookDelivery{}
+	for _, d := range r.deliveries {
+		if filter.Status != "" && d.Status != filter.Status {
+			continue
+		}
+		if filter.SubscriptionID != nil && d.SubscriptionID != *filter.SubscriptionID {
+			continue
+		}
+		deliveries = append(deliveries, *d)
+	}
+	// Метки времени из tick уникальны, так что порядок однозначен
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt) })
+	if limit := normalizeDeliveriesLimit(filter.Limit); len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (r *MemoryWalletRepository) Redeliver(ctx context.Context, id uuid.UUID, now time.Time) (model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, ok := r.deliveries[id]
+	if !ok {
+		return model.WebhookDelivery{}, fmt.Errorf("%w: %s", errors.DeliveryNotFound, id)
+	}
+	d.Status = model.DeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = now
+	return *d, nil
+}
@@ -0,0 +1,16 @@
+package repository_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fangimal/ITK/internal/config"
+	"github.com/fangimal/ITK/internal/repository"
+	"github.com/fangimal/ITK/internal/repository/repotest"
+)
+
+func TestMemoryWalletRepository(t *testing.T) {
+	repotest.RunConformance(t, func(t *testing.T) repository.WalletRepository {
+		return repository.NewMemoryWalletRepository(&config.Config{IdempotencyTTL: time.Hour})
+	})
+}
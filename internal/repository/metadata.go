@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// validateMetadata — метаданные операции в пределах ограничений
+func validateMetadata(m model.Metadata) error {
+	if err := m.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", errors.InvalidMetadata, err)
+	}
+	return nil
+}
+
+// checkExternalRef — внешняя ссылка ещё не использована на кошельке. Вызывается
+// после lockWallet: все записи в журнал кошелька идут под его блокировкой,
+// уникальный индекс idx_transactions_wallet_external_ref — последний рубеж
+func checkExternalRef(ctx context.Context, tx pgx.Tx, walletID uuid.UUID, ref string) error {
+	if ref == "" {
+		return nil
+	}
+	var exists bool
+	err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM transactions WHERE wallet_id = $1 AND external_ref = $2)`,
+		walletID, ref).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("check external ref: %w", err)
+	}
+	if exists {
+		return fmt.Errorf("%w: %q", errors.DuplicateExternalRef, ref)
+	}
+	return nil
+}
+
+// tagsArg — теги для колонки tags: пустые хранятся как NULL
+func tagsArg(tags map[string]string) any {
+	if len(tags) == 0 {
+		return nil
+	}
+	return tags
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// Кредитная линия: баланс кошелька может уйти в минус до −overdraft_limit.
+// Ограничение CHECK (balance >= -overdraft_limit) в таблице wallets держит
+// это правило и для SQL в обход сервиса.
+
+// validateOverdraftChange — общие проверки нового лимита для обоих хранилищ.
+// Лимит нельзя опустить ниже уже занятого кредита.
+func validateOverdraftChange(w lockedWallet, limit int64, reason string) error {
+	if strings.TrimSpace(reason) == "" {
+		return errors.ReasonRequired
+	}
+	if limit < 0 {
+		return fmt.Errorf("%w: %d", errors.InvalidOverdraft, limit)
+	}
+	if w.status == model.WalletClosed {
+		return fmt.Errorf("%w: %s", errors.WalletClosed, w.id)
+	}
+	if w.balance < -limit {
+		return fmt.Errorf("%w: balance %d, limit %d", errors.OverdraftInUse, w.balance, limit)
+	}
+	return nil
+}
+
+func (r *PostgresWalletRepository) SetOverdraftLimit(ctx context.Context, walletID uuid.UUID, limit int64, reason string) (model.OverdraftChange, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return model.OverdraftChange{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// 🔒 Под блокировкой кошелька лимит не разминётся с параллельным списанием
+	wallet, err := lockWallet(ctx, tx, walletID)
+	if err != nil {
+		return model.OverdraftChange{}, err
+	}
+	if err := validateOverdraftChange(wallet, limit, reason); err != nil {
+		return model.OverdraftChange{}, err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE wallets SET overdraft_limit = $2, updated_at = NOW() WHERE id = $1`, walletID, limit)
+	if err != nil {
+		return model.OverdraftChange{}, fmt.Errorf("update overdraft limit: %w", err)
+	}
+
+	change := model.OverdraftChange{WalletID: walletID, OldLimit: wallet.overdraftLimit, NewLimit: limit, Reason: reason}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO wallet_overdraft_history (wallet_id, old_limit, new_limit, reason)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`,
+		walletID, wallet.overdraftLimit, limit, reason,
+	).Scan(&change.ID, &change.CreatedAt)
+	if err != nil {
+		return model.OverdraftChange{}, fmt.Errorf("insert overdraft history: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return model.OverdraftChange{}, fmt.Errorf("commit: %w", err)
+	}
+	return change, nil
+}
+
+// GetOverdraftHistory — изменения кредитного лимита кошелька, от старых к новым
+func (r *PostgresWalletRepository) GetOverdraftHistory(ctx context.Context, walletID uuid.UUID) ([]model.OverdraftChange, error) {
+	var exists bool
+	if err := r.pool.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM wallets WHERE id = $1)`, walletID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("check wallet: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
+	}
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, wallet_id, old_limit, new_limit, reason, created_at
+		FROM wallet_overdraft_history
+		WHERE wallet_id = $1
+		ORDER BY created_at, id`, walletID)
+	if err != nil {
+		return nil, fmt.Errorf("select overdraft history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []model.OverdraftChange{}
+	for rows.Next() {
+		var c model.OverdraftChange
+		if err := rows.Scan(&c.ID, &c.WalletID, &c.OldLimit, &c.NewLimit, &c.Reason, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan overdraft history: %w", err)
+		}
+		history = append(history, c)
+	}
+	return history, rows.Err()
+}
@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// signedAmountSQL — влияние строки transactions на баланс кошелька
+// (CASE по model.CreditOperationTypes, комиссия всегда списывается; см. Transaction.BalanceDelta)
+func signedAmountSQL() string {
+	credits := make([]string, len(model.CreditOperationTypes))
+	for i, t := range model.CreditOperationTypes {
+		credits[i] = "'" + string(t) + "'"
+	}
+	return "CASE WHEN operation_type IN (" + strings.Join(credits, ", ") + ") THEN amount ELSE -amount END - fee"
+}
+
+// reconcileRow — кошелёк с суммами журнала и проводок
+type reconcileRow struct {
+	walletID    uuid.UUID
+	balance     int64
+	logSum      int64
+	logCount    int64
+	postingsSum int64
+}
+
+// Reconcile сверяет wallets.balance с журналом transactions, читая кошельки
+// пачками по id. С opts.Fix на каждое расхождение пишется корректировка
+// ADJUSTMENT_IN/ADJUSTMENT_OUT с причиной: баланс не перезаписывается,
+// журнал и главная книга доводятся до него.
+func (r *PostgresWalletRepository) Reconcile(ctx context.Context, opts model.ReconcileOptions) (model.ReconcileReport, error) {
+	if opts.Fix && strings.TrimSpace(opts.Reason) == "" {
+		return model.ReconcileReport{}, errors.ReasonRequired
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = model.DefaultReconcileBatchSize
+	}
+
+	report := newReconcileReport()
+
+	sqlQuery := fmt.Sprintf(`
+		SELECT w.id, w.balance,
+		       COALESCE(t.total, 0), COALESCE(t.cnt, 0),
+		       COALESCE(p.total, 0)
+		FROM (
+			SELECT id, balance FROM wallets
+			WHERE id > $1
+			ORDER BY id
+			LIMIT $2
+		) w
+		LEFT JOIN LATERAL (
+			SELECT SUM(%s) AS total, COUNT(*) AS cnt
+			FROM transactions
+			WHERE wallet_id = w.id
+		) t ON true
+		LEFT JOIN LATERAL (
+			SELECT SUM(amount) AS total
+			FROM postings
+			WHERE wallet_id = w.id
+		) p ON true
+		ORDER BY w.id`, signedAmountSQL())
+
+	after := uuid.Nil
+	for {
+		rows, err := r.pool.Query(ctx, sqlQuery, after, batchSize)
+		if err != nil {
+			return report, fmt.Errorf("select reconcile batch: %w", err)
+		}
+		batch, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (reconcileRow, error) {
+			var rr reconcileRow
+			err := row.Scan(&rr.walletID, &rr.balance, &rr.logSum, &rr.logCount, &rr.postingsSum)
+			return rr, err
+		})
+		if err != nil {
+			return report, fmt.Errorf("read reconcile batch: %w", err)
+		}
+
+		for _, rr := range batch {
+			mismatch := classifyReconcileRow(&report, rr)
+			if mismatch && opts.Fix {
+				fix, err := r.fixDrift(ctx, rr.walletID, opts.Reason)
+				if err != nil {
+					return report, err
+				}
+				if fix != nil {
+					report.Fixed = append(report.Fixed, *fix)
+				}
+			}
+		}
+
+		if len(batch) < batchSize {
+			break
+		}
+		after = batch[len(batch)-1].walletID
+	}
+
+	finishReconcileReport(&report)
+	return report, nil
+}
+
+// fixDrift пересчитывает расхождение под блокировкой кошелька и записывает
+// корректировку. nil — расхождение исчезло, пока шла сверка.
+func (r *PostgresWalletRepository) fixDrift(ctx context.Context, walletID uuid.UUID, reason string) (*model.ReconcileFix, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Корректировка сверки проводится при любом статусе кошелька
+	wallet, err := lockWallet(ctx, tx, walletID)
+	if err != nil {
+		return nil, err
+	}
+	balance := wallet.balance
+
+	var logSum, postingsSum int64
+	sqlQuery := fmt.Sprintf(`
+		SELECT
+			(SELECT COALESCE(SUM(%s), 0) FROM transactions WHERE wallet_id = $1),
+			(SELECT COALESCE(SUM(amount), 0) FROM postings WHERE wallet_id = $1)`, signedAmountSQL())
+	if err := tx.QueryRow(ctx, sqlQuery, walletID).Scan(&logSum, &postingsSum); err != nil {
+		return nil, fmt.Errorf("select sums: %w", err)
+	}
+
+	drift := balance - logSum
+	if drift == 0 {
+		return nil, nil
+	}
+
+	fix := &model.ReconcileFix{WalletID: walletID, Amount: drift, Reason: reason}
+
+	// Главную книгу догоняем до баланса отдельной записью против ADJUSTMENTS
+	if ledgerDrift := balance - postingsSum; ledgerDrift != 0 {
+		entryID, err := insertEntry(ctx, tx, model.EntryAdjustment, wallet.currency, adjustmentPostings(walletID, ledgerDrift))
+		if err != nil {
+			return nil, err
+		}
+		fix.EntryID = &entryID
+	}
+
+	fix.TransactionID, err = insertTransaction(ctx, tx, adjustmentTransaction(walletID, drift, fix.EntryID, reason))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return fix, nil
+}
+
+// === Общее для всех хранилищ ===
+
+func newReconcileReport() model.ReconcileReport {
+	return model.ReconcileReport{
+		StartedAt:  time.Now().UTC(),
+		Mismatches: []model.ReconcileMismatch{},
+		NoHistory:  []model.WalletSummary{},
+		Fixed:      []model.ReconcileFix{},
+	}
+}
+
+// classifyReconcileRow раскладывает кошелёк по разделам отчёта
+// и сообщает, есть ли расхождение баланса с журналом
+func classifyReconcileRow(report *model.ReconcileReport, rr reconcileRow) bool {
+	report.WalletsScanned++
+	summary := model.WalletSummary{WalletID: rr.walletID, Balance: rr.balance}
+
+	if rr.logCount == 0 {
+		report.NoHistory = append(report.NoHistory, summary)
+	}
+	if rr.balance == rr.logSum {
+		return false
+	}
+	report.Mismatches = append(report.Mismatches, model.ReconcileMismatch{
+		WalletID:    rr.walletID,
+		Balance:     rr.balance,
+		LogSum:      rr.logSum,
+		Drift:       rr.balance - rr.logSum,
+		PostingsSum: rr.postingsSum,
+	})
+	return true
+}
+
+func finishReconcileReport(report *model.ReconcileReport) {
+	report.FinishedAt = time.Now().UTC()
+	report.DriftDetected = report.HasDrift()
+}
+
+// adjustmentPostings — кошелёк ±drift против системного счёта ADJUSTMENTS
+func adjustmentPostings(walletID uuid.UUID, drift int64) []model.Posting {
+	return []model.Posting{
+		{Account: model.WalletAccount(walletID), Amount: drift},
+		{Account: model.SystemLedgerAccount(model.AccountAdjustments), Amount: -drift},
+	}
+}
+
+// adjustmentTransaction — строка журнала, объясняющая расхождение drift
+func adjustmentTransaction(walletID uuid.UUID, drift int64, entryID *uuid.UUID, reason string) model.Transaction {
+	t := model.Transaction{
+		WalletID:      walletID,
+		OperationType: model.OperationAdjustmentIn,
+		Amount:        drift,
+		EntryID:       entryID,
+		Reason:        reason,
+	}
+	if drift < 0 {
+		t.OperationType = model.OperationAdjustmentOut
+		t.Amount = -drift
+	}
+	return t
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fangimal/ITK/internal/config"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+func TestSignedAmountSQL(t *testing.T) {
+	sql := signedAmountSQL()
+	for _, ot := range model.CreditOperationTypes {
+		assert.Contains(t, sql, "'"+string(ot)+"'")
+	}
+	for _, ot := range model.DebitOperationTypes {
+		assert.NotContains(t, sql, "'"+string(ot)+"'")
+	}
+}
+
+// Расхождение имитируется правкой баланса в обход операций —
+// как ручной UPDATE wallets в PostgreSQL
+func TestMemoryReconcileFix(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryWalletRepository(&config.Config{IdempotencyTTL: time.Hour})
+
+	upWallet, err := repo.CreateWallet(ctx, model.CreateWalletRequest{})
+	require.NoError(t, err)
+	downWallet, err := repo.CreateWallet(ctx, model.CreateWalletRequest{})
+	require.NoError(t, err)
+	up, down := upWallet.ID, downWallet.ID
+	require.NoError(t, repo.UpdateBalance(ctx, up, 1000, true))
+	require.NoError(t, repo.UpdateBalance(ctx, down, 1000, true))
+
+	repo.wallets[up].balance += 250
+	repo.wallets[down].balance -= 1100
+
+	report, err := repo.Reconcile(ctx, model.ReconcileOptions{})
+	require.NoError(t, err)
+	assert.True(t, report.DriftDetected)
+	require.Len(t, report.Mismatches, 2)
+	assert.Empty(t, report.Fixed)
+
+	drifts := map[string]int64{}
+	for _, m := range report.Mismatches {
+		drifts[m.WalletID.String()] = m.Drift
+		assert.Equal(t, m.Balance-m.LogSum, m.Drift)
+	}
+	assert.Equal(t, int64(250), drifts[up.String()])
+	assert.Equal(t, int64(-1100), drifts[down.String()])
+
+	// Отчёт без исправления ничего не меняет
+	balance, err := repo.GetBalance(ctx, up)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1250), balance.Balance)
+
+	report, err = repo.Reconcile(ctx, model.ReconcileOptions{Fix: true, Reason: "manual SQL fix INC-42"})
+	require.NoError(t, err)
+	require.Len(t, report.Fixed, 2)
+	for _, fix := range report.Fixed {
+		assert.Equal(t, "manual SQL fix INC-42", fix.Reason)
+		require.NotNil(t, fix.EntryID)
+	}
+	// Исправленные расхождения дрейфом не считаются
+	assert.False(t, report.DriftDetected)
+
+	// Баланс не перезаписан — журнал догнал его корректировкой
+	page, err := repo.GetTransactions(ctx, up, model.TransactionFilter{})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	adj := page.Items[0]
+	assert.Equal(t, model.OperationAdjustmentIn, adj.OperationType)
+	assert.Equal(t, int64(250), adj.Amount)
+	assert.Equal(t, "manual SQL fix INC-42", adj.Reason)
+
+	page, err = repo.GetTransactions(ctx, down, model.TransactionFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, model.OperationAdjustmentOut, page.Items[0].OperationType)
+	assert.Equal(t, int64(1100), page.Items[0].Amount)
+
+	ledger, err := repo.CheckLedger(ctx)
+	require.NoError(t, err)
+	assert.True(t, ledger.Balanced)
+	for _, acc := range ledger.SystemAccounts {
+		if acc.Account.System == model.AccountAdjustments {
+			assert.Equal(t, int64(-250+1100), acc.Balance)
+		}
+	}
+
+	// Повторная сверка расхождений не находит
+	report, err = repo.Reconcile(ctx, model.ReconcileOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, report.Mismatches)
+	assert.False(t, report.DriftDetected)
+}
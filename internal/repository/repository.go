@@ -1,9 +1,12 @@
 package repository
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log"
+	"sort"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -11,25 +14,113 @@ import (
 
 	"github.com/fangimal/ITK/internal/config"
 	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
 )
 
 type WalletRepository interface {
-	CreateWallet(ctx context.Context) (uuid.UUID, error)
-	GetBalance(ctx context.Context, walletID uuid.UUID) (int64, error)
+	// CreateWallet создаёт кошелёк; с externalId, который у владельца уже есть, возвращает существующий (Replayed)
+	CreateWallet(ctx context.Context, req model.CreateWalletRequest) (model.Wallet, error)
+	GetBalance(ctx context.Context, walletID uuid.UUID) (model.WalletBalance, error)
+	// GetBalanceAsOf считает баланс по журналу операций на момент asOf
+	GetBalanceAsOf(ctx context.Context, walletID uuid.UUID, asOf time.Time) (model.HistoricalBalance, error)
+	// SnapshotBalances пишет снимки балансов на момент at для кошельков с операциями
+	// после предыдущего снимка и возвращает их число
+	SnapshotBalances(ctx context.Context, at time.Time) (int64, error)
 	UpdateBalance(ctx context.Context, walletID uuid.UUID, amount int64, isDeposit bool) error
+	GetTransactions(ctx context.Context, walletID uuid.UUID, filter model.TransactionFilter) (model.TransactionPage, error)
+	// Statement передаёт emit строки выписки за период [from, to) по мере чтения журнала;
+	// ошибка emit прерывает выписку
+	Statement(ctx context.Context, walletID uuid.UUID, from, to time.Time, emit func(model.StatementLine) error) error
+	Transfer(ctx context.Context, fromID, toID uuid.UUID, amount int64) (model.Transfer, error)
+	ApplyOperation(ctx context.Context, op model.WalletOperation, opts model.OperationOptions) (model.OperationResult, error)
+	// ApplyBatch проводит пакет операций; ошибка — только если пакет не удалось обработать целиком
+	ApplyBatch(ctx context.Context, mode model.BatchMode, ops []model.WalletOperation) ([]model.BatchOutcome, error)
+	// ApplyWalletBatch проводит операции одного кошелька одной транзакцией с одним изменением баланса;
+	// каждая операция принимается или отклоняется по порядку (см. CoalescingRepository)
+	ApplyWalletBatch(ctx context.Context, walletID uuid.UUID, ops []model.WalletOperation) ([]model.BatchOutcome, error)
+	PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error)
+	GetJournalEntry(ctx context.Context, entryID uuid.UUID) (model.JournalEntry, error)
+	CheckLedger(ctx context.Context) (model.LedgerReport, error)
+	Reconcile(ctx context.Context, opts model.ReconcileOptions) (model.ReconcileReport, error)
+
+	// CreateHold блокирует amount на ttl (0 — HOLD_TTL из конфигурации)
+	CreateHold(ctx context.Context, walletID uuid.UUID, amount int64, ttl time.Duration) (model.Hold, error)
+	GetHold(ctx context.Context, holdID uuid.UUID) (model.Hold, error)
+	// CaptureHold списывает amount из холда (0 — всю сумму); остаток разблокируется
+	CaptureHold(ctx context.Context, holdID uuid.UUID, amount int64) (model.Hold, error)
+	VoidHold(ctx context.Context, holdID uuid.UUID) (model.Hold, error)
+	// ExpireHolds переводит просроченные холды в EXPIRED и возвращает их число
+	ExpireHolds(ctx context.Context) (int64, error)
+
+	// ChangeWalletStatus переводит кошелёк в статус to и пишет переход в журнал статусов
+	ChangeWalletStatus(ctx context.Context, walletID uuid.UUID, to model.WalletStatus, reason string) (model.WalletStatusChange, error)
+	GetWalletStatusHistory(ctx context.Context, walletID uuid.UUID) ([]model.WalletStatusChange, error)
+
+	// SetOverdraftLimit задаёт кредитную линию кошелька и пишет изменение в журнал лимитов
+	SetOverdraftLimit(ctx context.Context, walletID uuid.UUID, limit int64, reason string) (model.OverdraftChange, error)
+	GetOverdraftHistory(ctx context.Context, walletID uuid.UUID) ([]model.OverdraftChange, error)
+
+	// UpsertLimitPolicy создаёт политику лимитов или заменяет политику той же области (кошелёк или тип кошелька)
+	UpsertLimitPolicy(ctx context.Context, p model.LimitPolicy) (model.LimitPolicy, error)
+	ListLimitPolicies(ctx context.Context) ([]model.LimitPolicy, error)
+	DeleteLimitPolicy(ctx context.Context, id uuid.UUID) error
+
+	// ListWallets возвращает кошельки владельца в порядке создания
+	ListWallets(ctx context.Context, ownerID string) ([]model.Wallet, error)
+	GetWalletByExternalID(ctx context.Context, ownerID, externalID string) (model.Wallet, error)
+
+	// ReverseTransaction проводит полный (amount = 0) или частичный возврат по строке журнала
+	ReverseTransaction(ctx context.Context, transactionID uuid.UUID, amount int64, reason string) (model.Reversal, error)
+
+	// UpsertFXRates записывает курсы одной транзакцией: импорт либо проходит целиком, либо нет
+	UpsertFXRates(ctx context.Context, rates []model.FXRate) ([]model.FXRate, error)
+	ListFXRates(ctx context.Context) ([]model.FXRate, error)
+	// CreateFXQuote фиксирует курс и суммы обмена на ttl (0 — FX_QUOTE_TTL из конфигурации)
+	CreateFXQuote(ctx context.Context, req model.QuoteRequest, ttl time.Duration) (model.FXQuote, error)
+	GetFXQuote(ctx context.Context, quoteID uuid.UUID) (model.FXQuote, error)
+	// ExecuteFXQuote атомарно списывает SourceAmount и зачисляет TargetAmount по курсу котировки
+	ExecuteFXQuote(ctx context.Context, quoteID uuid.UUID) (model.FXQuote, error)
+
+	// UpsertFeeRule создаёт правило комиссии или заменяет правило с той же
+	// операцией, валютой и типом кошелька
+	UpsertFeeRule(ctx context.Context, rule model.FeeRule) (model.FeeRule, error)
+	ListFeeRules(ctx context.Context) ([]model.FeeRule, error)
+	DeleteFeeRule(ctx context.Context, id uuid.UUID) error
+
+	WebhookRepository
+}
+
+// WebhookRepository — подписки на события и очередь их доставки.
+// События пишутся в outbox в той же транзакции, что и изменение баланса;
+// время передаётся явно, чтобы диспетчер можно было проверять с подменёнными часами.
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, sub model.WebhookSubscription) (model.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id uuid.UUID) error
+	// FanOutEvents создаёт доставки для ещё не разосланных событий по всем подпискам
+	// и возвращает число обработанных событий
+	FanOutEvents(ctx context.Context, now time.Time, limit int) (int, error)
+	// ClaimDeliveries берёт в работу доставки, срок которых наступил, и
+	// откладывает их на lease — чтобы другой диспетчер не отправил их повторно
+	ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.DeliveryTask, error)
+	RecordDeliveryAttempt(ctx context.Context, attempt model.DeliveryAttempt) error
+	ListDeliveries(ctx context.Context, filter model.DeliveryFilter) ([]model.WebhookDelivery, error)
+	// Redeliver возвращает доставку в очередь с обнулённым счётчиком попыток
+	Redeliver(ctx context.Context, id uuid.UUID, now time.Time) (model.WebhookDelivery, error)
 }
 
 type PostgresWalletRepository struct {
-	pool *pgxpool.Pool
+	pool           *pgxpool.Pool
+	idempotencyTTL time.Duration
+	holdTTL        time.Duration
+
+	freezeBlocksCredits bool
+	fxQuoteTTL          time.Duration
+	fxRounding          model.Rounding
 }
 
 func NewPostgresWalletRepository(cfg *config.Config) (*PostgresWalletRepository, error) {
-	connStr := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		cfg.DBHost, cfg.DBPort, cfg.DBUser, cfg.DBPass, cfg.DBName, cfg.DBSSLMode,
-	)
-
-	pool, err := pgxpool.New(context.Background(), connStr)
+	pool, err := pgxpool.New(context.Background(), cfg.PostgresDSN())
 	if err != nil {
 		return nil, fmt.Errorf("unable to create connection pool: %w", err)
 	}
@@ -41,109 +132,506 @@ func NewPostgresWalletRepository(cfg *config.Config) (*PostgresWalletRepository,
 	}
 
 	log.Println("✅ Подключение к PostgreSQL установлено")
-	return &PostgresWalletRepository{pool: pool}, nil
+	return &PostgresWalletRepository{
+		pool:                pool,
+		idempotencyTTL:      cfg.IdempotencyTTL,
+		holdTTL:             cfg.HoldTTL,
+		freezeBlocksCredits: cfg.FreezeBlocksCredits,
+		fxQuoteTTL:          cfg.FXQuoteTTL,
+		fxRounding:          fxRounding(cfg),
+	}, nil
 }
 
 func (r *PostgresWalletRepository) Close() {
 	r.pool.Close()
 }
 
-// CreateWallet создаёт новый кошелёк и возвращает его ID
-func (r *PostgresWalletRepository) CreateWallet(ctx context.Context) (uuid.UUID, error) {
-	var id uuid.UUID
-	err := r.pool.QueryRow(ctx, `
-		INSERT INTO wallets (balance) 
-		VALUES (0) 
-		RETURNING id
-	`).Scan(&id)
-	return id, err
+// CreateWallet создаёт новый кошелёк. Повторный запрос с тем же externalId
+// владельца возвращает уже созданный кошелёк — в том числе при гонке двух запросов
+func (r *PostgresWalletRepository) CreateWallet(ctx context.Context, req model.CreateWalletRequest) (model.Wallet, error) {
+	req, err := validateCreateWallet(req)
+	if err != nil {
+		return model.Wallet{}, err
+	}
+
+	wallet, err := scanWallet(r.pool.QueryRow(ctx, `
+		INSERT INTO wallets (balance, currency, wallet_type, owner_id, external_id, labels) 
+		VALUES (0, $1, $2, NULLIF($3, ''), NULLIF($4, ''), $5) 
+		ON CONFLICT ((COALESCE(owner_id, '')), external_id) WHERE external_id IS NOT NULL DO NOTHING
+		RETURNING `+walletColumns,
+		string(req.Currency), string(req.WalletType), req.OwnerID, req.ExternalID, tagsArg(req.Labels)))
+	if err != pgx.ErrNoRows {
+		return wallet, err
+	}
+
+	// Кошелёк с этим externalId уже есть
+	existing, err := r.GetWalletByExternalID(ctx, req.OwnerID, req.ExternalID)
+	if err != nil {
+		return model.Wallet{}, err
+	}
+	return replayedWallet(existing, req)
+}
+
+// validateCreateWallet — запрос на создание кошелька со значениями по умолчанию
+func validateCreateWallet(req model.CreateWalletRequest) (model.CreateWalletRequest, error) {
+	req = req.WithDefaults()
+	if !req.Currency.IsSupported() {
+		return req, fmt.Errorf("%w: %q", errors.UnsupportedCurrency, req.Currency)
+	}
+	if !req.WalletType.IsValid() {
+		return req, fmt.Errorf("%w: %q", errors.InvalidWalletType, req.WalletType)
+	}
+	if err := req.ValidateOwnership(); err != nil {
+		return req, fmt.Errorf("%w: %v", errors.InvalidWalletOwner, err)
+	}
+	return req, nil
 }
 
-// GetBalance возвращает текущий баланс
-func (r *PostgresWalletRepository) GetBalance(ctx context.Context, walletID uuid.UUID) (int64, error) {
-	var balance int64
+// GetBalance возвращает текущий и доступный (за вычетом холдов) баланс,
+// статус кошелька и остаток кредитной линии
+func (r *PostgresWalletRepository) GetBalance(ctx context.Context, walletID uuid.UUID) (model.WalletBalance, error) {
+	wb := model.WalletBalance{WalletID: walletID}
 	err := r.pool.QueryRow(ctx, `
-		SELECT balance 
+		SELECT balance, currency, status, wallet_type, overdraft_limit, version, (`+heldAmountSQL+`)
 		FROM wallets 
 		WHERE id = $1
-	`, walletID).Scan(&balance)
+	`, walletID).Scan(&wb.Balance, &wb.Currency, &wb.Status, &wb.WalletType, &wb.OverdraftLimit, &wb.Version, &wb.Held)
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			return 0, fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
+			return wb, fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
 		}
-		return 0, err
+		return wb, err
 	}
-	return balance, nil
+	wb.Available = wb.Balance - wb.Held
+	wb.CreditAvailable = model.CreditAvailable(wb.Available, wb.OverdraftLimit)
+	return wb, nil
 }
 
 // UpdateBalance — атомарное обновление баланса
 // isDeposit = true → +amount, false → -amount (с проверкой на отрицательный баланс!)
 func (r *PostgresWalletRepository) UpdateBalance(ctx context.Context, walletID uuid.UUID, amount int64, isDeposit bool) error {
+	op := model.WalletOperation{WalletID: walletID, OperationType: model.OperationWithdraw, Amount: amount}
+	if isDeposit {
+		op.OperationType = model.OperationDeposit
+	}
+	_, err := r.ApplyOperation(ctx, op, model.OperationOptions{})
+	return err
+}
+
+// ApplyOperation проводит DEPOSIT/WITHDRAW. С Idempotency-Key ключ, отпечаток
+// запроса и ответ сохраняются в той же транзакции, что и изменение баланса:
+// повтор с тем же ключом получает сохранённый ответ и ничего не списывает.
+func (r *PostgresWalletRepository) ApplyOperation(ctx context.Context, op model.WalletOperation, opts model.OperationOptions) (model.OperationResult, error) {
 	tx, err := r.pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("begin tx: %w", err)
+		return model.OperationResult{}, fmt.Errorf("begin tx: %w", err)
 	}
 	defer tx.Rollback(ctx) // откат при ошибке
 
+	if opts.IdempotencyKey != "" {
+		stored, replay, err := r.claimIdempotencyKey(ctx, tx, opts.IdempotencyKey, op.Fingerprint())
+		if err != nil {
+			return model.OperationResult{}, err
+		}
+		if replay {
+			return stored, nil
+		}
+	}
+
+	// If-Match проверяется под блокировкой кошелька, которую applyOperation возьмёт повторно
+	if opts.IfMatch != "" {
+		wallet, err := lockWallet(ctx, tx, op.WalletID)
+		if err != nil {
+			return model.OperationResult{}, err
+		}
+		held, err := heldAmount(ctx, tx, op.WalletID)
+		if err != nil {
+			return model.OperationResult{}, err
+		}
+		if err := checkPrecondition(wallet, held, opts.IfMatch); err != nil {
+			return model.OperationResult{}, err
+		}
+	}
+
+	result, err := r.applyOperation(ctx, tx, op)
+	if err != nil {
+		return model.OperationResult{}, err
+	}
+
+	if opts.IdempotencyKey != "" {
+		if err := saveIdempotentResponse(ctx, tx, opts.IdempotencyKey, result); err != nil {
+			return model.OperationResult{}, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return model.OperationResult{}, fmt.Errorf("commit: %w", err)
+	}
+	return result, nil
+}
+
+// applyOperation — изменение баланса внутри уже открытой транзакции
+func (r *PostgresWalletRepository) applyOperation(ctx context.Context, tx pgx.Tx, op model.WalletOperation) (model.OperationResult, error) {
+	if err := validateMetadata(op.Metadata); err != nil {
+		return model.OperationResult{}, err
+	}
+	isDeposit := op.OperationType == model.OperationDeposit
+
 	// 🔒 Блокируем строку кошелька на время транзакции
-	var currentBalance int64
+	wallet, err := lockWallet(ctx, tx, op.WalletID)
+	if err != nil {
+		return model.OperationResult{}, err
+	}
+	if err := checkWalletStatus(wallet, !isDeposit, r.freezeBlocksCredits); err != nil {
+		return model.OperationResult{}, err
+	}
+	if op.Currency != "" && op.Currency != wallet.currency {
+		return model.OperationResult{}, fmt.Errorf("%w: wallet %s, operation %s", errors.CurrencyMismatch, wallet.currency, op.Currency)
+	}
+	if err := checkExternalRef(ctx, tx, op.WalletID, op.ExternalRef); err != nil {
+		return model.OperationResult{}, err
+	}
+	currentBalance := wallet.balance
+
+	// Комиссия считается и списывается в той же транзакции, что и операция
+	var fee int64
+	if !isDeposit {
+		if fee, err = r.computeFee(ctx, tx, model.FeeOnWithdraw, wallet, op.Amount); err != nil {
+			return model.OperationResult{}, err
+		}
+	}
+
+	// Проверяем лимиты на списания и хватит ли доступных средств (за вычетом холдов, с кредитной линией) при WITHDRAW
+	if !isDeposit {
+		if err := r.checkLimits(ctx, tx, wallet, op.Amount, fee); err != nil {
+			return model.OperationResult{}, err
+		}
+		held, err := heldAmount(ctx, tx, op.WalletID)
+		if err != nil {
+			return model.OperationResult{}, err
+		}
+		if available := wallet.spendable(held); available < op.Amount+fee {
+			return model.OperationResult{}, fmt.Errorf("%w: available %d, withdraw %d, fee %d", errors.InsufficientFunds, available, op.Amount, fee)
+		}
+	}
+
+	// Проводим через главную книгу: кошелёк ↔ внешний источник/получатель
+	entryType, postings := operationPostings(op, fee)
+	entryID, err := postEntry(ctx, tx, entryType, wallet.currency, postings)
+	if err != nil {
+		return model.OperationResult{}, err
+	}
+
+	// Логируем операцию в transactions
+	t := model.Transaction{
+		WalletID:      op.WalletID,
+		OperationType: op.OperationType,
+		Amount:        op.Amount,
+		Fee:           fee,
+		EntryID:       &entryID,
+		Metadata:      op.Metadata,
+	}
+	if t.ID, err = insertTransaction(ctx, tx, t); err != nil {
+		return model.OperationResult{}, err
+	}
+
+	// Событие для подписчиков — в той же транзакции (transactional outbox)
+	newBalance := currentBalance + t.BalanceDelta()
+	if err := insertOutboxEvent(ctx, tx, model.NewBalanceChanged(t, newBalance)); err != nil {
+		return model.OperationResult{}, err
+	}
+
+	return model.OperationResult{
+		WalletID:      op.WalletID,
+		OperationType: op.OperationType,
+		Amount:        op.Amount,
+		Fee:           fee,
+		Currency:      wallet.currency,
+		Status:        model.OperationStatusAccepted,
+	}, nil
+}
+
+// Transfer — перевод между кошельками в одной транзакции.
+// Обе строки блокируются в порядке возрастания id, поэтому встречные
+// переводы A→B и B→A не могут взаимно заблокироваться.
+func (r *PostgresWalletRepository) Transfer(ctx context.Context, fromID, toID uuid.UUID, amount int64) (model.Transfer, error) {
+	if fromID == toID {
+		return model.Transfer{}, errors.SameWallet
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return model.Transfer{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// 🔒 Фиксированный порядок блокировок
+	wallets := make(map[uuid.UUID]lockedWallet, 2)
+	for _, id := range lockOrder(fromID, toID) {
+		wallet, err := lockWallet(ctx, tx, id)
+		if err != nil {
+			return model.Transfer{}, err
+		}
+		if err := checkWalletStatus(wallet, id == fromID, r.freezeBlocksCredits); err != nil {
+			return model.Transfer{}, err
+		}
+		wallets[id] = wallet
+	}
+	// Перевод — только между кошельками одной валюты
+	currency := wallets[fromID].currency
+	if to := wallets[toID].currency; to != currency {
+		return model.Transfer{}, fmt.Errorf("%w: %s → %s", errors.CurrencyMismatch, currency, to)
+	}
+
+	// Комиссию платит отправитель, сверх суммы перевода
+	fee, err := r.computeFee(ctx, tx, model.FeeOnTransfer, wallets[fromID], amount)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	if err := r.checkLimits(ctx, tx, wallets[fromID], amount, fee); err != nil {
+		return model.Transfer{}, err
+	}
+	held, err := heldAmount(ctx, tx, fromID)
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	if available := wallets[fromID].spendable(held); available < amount+fee {
+		return model.Transfer{}, fmt.Errorf("%w: available %d, transfer %d, fee %d", errors.InsufficientFunds, available, amount, fee)
+	}
+
+	entryID, err := postEntry(ctx, tx, model.EntryTransfer, currency, transferPostings(fromID, toID, amount, fee))
+	if err != nil {
+		return model.Transfer{}, err
+	}
 
-	sqlQuery := `SELECT balance 
+	transferID := uuid.New()
+	for _, leg := range transferLegs(transferID, entryID, fromID, toID, amount, fee) {
+		if leg.ID, err = insertTransaction(ctx, tx, leg); err != nil {
+			return model.Transfer{}, err
+		}
+		newBalance := wallets[leg.WalletID].balance + leg.BalanceDelta()
+		if err := insertOutboxEvent(ctx, tx, model.NewBalanceChanged(leg, newBalance)); err != nil {
+			return model.Transfer{}, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return model.Transfer{}, fmt.Errorf("commit: %w", err)
+	}
+	return newTransfer(transferID, fromID, toID, amount, fee), nil
+}
+
+// lockOrder возвращает id кошельков в порядке блокировки (по возрастанию).
+// Побайтовое сравнение совпадает с порядком типа uuid в PostgreSQL.
+func lockOrder(ids ...uuid.UUID) []uuid.UUID {
+	sorted := append([]uuid.UUID(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i][:], sorted[j][:]) < 0
+	})
+	return sorted
+}
+
+// lockWallet блокирует строку кошелька до конца транзакции (SELECT ... FOR UPDATE)
+// и возвращает текущий баланс, валюту, статус и тип
+func lockWallet(ctx context.Context, tx pgx.Tx, walletID uuid.UUID) (lockedWallet, error) {
+	w := lockedWallet{id: walletID}
+
+	sqlQuery := `SELECT balance, currency, status, wallet_type, overdraft_limit, version 
 		FROM wallets 
 		WHERE id = $1 
 		FOR UPDATE`
 
-	err = tx.QueryRow(ctx, sqlQuery, walletID).Scan(&currentBalance)
+	err := tx.QueryRow(ctx, sqlQuery, walletID).Scan(&w.balance, &w.currency, &w.status, &w.walletType, &w.overdraftLimit, &w.version)
 	if err != nil {
 		if err == pgx.ErrNoRows {
-			return fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
+			return w, fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
 		}
-		return fmt.Errorf("select for update: %w", err)
+		return w, fmt.Errorf("select for update: %w", err)
 	}
+	return w, nil
+}
 
-	// Проверяем, не уйдёт ли баланс в минус при WITHDRAW
-	if !isDeposit && currentBalance < amount {
-		return fmt.Errorf("%w: balance %d, withdraw %d", errors.InsufficientFunds, currentBalance, amount)
+// operationPostings — проводки DEPOSIT/WITHDRAW: деньги приходят с
+// EXTERNAL_CASH_IN и уходят на EXTERNAL_CASH_OUT, комиссия списания — на FEES
+func operationPostings(op model.WalletOperation, fee int64) (string, []model.Posting) {
+	wallet := model.WalletAccount(op.WalletID)
+	if op.OperationType == model.OperationDeposit {
+		return model.EntryDeposit, []model.Posting{
+			{Account: wallet, Amount: op.Amount},
+			{Account: model.SystemLedgerAccount(model.AccountExternalCashIn), Amount: -op.Amount},
+		}
 	}
+	return model.EntryWithdraw, withFee([]model.Posting{
+		{Account: wallet, Amount: -op.Amount - fee},
+		{Account: model.SystemLedgerAccount(model.AccountExternalCashOut), Amount: op.Amount},
+	}, fee)
+}
 
-	// Обновляем баланс
-	newBalance := currentBalance
-	if isDeposit {
-		newBalance += amount
-	} else {
-		newBalance -= amount
+// insertTransaction пишет операцию в журнал transactions и возвращает её ID.
+// ID и created_at проставляет БД.
+func insertTransaction(ctx context.Context, tx pgx.Tx, t model.Transaction) (uuid.UUID, error) {
+	sqlQuery := `
+		INSERT INTO transactions (wallet_id, operation_type, amount, transfer_id, entry_id, reason, hold_id, quote_id, fx_rate, fee, reverses_id,
+			external_ref, description, tags)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, NULLIF($9, '')::numeric, $10, $11, NULLIF($12, ''), NULLIF($13, ''), $14)
+		RETURNING id`
+
+	var id uuid.UUID
+	err := tx.QueryRow(ctx, sqlQuery, t.WalletID, string(t.OperationType), t.Amount, t.TransferID, t.EntryID, t.Reason, t.HoldID, t.QuoteID, t.FXRate, t.Fee, t.ReversesID,
+		t.ExternalRef, t.Description, tagsArg(t.Tags)).Scan(&id)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("insert transaction: %w", err)
 	}
+	return id, nil
+}
 
-	sqlQuery = `
-	UPDATE wallets
-	SET balance = $1, updated_at = NOW()
-	WHERE id = $2
-	`
-	_, err = tx.Exec(ctx, sqlQuery, newBalance, walletID)
+const transactionColumns = `id, wallet_id, operation_type, amount, fee, transfer_id, entry_id, COALESCE(reason, ''), hold_id,
+	quote_id, COALESCE(fx_rate::text, ''), created_at, reverses_id, reversed_amount, COALESCE(external_ref, ''), COALESCE(description, ''), tags`
+
+func scanTransaction(row pgx.Row) (model.Transaction, error) {
+	var t model.Transaction
+	var opType string
+	err := row.Scan(&t.ID, &t.WalletID, &opType, &t.Amount, &t.Fee, &t.TransferID, &t.EntryID, &t.Reason, &t.HoldID,
+		&t.QuoteID, &t.FXRate, &t.CreatedAt, &t.ReversesID, &t.ReversedAmount, &t.ExternalRef, &t.Description, &t.Tags)
+	t.OperationType = model.OperationType(opType)
+	return t, err
+}
+
+// GetTransactions возвращает историю операций кошелька, от новых к старым.
+// Пагинация — по курсору (created_at, id) последней записи предыдущей страницы.
+func (r *PostgresWalletRepository) GetTransactions(ctx context.Context, walletID uuid.UUID, filter model.TransactionFilter) (model.TransactionPage, error) {
+	page := model.TransactionPage{Items: []model.Transaction{}}
+
+	var exists bool
+	err := r.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM wallets WHERE id = $1)`, walletID).Scan(&exists)
 	if err != nil {
-		return fmt.Errorf("update balance: %w", err)
+		return page, fmt.Errorf("check wallet: %w", err)
+	}
+	if !exists {
+		return page, fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
 	}
 
-	// Логируем операцию в transactions
-	opType := "DEPOSIT"
-	if !isDeposit {
-		opType = "WITHDRAW"
+	limit := normalizeLimit(filter.Limit)
+
+	sqlQuery := `SELECT ` + transactionColumns + ` FROM transactions WHERE wallet_id = $1`
+	args := []any{walletID}
+
+	// where добавляет условие; %d в cond заменяется номером нового аргумента
+	where := func(cond string, value any) {
+		args = append(args, value)
+		sqlQuery += " AND " + fmt.Sprintf(cond, len(args))
+	}
+
+	if filter.OperationType != "" {
+		where("operation_type = $%d", string(filter.OperationType))
+	}
+	if filter.ExternalRef != "" {
+		where("external_ref = $%d", filter.ExternalRef)
+	}
+	if filter.MinAmount != nil {
+		where("amount >= $%d", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		where("amount <= $%d", *filter.MaxAmount)
+	}
+	if filter.From != nil {
+		where("created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		where("created_at < $%d", *filter.To)
+	}
+	if filter.Cursor != "" {
+		createdAt, id, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return page, err
+		}
+		args = append(args, createdAt, id)
+		sqlQuery += fmt.Sprintf(" AND (created_at, id) < ($%d, $%d)", len(args)-1, len(args))
 	}
 
-	sqlQuery = `
-		INSERT INTO transactions (wallet_id, operation_type, amount)
-		VALUES ($1, $2, $3)`
+	// Берём на одну запись больше — так узнаём, есть ли следующая страница
+	args = append(args, limit+1)
+	sqlQuery += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", len(args))
 
-	_, err = tx.Exec(ctx, sqlQuery, walletID, opType, amount)
+	rows, err := r.pool.Query(ctx, sqlQuery, args...)
 	if err != nil {
-		return fmt.Errorf("insert transaction: %w", err)
+		return page, fmt.Errorf("select transactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return page, fmt.Errorf("scan transaction: %w", err)
+		}
+		page.Items = append(page.Items, t)
+	}
+	if err := rows.Err(); err != nil {
+		return page, fmt.Errorf("read transactions: %w", err)
 	}
 
-	return tx.Commit(ctx)
+	if len(page.Items) > limit {
+		page.Items = page.Items[:limit]
+		last := page.Items[limit-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	if err := r.fillReversedBy(ctx, page.Items); err != nil {
+		return page, err
+	}
+	return page, nil
+}
+
+// fillReversedBy проставляет строкам ссылки на их возвраты — обратные к reverses_id
+func (r *PostgresWalletRepository) fillReversedBy(ctx context.Context, items []model.Transaction) error {
+	var ids []uuid.UUID
+	for _, t := range items {
+		if t.ReversedAmount > 0 {
+			ids = append(ids, t.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT reverses_id, id FROM transactions
+		WHERE reverses_id = ANY($1::uuid[])
+		ORDER BY created_at, id`, ids)
+	if err != nil {
+		return fmt.Errorf("select reversals: %w", err)
+	}
+	defer rows.Close()
+
+	reversedBy := make(map[uuid.UUID][]uuid.UUID, len(ids))
+	for rows.Next() {
+		var originalID, id uuid.UUID
+		if err := rows.Scan(&originalID, &id); err != nil {
+			return fmt.Errorf("scan reversal: %w", err)
+		}
+		reversedBy[originalID] = append(reversedBy[originalID], id)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read reversals: %w", err)
+	}
+	for i := range items {
+		items[i].ReversedBy = reversedBy[items[i].ID]
+	}
+	return nil
+}
+
+// normalizeLimit приводит limit к допустимому диапазону
+func normalizeLimit(limit int) int {
+	if limit <= 0 {
+		return model.DefaultTransactionsLimit
+	}
+	if limit > model.MaxTransactionsLimit {
+		return model.MaxTransactionsLimit
+	}
+	return limit
 }
 
 // TruncateTables — очищает таблицы (только для тестов!)
 func (r *PostgresWalletRepository) TruncateTables(ctx context.Context) error {
-	_, err := r.pool.Exec(ctx, "TRUNCATE TABLE transactions, wallets RESTART IDENTITY CASCADE")
+	_, err := r.pool.Exec(ctx, "TRUNCATE TABLE balance_snapshots, webhook_deliveries, webhook_subscriptions, outbox_events, holds, wallet_status_history, wallet_overdraft_history, limit_policies, fx_quotes, fx_rates, fee_rules, idempotency_keys, postings, journal_entries, transactions, wallets RESTART IDENTITY CASCADE")
 	return err
 }
@@ -1,133 +1,225 @@
-package repository
+package repository_test
 
 import (
 	"context"
-	"fmt"
-	"sync"
+	"os"
 	"testing"
 	"time"
 
-	"github.com/fangimal/ITK/internal/errors"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
+
+	"github.com/fangimal/ITK/internal/config"
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/migrations"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/fangimal/ITK/internal/repository"
+	"github.com/fangimal/ITK/internal/repository/repotest"
 )
 
 func TestPostgresWalletRepository(t *testing.T) {
-	ctx := context.Background()
-
-	// Запускаем PostgreSQL через GenericContainer
-	req := testcontainers.ContainerRequest{
-		Image: "postgres:16-alpine",
-		Env: map[string]string{
-			"POSTGRES_USER":     "test_user",
-			"POSTGRES_PASSWORD": "test_pass",
-			"POSTGRES_DB":       "test_wallet_db",
-		},
-		ExposedPorts: []string{"5432/tcp"},
-		WaitingFor:   wait.ForLog("database system is ready to accept connections").WithOccurrence(2).WithStartupTimeout(30 * time.Second),
+	if testing.Short() {
+		t.Skip("skipping testcontainers test in -short mode")
 	}
 
-	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
-		ContainerRequest: req,
-		Started:          true,
+	repo := connectPostgres(t, postgresConfig(t))
+	repotest.RunConformance(t, func(t *testing.T) repository.WalletRepository {
+		return repo
 	})
-	require.NoError(t, err)
-	defer container.Terminate(ctx)
+}
 
-	// Получаем host и port для подключения
-	host, err := container.Host(ctx)
-	require.NoError(t, err)
-	port, err := container.MappedPort(ctx, "5432")
+func TestPostgresMigrations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping testcontainers test in -short mode")
+	}
+
+	ctx := context.Background()
+	cfg := postgresConfig(t)
+	conn, err := pgx.Connect(ctx, cfg.PostgresDSN())
 	require.NoError(t, err)
+	defer conn.Close(ctx)
 
-	connStr := fmt.Sprintf(
-		"host=%s port=%s user=test_user password=test_pass dbname=test_wallet_db sslmode=disable",
-		host, port.Port(),
-	)
+	all, err := migrations.All()
+	require.NoError(t, err)
 
-	// Подключаемся
-	pool, err := pgxpool.New(ctx, connStr)
+	// postgresConfig уже всё применил: повторный Up ничего не делает
+	applied, err := migrations.Up(ctx, conn)
 	require.NoError(t, err)
-	defer pool.Close()
+	assert.Empty(t, applied)
 
-	// Инициализация БД (минимальная)
-	sqlQuery := `
-	CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
-	CREATE TABLE IF NOT EXISTS wallets (
-		id         UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-		balance    BIGINT NOT NULL DEFAULT 0,
-		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-	);
-	CREATE TABLE IF NOT EXISTS transactions (
-		id             UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-		wallet_id      UUID NOT NULL REFERENCES wallets(id),
-		operation_type TEXT NOT NULL,
-		amount         BIGINT NOT NULL,
-		created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
-	);`
+	statuses, err := migrations.GetStatus(ctx, conn)
+	require.NoError(t, err)
+	require.Len(t, statuses, len(all))
+	for _, s := range statuses {
+		assert.NotNil(t, s.AppliedAt, s.Migration.String())
+		assert.False(t, s.Modified, s.Migration.String())
+	}
 
-	_, err = pool.Exec(ctx, sqlQuery)
+	// Изменённая после применения миграция останавливает Up
+	_, err = conn.Exec(ctx, `UPDATE schema_migrations SET checksum = 'changed' WHERE version = $1`, all[0].Version)
+	require.NoError(t, err)
+	_, err = migrations.Up(ctx, conn)
+	assert.ErrorIs(t, err, errors.MigrationModified)
+	statuses, err = migrations.GetStatus(ctx, conn)
 	require.NoError(t, err)
+	assert.True(t, statuses[0].Modified)
 
-	repo := &PostgresWalletRepository{pool: pool}
+	// Применённая, но незнакомая бинарнику миграция видна в статусе
+	_, err = conn.Exec(ctx, `UPDATE schema_migrations SET checksum = $1 WHERE version = $2`, all[0].Checksum, all[0].Version)
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, `INSERT INTO schema_migrations (version, name, checksum) VALUES (9999, 'future', 'x')`)
+	require.NoError(t, err)
+	statuses, err = migrations.GetStatus(ctx, conn)
+	require.NoError(t, err)
+	last := statuses[len(statuses)-1]
+	assert.Equal(t, 9999, last.Version)
+	assert.True(t, last.Unknown)
+}
 
-	t.Run("CreateWallet", func(t *testing.T) {
-		id, err := repo.CreateWallet(ctx)
-		require.NoError(t, err)
-		assert.NotEmpty(t, id)
-	})
+// База, поднятая прежним docker/db-init/01-init.sql, обновляется миграциями
+// до текущей схемы без потери данных
+func TestPostgresMigrationsUpgradeFromBaseline(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping testcontainers test in -short mode")
+	}
 
-	t.Run("GetBalance and UpdateBalance", func(t *testing.T) {
-		id, err := repo.CreateWallet(ctx)
-		require.NoError(t, err)
+	ctx := context.Background()
+	cfg := startPostgres(t)
+	conn, err := pgx.Connect(ctx, cfg.PostgresDSN())
+	require.NoError(t, err)
+	defer conn.Close(ctx)
 
-		balance, err := repo.GetBalance(ctx, id)
-		require.NoError(t, err)
-		assert.Equal(t, int64(0), balance)
+	all, err := migrations.All()
+	require.NoError(t, err)
 
-		// DEPOSIT
-		err = repo.UpdateBalance(ctx, id, 1000, true)
-		require.NoError(t, err)
+	// Исходная схема накатывается так же, как init-скрипт: без schema_migrations
+	_, err = conn.Exec(ctx, all[0].SQL)
+	require.NoError(t, err)
+	var walletID uuid.UUID
+	err = conn.QueryRow(ctx, `INSERT INTO wallets (balance) VALUES (700) RETURNING id`).Scan(&walletID)
+	require.NoError(t, err)
+	_, err = conn.Exec(ctx, `
+		INSERT INTO transactions (wallet_id, operation_type, amount, created_at) VALUES
+			($1, 'DEPOSIT', 1000, NOW() - INTERVAL '2 days'),
+			($1, 'WITHDRAW', 300, NOW() - INTERVAL '1 day')`, walletID)
+	require.NoError(t, err)
 
-		balance, err = repo.GetBalance(ctx, id)
-		require.NoError(t, err)
-		assert.Equal(t, int64(1000), balance)
+	applied, err := migrations.Up(ctx, conn)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(all))
+	statuses, err := migrations.GetStatus(ctx, conn)
+	require.NoError(t, err)
+	for _, s := range statuses {
+		assert.NotNil(t, s.AppliedAt, s.Migration.String())
+	}
 
-		// WITHDRAW
-		err = repo.UpdateBalance(ctx, id, 300, false)
-		require.NoError(t, err)
+	repo := connectPostgres(t, cfg)
 
-		balance, err = repo.GetBalance(ctx, id)
-		require.NoError(t, err)
-		assert.Equal(t, int64(700), balance)
+	// Старый кошелёк получил значения новых колонок по умолчанию
+	balance, err := repo.GetBalance(ctx, walletID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(700), balance.Balance)
+	assert.Equal(t, model.DefaultCurrency, balance.Currency)
+	assert.Equal(t, model.WalletActive, balance.Status)
 
-		// Insufficient funds
-		err = repo.UpdateBalance(ctx, id, 1000, false)
-		assert.Error(t, err)
-		assert.ErrorIs(t, err, errors.InsufficientFunds)
-	})
+	// Старым операциям дописаны записи главной книги
+	page, err := repo.GetTransactions(ctx, walletID, model.TransactionFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	for _, tx := range page.Items {
+		assert.NotNil(t, tx.EntryID, tx.OperationType)
+	}
+	ledger, err := repo.CheckLedger(ctx)
+	require.NoError(t, err)
+	assert.True(t, ledger.Balanced)
+	assert.Empty(t, ledger.WalletMismatches)
+	report, err := repo.Reconcile(ctx, model.ReconcileOptions{})
+	require.NoError(t, err)
+	assert.False(t, report.DriftDetected)
 
-	t.Run("WalletNotFound", func(t *testing.T) {
-		fakeID := uuid.New()
-		_, err := repo.GetBalance(ctx, fakeID)
-		assert.Error(t, err)
-		assert.ErrorIs(t, err, errors.WalletNotFound)
-	})
+	// И кошелёк работает как новый
+	_, err = repo.ApplyOperation(ctx, model.WalletOperation{
+		WalletID: walletID, OperationType: model.OperationWithdraw, Amount: 200,
+	}, model.OperationOptions{})
+	require.NoError(t, err)
+	balance, err = repo.GetBalance(ctx, walletID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(500), balance.Balance)
+	asOf, err := repo.GetBalanceAsOf(ctx, walletID, time.Now().Add(-36*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), asOf.Balance)
 }
 
-func TestConcurrency_OnlyDeposits(t *testing.T) {
+// Операция, заблокировавшая кошелёк до момента снимка и зафиксированная
+// после начала снимка, попадает в снимок: он дожидается её коммита
+func TestPostgresSnapshotBalancesWaitsForInFlight(t *testing.T) {
 	if testing.Short() {
-		t.Skip("skipping concurrency test in -short mode")
+		t.Skip("skipping testcontainers test in -short mode")
+	}
+
+	ctx := context.Background()
+	cfg := postgresConfig(t)
+	repo := connectPostgres(t, cfg)
+	wallet, err := repo.CreateWallet(ctx, model.CreateWalletRequest{})
+	require.NoError(t, err)
+	_, err = repo.ApplyOperation(ctx, model.WalletOperation{
+		WalletID: wallet.ID, OperationType: model.OperationDeposit, Amount: 50,
+	}, model.OperationOptions{})
+	require.NoError(t, err)
+
+	conn, err := pgx.Connect(ctx, cfg.PostgresDSN())
+	require.NoError(t, err)
+	defer conn.Close(ctx)
+	tx, err := conn.Begin(ctx)
+	require.NoError(t, err)
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(ctx, `UPDATE wallets SET balance = balance + 100 WHERE id = $1`, wallet.ID)
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx, `INSERT INTO transactions (wallet_id, operation_type, amount) VALUES ($1, 'DEPOSIT', 100)`, wallet.ID)
+	require.NoError(t, err)
+	var at time.Time
+	require.NoError(t, tx.QueryRow(ctx, `SELECT clock_timestamp()`).Scan(&at))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := repo.SnapshotBalances(ctx, at)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("snapshot finished before the operation committed: %v", err)
+	case <-time.After(500 * time.Millisecond):
 	}
+	require.NoError(t, tx.Commit(ctx))
+	require.NoError(t, <-done)
 
+	hb, err := repo.GetBalanceAsOf(ctx, wallet.ID, at)
+	require.NoError(t, err)
+	assert.Equal(t, int64(150), hb.Balance)
+}
+
+// postgresConfig поднимает PostgreSQL в контейнере со схемой и возвращает
+// конфигурацию подключения к нему
+func postgresConfig(tb testing.TB) *config.Config {
+	tb.Helper()
+
+	cfg := startPostgres(tb)
+	// Схема — та же, что поднимается в docker-compose
+	applySchema(tb, context.Background(), cfg)
+	return cfg
+}
+
+// startPostgres поднимает PostgreSQL в контейнере с пустой базой
+func startPostgres(tb testing.TB) *config.Config {
+	tb.Helper()
 	ctx := context.Background()
+	skipWithoutDocker(tb)
 
-	// Запускаем PostgreSQL
+	// Запускаем PostgreSQL через GenericContainer
 	req := testcontainers.ContainerRequest{
 		Image: "postgres:16-alpine",
 		Env: map[string]string{
@@ -136,95 +228,80 @@ func TestConcurrency_OnlyDeposits(t *testing.T) {
 			"POSTGRES_DB":       "test_wallet_db",
 		},
 		ExposedPorts: []string{"5432/tcp"},
-		WaitingFor:   wait.ForLog("database system is ready to accept connections").WithOccurrence(2),
+		WaitingFor:   wait.ForLog("database system is ready to accept connections").WithOccurrence(2).WithStartupTimeout(30 * time.Second),
 	}
 
 	container, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
 		ContainerRequest: req,
 		Started:          true,
 	})
-	require.NoError(t, err)
-	defer container.Terminate(ctx)
+	require.NoError(tb, err)
+	tb.Cleanup(func() { _ = container.Terminate(ctx) })
 
+	// Получаем host и port для подключения
 	host, err := container.Host(ctx)
-	require.NoError(t, err)
+	require.NoError(tb, err)
 	port, err := container.MappedPort(ctx, "5432")
-	require.NoError(t, err)
+	require.NoError(tb, err)
 
-	connStr := fmt.Sprintf(
-		"host=%s port=%s user=test_user password=test_pass dbname=test_wallet_db sslmode=disable",
-		host, port.Port(),
-	)
-
-	pool, err := pgxpool.New(ctx, connStr)
-	require.NoError(t, err)
-	defer pool.Close()
-
-	sqlQuery := `CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
-	CREATE TABLE IF NOT EXISTS wallets (
-		id         UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-		balance    BIGINT NOT NULL DEFAULT 0,
-		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-	);
-	CREATE TABLE IF NOT EXISTS transactions (
-		id             UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-		wallet_id      UUID NOT NULL REFERENCES wallets(id),
-		operation_type TEXT NOT NULL,
-		amount         BIGINT NOT NULL,
-		created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
-	);`
-
-	_, err = pool.Exec(ctx, sqlQuery)
-	require.NoError(t, err)
-
-	repo := &PostgresWalletRepository{pool: pool}
-
-	// Создаём кошелёк
-	walletID, err := repo.CreateWallet(ctx)
-	require.NoError(t, err)
-
-	// Параметры
-	const (
-		numGoroutines = 1000
-		amount        = 7 // любое положительное число
-	)
-
-	var wg sync.WaitGroup
-	errCh := make(chan error, numGoroutines)
-
-	// Запускаем 1000 горутин: все — DEPOSIT
-	for i := 0; i < numGoroutines; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			err := repo.UpdateBalance(ctx, walletID, amount, true) // только DEPOSIT
-			if err != nil {
-				select {
-				case errCh <- err:
-				default:
-				}
-			}
-		}()
-	}
+	cfg := &config.Config{
+		DBHost:    host,
+		DBPort:    port.Port(),
+		DBUser:    "test_user",
+		DBPass:    "test_pass",
+		DBName:    "test_wallet_db",
+		DBSSLMode: "disable",
 
-	wg.Wait()
-	close(errCh)
+		IdempotencyTTL: time.Hour,
+	}
+	return cfg
+}
 
-	// Проверяем, что НЕТ критических ошибок
-	for err := range errCh {
-		t.Fatalf("❌ Критическая ошибка в конкурентной среде: %v", err)
+// skipWithoutDocker пропускает тест, если Docker недоступен. Без Docker
+// testcontainers паникует и роняет весь тестовый бинарник вместе с тестами,
+// которым Docker не нужен. То же делает testcontainers.SkipIfProviderIsNotHealthy,
+// но он принимает только *testing.T, а postgresConfig нужен и бенчмаркам.
+// С REQUIRE_DOCKER (так запускает CI) тест без Docker падает, а не пропускается.
+func skipWithoutDocker(tb testing.TB) {
+	tb.Helper()
+	unavailable := tb.Skipf
+	if os.Getenv("REQUIRE_DOCKER") != "" {
+		unavailable = tb.Fatalf
 	}
+	defer func() {
+		if r := recover(); r != nil {
+			unavailable("Docker is not available: %v", r)
+		}
+	}()
+
+	provider, err := testcontainers.ProviderDocker.GetProvider()
+	if err != nil {
+		unavailable("Docker is not available: %v", err)
+	}
+	defer provider.Close()
+	if err := provider.Health(context.Background()); err != nil {
+		unavailable("Docker is not available: %v", err)
+	}
+}
 
-	// Проверяем баланс
-	balance, err := repo.GetBalance(ctx, walletID)
-	require.NoError(t, err)
+// connectPostgres подключает репозиторий к поднятой postgresConfig базе
+func connectPostgres(tb testing.TB, cfg *config.Config) *repository.PostgresWalletRepository {
+	tb.Helper()
+	repo, err := repository.NewPostgresWalletRepository(cfg)
+	require.NoError(tb, err)
+	tb.Cleanup(repo.Close)
+	return repo
+}
 
-	expected := int64(numGoroutines) * amount
-	if balance != expected {
-		t.Errorf("❌ Баланс неверен: получено %d, ожидалось %d", balance, expected)
-		t.Fail()
-	}
+// applySchema накатывает миграции из internal/migrations — те же, что
+// применяет сервер при старте, поэтому схема в тестах не расходится с рабочей
+func applySchema(tb testing.TB, ctx context.Context, cfg *config.Config) {
+	tb.Helper()
+
+	conn, err := pgx.Connect(ctx, cfg.PostgresDSN())
+	require.NoError(tb, err)
+	defer conn.Close(ctx)
 
-	t.Logf("✅ Успешно: %d операций DEPOSIT по %d → баланс = %d", numGoroutines, amount, balance)
+	_, err = migrations.Up(ctx, conn)
+	require.NoError(tb, err)
 }
@@ -0,0 +1,2117 @@
+// Package repotest — общий набор проверок контракта repository.WalletRepository.
+//
+// Любая реализация (PostgreSQL, память, обёртки над ними) прогоняется через
+// RunConformance и обязана вести себя одинаково.
+package repotest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/fangimal/ITK/internal/repository"
+)
+
+// Factory возвращает хранилище для очередной проверки. Проверки создают
+// собственные кошельки, поэтому одно хранилище можно отдавать повторно.
+type Factory func(t *testing.T) repository.WalletRepository
+
+// RunConformance прогоняет все проверки контракта против реализации
+func RunConformance(t *testing.T, newRepo Factory) {
+	t.Run("CreateWallet", func(t *testing.T) { testCreateWallet(t, newRepo(t)) })
+	t.Run("DepositWithdraw", func(t *testing.T) { testDepositWithdraw(t, newRepo(t)) })
+	t.Run("OverdraftRejected", func(t *testing.T) { testOverdraftRejected(t, newRepo(t)) })
+	t.Run("UnknownWallet", func(t *testing.T) { testUnknownWallet(t, newRepo(t)) })
+	t.Run("ConcurrentDeposits", func(t *testing.T) { testConcurrentDeposits(t, newRepo(t)) })
+	t.Run("ConcurrentDepositsAndWithdrawals", func(t *testing.T) { testConcurrentMixed(t, newRepo(t)) })
+	t.Run("AuditLog", func(t *testing.T) { testAuditLog(t, newRepo(t)) })
+	t.Run("HistoryFilters", func(t *testing.T) { testHistoryFilters(t, newRepo(t)) })
+	t.Run("Transfer", func(t *testing.T) { testTransfer(t, newRepo(t)) })
+	t.Run("OppositeTransfers", func(t *testing.T) { testOppositeTransfers(t, newRepo(t)) })
+	t.Run("IdempotencyKey", func(t *testing.T) { testIdempotencyKey(t, newRepo(t)) })
+	t.Run("Ledger", func(t *testing.T) { testLedger(t, newRepo(t)) })
+	t.Run("Reconcile", func(t *testing.T) { testReconcile(t, newRepo(t)) })
+	t.Run("Webhooks", func(t *testing.T) { testWebhooks(t, newRepo(t)) })
+	t.Run("Holds", func(t *testing.T) { testHolds(t, newRepo(t)) })
+	t.Run("ConcurrentHolds", func(t *testing.T) { testConcurrentHolds(t, newRepo(t)) })
+	t.Run("WalletStatus", func(t *testing.T) { testWalletStatus(t, newRepo(t)) })
+	t.Run("Currencies", func(t *testing.T) { testCurrencies(t, newRepo(t)) })
+	t.Run("FX", func(t *testing.T) { testFX(t, newRepo(t)) })
+	t.Run("Fees", func(t *testing.T) { testFees(t, newRepo(t)) })
+	t.Run("OverdraftLimit", func(t *testing.T) { testOverdraftLimit(t, newRepo(t)) })
+	t.Run("LimitPolicies", func(t *testing.T) { testLimitPolicies(t, newRepo(t)) })
+	t.Run("LimitUsage", func(t *testing.T) { testLimitUsage(t, newRepo(t)) })
+	t.Run("ConcurrentLimits", func(t *testing.T) { testConcurrentLimits(t, newRepo(t)) })
+	t.Run("Reversal", func(t *testing.T) { testReversal(t, newRepo(t)) })
+	t.Run("ReversalOverdraft", func(t *testing.T) { testReversalOverdraft(t, newRepo(t)) })
+	t.Run("Metadata", func(t *testing.T) { testMetadata(t, newRepo(t)) })
+	t.Run("WalletOwners", func(t *testing.T) { testWalletOwners(t, newRepo(t)) })
+	t.Run("Batch", func(t *testing.T) { testBatch(t, newRepo(t)) })
+	t.Run("ConcurrentBatches", func(t *testing.T) { testConcurrentBatches(t, newRepo(t)) })
+	t.Run("WalletBatch", func(t *testing.T) { testWalletBatch(t, newRepo(t)) })
+	t.Run("Versions", func(t *testing.T) { testVersions(t, newRepo(t)) })
+	t.Run("BalanceAsOf", func(t *testing.T) { testBalanceAsOf(t, newRepo(t)) })
+	t.Run("Statement", func(t *testing.T) { testStatement(t, newRepo(t)) })
+	t.Run("CaptureFee", func(t *testing.T) { testCaptureFee(t, newRepo(t)) })
+	t.Run("HoldLimits", func(t *testing.T) { testHoldLimits(t, newRepo(t)) })
+}
+
+func testCreateWallet(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+
+	wallet, err := repo.CreateWallet(ctx, model.CreateWalletRequest{})
+	require.NoError(t, err)
+	id := wallet.ID
+	assert.NotEqual(t, uuid.Nil, id)
+	assert.Equal(t, model.WalletActive, wallet.Status)
+
+	other := mustCreateWallet(t, repo)
+	assert.NotEqual(t, id, other)
+
+	// Новый кошелёк пуст
+	assertBalance(t, repo, id, 0)
+	page, err := repo.GetTransactions(ctx, id, model.TransactionFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, page.Items)
+}
+
+func testDepositWithdraw(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+
+	require.NoError(t, repo.UpdateBalance(ctx, id, 1000, true))
+	assertBalance(t, repo, id, 1000)
+
+	require.NoError(t, repo.UpdateBalance(ctx, id, 300, false))
+	assertBalance(t, repo, id, 700)
+
+	// Списание всего остатка допустимо
+	require.NoError(t, repo.UpdateBalance(ctx, id, 700, false))
+	assertBalance(t, repo, id, 0)
+
+	result, err := repo.ApplyOperation(ctx, model.WalletOperation{
+		WalletID:      id,
+		OperationType: model.OperationDeposit,
+		Amount:        42,
+	}, model.OperationOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, id, result.WalletID)
+	assert.Equal(t, model.OperationDeposit, result.OperationType)
+	assert.Equal(t, int64(42), result.Amount)
+	assert.Equal(t, model.OperationStatusAccepted, result.Status)
+	assert.False(t, result.Replayed)
+}
+
+func testOverdraftRejected(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 100, true))
+
+	err := repo.UpdateBalance(ctx, id, 101, false)
+	assert.ErrorIs(t, err, errors.InsufficientFunds)
+
+	// Отклонённая операция не меняет баланс и не попадает в журнал
+	assertBalance(t, repo, id, 100)
+	page, err := repo.GetTransactions(ctx, id, model.TransactionFilter{})
+	require.NoError(t, err)
+	assert.Len(t, page.Items, 1)
+}
+
+func testUnknownWallet(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	unknown := uuid.New()
+
+	_, err := repo.GetBalance(ctx, unknown)
+	assert.ErrorIs(t, err, errors.WalletNotFound)
+
+	err = repo.UpdateBalance(ctx, unknown, 10, true)
+	assert.ErrorIs(t, err, errors.WalletNotFound)
+
+	err = repo.UpdateBalance(ctx, unknown, 10, false)
+	assert.ErrorIs(t, err, errors.WalletNotFound)
+
+	_, err = repo.GetTransactions(ctx, unknown, model.TransactionFilter{})
+	assert.ErrorIs(t, err, errors.WalletNotFound)
+
+	known := mustCreateWallet(t, repo)
+	require.NoError(t, repo.UpdateBalance(ctx, known, 10, true))
+	_, err = repo.Transfer(ctx, known, unknown, 1)
+	assert.ErrorIs(t, err, errors.WalletNotFound)
+	_, err = repo.Transfer(ctx, unknown, known, 1)
+	assert.ErrorIs(t, err, errors.WalletNotFound)
+	assertBalance(t, repo, known, 10)
+}
+
+func testConcurrentDeposits(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+
+	const (
+		numGoroutines = 1000
+		amount        = 7
+	)
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := repo.UpdateBalance(ctx, id, amount, true); err != nil {
+				errCh <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		t.Fatalf("❌ Ошибка в конкурентной среде: %v", err)
+	}
+	assertBalance(t, repo, id, numGoroutines*amount)
+}
+
+func testConcurrentMixed(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+
+	const (
+		initial       = 100
+		numGoroutines = 400
+	)
+	require.NoError(t, repo.UpdateBalance(ctx, id, initial, true))
+
+	// Половина горутин пополняет на 1, половина списывает по 3:
+	// часть списаний упрётся в нехватку средств, но баланс не уйдёт в минус
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		withdrawn int64
+	)
+	errCh := make(chan error, numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func(deposit bool) {
+			defer wg.Done()
+			amount := int64(1)
+			if !deposit {
+				amount = 3
+			}
+			err := repo.UpdateBalance(ctx, id, amount, deposit)
+			switch {
+			case err == nil && !deposit:
+				mu.Lock()
+				withdrawn += amount
+				mu.Unlock()
+			case err != nil && !errors.Is(errors.InsufficientFunds, err):
+				errCh <- err
+			}
+		}(i%2 == 0)
+	}
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		t.Fatalf("❌ Ошибка в конкурентной среде: %v", err)
+	}
+
+	balance := assertBalance(t, repo, id, initial+numGoroutines/2-withdrawn)
+	assert.GreaterOrEqual(t, balance, int64(0))
+	assertLogMatchesBalance(t, repo, id)
+}
+
+func testAuditLog(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+
+	amounts := []int64{100, 200, 300, 400, 500}
+	for _, amount := range amounts {
+		require.NoError(t, repo.UpdateBalance(ctx, id, amount, true))
+	}
+	require.NoError(t, repo.UpdateBalance(ctx, id, 50, false))
+	_ = repo.UpdateBalance(ctx, id, 1_000_000, false) // отклонится и не попадёт в журнал
+
+	// Постранично обходим весь журнал: без дублей, от новых к старым
+	var all []model.Transaction
+	cursor := ""
+	for {
+		page, err := repo.GetTransactions(ctx, id, model.TransactionFilter{Limit: 2, Cursor: cursor})
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(page.Items), 2)
+		all = append(all, page.Items...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	require.Len(t, all, len(amounts)+1)
+	seen := make(map[uuid.UUID]bool)
+	for i, tx := range all {
+		assert.Equal(t, id, tx.WalletID)
+		assert.False(t, seen[tx.ID], "duplicate transaction %s", tx.ID)
+		seen[tx.ID] = true
+		if i > 0 {
+			assert.False(t, tx.CreatedAt.After(all[i-1].CreatedAt), "history must be newest first")
+		}
+	}
+	assert.Equal(t, model.OperationWithdraw, all[0].OperationType)
+	assert.Equal(t, int64(50), all[0].Amount)
+	assert.Equal(t, int64(100), all[len(all)-1].Amount)
+
+	assertLogMatchesBalance(t, repo, id)
+
+	_, err := repo.GetTransactions(ctx, id, model.TransactionFilter{Cursor: "not-a-cursor"})
+	assert.ErrorIs(t, err, errors.InvalidCursor)
+}
+
+func testHistoryFilters(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+
+	for _, amount := range []int64{100, 200, 300} {
+		require.NoError(t, repo.UpdateBalance(ctx, id, amount, true))
+	}
+	require.NoError(t, repo.UpdateBalance(ctx, id, 150, false))
+
+	page, err := repo.GetTransactions(ctx, id, model.TransactionFilter{OperationType: model.OperationWithdraw})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, int64(150), page.Items[0].Amount)
+
+	minAmount, maxAmount := int64(150), int64(250)
+	page, err = repo.GetTransactions(ctx, id, model.TransactionFilter{MinAmount: &minAmount, MaxAmount: &maxAmount})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, int64(150), page.Items[0].Amount)
+	assert.Equal(t, int64(200), page.Items[1].Amount)
+
+	// Диапазон дат: [from, to) по created_at
+	all, err := repo.GetTransactions(ctx, id, model.TransactionFilter{})
+	require.NoError(t, err)
+	require.Len(t, all.Items, 4)
+	from := all.Items[2].CreatedAt // вторая по времени операция
+	to := all.Items[0].CreatedAt   // самая новая — не включается
+	page, err = repo.GetTransactions(ctx, id, model.TransactionFilter{From: &from, To: &to})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	for _, tx := range page.Items {
+		assert.False(t, tx.CreatedAt.Before(from))
+		assert.True(t, tx.CreatedAt.Before(to))
+	}
+}
+
+func testTransfer(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	from := mustCreateWallet(t, repo)
+	to := mustCreateWallet(t, repo)
+	require.NoError(t, repo.UpdateBalance(ctx, from, 1000, true))
+
+	transfer, err := repo.Transfer(ctx, from, to, 300)
+	require.NoError(t, err)
+	assertBalance(t, repo, from, 700)
+	assertBalance(t, repo, to, 300)
+
+	// Обе ноги связаны общим transfer_id
+	page, err := repo.GetTransactions(ctx, from, model.TransactionFilter{OperationType: model.OperationTransferOut})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	require.NotNil(t, page.Items[0].TransferID)
+	assert.Equal(t, transfer.TransferID, *page.Items[0].TransferID)
+
+	page, err = repo.GetTransactions(ctx, to, model.TransactionFilter{})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, model.OperationTransferIn, page.Items[0].OperationType)
+	require.NotNil(t, page.Items[0].TransferID)
+	assert.Equal(t, transfer.TransferID, *page.Items[0].TransferID)
+
+	// Недостаточно средств — ни одна сторона не меняется
+	_, err = repo.Transfer(ctx, from, to, 701)
+	assert.ErrorIs(t, err, errors.InsufficientFunds)
+	assertBalance(t, repo, from, 700)
+	assertBalance(t, repo, to, 300)
+
+	_, err = repo.Transfer(ctx, from, from, 1)
+	assert.ErrorIs(t, err, errors.SameWallet)
+
+	assertLogMatchesBalance(t, repo, from)
+	assertLogMatchesBalance(t, repo, to)
+}
+
+func testOppositeTransfers(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	a := mustCreateWallet(t, repo)
+	b := mustCreateWallet(t, repo)
+	require.NoError(t, repo.UpdateBalance(ctx, a, 10000, true))
+	require.NoError(t, repo.UpdateBalance(ctx, b, 10000, true))
+
+	// Встречные переводы A→B и B→A не должны взаимно блокироваться
+	const rounds = 100
+	var wg sync.WaitGroup
+	errCh := make(chan error, 2*rounds)
+	for i := 0; i < rounds; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := repo.Transfer(ctx, a, b, 10); err != nil {
+				errCh <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := repo.Transfer(ctx, b, a, 10); err != nil {
+				errCh <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		t.Fatalf("❌ Ошибка встречного перевода: %v", err)
+	}
+	assertBalance(t, repo, a, 10000)
+	assertBalance(t, repo, b, 10000)
+}
+
+func testIdempotencyKey(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+
+	op := model.WalletOperation{WalletID: id, OperationType: model.OperationDeposit, Amount: 500}
+	opts := model.OperationOptions{IdempotencyKey: "key-" + uuid.NewString()}
+
+	first, err := repo.ApplyOperation(ctx, op, opts)
+	require.NoError(t, err)
+	assert.False(t, first.Replayed)
+
+	// Повтор — тот же ответ, деньги не зачисляются второй раз
+	second, err := repo.ApplyOperation(ctx, op, opts)
+	require.NoError(t, err)
+	assert.True(t, second.Replayed)
+	second.Replayed = false
+	assert.Equal(t, first, second)
+	assertBalance(t, repo, id, 500)
+
+	// Тот же ключ с другим телом
+	op.Amount = 600
+	_, err = repo.ApplyOperation(ctx, op, opts)
+	assert.ErrorIs(t, err, errors.IdempotencyKeyReused)
+
+	// Отклонённая операция ключ не занимает: после пополнения повтор проходит
+	withdraw := model.WalletOperation{WalletID: id, OperationType: model.OperationWithdraw, Amount: 800}
+	withdrawOpts := model.OperationOptions{IdempotencyKey: "key-" + uuid.NewString()}
+	_, err = repo.ApplyOperation(ctx, withdraw, withdrawOpts)
+	assert.ErrorIs(t, err, errors.InsufficientFunds)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 300, true))
+	_, err = repo.ApplyOperation(ctx, withdraw, withdrawOpts)
+	require.NoError(t, err)
+	assertBalance(t, repo, id, 0)
+
+	// Параллельные повторы одного ключа проводят операцию ровно один раз
+	op.Amount = 10
+	opts.IdempotencyKey = "key-" + uuid.NewString()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.ApplyOperation(ctx, op, opts)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assertBalance(t, repo, id, 10)
+}
+
+func testLedger(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	a := mustCreateWallet(t, repo)
+	b := mustCreateWallet(t, repo)
+
+	require.NoError(t, repo.UpdateBalance(ctx, a, 1000, true))
+	require.NoError(t, repo.UpdateBalance(ctx, a, 300, false))
+	transfer, err := repo.Transfer(ctx, a, b, 200)
+	require.NoError(t, err)
+
+	page, err := repo.GetTransactions(ctx, a, model.TransactionFilter{})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 3)
+
+	// Каждая операция — сбалансированная запись журнала
+	expected := map[model.OperationType][]model.Posting{
+		model.OperationDeposit: {
+			{Account: model.WalletAccount(a), Amount: 1000},
+			{Account: model.SystemLedgerAccount(model.AccountExternalCashIn), Amount: -1000},
+		},
+		model.OperationWithdraw: {
+			{Account: model.WalletAccount(a), Amount: -300},
+			{Account: model.SystemLedgerAccount(model.AccountExternalCashOut), Amount: 300},
+		},
+		model.OperationTransferOut: {
+			{Account: model.WalletAccount(a), Amount: -200},
+			{Account: model.WalletAccount(b), Amount: 200},
+		},
+	}
+	for _, tx := range page.Items {
+		require.NotNil(t, tx.EntryID, "transaction %s has no journal entry", tx.ID)
+		entry, err := repo.GetJournalEntry(ctx, *tx.EntryID)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, expected[tx.OperationType], entry.Postings, "postings of %s", tx.OperationType)
+
+		var sum int64
+		for _, p := range entry.Postings {
+			sum += p.Amount
+		}
+		assert.Zero(t, sum)
+	}
+
+	// Обе ноги перевода ссылаются на одну запись
+	legs, err := repo.GetTransactions(ctx, b, model.TransactionFilter{})
+	require.NoError(t, err)
+	require.Len(t, legs.Items, 1)
+	assert.Equal(t, transfer.TransferID, *legs.Items[0].TransferID)
+	assert.Equal(t, page.Items[0].EntryID, legs.Items[0].EntryID)
+
+	report, err := repo.CheckLedger(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Balanced)
+	assert.Empty(t, report.UnbalancedEntries)
+	assert.Empty(t, report.WalletMismatches)
+	var codes []model.SystemAccount
+	for _, acc := range report.SystemAccounts {
+		codes = append(codes, acc.Account.System)
+		assert.Equal(t, acc.Balance, acc.PostingsSum)
+	}
+	assert.Subset(t, codes, model.SystemAccounts)
+
+	_, err = repo.GetJournalEntry(ctx, uuid.New())
+	assert.ErrorIs(t, err, errors.EntryNotFound)
+}
+
+func testReconcile(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	active := mustCreateWallet(t, repo)
+	empty := mustCreateWallet(t, repo)
+
+	require.NoError(t, repo.UpdateBalance(ctx, active, 500, true))
+	_, err := repo.Transfer(ctx, active, empty, 100)
+	require.NoError(t, err)
+	fresh := mustCreateWallet(t, repo)
+
+	// Маленькая пачка — чтобы обход прошёл через несколько запросов
+	report, err := repo.Reconcile(ctx, model.ReconcileOptions{BatchSize: 2})
+	require.NoError(t, err)
+	assert.False(t, report.DriftDetected)
+	assert.Empty(t, report.Mismatches)
+	assert.Empty(t, report.Fixed)
+	assert.GreaterOrEqual(t, report.WalletsScanned, 3)
+	assert.False(t, report.FinishedAt.Before(report.StartedAt))
+
+	var noHistory []uuid.UUID
+	for _, w := range report.NoHistory {
+		noHistory = append(noHistory, w.WalletID)
+	}
+	assert.Contains(t, noHistory, fresh)
+	assert.NotContains(t, noHistory, active)
+	assert.NotContains(t, noHistory, empty)
+
+	// Исправление без причины запрещено
+	_, err = repo.Reconcile(ctx, model.ReconcileOptions{Fix: true})
+	assert.ErrorIs(t, err, errors.ReasonRequired)
+}
+
+func testWebhooks(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	// События предыдущих проверок раскладываем до появления подписки
+	for {
+		n, err := repo.FanOutEvents(ctx, now, 1000)
+		require.NoError(t, err)
+		if n == 0 {
+			break
+		}
+	}
+
+	sub, err := repo.CreateSubscription(ctx, model.WebhookSubscription{URL: "http://example.invalid/hook", Secret: "s3cret"})
+	require.NoError(t, err)
+	require.NotEqual(t, uuid.Nil, sub.ID)
+	defer func() { assert.NoError(t, repo.DeleteSubscription(ctx, sub.ID)) }()
+
+	subs, err := repo.ListSubscriptions(ctx)
+	require.NoError(t, err)
+	var listed *model.WebhookSubscription
+	for i := range subs {
+		if subs[i].ID == sub.ID {
+			listed = &subs[i]
+		}
+	}
+	require.NotNil(t, listed)
+	assert.Equal(t, sub.URL, listed.URL)
+	assert.Empty(t, listed.Secret, "secret must not be listed")
+
+	// Каждое изменение баланса — событие в outbox; перевод — по событию на кошелёк
+	a := mustCreateWallet(t, repo)
+	b := mustCreateWallet(t, repo)
+	require.NoError(t, repo.UpdateBalance(ctx, a, 500, true))
+	_, err = repo.Transfer(ctx, a, b, 200)
+	require.NoError(t, err)
+	require.ErrorIs(t, repo.UpdateBalance(ctx, a, 10_000, false), errors.InsufficientFunds)
+
+	n, err := repo.FanOutEvents(ctx, now, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	tasks, err := repo.ClaimDeliveries(ctx, now, time.Minute, 1000)
+	require.NoError(t, err)
+	balances := map[uuid.UUID][]int64{}
+	var mine []model.DeliveryTask
+	for _, task := range tasks {
+		if task.Delivery.SubscriptionID != sub.ID {
+			continue
+		}
+		mine = append(mine, task)
+		assert.Equal(t, sub.URL, task.URL)
+		assert.Equal(t, "s3cret", task.Secret)
+		assert.Equal(t, model.EventBalanceChanged, task.Event.Type)
+
+		var data model.BalanceChanged
+		require.NoError(t, json.Unmarshal(task.Event.Data, &data))
+		assert.Equal(t, task.Event.WalletID, data.WalletID)
+		assert.NotEqual(t, uuid.Nil, data.TransactionID)
+		balances[data.WalletID] = append(balances[data.WalletID], data.Balance)
+	}
+	require.Len(t, mine, 3)
+	assert.ElementsMatch(t, []int64{500, 300}, balances[a])
+	assert.Equal(t, []int64{200}, balances[b])
+
+	// Взятые в работу доставки до истечения lease повторно не выдаются
+	again, err := repo.ClaimDeliveries(ctx, now, time.Minute, 1000)
+	require.NoError(t, err)
+	for _, task := range again {
+		assert.NotEqual(t, sub.ID, task.Delivery.SubscriptionID)
+	}
+
+	delivered, dead := mine[0].Delivery.ID, mine[1].Delivery.ID
+	require.NoError(t, repo.RecordDeliveryAttempt(ctx, model.DeliveryAttempt{
+		DeliveryID: delivered, Status: model.DeliveryDelivered, StatusCode: 200, NextAttemptAt: now, At: now,
+	}))
+	require.NoError(t, repo.RecordDeliveryAttempt(ctx, model.DeliveryAttempt{
+		DeliveryID: dead, Status: model.DeliveryDead, StatusCode: 500, Error: "unexpected status 500", NextAttemptAt: now, At: now,
+	}))
+
+	deadList, err := repo.ListDeliveries(ctx, model.DeliveryFilter{Status: model.DeliveryDead, SubscriptionID: &sub.ID})
+	require.NoError(t, err)
+	require.Len(t, deadList, 1)
+	assert.Equal(t, dead, deadList[0].ID)
+	assert.Equal(t, 1, deadList[0].Attempts)
+	assert.Equal(t, 500, deadList[0].LastStatusCode)
+	assert.Equal(t, "unexpected status 500", deadList[0].LastError)
+
+	all, err := repo.ListDeliveries(ctx, model.DeliveryFilter{SubscriptionID: &sub.ID})
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	redelivered, err := repo.Redeliver(ctx, dead, now)
+	require.NoError(t, err)
+	assert.Equal(t, model.DeliveryPending, redelivered.Status)
+	assert.Zero(t, redelivered.Attempts)
+
+	_, err = repo.Redeliver(ctx, uuid.New(), now)
+	assert.ErrorIs(t, err, errors.DeliveryNotFound)
+	assert.ErrorIs(t, repo.DeleteSubscription(ctx, uuid.New()), errors.SubscriptionNotFound)
+	assert.ErrorIs(t, repo.RecordDeliveryAttempt(ctx, model.DeliveryAttempt{DeliveryID: uuid.New()}), errors.DeliveryNotFound)
+}
+
+func testHolds(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 1000, true))
+
+	hold, err := repo.CreateHold(ctx, id, 600, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, model.HoldActive, hold.Status)
+	assert.Equal(t, id, hold.WalletID)
+
+	// Холд уменьшает доступный баланс, но не сам баланс
+	balance, err := repo.GetBalance(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, model.WalletBalance{WalletID: id, Balance: 1000, Available: 400, Held: 600, Currency: model.DefaultCurrency, Status: model.WalletActive, WalletType: model.DefaultWalletType, Version: 2}, balance)
+
+	err = repo.UpdateBalance(ctx, id, 500, false)
+	assert.ErrorIs(t, err, errors.InsufficientFunds)
+	_, err = repo.CreateHold(ctx, id, 500, time.Hour)
+	assert.ErrorIs(t, err, errors.InsufficientFunds)
+	_, err = repo.Transfer(ctx, id, mustCreateWallet(t, repo), 500)
+	assert.ErrorIs(t, err, errors.InsufficientFunds)
+
+	// Частичное списание: остаток холда освобождается
+	_, err = repo.CaptureHold(ctx, hold.ID, 700)
+	assert.ErrorIs(t, err, errors.InvalidAmount)
+	captured, err := repo.CaptureHold(ctx, hold.ID, 250)
+	require.NoError(t, err)
+	assert.Equal(t, model.HoldCaptured, captured.Status)
+	assert.Equal(t, int64(250), captured.CapturedAmount)
+
+	balance, err = repo.GetBalance(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, model.WalletBalance{WalletID: id, Balance: 750, Available: 750, Currency: model.DefaultCurrency, Status: model.WalletActive, WalletType: model.DefaultWalletType, Version: 3}, balance)
+
+	_, err = repo.CaptureHold(ctx, hold.ID, 0)
+	assert.ErrorIs(t, err, errors.HoldNotActive)
+	_, err = repo.VoidHold(ctx, hold.ID)
+	assert.ErrorIs(t, err, errors.HoldNotActive)
+
+	// В журнале — операция CAPTURE со ссылкой на холд и сбалансированной записью
+	page, err := repo.GetTransactions(ctx, id, model.TransactionFilter{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	last := page.Items[0]
+	assert.Equal(t, model.OperationCapture, last.OperationType)
+	assert.Equal(t, int64(250), last.Amount)
+	require.NotNil(t, last.HoldID)
+	assert.Equal(t, hold.ID, *last.HoldID)
+	require.NotNil(t, last.EntryID)
+	entry, err := repo.GetJournalEntry(ctx, *last.EntryID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []model.Posting{
+		{Account: model.WalletAccount(id), Amount: -250},
+		{Account: model.SystemLedgerAccount(model.AccountExternalCashOut), Amount: 250},
+	}, entry.Postings)
+
+	// Полное списание без суммы и отмена
+	full, err := repo.CreateHold(ctx, id, 100, time.Hour)
+	require.NoError(t, err)
+	full, err = repo.CaptureHold(ctx, full.ID, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), full.CapturedAmount)
+
+	voided, err := repo.CreateHold(ctx, id, 300, time.Hour)
+	require.NoError(t, err)
+	voided, err = repo.VoidHold(ctx, voided.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.HoldVoided, voided.Status)
+	got, err := repo.GetHold(ctx, voided.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.HoldVoided, got.Status)
+	assertBalance(t, repo, id, 650)
+
+	// Истёкший холд сразу перестаёт блокировать средства
+	expiring, err := repo.CreateHold(ctx, id, 650, time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	balance, err = repo.GetBalance(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(650), balance.Available)
+	got, err = repo.GetHold(ctx, expiring.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.HoldExpired, got.Status)
+	_, err = repo.CaptureHold(ctx, expiring.ID, 0)
+	assert.ErrorIs(t, err, errors.HoldNotActive)
+
+	n, err := repo.ExpireHolds(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, n, int64(1))
+
+	_, err = repo.GetHold(ctx, uuid.New())
+	assert.ErrorIs(t, err, errors.HoldNotFound)
+	_, err = repo.CaptureHold(ctx, uuid.New(), 0)
+	assert.ErrorIs(t, err, errors.HoldNotFound)
+	_, err = repo.VoidHold(ctx, uuid.New())
+	assert.ErrorIs(t, err, errors.HoldNotFound)
+	_, err = repo.CreateHold(ctx, uuid.New(), 1, time.Hour)
+	assert.ErrorIs(t, err, errors.WalletNotFound)
+
+	assertLogMatchesBalance(t, repo, id)
+	report, err := repo.CheckLedger(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Balanced)
+}
+
+// testConcurrentHolds — параллельные холды не блокируют больше, чем есть на кошельке
+func testConcurrentHolds(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 1000, true))
+
+	const workers = 20
+	var wg sync.WaitGroup
+	var created atomic.Int64
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := repo.CreateHold(ctx, id, 100, time.Hour)
+			if err == nil {
+				created.Add(1)
+				return
+			}
+			assert.ErrorIs(t, err, errors.InsufficientFunds)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int64(10), created.Load())
+	balance, err := repo.GetBalance(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000), balance.Held)
+	assert.Zero(t, balance.Available)
+}
+
+func testWalletStatus(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+	other := mustCreateWallet(t, repo)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 500, true))
+	require.NoError(t, repo.UpdateBalance(ctx, other, 500, true))
+	hold, err := repo.CreateHold(ctx, id, 100, time.Hour)
+	require.NoError(t, err)
+
+	balance, err := repo.GetBalance(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, model.WalletActive, balance.Status)
+
+	// Без причины статус не меняется
+	_, err = repo.ChangeWalletStatus(ctx, id, model.WalletFrozen, " ")
+	assert.ErrorIs(t, err, errors.ReasonRequired)
+
+	frozen, err := repo.ChangeWalletStatus(ctx, id, model.WalletFrozen, "AML-7: подозрительные переводы")
+	require.NoError(t, err)
+	assert.Equal(t, model.WalletActive, frozen.FromStatus)
+	assert.Equal(t, model.WalletFrozen, frozen.ToStatus)
+
+	// Замороженный кошелёк: списания запрещены, зачисления — нет
+	assert.ErrorIs(t, repo.UpdateBalance(ctx, id, 10, false), errors.WalletFrozen)
+	_, err = repo.Transfer(ctx, id, other, 10)
+	assert.ErrorIs(t, err, errors.WalletFrozen)
+	_, err = repo.CreateHold(ctx, id, 10, time.Hour)
+	assert.ErrorIs(t, err, errors.WalletFrozen)
+	_, err = repo.CaptureHold(ctx, hold.ID, 0)
+	assert.ErrorIs(t, err, errors.WalletFrozen)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 10, true))
+	_, err = repo.Transfer(ctx, other, id, 10)
+	require.NoError(t, err)
+	assertBalance(t, repo, id, 520)
+
+	_, err = repo.ChangeWalletStatus(ctx, id, model.WalletFrozen, "ещё раз")
+	assert.ErrorIs(t, err, errors.InvalidTransition)
+
+	// Закрыть можно только пустой кошелёк без холдов
+	_, err = repo.ChangeWalletStatus(ctx, id, model.WalletClosed, "по заявлению клиента")
+	assert.ErrorIs(t, err, errors.WalletNotEmpty)
+
+	_, err = repo.ChangeWalletStatus(ctx, id, model.WalletActive, "проверка пройдена")
+	require.NoError(t, err)
+	_, err = repo.VoidHold(ctx, hold.ID)
+	require.NoError(t, err)
+	_, err = repo.Transfer(ctx, id, other, 520)
+	require.NoError(t, err)
+
+	closed, err := repo.ChangeWalletStatus(ctx, id, model.WalletClosed, "по заявлению клиента")
+	require.NoError(t, err)
+	assert.Equal(t, model.WalletClosed, closed.ToStatus)
+
+	// Закрытый кошелёк: запрещено всё, статус окончательный
+	assert.ErrorIs(t, repo.UpdateBalance(ctx, id, 10, true), errors.WalletClosed)
+	_, err = repo.Transfer(ctx, other, id, 10)
+	assert.ErrorIs(t, err, errors.WalletClosed)
+	_, err = repo.CreateHold(ctx, id, 10, time.Hour)
+	assert.ErrorIs(t, err, errors.WalletClosed)
+	_, err = repo.ChangeWalletStatus(ctx, id, model.WalletActive, "ошибка")
+	assert.ErrorIs(t, err, errors.InvalidTransition)
+
+	history, err := repo.GetWalletStatusHistory(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, []model.WalletStatus{model.WalletFrozen, model.WalletActive, model.WalletClosed},
+		[]model.WalletStatus{history[0].ToStatus, history[1].ToStatus, history[2].ToStatus})
+	assert.Equal(t, "AML-7: подозрительные переводы", history[0].Reason)
+	assert.Equal(t, model.WalletFrozen, history[1].FromStatus)
+
+	empty, err := repo.GetWalletStatusHistory(ctx, other)
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	_, err = repo.ChangeWalletStatus(ctx, uuid.New(), model.WalletFrozen, "нет такого")
+	assert.ErrorIs(t, err, errors.WalletNotFound)
+	_, err = repo.GetWalletStatusHistory(ctx, uuid.New())
+	assert.ErrorIs(t, err, errors.WalletNotFound)
+
+	assertLogMatchesBalance(t, repo, id)
+}
+
+func testCurrencies(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	rub := mustCreateWallet(t, repo)
+	kzt := mustCreateWalletWith(t, repo, model.CreateWalletRequest{Currency: "KZT"})
+	usd := mustCreateWalletWith(t, repo, model.CreateWalletRequest{Currency: "USD"})
+
+	_, err := repo.CreateWallet(ctx, model.CreateWalletRequest{Currency: "XXX"})
+	assert.ErrorIs(t, err, errors.UnsupportedCurrency)
+
+	balance, err := repo.GetBalance(ctx, kzt)
+	require.NoError(t, err)
+	assert.Equal(t, model.Currency("KZT"), balance.Currency)
+	balance, err = repo.GetBalance(ctx, rub)
+	require.NoError(t, err)
+	assert.Equal(t, model.DefaultCurrency, balance.Currency)
+
+	// Валюта операции необязательна, но если указана — должна совпадать
+	result, err := repo.ApplyOperation(ctx, model.WalletOperation{
+		WalletID: kzt, OperationType: model.OperationDeposit, Amount: 50000, Currency: "KZT",
+	}, model.OperationOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, model.Currency("KZT"), result.Currency)
+	_, err = repo.ApplyOperation(ctx, model.WalletOperation{
+		WalletID: kzt, OperationType: model.OperationDeposit, Amount: 100, Currency: "USD",
+	}, model.OperationOptions{})
+	assert.ErrorIs(t, err, errors.CurrencyMismatch)
+	require.NoError(t, repo.UpdateBalance(ctx, usd, 1000, true))
+	require.NoError(t, repo.UpdateBalance(ctx, rub, 1000, true))
+
+	// Перевод между валютами запрещён, внутри валюты — как обычно
+	_, err = repo.Transfer(ctx, kzt, usd, 100)
+	assert.ErrorIs(t, err, errors.CurrencyMismatch)
+	_, err = repo.Transfer(ctx, rub, kzt, 100)
+	assert.ErrorIs(t, err, errors.CurrencyMismatch)
+	kzt2 := mustCreateWalletWith(t, repo, model.CreateWalletRequest{Currency: "KZT"})
+	_, err = repo.Transfer(ctx, kzt, kzt2, 20000)
+	require.NoError(t, err)
+	assertBalance(t, repo, kzt, 30000)
+	assertBalance(t, repo, kzt2, 20000)
+
+	// Записи журнала — в валюте кошелька
+	page, err := repo.GetTransactions(ctx, kzt, model.TransactionFilter{})
+	require.NoError(t, err)
+	for _, tx := range page.Items {
+		entry, err := repo.GetJournalEntry(ctx, *tx.EntryID)
+		require.NoError(t, err)
+		assert.Equal(t, model.Currency("KZT"), entry.Currency)
+	}
+
+	// Системные счета — отдельно по каждой валюте
+	report, err := repo.CheckLedger(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Balanced)
+	cashIn := map[model.Currency]int64{}
+	for _, acc := range report.SystemAccounts {
+		if acc.Account.System == model.AccountExternalCashIn {
+			cashIn[acc.Currency] = acc.Balance
+		}
+	}
+	assert.LessOrEqual(t, cashIn["KZT"], int64(-50000))
+	assert.LessOrEqual(t, cashIn["USD"], int64(-1000))
+	assert.LessOrEqual(t, cashIn[model.DefaultCurrency], int64(-1000))
+}
+
+func testFX(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	rub := mustCreateWallet(t, repo)
+	require.NoError(t, repo.UpdateBalance(ctx, rub, 100000, true))
+	usd := mustCreateWalletWith(t, repo, model.CreateWalletRequest{Currency: "USD"})
+
+	_, err := repo.UpsertFXRates(ctx, []model.FXRate{{Base: "RUB", Quote: "USD", Rate: "abc"}})
+	assert.ErrorIs(t, err, errors.InvalidRate)
+	_, err = repo.CreateFXQuote(ctx, model.QuoteRequest{FromWalletID: rub, ToWalletID: usd, Amount: 100}, time.Minute)
+	assert.ErrorIs(t, err, errors.RateNotFound)
+
+	// Повторная загрузка обновляет курс направления
+	_, err = repo.UpsertFXRates(ctx, []model.FXRate{{Base: "RUB", Quote: "USD", Rate: "0.01"}, {Base: "USD", Quote: "RUB", Rate: "92.5"}})
+	require.NoError(t, err)
+	saved, err := repo.UpsertFXRates(ctx, []model.FXRate{{Base: "RUB", Quote: "USD", Rate: "0.0105"}})
+	require.NoError(t, err)
+	require.Len(t, saved, 1)
+	assert.False(t, saved[0].UpdatedAt.IsZero())
+	rates, err := repo.ListFXRates(ctx)
+	require.NoError(t, err)
+	require.Len(t, rates, 2)
+	assert.Equal(t, model.FXRate{Base: "RUB", Quote: "USD", Rate: "0.0105"}, model.FXRate{Base: rates[0].Base, Quote: rates[0].Quote, Rate: rates[0].Rate})
+
+	_, err = repo.CreateFXQuote(ctx, model.QuoteRequest{FromWalletID: rub, ToWalletID: mustCreateWallet(t, repo), Amount: 100}, time.Minute)
+	assert.ErrorIs(t, err, errors.SameCurrency)
+	_, err = repo.CreateFXQuote(ctx, model.QuoteRequest{FromWalletID: rub, ToWalletID: rub, Amount: 100}, time.Minute)
+	assert.ErrorIs(t, err, errors.SameWallet)
+	_, err = repo.CreateFXQuote(ctx, model.QuoteRequest{FromWalletID: rub, ToWalletID: uuid.New(), Amount: 100}, time.Minute)
+	assert.ErrorIs(t, err, errors.WalletNotFound)
+	// 0.50 RUB — меньше цента
+	_, err = repo.CreateFXQuote(ctx, model.QuoteRequest{FromWalletID: rub, ToWalletID: usd, Amount: 50}, time.Minute)
+	assert.ErrorIs(t, err, errors.InvalidAmount)
+
+	// Котировка фиксирует обе суммы; исполнение — по ним, даже если курс успел измениться
+	quote, err := repo.CreateFXQuote(ctx, model.QuoteRequest{FromWalletID: rub, ToWalletID: usd, Amount: 12345}, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, model.QuoteOpen, quote.Status)
+	assert.Equal(t, int64(129), quote.TargetAmount)
+	_, err = repo.UpsertFXRates(ctx, []model.FXRate{{Base: "RUB", Quote: "USD", Rate: "0.02"}})
+	require.NoError(t, err)
+
+	executed, err := repo.ExecuteFXQuote(ctx, quote.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.QuoteExecuted, executed.Status)
+	require.NotNil(t, executed.ExecutedAt)
+	assertBalance(t, repo, rub, 100000-12345)
+	assertBalance(t, repo, usd, 129)
+	assertLogMatchesBalance(t, repo, rub)
+	assertLogMatchesBalance(t, repo, usd)
+
+	_, err = repo.ExecuteFXQuote(ctx, quote.ID)
+	assert.ErrorIs(t, err, errors.QuoteNotOpen)
+	_, err = repo.ExecuteFXQuote(ctx, uuid.New())
+	assert.ErrorIs(t, err, errors.QuoteNotFound)
+
+	// Обе ноги ссылаются на котировку и хранят курс; записи журнала — в своих валютах
+	for _, id := range []uuid.UUID{rub, usd} {
+		page, err := repo.GetTransactions(ctx, id, model.TransactionFilter{})
+		require.NoError(t, err)
+		leg := page.Items[0] // самая новая операция кошелька
+		assert.Contains(t, []model.OperationType{model.OperationFXOut, model.OperationFXIn}, leg.OperationType)
+		require.NotNil(t, leg.QuoteID)
+		assert.Equal(t, quote.ID, *leg.QuoteID)
+		assert.Equal(t, "0.0105", leg.FXRate)
+		entry, err := repo.GetJournalEntry(ctx, *leg.EntryID)
+		require.NoError(t, err)
+		assert.Equal(t, model.EntryFX, entry.EntryType)
+		balance, err := repo.GetBalance(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, balance.Currency, entry.Currency)
+	}
+
+	report, err := repo.CheckLedger(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Balanced)
+	position := map[model.Currency]int64{}
+	for _, acc := range report.SystemAccounts {
+		if acc.Account.System == model.AccountFXPosition {
+			position[acc.Currency] = acc.Balance
+		}
+	}
+	assert.Equal(t, int64(12345), position["RUB"])
+	assert.Equal(t, int64(-129), position["USD"])
+
+	// Истёкшая котировка не исполняется
+	expiring, err := repo.CreateFXQuote(ctx, model.QuoteRequest{FromWalletID: usd, ToWalletID: rub, Amount: 100}, time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	got, err := repo.GetFXQuote(ctx, expiring.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.QuoteExpired, got.Status)
+	_, err = repo.ExecuteFXQuote(ctx, expiring.ID)
+	assert.ErrorIs(t, err, errors.QuoteNotOpen)
+	assertBalance(t, repo, usd, 129)
+
+	// Доступный баланс учитывает холды
+	pending, err := repo.CreateFXQuote(ctx, model.QuoteRequest{FromWalletID: usd, ToWalletID: rub, Amount: 100}, time.Minute)
+	require.NoError(t, err)
+	_, err = repo.CreateHold(ctx, usd, 50, time.Minute)
+	require.NoError(t, err)
+	_, err = repo.ExecuteFXQuote(ctx, pending.ID)
+	assert.ErrorIs(t, err, errors.InsufficientFunds)
+}
+
+func testFees(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+
+	_, err := repo.UpsertFeeRule(ctx, model.FeeRule{Operation: model.FeeOnWithdraw, Kind: model.FeePercent, Percent: "0"})
+	assert.ErrorIs(t, err, errors.InvalidFeeRule)
+
+	withdrawRule, err := repo.UpsertFeeRule(ctx, model.FeeRule{
+		Operation: model.FeeOnWithdraw, Kind: model.FeePercent, Percent: "1", MinFee: 50, MaxFee: 1000,
+	})
+	require.NoError(t, err)
+	_, err = repo.UpsertFeeRule(ctx, model.FeeRule{
+		Operation: model.FeeOnWithdraw, Currency: "RUB", WalletType: model.WalletBusiness, Kind: model.FeeFixed, Fixed: 10,
+	})
+	require.NoError(t, err)
+	_, err = repo.UpsertFeeRule(ctx, model.FeeRule{
+		Operation: model.FeeOnTransfer, Kind: model.FeeTiered,
+		Tiers: []model.FeeTier{{UpTo: 10000, Fixed: 100}, {Percent: "1"}},
+	})
+	require.NoError(t, err)
+
+	// Повторная запись с тем же ключом заменяет правило
+	replaced, err := repo.UpsertFeeRule(ctx, model.FeeRule{
+		Operation: model.FeeOnWithdraw, Kind: model.FeePercent, Percent: "1", MinFee: 50, MaxFee: 2000,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, withdrawRule.ID, replaced.ID)
+	rules, err := repo.ListFeeRules(ctx)
+	require.NoError(t, err)
+	assert.Len(t, rules, 3)
+
+	personal := mustCreateWallet(t, repo)
+	business := mustCreateWalletWith(t, repo, model.CreateWalletRequest{WalletType: model.WalletBusiness})
+	_, err = repo.CreateWallet(ctx, model.CreateWalletRequest{WalletType: "VIP"})
+	assert.ErrorIs(t, err, errors.InvalidWalletType)
+	balance, err := repo.GetBalance(ctx, business)
+	require.NoError(t, err)
+	assert.Equal(t, model.WalletBusiness, balance.WalletType)
+
+	// Пополнение без комиссии, списание — 1% сверх суммы
+	require.NoError(t, repo.UpdateBalance(ctx, personal, 100000, true))
+	result, err := repo.ApplyOperation(ctx, model.WalletOperation{
+		WalletID: personal, OperationType: model.OperationWithdraw, Amount: 20000,
+	}, model.OperationOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(20000), result.Amount)
+	assert.Equal(t, int64(200), result.Fee)
+	assertBalance(t, repo, personal, 100000-20200)
+
+	page, err := repo.GetTransactions(ctx, personal, model.TransactionFilter{OperationType: model.OperationWithdraw})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, int64(200), page.Items[0].Fee)
+	entry, err := repo.GetJournalEntry(ctx, *page.Items[0].EntryID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []model.Posting{
+		{Account: model.WalletAccount(personal), Amount: -20200},
+		{Account: model.SystemLedgerAccount(model.AccountExternalCashOut), Amount: 20000},
+		{Account: model.SystemLedgerAccount(model.AccountFees), Amount: 200},
+	}, entry.Postings)
+
+	// Для бизнес-кошелька в рублях — своё, более точное правило
+	require.NoError(t, repo.UpdateBalance(ctx, business, 2000, true))
+	result, err = repo.ApplyOperation(ctx, model.WalletOperation{
+		WalletID: business, OperationType: model.OperationWithdraw, Amount: 1000,
+	}, model.OperationOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), result.Fee)
+
+	// Комиссия не помещается в доступный баланс — ничего не списывается
+	_, err = repo.ApplyOperation(ctx, model.WalletOperation{
+		WalletID: business, OperationType: model.OperationWithdraw, Amount: 990,
+	}, model.OperationOptions{})
+	assert.ErrorIs(t, err, errors.InsufficientFunds)
+	assertBalance(t, repo, business, 990)
+
+	// Перевод: комиссию платит отправитель, получатель получает всю сумму
+	transfer, err := repo.Transfer(ctx, personal, business, 5000)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), transfer.Fee)
+	assertBalance(t, repo, personal, 79800-5100)
+	assertBalance(t, repo, business, 5990)
+	legs, err := repo.GetTransactions(ctx, business, model.TransactionFilter{OperationType: model.OperationTransferIn})
+	require.NoError(t, err)
+	require.Len(t, legs.Items, 1)
+	assert.Zero(t, legs.Items[0].Fee)
+
+	// Без правила комиссии нет
+	require.NoError(t, repo.DeleteFeeRule(ctx, withdrawRule.ID))
+	assert.ErrorIs(t, repo.DeleteFeeRule(ctx, withdrawRule.ID), errors.FeeRuleNotFound)
+	result, err = repo.ApplyOperation(ctx, model.WalletOperation{
+		WalletID: personal, OperationType: model.OperationWithdraw, Amount: 100,
+	}, model.OperationOptions{})
+	require.NoError(t, err)
+	assert.Zero(t, result.Fee)
+
+	assertLogMatchesBalance(t, repo, personal)
+	assertLogMatchesBalance(t, repo, business)
+	reconcile, err := repo.Reconcile(ctx, model.ReconcileOptions{})
+	require.NoError(t, err)
+	assert.False(t, reconcile.DriftDetected)
+
+	report, err := repo.CheckLedger(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Balanced)
+	for _, acc := range report.SystemAccounts {
+		if acc.Account.System == model.AccountFees && acc.Currency == model.DefaultCurrency {
+			assert.Equal(t, int64(200+10+100), acc.Balance)
+		}
+	}
+}
+
+// === Помощники ===
+
+func testOverdraftLimit(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+	other := mustCreateWallet(t, repo)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 100, true))
+
+	_, err := repo.SetOverdraftLimit(ctx, id, 500, "")
+	assert.ErrorIs(t, err, errors.ReasonRequired)
+	_, err = repo.SetOverdraftLimit(ctx, id, -1, "договор B2B-1")
+	assert.ErrorIs(t, err, errors.InvalidOverdraft)
+	_, err = repo.SetOverdraftLimit(ctx, uuid.New(), 500, "договор B2B-1")
+	assert.ErrorIs(t, err, errors.WalletNotFound)
+
+	change, err := repo.SetOverdraftLimit(ctx, id, 500, "договор B2B-1")
+	require.NoError(t, err)
+	assert.Zero(t, change.OldLimit)
+	assert.Equal(t, int64(500), change.NewLimit)
+
+	// Списание уходит в минус в пределах лимита, дальше — нет
+	require.NoError(t, repo.UpdateBalance(ctx, id, 400, false))
+	balance, err := repo.GetBalance(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-300), balance.Balance)
+	assert.Equal(t, int64(500), balance.OverdraftLimit)
+	assert.Equal(t, int64(200), balance.CreditAvailable)
+
+	assert.ErrorIs(t, repo.UpdateBalance(ctx, id, 201, false), errors.InsufficientFunds)
+	_, err = repo.Transfer(ctx, id, other, 201)
+	assert.ErrorIs(t, err, errors.InsufficientFunds)
+	hold, err := repo.CreateHold(ctx, id, 150, time.Hour)
+	require.NoError(t, err)
+	assert.ErrorIs(t, repo.UpdateBalance(ctx, id, 51, false), errors.InsufficientFunds)
+	_, err = repo.VoidHold(ctx, hold.ID)
+	require.NoError(t, err)
+	_, err = repo.Transfer(ctx, id, other, 200)
+	require.NoError(t, err)
+	assertBalance(t, repo, id, -500)
+	assertLogMatchesBalance(t, repo, id)
+
+	// Лимит нельзя опустить ниже занятого кредита
+	_, err = repo.SetOverdraftLimit(ctx, id, 499, "пересмотр")
+	assert.ErrorIs(t, err, errors.OverdraftInUse)
+
+	require.NoError(t, repo.UpdateBalance(ctx, id, 800, true))
+	balance, err = repo.GetBalance(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, int64(500), balance.CreditAvailable)
+	_, err = repo.SetOverdraftLimit(ctx, id, 0, "договор расторгнут")
+	require.NoError(t, err)
+	assert.ErrorIs(t, repo.UpdateBalance(ctx, id, 301, false), errors.InsufficientFunds)
+
+	history, err := repo.GetOverdraftHistory(ctx, id)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "договор B2B-1", history[0].Reason)
+	assert.Equal(t, int64(500), history[1].OldLimit)
+	assert.Zero(t, history[1].NewLimit)
+
+	// Минус в пределах лимита сверка не считает проблемой
+	require.NoError(t, repo.UpdateBalance(ctx, other, 1, true))
+	_, err = repo.SetOverdraftLimit(ctx, other, 1000, "договор B2B-2")
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateBalance(ctx, other, 700, false))
+	report, err := repo.Reconcile(ctx, model.ReconcileOptions{})
+	require.NoError(t, err)
+	assert.False(t, report.HasDrift())
+}
+
+func testLimitPolicies(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+	other := mustCreateWallet(t, repo)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 10000, true))
+
+	_, err := repo.UpsertLimitPolicy(ctx, model.LimitPolicy{MaxSingle: 100})
+	assert.ErrorIs(t, err, errors.InvalidLimitPolicy)
+	missing := uuid.New()
+	_, err = repo.UpsertLimitPolicy(ctx, model.LimitPolicy{WalletID: &missing, MaxSingle: 100})
+	assert.ErrorIs(t, err, errors.WalletNotFound)
+
+	// Политика типа действует на все кошельки PERSONAL
+	byType, err := repo.UpsertLimitPolicy(ctx, model.LimitPolicy{WalletType: model.WalletPersonal, MaxSingle: 1000, DailyWithdrawal: 1500})
+	require.NoError(t, err)
+	err = repo.UpdateBalance(ctx, id, 1001, false)
+	var limitErr *errors.LimitError
+	require.ErrorAs(t, err, &limitErr)
+	assert.ErrorIs(t, err, errors.LimitExceeded)
+	assert.Equal(t, errors.LimitError{Limit: string(model.LimitMaxSingle), Max: 1000, Requested: 1001}, *limitErr)
+
+	// Дневной лимит считает и списания, и исходящие переводы
+	require.NoError(t, repo.UpdateBalance(ctx, id, 1000, false))
+	_, err = repo.Transfer(ctx, id, other, 400)
+	require.NoError(t, err)
+	_, err = repo.Transfer(ctx, id, other, 101)
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, errors.LimitError{Limit: string(model.LimitDailyWithdrawal), Max: 1500, Used: 1400, Requested: 101}, *limitErr)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 100, false))
+	// Зачисления лимиты не ограничивают
+	require.NoError(t, repo.UpdateBalance(ctx, id, 5000, true))
+
+	// Политика кошелька важнее политики типа; повторный upsert заменяет её
+	own, err := repo.UpsertLimitPolicy(ctx, model.LimitPolicy{WalletID: &id, MaxOperations: 1, OperationsWindowSeconds: 3600})
+	require.NoError(t, err)
+	replaced, err := repo.UpsertLimitPolicy(ctx, model.LimitPolicy{WalletID: &id, MaxOperations: 5, OperationsWindowSeconds: 3600})
+	require.NoError(t, err)
+	assert.Equal(t, own.ID, replaced.ID)
+	assert.Equal(t, int64(5), replaced.MaxOperations)
+
+	// В окне уже три списания, пропускаются ещё два
+	require.NoError(t, repo.UpdateBalance(ctx, id, 2000, false))
+	require.NoError(t, repo.UpdateBalance(ctx, id, 1, false))
+	err = repo.UpdateBalance(ctx, id, 1, false)
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, errors.LimitError{Limit: string(model.LimitOperationCount), Max: 5, Used: 5, Requested: 1}, *limitErr)
+	assertLogMatchesBalance(t, repo, id)
+
+	policies, err := repo.ListLimitPolicies(ctx)
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+	assert.Equal(t, byType.ID, policies[0].ID)
+
+	require.NoError(t, repo.DeleteLimitPolicy(ctx, own.ID))
+	assert.ErrorIs(t, repo.DeleteLimitPolicy(ctx, own.ID), errors.LimitPolicyNotFound)
+	require.NoError(t, repo.DeleteLimitPolicy(ctx, byType.ID))
+	require.NoError(t, repo.UpdateBalance(ctx, id, 1, false))
+}
+
+func testConcurrentLimits(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 10000, true))
+	_, err := repo.UpsertLimitPolicy(ctx, model.LimitPolicy{WalletID: &id, DailyWithdrawal: 1000})
+	require.NoError(t, err)
+
+	// 50 параллельных списаний по 30: дневной лимит пропускает ровно 33
+	const numGoroutines = 50
+	var (
+		wg        sync.WaitGroup
+		succeeded atomic.Int64
+	)
+	errCh := make(chan error, numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := repo.UpdateBalance(ctx, id, 30, false)
+			switch {
+			case err == nil:
+				succeeded.Add(1)
+			case !errors.Is(errors.LimitExceeded, err):
+				errCh <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		t.Fatalf("❌ Ошибка в конкурентной среде: %v", err)
+	}
+	assert.Equal(t, int64(33), succeeded.Load())
+	assertBalance(t, repo, id, 10000-33*30)
+}
+
+func testLimitUsage(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	// Правило только для KZT/BUSINESS, чтобы не задеть кошельки других тестов
+	rule, err := repo.UpsertFeeRule(ctx, model.FeeRule{
+		Operation: model.FeeOnWithdraw, Currency: "KZT", WalletType: model.WalletBusiness, Kind: model.FeeFixed, Fixed: 10,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, repo.DeleteFeeRule(ctx, rule.ID)) }()
+
+	id := mustCreateWalletWith(t, repo, model.CreateWalletRequest{Currency: "KZT", WalletType: model.WalletBusiness})
+	require.NoError(t, repo.UpdateBalance(ctx, id, 10000, true))
+	_, err = repo.UpsertLimitPolicy(ctx, model.LimitPolicy{WalletID: &id, DailyWithdrawal: 1000})
+	require.NoError(t, err)
+
+	// Комиссия расходует лимит: дважды 490 + 10 — дневной лимит исчерпан
+	require.NoError(t, repo.UpdateBalance(ctx, id, 490, false))
+	require.NoError(t, repo.UpdateBalance(ctx, id, 490, false))
+	withdrawal := latestTransaction(t, repo, id)
+	err = repo.UpdateBalance(ctx, id, 1, false)
+	var limitErr *errors.LimitError
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, errors.LimitError{Limit: string(model.LimitDailyWithdrawal), Max: 1000, Used: 1000, Requested: 11}, *limitErr)
+
+	// Возврат освобождает лимит на возвращённую сумму, комиссия остаётся в счёте
+	_, err = repo.ReverseTransaction(ctx, withdrawal.ID, 300, "")
+	require.NoError(t, err)
+	err = repo.UpdateBalance(ctx, id, 291, false)
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, errors.LimitError{Limit: string(model.LimitDailyWithdrawal), Max: 1000, Used: 700, Requested: 301}, *limitErr)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 290, false))
+
+	// Месячный лимит считается так же; от полностью возвращённого списания в счёте остаётся комиссия
+	_, err = repo.UpsertLimitPolicy(ctx, model.LimitPolicy{WalletID: &id, MonthlyWithdrawal: 900})
+	require.NoError(t, err)
+	_, err = repo.ReverseTransaction(ctx, withdrawal.ID, 0, "")
+	require.NoError(t, err)
+	err = repo.UpdateBalance(ctx, id, 91, false)
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, errors.LimitError{Limit: string(model.LimitMonthlyWithdrawal), Max: 900, Used: 810, Requested: 101}, *limitErr)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 80, false))
+	assertLogMatchesBalance(t, repo, id)
+}
+
+func testReversal(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+	other := mustCreateWallet(t, repo)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 1000, true))
+	require.NoError(t, repo.UpdateBalance(ctx, id, 400, false))
+	withdrawal := latestTransaction(t, repo, id)
+
+	_, err := repo.ReverseTransaction(ctx, uuid.New(), 0, "")
+	assert.ErrorIs(t, err, errors.TransactionNotFound)
+
+	// Частичный возврат, затем остаток; больше суммы операции вернуть нельзя
+	reversal, err := repo.ReverseTransaction(ctx, withdrawal.ID, 150, "жалоба клиента")
+	require.NoError(t, err)
+	assert.Equal(t, withdrawal.ID, reversal.OriginalID)
+	assert.Equal(t, int64(150), reversal.ReversedAmount)
+	require.Len(t, reversal.Transactions, 1)
+	refund := reversal.Transactions[0]
+	assert.Equal(t, model.OperationReversalIn, refund.OperationType)
+	assert.Equal(t, int64(150), refund.Amount)
+	require.NotNil(t, refund.ReversesID)
+	assert.Equal(t, withdrawal.ID, *refund.ReversesID)
+	assert.Equal(t, "жалоба клиента", refund.Reason)
+	assertBalance(t, repo, id, 750)
+
+	_, err = repo.ReverseTransaction(ctx, withdrawal.ID, 251, "")
+	assert.ErrorIs(t, err, errors.InvalidAmount)
+	reversal, err = repo.ReverseTransaction(ctx, withdrawal.ID, 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(250), reversal.Amount)
+	assert.Equal(t, int64(400), reversal.ReversedAmount)
+	_, err = repo.ReverseTransaction(ctx, withdrawal.ID, 0, "")
+	assert.ErrorIs(t, err, errors.AlreadyReversed)
+	_, err = repo.ReverseTransaction(ctx, reversal.Transactions[0].ID, 0, "")
+	assert.ErrorIs(t, err, errors.NotReversible)
+	assertBalance(t, repo, id, 1000)
+
+	// История показывает связь с обеих сторон
+	page, err := repo.GetTransactions(ctx, id, model.TransactionFilter{})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 4)
+	assert.Equal(t, withdrawal.ID, *page.Items[0].ReversesID)
+	assert.Equal(t, withdrawal.ID, page.Items[2].ID)
+	assert.Equal(t, int64(400), page.Items[2].ReversedAmount)
+	assert.Equal(t, []uuid.UUID{page.Items[1].ID, page.Items[0].ID}, page.Items[2].ReversedBy)
+	assert.Empty(t, page.Items[3].ReversedBy)
+
+	// Сторно пополнения списывает: уже потраченное вернуть нельзя
+	require.NoError(t, repo.UpdateBalance(ctx, other, 500, true))
+	deposit := latestTransaction(t, repo, other)
+	require.NoError(t, repo.UpdateBalance(ctx, other, 400, false))
+	_, err = repo.ReverseTransaction(ctx, deposit.ID, 0, "")
+	assert.ErrorIs(t, err, errors.InsufficientFunds)
+	reversal, err = repo.ReverseTransaction(ctx, deposit.ID, 100, "")
+	require.NoError(t, err)
+	assert.Equal(t, model.OperationReversalOut, reversal.Transactions[0].OperationType)
+	assertBalance(t, repo, other, 0)
+
+	// Возврат перевода: обе ноги, деньги идут обратно отправителю
+	_, err = repo.Transfer(ctx, id, other, 300)
+	require.NoError(t, err)
+	transferIn := latestTransaction(t, repo, other)
+	transferOut := latestTransaction(t, repo, id)
+	reversal, err = repo.ReverseTransaction(ctx, transferIn.ID, 100, "")
+	require.NoError(t, err)
+	require.Len(t, reversal.Transactions, 2)
+	assertBalance(t, repo, id, 800)
+	assertBalance(t, repo, other, 200)
+	back := latestTransaction(t, repo, id)
+	assert.Equal(t, model.OperationReversalIn, back.OperationType)
+	assert.Equal(t, transferOut.ID, *back.ReversesID)
+	_, err = repo.ReverseTransaction(ctx, transferOut.ID, 201, "")
+	assert.ErrorIs(t, err, errors.InvalidAmount)
+
+	// Обратная ссылка есть у обеих ног, каждая — на строку возврата своего кошелька
+	backOut := latestTransaction(t, repo, other)
+	page, err = repo.GetTransactions(ctx, id, model.TransactionFilter{OperationType: model.OperationTransferOut})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, []uuid.UUID{back.ID}, page.Items[0].ReversedBy)
+	page, err = repo.GetTransactions(ctx, other, model.TransactionFilter{OperationType: model.OperationTransferIn})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, []uuid.UUID{backOut.ID}, page.Items[0].ReversedBy)
+
+	assertLogMatchesBalance(t, repo, id)
+	assertLogMatchesBalance(t, repo, other)
+	report, err := repo.CheckLedger(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Balanced)
+	assert.Empty(t, report.WalletMismatches)
+}
+
+func testReversalOverdraft(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+	other := mustCreateWallet(t, repo)
+	_, err := repo.SetOverdraftLimit(ctx, id, 1000, "договор B2B-1")
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 500, true))
+	deposit := latestTransaction(t, repo, id)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 400, false))
+
+	// Кредитная линия не покрывает сторно: вернуть можно только оставшиеся 100
+	_, err = repo.ReverseTransaction(ctx, deposit.ID, 0, "")
+	assert.ErrorIs(t, err, errors.InsufficientFunds)
+	_, err = repo.ReverseTransaction(ctx, deposit.ID, 101, "")
+	assert.ErrorIs(t, err, errors.InsufficientFunds)
+	assertBalance(t, repo, id, 100)
+	_, err = repo.ReverseTransaction(ctx, deposit.ID, 100, "")
+	require.NoError(t, err)
+	assertBalance(t, repo, id, 0)
+
+	// То же для входящей ноги перевода: получатель уже в кредите
+	_, err = repo.SetOverdraftLimit(ctx, other, 1000, "договор B2B-2")
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 300, true))
+	_, err = repo.Transfer(ctx, id, other, 300)
+	require.NoError(t, err)
+	transferIn := latestTransaction(t, repo, other)
+	require.NoError(t, repo.UpdateBalance(ctx, other, 500, false))
+	_, err = repo.ReverseTransaction(ctx, transferIn.ID, 0, "")
+	assert.ErrorIs(t, err, errors.InsufficientFunds)
+	assertBalance(t, repo, id, 0)
+	assertBalance(t, repo, other, -200)
+	assertLogMatchesBalance(t, repo, id)
+	assertLogMatchesBalance(t, repo, other)
+}
+
+func testMetadata(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+	other := mustCreateWallet(t, repo)
+
+	order := model.Metadata{
+		ExternalRef: "order-1001",
+		Description: "оплата заказа",
+		Tags:        map[string]string{"channel": "web", "campaign": "spring"},
+	}
+	deposit := model.WalletOperation{WalletID: id, OperationType: model.OperationDeposit, Amount: 1000, Metadata: order}
+	_, err := repo.ApplyOperation(ctx, deposit, model.OperationOptions{IdempotencyKey: "meta-1"})
+	require.NoError(t, err)
+	_, err = repo.ApplyOperation(ctx, model.WalletOperation{
+		WalletID: id, OperationType: model.OperationWithdraw, Amount: 100, Metadata: model.Metadata{ExternalRef: "order-1002"},
+	}, model.OperationOptions{})
+	require.NoError(t, err)
+
+	// Повтор по Idempotency-Key отдаёт сохранённый ответ, а не конфликт ссылки
+	result, err := repo.ApplyOperation(ctx, deposit, model.OperationOptions{IdempotencyKey: "meta-1"})
+	require.NoError(t, err)
+	assert.True(t, result.Replayed)
+
+	// Тот же заказ второй раз на кошелёк не проводится; на другом кошельке ссылка свободна
+	_, err = repo.ApplyOperation(ctx, deposit, model.OperationOptions{})
+	assert.ErrorIs(t, err, errors.DuplicateExternalRef)
+	_, err = repo.ApplyOperation(ctx, model.WalletOperation{
+		WalletID: id, OperationType: model.OperationWithdraw, Amount: 1, Metadata: model.Metadata{ExternalRef: "order-1001"},
+	}, model.OperationOptions{})
+	assert.ErrorIs(t, err, errors.DuplicateExternalRef)
+	_, err = repo.ApplyOperation(ctx, model.WalletOperation{
+		WalletID: other, OperationType: model.OperationDeposit, Amount: 1000, Metadata: model.Metadata{ExternalRef: "order-1001"},
+	}, model.OperationOptions{})
+	require.NoError(t, err)
+	assertBalance(t, repo, id, 900)
+
+	_, err = repo.ApplyOperation(ctx, model.WalletOperation{
+		WalletID: id, OperationType: model.OperationDeposit, Amount: 1,
+		Metadata: model.Metadata{ExternalRef: strings.Repeat("x", model.MaxExternalRefLength+1)},
+	}, model.OperationOptions{})
+	assert.ErrorIs(t, err, errors.InvalidMetadata)
+
+	// Метаданные возвращаются в истории, поиск — по точной ссылке
+	page, err := repo.GetTransactions(ctx, id, model.TransactionFilter{ExternalRef: "order-1001"})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, order, page.Items[0].Metadata)
+	assert.Equal(t, model.OperationDeposit, page.Items[0].OperationType)
+
+	page, err = repo.GetTransactions(ctx, id, model.TransactionFilter{ExternalRef: "order-100"})
+	require.NoError(t, err)
+	assert.Empty(t, page.Items)
+
+	page, err = repo.GetTransactions(ctx, id, model.TransactionFilter{})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 2)
+	assert.Equal(t, "order-1002", page.Items[0].ExternalRef)
+	assert.Nil(t, page.Items[0].Tags)
+}
+
+func testWalletOwners(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+
+	// У владельца несколько кошельков: основной, бонусный, накопительный
+	mainWallet, err := repo.CreateWallet(ctx, model.CreateWalletRequest{OwnerID: "user-42", ExternalID: "main", Labels: map[string]string{"purpose": "main"}})
+	require.NoError(t, err)
+	assert.False(t, mainWallet.Replayed)
+	assert.Equal(t, "user-42", mainWallet.OwnerID)
+	assert.Equal(t, model.DefaultCurrency, mainWallet.Currency)
+	bonus := mustCreateWalletWith(t, repo, model.CreateWalletRequest{OwnerID: "user-42", ExternalID: "bonus"})
+	savings := mustCreateWalletWith(t, repo, model.CreateWalletRequest{OwnerID: "user-42", Currency: "USD"})
+	mustCreateWalletWith(t, repo, model.CreateWalletRequest{OwnerID: "user-7", ExternalID: "main"})
+	mustCreateWallet(t, repo)
+
+	// Повторное создание по externalId возвращает тот же кошелёк
+	again, err := repo.CreateWallet(ctx, model.CreateWalletRequest{OwnerID: "user-42", ExternalID: "main"})
+	require.NoError(t, err)
+	assert.True(t, again.Replayed)
+	assert.Equal(t, mainWallet.ID, again.ID)
+	assert.Equal(t, map[string]string{"purpose": "main"}, again.Labels)
+	_, err = repo.CreateWallet(ctx, model.CreateWalletRequest{OwnerID: "user-42", ExternalID: "main", Currency: "USD"})
+	assert.ErrorIs(t, err, errors.ExternalIDConflict)
+	_, err = repo.CreateWallet(ctx, model.CreateWalletRequest{OwnerID: strings.Repeat("x", model.MaxOwnerIDLength+1)})
+	assert.ErrorIs(t, err, errors.InvalidWalletOwner)
+	_, err = repo.CreateWallet(ctx, model.CreateWalletRequest{Labels: map[string]string{"": "x"}})
+	assert.ErrorIs(t, err, errors.InvalidWalletOwner)
+
+	wallets, err := repo.ListWallets(ctx, "user-42")
+	require.NoError(t, err)
+	require.Len(t, wallets, 3)
+	assert.Equal(t, []uuid.UUID{mainWallet.ID, bonus, savings}, []uuid.UUID{wallets[0].ID, wallets[1].ID, wallets[2].ID})
+	wallets, err = repo.ListWallets(ctx, "nobody")
+	require.NoError(t, err)
+	assert.Empty(t, wallets)
+
+	found, err := repo.GetWalletByExternalID(ctx, "user-42", "bonus")
+	require.NoError(t, err)
+	assert.Equal(t, bonus, found.ID)
+	_, err = repo.GetWalletByExternalID(ctx, "user-7", "bonus")
+	assert.ErrorIs(t, err, errors.WalletNotFound)
+
+	// Параллельное создание с одним externalId даёт один кошелёк
+	const numGoroutines = 20
+	var wg sync.WaitGroup
+	ids := make(chan uuid.UUID, numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w, err := repo.CreateWallet(ctx, model.CreateWalletRequest{OwnerID: "user-99", ExternalID: "main"})
+			if assert.NoError(t, err) {
+				ids <- w.ID
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	unique := map[uuid.UUID]bool{}
+	for id := range ids {
+		unique[id] = true
+	}
+	assert.Len(t, unique, 1)
+}
+
+func testBatch(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	a := mustCreateWallet(t, repo)
+	b := mustCreateWallet(t, repo)
+	require.NoError(t, repo.UpdateBalance(ctx, b, 100, true))
+	deposit := func(id uuid.UUID, amount int64) model.WalletOperation {
+		return model.WalletOperation{WalletID: id, OperationType: model.OperationDeposit, Amount: amount}
+	}
+	withdraw := func(id uuid.UUID, amount int64) model.WalletOperation {
+		return model.WalletOperation{WalletID: id, OperationType: model.OperationWithdraw, Amount: amount}
+	}
+
+	_, err := repo.ApplyBatch(ctx, model.BatchAtomic, nil)
+	assert.ErrorIs(t, err, errors.InvalidBatch)
+
+	// Атомарный пакет: одна ошибка откатывает всё
+	outcomes, err := repo.ApplyBatch(ctx, model.BatchAtomic, []model.WalletOperation{deposit(a, 1000), withdraw(b, 500), deposit(b, 1)})
+	require.NoError(t, err)
+	require.Len(t, outcomes, 3)
+	assert.ErrorIs(t, outcomes[0].Err, errors.BatchAborted)
+	assert.ErrorIs(t, outcomes[1].Err, errors.InsufficientFunds)
+	assert.ErrorIs(t, outcomes[2].Err, errors.BatchAborted)
+	assertBalance(t, repo, a, 0)
+	assertBalance(t, repo, b, 100)
+	page, err := repo.GetTransactions(ctx, a, model.TransactionFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, page.Items)
+
+	// Операции пакета видят друг друга: пополнение, затем списание с того же кошелька
+	outcomes, err = repo.ApplyBatch(ctx, model.BatchAtomic, []model.WalletOperation{deposit(a, 1000), withdraw(a, 600), deposit(b, 50)})
+	require.NoError(t, err)
+	for _, o := range outcomes {
+		require.NoError(t, o.Err)
+		assert.Equal(t, model.OperationStatusAccepted, o.Result.Status)
+	}
+	assertBalance(t, repo, a, 400)
+	assertBalance(t, repo, b, 150)
+
+	// Повтор внешней ссылки внутри пакета — такой же конфликт, как между запросами
+	order := deposit(a, 1)
+	order.ExternalRef = "payroll-2025-03"
+	outcomes, err = repo.ApplyBatch(ctx, model.BatchAtomic, []model.WalletOperation{order, order})
+	require.NoError(t, err)
+	assert.ErrorIs(t, outcomes[1].Err, errors.DuplicateExternalRef)
+	assertBalance(t, repo, a, 400)
+
+	// Независимый режим: у каждой операции свой итог
+	missing := uuid.New()
+	outcomes, err = repo.ApplyBatch(ctx, model.BatchIndependent, []model.WalletOperation{
+		deposit(a, 100), withdraw(b, 1000), deposit(missing, 1), withdraw(b, 150), order, order,
+	})
+	require.NoError(t, err)
+	require.Len(t, outcomes, 6)
+	assert.NoError(t, outcomes[0].Err)
+	assert.ErrorIs(t, outcomes[1].Err, errors.InsufficientFunds)
+	assert.ErrorIs(t, outcomes[2].Err, errors.WalletNotFound)
+	assert.NoError(t, outcomes[3].Err)
+	assert.NoError(t, outcomes[4].Err)
+	assert.ErrorIs(t, outcomes[5].Err, errors.DuplicateExternalRef)
+	assertBalance(t, repo, a, 501)
+	assertBalance(t, repo, b, 0)
+
+	assertLogMatchesBalance(t, repo, a)
+	assertLogMatchesBalance(t, repo, b)
+	report, err := repo.CheckLedger(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Balanced)
+	assert.Empty(t, report.WalletMismatches)
+}
+
+func testConcurrentBatches(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	a := mustCreateWallet(t, repo)
+	b := mustCreateWallet(t, repo)
+	require.NoError(t, repo.UpdateBalance(ctx, a, 100000, true))
+	require.NoError(t, repo.UpdateBalance(ctx, b, 100000, true))
+
+	// Встречные пакеты перечисляют кошельки в разном порядке — блокировки всё равно берутся по возрастанию id
+	const numGoroutines = 20
+	var wg sync.WaitGroup
+	errCh := make(chan error, numGoroutines)
+	for i := 0; i < numGoroutines; i++ {
+		first, second := a, b
+		if i%2 == 1 {
+			first, second = b, a
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outcomes, err := repo.ApplyBatch(ctx, model.BatchAtomic, []model.WalletOperation{
+				{WalletID: first, OperationType: model.OperationWithdraw, Amount: 10},
+				{WalletID: second, OperationType: model.OperationDeposit, Amount: 10},
+			})
+			if err != nil {
+				errCh <- err
+				return
+			}
+			for _, o := range outcomes {
+				if o.Err != nil {
+					errCh <- o.Err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+
+	for err := range errCh {
+		t.Fatalf("❌ Ошибка в конкурентной среде: %v", err)
+	}
+	assertBalance(t, repo, a, 100000)
+	assertBalance(t, repo, b, 100000)
+	assertLogMatchesBalance(t, repo, a)
+}
+
+func testWalletBatch(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 100, true))
+	deposit := func(amount int64) model.WalletOperation {
+		return model.WalletOperation{WalletID: id, OperationType: model.OperationDeposit, Amount: amount}
+	}
+	withdraw := func(amount int64) model.WalletOperation {
+		return model.WalletOperation{WalletID: id, OperationType: model.OperationWithdraw, Amount: amount}
+	}
+
+	_, err := repo.ApplyWalletBatch(ctx, id, nil)
+	assert.ErrorIs(t, err, errors.InvalidBatch)
+	other := deposit(1)
+	other.WalletID = uuid.New()
+	_, err = repo.ApplyWalletBatch(ctx, id, []model.WalletOperation{deposit(1), other})
+	assert.ErrorIs(t, err, errors.InvalidBatch)
+
+	missing := uuid.New()
+	outcomes, err := repo.ApplyWalletBatch(ctx, missing, []model.WalletOperation{{WalletID: missing, OperationType: model.OperationDeposit, Amount: 1}})
+	require.NoError(t, err)
+	assert.ErrorIs(t, outcomes[0].Err, errors.WalletNotFound)
+
+	// Средства проверяются по порядку: отказ не мешает следующим операциям,
+	// а пополнение внутри микропакета доступно списаниям после него
+	order := deposit(5)
+	order.ExternalRef = "invoice-7"
+	outcomes, err = repo.ApplyWalletBatch(ctx, id, []model.WalletOperation{
+		withdraw(80), withdraw(50), deposit(30), withdraw(40), order, order,
+	})
+	require.NoError(t, err)
+	require.Len(t, outcomes, 6)
+	assert.NoError(t, outcomes[0].Err)
+	assert.ErrorIs(t, outcomes[1].Err, errors.InsufficientFunds)
+	assert.NoError(t, outcomes[2].Err)
+	assert.NoError(t, outcomes[3].Err)
+	assert.Equal(t, model.OperationStatusAccepted, outcomes[3].Result.Status)
+	assert.NoError(t, outcomes[4].Err)
+	assert.ErrorIs(t, outcomes[5].Err, errors.DuplicateExternalRef)
+	assertBalance(t, repo, id, 15)
+
+	page, err := repo.GetTransactions(ctx, id, model.TransactionFilter{})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 5)
+	assert.Equal(t, "invoice-7", page.Items[0].ExternalRef)
+
+	// Лимит на число списаний учитывает списания того же микропакета
+	policy, err := repo.UpsertLimitPolicy(ctx, model.LimitPolicy{WalletID: &id, MaxOperations: 3, OperationsWindowSeconds: 3600})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, repo.DeleteLimitPolicy(ctx, policy.ID)) }()
+	outcomes, err = repo.ApplyWalletBatch(ctx, id, []model.WalletOperation{withdraw(1), withdraw(1)})
+	require.NoError(t, err)
+	assert.NoError(t, outcomes[0].Err)
+	assert.ErrorIs(t, outcomes[1].Err, errors.LimitExceeded)
+	assertBalance(t, repo, id, 14)
+
+	assertLogMatchesBalance(t, repo, id)
+	report, err := repo.CheckLedger(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Balanced)
+	assert.Empty(t, report.WalletMismatches)
+}
+
+func testVersions(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+	balance := func() model.WalletBalance {
+		b, err := repo.GetBalance(ctx, id)
+		require.NoError(t, err)
+		return b
+	}
+	deposit := model.WalletOperation{WalletID: id, OperationType: model.OperationDeposit, Amount: 1000}
+	withdraw := model.WalletOperation{WalletID: id, OperationType: model.OperationWithdraw, Amount: 100}
+
+	// Версия растёт с каждым изменением кошелька
+	created := balance()
+	_, err := repo.ApplyOperation(ctx, deposit, model.OperationOptions{})
+	require.NoError(t, err)
+	funded := balance()
+	assert.Greater(t, funded.Version, created.Version)
+	_, err = repo.SetOverdraftLimit(ctx, id, 500, "кредитная линия")
+	require.NoError(t, err)
+	current := balance()
+	assert.Greater(t, current.Version, funded.Version)
+	assert.NotEqual(t, funded.ETag(), current.ETag())
+
+	// Устаревший If-Match отклоняется и ничего не меняет
+	_, err = repo.ApplyOperation(ctx, withdraw, model.OperationOptions{IfMatch: funded.ETag()})
+	assert.ErrorIs(t, err, errors.PreconditionFailed)
+	assert.Equal(t, current, balance())
+
+	_, err = repo.ApplyOperation(ctx, withdraw, model.OperationOptions{IfMatch: current.ETag()})
+	require.NoError(t, err)
+	assertBalance(t, repo, id, 900)
+	_, err = repo.ApplyOperation(ctx, withdraw, model.OperationOptions{IfMatch: current.ETag()})
+	assert.ErrorIs(t, err, errors.PreconditionFailed)
+	_, err = repo.ApplyOperation(ctx, withdraw, model.OperationOptions{IfMatch: "*"})
+	require.NoError(t, err)
+
+	// Холд не трогает строку кошелька, но меняет доступный баланс — и ETag
+	before := balance()
+	_, err = repo.CreateHold(ctx, id, 300, time.Hour)
+	require.NoError(t, err)
+	held := balance()
+	assert.Equal(t, before.Version, held.Version)
+	assert.NotEqual(t, before.ETag(), held.ETag())
+	_, err = repo.ApplyOperation(ctx, withdraw, model.OperationOptions{IfMatch: before.ETag()})
+	assert.ErrorIs(t, err, errors.PreconditionFailed)
+
+	// Повтор по Idempotency-Key отдаёт сохранённый ответ, хотя версия уже другая
+	opts := model.OperationOptions{IdempotencyKey: uuid.NewString(), IfMatch: held.ETag()}
+	first, err := repo.ApplyOperation(ctx, withdraw, opts)
+	require.NoError(t, err)
+	replay, err := repo.ApplyOperation(ctx, withdraw, opts)
+	require.NoError(t, err)
+	assert.True(t, replay.Replayed)
+	assert.Equal(t, first.Amount, replay.Amount)
+	assertBalance(t, repo, id, 700)
+}
+
+func testBalanceAsOf(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+	for _, op := range []model.WalletOperation{
+		{WalletID: id, OperationType: model.OperationDeposit, Amount: 1000},
+		{WalletID: id, OperationType: model.OperationDeposit, Amount: 500},
+		{WalletID: id, OperationType: model.OperationWithdraw, Amount: 300},
+	} {
+		_, err := repo.ApplyOperation(ctx, op, model.OperationOptions{})
+		require.NoError(t, err)
+	}
+	page, err := repo.GetTransactions(ctx, id, model.TransactionFilter{})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 3)
+	first, second, last := page.Items[2], page.Items[1], page.Items[0]
+
+	assertAsOf := func(asOf time.Time, balance int64, lastTransaction *uuid.UUID) {
+		t.Helper()
+		hb, err := repo.GetBalanceAsOf(ctx, id, asOf)
+		require.NoError(t, err)
+		assert.Equal(t, balance, hb.Balance)
+		assert.Equal(t, lastTransaction, hb.LastTransactionID)
+		assert.Equal(t, model.DefaultCurrency, hb.Currency)
+		assert.True(t, asOf.Equal(hb.AsOf))
+	}
+	check := func() {
+		t.Helper()
+		assertAsOf(first.CreatedAt.Add(-time.Microsecond), 0, nil)
+		assertAsOf(first.CreatedAt, 1000, &first.ID)
+		assertAsOf(second.CreatedAt, 1500, &second.ID)
+		assertAsOf(last.CreatedAt.Add(-time.Microsecond), 1500, &second.ID)
+		assertAsOf(time.Now(), 1200, &last.ID)
+	}
+	check()
+
+	// Снимки не меняют ответа: баланс досчитывается от последнего снимка не позже asOf
+	n, err := repo.SnapshotBalances(ctx, second.CreatedAt)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, n, int64(1))
+	check()
+	n, err = repo.SnapshotBalances(ctx, second.CreatedAt)
+	require.NoError(t, err)
+	assert.Zero(t, n, "повторный снимок на тот же момент")
+
+	_, err = repo.SnapshotBalances(ctx, last.CreatedAt)
+	require.NoError(t, err)
+	check()
+
+	// Снимок на момент, который ещё не наступил, не учёл бы операций до него
+	_, err = repo.SnapshotBalances(ctx, time.Now().Add(time.Hour))
+	assert.ErrorIs(t, err, errors.SnapshotInFuture)
+
+	_, err = repo.GetBalanceAsOf(ctx, uuid.New(), time.Now())
+	assert.ErrorIs(t, err, errors.WalletNotFound)
+}
+
+func testStatement(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+	for _, op := range []model.WalletOperation{
+		{WalletID: id, OperationType: model.OperationDeposit, Amount: 1000},
+		{WalletID: id, OperationType: model.OperationWithdraw, Amount: 300},
+		{WalletID: id, OperationType: model.OperationDeposit, Amount: 200},
+	} {
+		_, err := repo.ApplyOperation(ctx, op, model.OperationOptions{})
+		require.NoError(t, err)
+	}
+	page, err := repo.GetTransactions(ctx, id, model.TransactionFilter{})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 3)
+	first, second, third := page.Items[2], page.Items[1], page.Items[0]
+
+	statement := func(from, to time.Time) []model.StatementLine {
+		t.Helper()
+		var lines []model.StatementLine
+		err := repo.Statement(ctx, id, from, to, func(line model.StatementLine) error {
+			lines = append(lines, line)
+			return nil
+		})
+		require.NoError(t, err)
+		return lines
+	}
+	// balances — остатки строк: OPENING, операции, CLOSING
+	assertStatement := func(lines []model.StatementLine, balances []int64, transactions ...uuid.UUID) {
+		t.Helper()
+		require.Len(t, lines, len(balances))
+		assert.Equal(t, model.StatementOpening, lines[0].Type)
+		assert.Equal(t, model.StatementClosing, lines[len(lines)-1].Type)
+		for i, line := range lines {
+			assert.Equal(t, balances[i], line.Balance, "строка %d", i)
+			assert.Equal(t, model.DefaultCurrency, line.Currency)
+			if i == 0 || i == len(lines)-1 {
+				assert.Nil(t, line.Transaction)
+				continue
+			}
+			assert.Equal(t, model.StatementOperation, line.Type)
+			require.NotNil(t, line.Transaction)
+			assert.Equal(t, transactions[i-1], line.Transaction.ID)
+			assert.True(t, line.Transaction.CreatedAt.Equal(line.Time))
+		}
+	}
+
+	// Период [from, to): операция в момент to в него не входит
+	lines := statement(second.CreatedAt, third.CreatedAt)
+	assertStatement(lines, []int64{1000, 700, 700}, second.ID)
+	assert.True(t, second.CreatedAt.Equal(lines[0].Time))
+	assert.True(t, third.CreatedAt.Equal(lines[2].Time))
+
+	whole := []int64{0, 1000, 700, 900, 900}
+	assertStatement(statement(first.CreatedAt, time.Now()), whole, first.ID, second.ID, third.ID)
+
+	// Снимок на начало периода в остаток на начало не входит — он включает операцию в момент from
+	_, err = repo.SnapshotBalances(ctx, first.CreatedAt)
+	require.NoError(t, err)
+	assertStatement(statement(first.CreatedAt, time.Now()), whole, first.ID, second.ID, third.ID)
+	assertStatement(statement(second.CreatedAt, time.Now()), []int64{1000, 700, 900, 900}, second.ID, third.ID)
+
+	// Ошибка emit прерывает выписку
+	stop := fmt.Errorf("client went away")
+	var n int
+	err = repo.Statement(ctx, id, first.CreatedAt, time.Now(), func(model.StatementLine) error {
+		n++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, n)
+
+	err = repo.Statement(ctx, uuid.New(), first.CreatedAt, time.Now(), func(model.StatementLine) error {
+		t.Fatal("unknown wallet has no statement lines")
+		return nil
+	})
+	assert.ErrorIs(t, err, errors.WalletNotFound)
+}
+
+func testCaptureFee(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	// Правило только для KZT/BUSINESS, чтобы не задеть кошельки других тестов
+	rule, err := repo.UpsertFeeRule(ctx, model.FeeRule{
+		Operation: model.FeeOnWithdraw, Currency: "KZT", WalletType: model.WalletBusiness, Kind: model.FeeFixed, Fixed: 25,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, repo.DeleteFeeRule(ctx, rule.ID)) }()
+
+	id := mustCreateWalletWith(t, repo, model.CreateWalletRequest{Currency: "KZT", WalletType: model.WalletBusiness})
+	require.NoError(t, repo.UpdateBalance(ctx, id, 1000, true))
+
+	// Списание холда берёт комиссию WITHDRAW сверх суммы, как обычное списание
+	hold, err := repo.CreateHold(ctx, id, 600, time.Hour)
+	require.NoError(t, err)
+	_, err = repo.CaptureHold(ctx, hold.ID, 500)
+	require.NoError(t, err)
+	assertBalance(t, repo, id, 1000-500-25)
+
+	last := latestTransaction(t, repo, id)
+	assert.Equal(t, model.OperationCapture, last.OperationType)
+	assert.Equal(t, int64(500), last.Amount)
+	assert.Equal(t, int64(25), last.Fee)
+	require.NotNil(t, last.EntryID)
+	entry, err := repo.GetJournalEntry(ctx, *last.EntryID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []model.Posting{
+		{Account: model.WalletAccount(id), Amount: -525},
+		{Account: model.SystemLedgerAccount(model.AccountExternalCashOut), Amount: 500},
+		{Account: model.SystemLedgerAccount(model.AccountFees), Amount: 25},
+	}, entry.Postings)
+
+	// Холд на весь доступный баланс: комиссия сверх полной суммы не помещается,
+	// и ничего не списывается
+	hold, err = repo.CreateHold(ctx, id, 475, time.Hour)
+	require.NoError(t, err)
+	_, err = repo.CaptureHold(ctx, hold.ID, 0)
+	assert.ErrorIs(t, err, errors.InsufficientFunds)
+	assertBalance(t, repo, id, 475)
+	hold, err = repo.GetHold(ctx, hold.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.HoldActive, hold.Status)
+
+	// Частичное списание оставляет место для комиссии
+	_, err = repo.CaptureHold(ctx, hold.ID, 450)
+	require.NoError(t, err)
+	assertBalance(t, repo, id, 0)
+
+	assertLogMatchesBalance(t, repo, id)
+	report, err := repo.CheckLedger(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.Balanced)
+}
+
+func testHoldLimits(t *testing.T, repo repository.WalletRepository) {
+	ctx := context.Background()
+	id := mustCreateWallet(t, repo)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 10000, true))
+	policy, err := repo.UpsertLimitPolicy(ctx, model.LimitPolicy{WalletID: &id, MaxSingle: 800, DailyWithdrawal: 1000})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, repo.DeleteLimitPolicy(ctx, policy.ID)) }()
+
+	// Холд, который не пройдёт лимиты, не создаётся
+	var limitErr *errors.LimitError
+	_, err = repo.CreateHold(ctx, id, 900, time.Hour)
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, errors.LimitError{Limit: string(model.LimitMaxSingle), Max: 800, Requested: 900}, *limitErr)
+
+	// Списание холда учитывается дневным лимитом наравне с WITHDRAW
+	hold, err := repo.CreateHold(ctx, id, 700, time.Hour)
+	require.NoError(t, err)
+	_, err = repo.CaptureHold(ctx, hold.ID, 0)
+	require.NoError(t, err)
+	_, err = repo.CreateHold(ctx, id, 400, time.Hour)
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, errors.LimitError{Limit: string(model.LimitDailyWithdrawal), Max: 1000, Used: 700, Requested: 400}, *limitErr)
+
+	// Между созданием холда и списанием прошло другое списание: лимит
+	// проверяется ещё раз, и холд остаётся действующим
+	hold, err = repo.CreateHold(ctx, id, 300, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateBalance(ctx, id, 200, false))
+	_, err = repo.CaptureHold(ctx, hold.ID, 0)
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, errors.LimitError{Limit: string(model.LimitDailyWithdrawal), Max: 1000, Used: 900, Requested: 300}, *limitErr)
+	hold, err = repo.GetHold(ctx, hold.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.HoldActive, hold.Status)
+	assertBalance(t, repo, id, 10000-700-200)
+
+	// Частичное списание укладывается в остаток лимита
+	_, err = repo.CaptureHold(ctx, hold.ID, 100)
+	require.NoError(t, err)
+	err = repo.UpdateBalance(ctx, id, 1, false)
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, errors.LimitError{Limit: string(model.LimitDailyWithdrawal), Max: 1000, Used: 1000, Requested: 1}, *limitErr)
+	assertLogMatchesBalance(t, repo, id)
+}
+
+func mustCreateWallet(t *testing.T, repo repository.WalletRepository) uuid.UUID {
+	t.Helper()
+	return mustCreateWalletWith(t, repo, model.CreateWalletRequest{})
+}
+
+func mustCreateWalletWith(t *testing.T, repo repository.WalletRepository, req model.CreateWalletRequest) uuid.UUID {
+	t.Helper()
+	wallet, err := repo.CreateWallet(context.Background(), req)
+	require.NoError(t, err)
+	return wallet.ID
+}
+
+func assertBalance(t *testing.T, repo repository.WalletRepository, id uuid.UUID, expected int64) int64 {
+	t.Helper()
+	balance, err := repo.GetBalance(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, expected, balance.Balance)
+	return balance.Balance
+}
+
+// latestTransaction — последняя строка журнала кошелька
+func latestTransaction(t *testing.T, repo repository.WalletRepository, id uuid.UUID) model.Transaction {
+	t.Helper()
+	page, err := repo.GetTransactions(context.Background(), id, model.TransactionFilter{Limit: 1})
+	require.NoError(t, err)
+	require.NotEmpty(t, page.Items)
+	return page.Items[0]
+}
+
+// assertLogMatchesBalance — баланс равен сумме операций журнала
+func assertLogMatchesBalance(t *testing.T, repo repository.WalletRepository, id uuid.UUID) {
+	t.Helper()
+	ctx := context.Background()
+
+	var sum int64
+	cursor := ""
+	for {
+		page, err := repo.GetTransactions(ctx, id, model.TransactionFilter{Limit: model.MaxTransactionsLimit, Cursor: cursor})
+		require.NoError(t, err)
+		for _, tx := range page.Items {
+			require.NotZero(t, tx.OperationType.Sign(), "unknown operation type %s", tx.OperationType)
+			sum += tx.BalanceDelta()
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	balance, err := repo.GetBalance(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, balance.Balance, sum, "balance must equal the sum of the audit log")
+}
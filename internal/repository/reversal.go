@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// Возврат не меняет исходную строку журнала, кроме счётчика reversed_amount:
+// пишется компенсирующая запись главной книги и строки REVERSAL_IN/REVERSAL_OUT
+// со ссылкой reverses_id. У перевода сторнируются обе ноги — деньги идут
+// от получателя обратно отправителю. Комиссия исходной операции не возвращается.
+
+// isTransferLeg — строка журнала — нога перевода между кошельками
+func isTransferLeg(t model.Transaction) bool {
+	return t.TransferID != nil && (t.OperationType == model.OperationTransferOut || t.OperationType == model.OperationTransferIn)
+}
+
+// planReversal — сумма возврата по исходной операции legs[0]; amount 0 — весь остаток
+func planReversal(legs []model.Transaction, amount int64) (int64, error) {
+	original := legs[0]
+	if _, ok := model.ReversalType(original.OperationType); !ok {
+		return 0, fmt.Errorf("%w: %s is %s", errors.NotReversible, original.ID, original.OperationType)
+	}
+	remaining := original.Reversible()
+	if remaining == 0 {
+		return 0, fmt.Errorf("%w: %s", errors.AlreadyReversed, original.ID)
+	}
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount < 0 || amount > remaining {
+		return 0, fmt.Errorf("%w: reversal %d exceeds remaining %d", errors.InvalidAmount, amount, remaining)
+	}
+	return amount, nil
+}
+
+// checkReversalWallet — статус кошелька и, если возврат с него списывает, доступные средства.
+// Сторно списывает только собственные деньги: кредитная линия не в счёт,
+// иначе возврат уже потраченного пополнения уводил бы кошелёк в долг.
+func checkReversalWallet(w lockedWallet, held int64, leg model.Transaction, amount int64, freezeBlocksCredits bool) error {
+	reversalType, _ := model.ReversalType(leg.OperationType)
+	debit := reversalType == model.OperationReversalOut
+	if err := checkWalletStatus(w, debit, freezeBlocksCredits); err != nil {
+		return err
+	}
+	if available := w.balance - held; debit && available < amount {
+		return fmt.Errorf("%w: available %d, reversal %d", errors.InsufficientFunds, available, amount)
+	}
+	return nil
+}
+
+// reversalPostings — проводки исходной операции с обратным знаком, на сумму возврата.
+// У перевода ноги гасят друг друга; у одиночной операции противоположная сторона —
+// EXTERNAL_CASH_IN (пополнение) или EXTERNAL_CASH_OUT (списание, CAPTURE)
+func reversalPostings(legs []model.Transaction, amount int64) []model.Posting {
+	postings := make([]model.Posting, 0, 2)
+	for _, leg := range legs {
+		postings = append(postings, model.Posting{Account: model.WalletAccount(leg.WalletID), Amount: -leg.OperationType.Sign() * amount})
+	}
+	if len(legs) == 1 {
+		account := model.AccountExternalCashOut
+		if legs[0].OperationType == model.OperationDeposit {
+			account = model.AccountExternalCashIn
+		}
+		postings = append(postings, model.Posting{Account: model.SystemLedgerAccount(account), Amount: legs[0].OperationType.Sign() * amount})
+	}
+	return postings
+}
+
+// reversalRows — компенсирующие строки журнала, по одной на ногу
+func reversalRows(legs []model.Transaction, amount int64, entryID uuid.UUID, reason string) []model.Transaction {
+	rows := make([]model.Transaction, len(legs))
+	for i, leg := range legs {
+		reversalType, _ := model.ReversalType(leg.OperationType)
+		rows[i] = model.Transaction{
+			WalletID:      leg.WalletID,
+			OperationType: reversalType,
+			Amount:        amount,
+			EntryID:       &entryID,
+			Reason:        reason,
+			ReversesID:    &leg.ID,
+		}
+	}
+	return rows
+}
+
+func (r *PostgresWalletRepository) ReverseTransaction(ctx context.Context, transactionID uuid.UUID, amount int64, reason string) (model.Reversal, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return model.Reversal{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Ноги исходной операции (у перевода — обе) и их кошельки
+	original, err := scanTransaction(tx.QueryRow(ctx, `SELECT `+transactionColumns+` FROM transactions WHERE id = $1`, transactionID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return model.Reversal{}, fmt.Errorf("%w: %s", errors.TransactionNotFound, transactionID)
+		}
+		return model.Reversal{}, fmt.Errorf("select transaction: %w", err)
+	}
+	legIDs := []uuid.UUID{transactionID}
+	walletIDs := []uuid.UUID{original.WalletID}
+	if isTransferLeg(original) {
+		var otherID, otherWallet uuid.UUID
+		err := tx.QueryRow(ctx, `
+			SELECT id, wallet_id FROM transactions
+			WHERE transfer_id = $1 AND id <> $2 AND operation_type IN ('TRANSFER_OUT', 'TRANSFER_IN')`,
+			*original.TransferID, transactionID,
+		).Scan(&otherID, &otherWallet)
+		if err != nil {
+			return model.Reversal{}, fmt.Errorf("select transfer leg: %w", err)
+		}
+		legIDs = append(legIDs, otherID)
+		walletIDs = append(walletIDs, otherWallet)
+	}
+
+	// 🔒 Порядок блокировок как в CaptureHold: сначала кошельки, потом строки журнала
+	wallets := make(map[uuid.UUID]lockedWallet, len(walletIDs))
+	for _, id := range lockOrder(walletIDs...) {
+		if wallets[id], err = lockWallet(ctx, tx, id); err != nil {
+			return model.Reversal{}, err
+		}
+	}
+	legs := make([]model.Transaction, len(legIDs))
+	for i, id := range legIDs {
+		if legs[i], err = scanTransaction(tx.QueryRow(ctx, `SELECT `+transactionColumns+` FROM transactions WHERE id = $1 FOR UPDATE`, id)); err != nil {
+			return model.Reversal{}, fmt.Errorf("lock transaction: %w", err)
+		}
+	}
+
+	if amount, err = planReversal(legs, amount); err != nil {
+		return model.Reversal{}, err
+	}
+	for _, leg := range legs {
+		held, err := heldAmount(ctx, tx, leg.WalletID)
+		if err != nil {
+			return model.Reversal{}, err
+		}
+		if err := checkReversalWallet(wallets[leg.WalletID], held, leg, amount, r.freezeBlocksCredits); err != nil {
+			return model.Reversal{}, err
+		}
+	}
+
+	entryID, err := postEntry(ctx, tx, model.EntryReversal, wallets[original.WalletID].currency, reversalPostings(legs, amount))
+	if err != nil {
+		return model.Reversal{}, err
+	}
+	rows := reversalRows(legs, amount, entryID, reason)
+	for i, row := range rows {
+		id, err := insertTransaction(ctx, tx, row)
+		if err != nil {
+			return model.Reversal{}, err
+		}
+		_, err = tx.Exec(ctx, `UPDATE transactions SET reversed_amount = reversed_amount + $2 WHERE id = $1`, legs[i].ID, amount)
+		if err != nil {
+			return model.Reversal{}, fmt.Errorf("update reversed amount: %w", err)
+		}
+		if rows[i], err = scanTransaction(tx.QueryRow(ctx, `SELECT `+transactionColumns+` FROM transactions WHERE id = $1`, id)); err != nil {
+			return model.Reversal{}, fmt.Errorf("select reversal: %w", err)
+		}
+		balance := wallets[row.WalletID].balance + rows[i].BalanceDelta()
+		if err := insertOutboxEvent(ctx, tx, model.NewBalanceChanged(rows[i], balance)); err != nil {
+			return model.Reversal{}, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return model.Reversal{}, fmt.Errorf("commit: %w", err)
+	}
+	return model.Reversal{
+		OriginalID:     transactionID,
+		Amount:         amount,
+		ReversedAmount: legs[0].ReversedAmount + amount,
+		Transactions:   rows,
+	}, nil
+}
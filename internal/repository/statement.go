@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// Statement читает выписку в транзакции REPEATABLE READ: остаток на начало и
+// операции периода видят один и тот же журнал, и CLOSING сходится с суммой
+// строк. Операции идут курсором pgx по мере того, как emit их принимает, —
+// память не зависит от числа строк. Транзакция держится, пока выписка
+// передаётся клиенту.
+func (r *PostgresWalletRepository) Statement(ctx context.Context, walletID uuid.UUID, from, to time.Time, emit func(model.StatementLine) error) error {
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Остаток на начало — по операциям строго раньше from, от последнего снимка
+	opening := model.StatementLine{Type: model.StatementOpening, Time: from}
+	sqlQuery := `
+		SELECT w.currency, COALESCE(s.balance, 0) + t.delta
+		FROM wallets w` + balanceAtJoinsSQL("$2::timestamptz", "<") + `
+		WHERE w.id = $1`
+	err = tx.QueryRow(ctx, sqlQuery, walletID, from).Scan(&opening.Currency, &opening.Balance)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
+		}
+		return fmt.Errorf("select opening balance: %w", err)
+	}
+	if err := emit(opening); err != nil {
+		return err
+	}
+
+	sqlQuery = `
+		SELECT ` + transactionColumns + `
+		FROM transactions
+		WHERE wallet_id = $1 AND created_at >= $2 AND created_at < $3
+		ORDER BY created_at, id`
+	rows, err := tx.Query(ctx, sqlQuery, walletID, from, to)
+	if err != nil {
+		return fmt.Errorf("select statement: %w", err)
+	}
+	defer rows.Close()
+
+	balance := opening.Balance
+	for rows.Next() {
+		t, err := scanTransaction(rows)
+		if err != nil {
+			return fmt.Errorf("scan transaction: %w", err)
+		}
+		balance += t.BalanceDelta()
+		line := model.StatementLine{Type: model.StatementOperation, Time: t.CreatedAt, Balance: balance, Currency: opening.Currency, Transaction: &t}
+		if err := emit(line); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("read statement: %w", err)
+	}
+
+	return emit(model.StatementLine{Type: model.StatementClosing, Time: to, Balance: balance, Currency: opening.Currency})
+}
@@ -0,0 +1,22 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// Оптимистичная блокировка: wallets.version увеличивает триггер
+// wallets_bump_version при любом UPDATE строки кошелька, так что ни один
+// путь записи (обычный, пакеты, микропакеты, смена статуса) её не минует.
+
+// checkPrecondition — If-Match совпадает с текущим ETag кошелька. Вызывается
+// под блокировкой кошелька, которая держится до конца операции: между
+// проверкой и изменением баланса версия не сменится.
+func checkPrecondition(w lockedWallet, held int64, ifMatch string) error {
+	if etag := model.WalletETag(w.version, held); !model.ETagMatches(ifMatch, etag, false) {
+		return fmt.Errorf("%w: current ETag %s", errors.PreconditionFailed, etag)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+const walletColumns = `id, currency, wallet_type, status, COALESCE(owner_id, ''), COALESCE(external_id, ''), labels, created_at`
+
+func scanWallet(row pgx.Row) (model.Wallet, error) {
+	var w model.Wallet
+	err := row.Scan(&w.ID, &w.Currency, &w.WalletType, &w.Status, &w.OwnerID, &w.ExternalID, &w.Labels, &w.CreatedAt)
+	return w, err
+}
+
+// replayedWallet — ответ на повторное создание кошелька с тем же externalId
+func replayedWallet(existing model.Wallet, req model.CreateWalletRequest) (model.Wallet, error) {
+	if !existing.Matches(req) {
+		return model.Wallet{}, fmt.Errorf("%w: %q is %s %s", errors.ExternalIDConflict, req.ExternalID, existing.Currency, existing.WalletType)
+	}
+	existing.Replayed = true
+	return existing, nil
+}
+
+func (r *PostgresWalletRepository) ListWallets(ctx context.Context, ownerID string) ([]model.Wallet, error) {
+	rows, err := r.pool.Query(ctx, `SELECT `+walletColumns+` FROM wallets WHERE owner_id = $1 ORDER BY created_at, id`, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("select wallets: %w", err)
+	}
+	wallets, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.Wallet, error) {
+		return scanWallet(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scan wallet: %w", err)
+	}
+	return wallets, nil
+}
+
+// GetWalletByExternalID ищет кошелёк по externalId в пространстве владельца (пустой ownerId — кошельки без владельца)
+func (r *PostgresWalletRepository) GetWalletByExternalID(ctx context.Context, ownerID, externalID string) (model.Wallet, error) {
+	w, err := scanWallet(r.pool.QueryRow(ctx, `SELECT `+walletColumns+` FROM wallets
+		WHERE COALESCE(owner_id, '') = $1 AND external_id = $2`, ownerID, externalID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return w, fmt.Errorf("%w: external id %q", errors.WalletNotFound, externalID)
+		}
+		return w, fmt.Errorf("select wallet: %w", err)
+	}
+	return w, nil
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// lockedWallet — строка кошелька, заблокированная lockWallet
+type lockedWallet struct {
+	id       uuid.UUID
+	balance  int64
+	currency model.Currency
+	status   model.WalletStatus
+
+	walletType model.WalletType
+
+	overdraftLimit int64
+
+	version int64
+}
+
+// spendable — сколько можно списать с кошелька: доступный баланс плюс кредитная линия
+func (w lockedWallet) spendable(held int64) int64 {
+	return w.balance - held + w.overdraftLimit
+}
+
+// checkWalletStatus — можно ли провести операцию по кошельку в его статусе.
+// debit — операция уменьшает доступный баланс (списание, исходящий перевод, холд).
+// Замороженный кошелёк принимает зачисления, если не включён FREEZE_BLOCKS_CREDITS;
+// закрытый не принимает ничего.
+func checkWalletStatus(w lockedWallet, debit, freezeBlocksCredits bool) error {
+	switch w.status {
+	case model.WalletClosed:
+		return fmt.Errorf("%w: %s", errors.WalletClosed, w.id)
+	case model.WalletFrozen:
+		if debit || freezeBlocksCredits {
+			return fmt.Errorf("%w: %s", errors.WalletFrozen, w.id)
+		}
+	}
+	return nil
+}
+
+// validateStatusChange — общие проверки перехода для обоих хранилищ.
+// Закрыть можно только пустой кошелёк: без денег и действующих холдов.
+func validateStatusChange(w lockedWallet, held int64, to model.WalletStatus, reason string) error {
+	if strings.TrimSpace(reason) == "" {
+		return errors.ReasonRequired
+	}
+	if !w.status.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s → %s", errors.InvalidTransition, w.status, to)
+	}
+	if to == model.WalletClosed && (w.balance != 0 || held != 0) {
+		return fmt.Errorf("%w: balance %d, held %d", errors.WalletNotEmpty, w.balance, held)
+	}
+	return nil
+}
+
+func (r *PostgresWalletRepository) ChangeWalletStatus(ctx context.Context, walletID uuid.UUID, to model.WalletStatus, reason string) (model.WalletStatusChange, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return model.WalletStatusChange{}, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// 🔒 Под блокировкой кошелька: закрытие не разминётся с параллельным пополнением
+	wallet, err := lockWallet(ctx, tx, walletID)
+	if err != nil {
+		return model.WalletStatusChange{}, err
+	}
+	held, err := heldAmount(ctx, tx, walletID)
+	if err != nil {
+		return model.WalletStatusChange{}, err
+	}
+	if err := validateStatusChange(wallet, held, to, reason); err != nil {
+		return model.WalletStatusChange{}, err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE wallets SET status = $2, updated_at = NOW() WHERE id = $1`, walletID, string(to))
+	if err != nil {
+		return model.WalletStatusChange{}, fmt.Errorf("update status: %w", err)
+	}
+
+	change := model.WalletStatusChange{WalletID: walletID, FromStatus: wallet.status, ToStatus: to, Reason: reason}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO wallet_status_history (wallet_id, from_status, to_status, reason)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`,
+		walletID, string(wallet.status), string(to), reason,
+	).Scan(&change.ID, &change.CreatedAt)
+	if err != nil {
+		return model.WalletStatusChange{}, fmt.Errorf("insert status history: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return model.WalletStatusChange{}, fmt.Errorf("commit: %w", err)
+	}
+	return change, nil
+}
+
+// GetWalletStatusHistory — переходы статусов кошелька, от старых к новым
+func (r *PostgresWalletRepository) GetWalletStatusHistory(ctx context.Context, walletID uuid.UUID) ([]model.WalletStatusChange, error) {
+	var exists bool
+	if err := r.pool.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM wallets WHERE id = $1)`, walletID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("check wallet: %w", err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", errors.WalletNotFound, walletID)
+	}
+
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, wallet_id, from_status, to_status, reason, created_at
+		FROM wallet_status_history
+		WHERE wallet_id = $1
+		ORDER BY created_at, id`, walletID)
+	if err != nil {
+		return nil, fmt.Errorf("select status history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []model.WalletStatusChange{}
+	for rows.Next() {
+		var c model.WalletStatusChange
+		if err := rows.Scan(&c.ID, &c.WalletID, &c.FromStatus, &c.ToStatus, &c.Reason, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan status history: %w", err)
+		}
+		history = append(history, c)
+	}
+	return history, rows.Err()
+}
@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+func TestCheckWalletStatus(t *testing.T) {
+	tests := []struct {
+		name                string
+		status              model.WalletStatus
+		debit               bool
+		freezeBlocksCredits bool
+		want                error
+	}{
+		{"active debit", model.WalletActive, true, false, nil},
+		{"active credit", model.WalletActive, false, true, nil},
+		{"frozen debit", model.WalletFrozen, true, false, errors.WalletFrozen},
+		{"frozen credit", model.WalletFrozen, false, false, nil},
+		{"frozen credit, credits blocked", model.WalletFrozen, false, true, errors.WalletFrozen},
+		{"closed debit", model.WalletClosed, true, false, errors.WalletClosed},
+		{"closed credit", model.WalletClosed, false, false, errors.WalletClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkWalletStatus(lockedWallet{id: uuid.New(), status: tt.status}, tt.debit, tt.freezeBlocksCredits)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
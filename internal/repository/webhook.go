@@ -0,0 +1,246 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+)
+
+// Transactional outbox: событие пишется в outbox_events в транзакции операции,
+// поэтому подписчики узнают ровно о тех изменениях баланса, что закоммичены.
+// Дальше диспетчер (internal/webhook) раскладывает события по подпискам
+// в webhook_deliveries и доставляет их с повторами.
+
+// insertOutboxEvent записывает событие wallet.balance_changed
+func insertOutboxEvent(ctx context.Context, tx pgx.Tx, data model.BalanceChanged) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	sqlQuery := `
+		INSERT INTO outbox_events (event_type, wallet_id, payload)
+		VALUES ($1, $2, $3)`
+	if _, err := tx.Exec(ctx, sqlQuery, model.EventBalanceChanged, data.WalletID, payload); err != nil {
+		return fmt.Errorf("insert outbox event: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresWalletRepository) CreateSubscription(ctx context.Context, sub model.WebhookSubscription) (model.WebhookSubscription, error) {
+	sqlQuery := `
+		INSERT INTO webhook_subscriptions (url, secret)
+		VALUES ($1, $2)
+		RETURNING id, created_at`
+	if err := r.pool.QueryRow(ctx, sqlQuery, sub.URL, sub.Secret).Scan(&sub.ID, &sub.CreatedAt); err != nil {
+		return sub, fmt.Errorf("insert subscription: %w", err)
+	}
+	return sub, nil
+}
+
+// ListSubscriptions возвращает подписки без секретов
+func (r *PostgresWalletRepository) ListSubscriptions(ctx context.Context) ([]model.WebhookSubscription, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT id, url, created_at
+		FROM webhook_subscriptions
+		ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("select subscriptions: %w", err)
+	}
+	subs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.WebhookSubscription, error) {
+		var sub model.WebhookSubscription
+		err := row.Scan(&sub.ID, &sub.URL, &sub.CreatedAt)
+		return sub, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+// DeleteSubscription удаляет подписку вместе с её доставками
+func (r *PostgresWalletRepository) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("delete subscription: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", errors.SubscriptionNotFound, id)
+	}
+	return nil
+}
+
+func (r *PostgresWalletRepository) FanOutEvents(ctx context.Context, now time.Time, limit int) (int, error) {
+	// SKIP LOCKED — несколько диспетчеров не раскладывают одно событие дважды
+	sqlQuery := `
+		WITH batch AS (
+			SELECT id
+			FROM outbox_events
+			WHERE dispatched_at IS NULL
+			ORDER BY created_at, id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		), fan_out AS (
+			INSERT INTO webhook_deliveries (event_id, subscription_id, status, next_attempt_at)
+			SELECT b.id, s.id, $3, $1
+			FROM batch b
+			CROSS JOIN webhook_subscriptions s
+			ON CONFLICT (event_id, subscription_id) DO NOTHING
+		)
+		UPDATE outbox_events
+		SET dispatched_at = $1
+		WHERE id IN (SELECT id FROM batch)`
+	tag, err := r.pool.Exec(ctx, sqlQuery, now, limit, string(model.DeliveryPending))
+	if err != nil {
+		return 0, fmt.Errorf("fan out events: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+func (r *PostgresWalletRepository) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.DeliveryTask, error) {
+	sqlQuery := `
+		WITH due AS (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = $4 AND next_attempt_at <= $1
+			ORDER BY next_attempt_at, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		), claimed AS (
+			UPDATE webhook_deliveries d
+			SET next_attempt_at = $1 + $2::bigint * INTERVAL '1 millisecond'
+			FROM due
+			WHERE d.id = due.id
+			RETURNING d.*
+		)
+		SELECT ` + deliveryColumns("c") + `,
+		       e.id, e.event_type, e.wallet_id, e.payload, e.created_at,
+		       s.url, s.secret
+		FROM claimed c
+		JOIN outbox_events e ON e.id = c.event_id
+		JOIN webhook_subscriptions s ON s.id = c.subscription_id
+		ORDER BY c.next_attempt_at, c.id`
+	rows, err := r.pool.Query(ctx, sqlQuery, now, lease.Milliseconds(), limit, string(model.DeliveryPending))
+	if err != nil {
+		return nil, fmt.Errorf("claim deliveries: %w", err)
+	}
+	tasks, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.DeliveryTask, error) {
+		var task model.DeliveryTask
+		dest := append(deliveryDest(&task.Delivery),
+			&task.Event.ID, &task.Event.Type, &task.Event.WalletID, &task.Event.Data, &task.Event.CreatedAt,
+			&task.URL, &task.Secret)
+		err := row.Scan(dest...)
+		return task, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read claimed deliveries: %w", err)
+	}
+	return tasks, nil
+}
+
+func (r *PostgresWalletRepository) RecordDeliveryAttempt(ctx context.Context, attempt model.DeliveryAttempt) error {
+	var deliveredAt *time.Time
+	if attempt.Status == model.DeliveryDelivered {
+		deliveredAt = &attempt.At
+	}
+
+	sqlQuery := `
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1,
+		    status = $2,
+		    last_status_code = NULLIF($3, 0),
+		    last_error = NULLIF($4, ''),
+		    next_attempt_at = $5,
+		    delivered_at = $6
+		WHERE id = $1`
+	tag, err := r.pool.Exec(ctx, sqlQuery,
+		attempt.DeliveryID, string(attempt.Status), attempt.StatusCode, attempt.Error, attempt.NextAttemptAt, deliveredAt)
+	if err != nil {
+		return fmt.Errorf("update delivery: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", errors.DeliveryNotFound, attempt.DeliveryID)
+	}
+	return nil
+}
+
+// ListDeliveries возвращает доставки от новых к старым
+func (r *PostgresWalletRepository) ListDeliveries(ctx context.Context, filter model.DeliveryFilter) ([]model.WebhookDelivery, error) {
+	sqlQuery := `SELECT ` + deliveryColumns("d") + ` FROM webhook_deliveries d WHERE true`
+	var args []any
+	if filter.Status != "" {
+		args = append(args, string(filter.Status))
+		sqlQuery += fmt.Sprintf(" AND d.status = $%d", len(args))
+	}
+	if filter.SubscriptionID != nil {
+		args = append(args, *filter.SubscriptionID)
+		sqlQuery += fmt.Sprintf(" AND d.subscription_id = $%d", len(args))
+	}
+	args = append(args, normalizeDeliveriesLimit(filter.Limit))
+	sqlQuery += fmt.Sprintf(" ORDER BY d.created_at DESC, d.id DESC LIMIT $%d", len(args))
+
+	rows, err := r.pool.Query(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select deliveries: %w", err)
+	}
+	deliveries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.WebhookDelivery, error) {
+		var d model.WebhookDelivery
+		err := row.Scan(deliveryDest(&d)...)
+		return d, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (r *PostgresWalletRepository) Redeliver(ctx context.Context, id uuid.UUID, now time.Time) (model.WebhookDelivery, error) {
+	sqlQuery := `
+		UPDATE webhook_deliveries d
+		SET status = $2, attempts = 0, next_attempt_at = $3
+		WHERE d.id = $1
+		RETURNING ` + deliveryColumns("d")
+
+	var d model.WebhookDelivery
+	err := r.pool.QueryRow(ctx, sqlQuery, id, string(model.DeliveryPending), now).Scan(deliveryDest(&d)...)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return d, fmt.Errorf("%w: %s", errors.DeliveryNotFound, id)
+		}
+		return d, fmt.Errorf("redeliver: %w", err)
+	}
+	return d, nil
+}
+
+// deliveryColumns — колонки webhook_deliveries в порядке deliveryDest
+func deliveryColumns(alias string) string {
+	return fmt.Sprintf(`%[1]s.id, %[1]s.event_id, %[1]s.subscription_id, %[1]s.status, %[1]s.attempts,
+		%[1]s.next_attempt_at, COALESCE(%[1]s.last_status_code, 0), COALESCE(%[1]s.last_error, ''),
+		%[1]s.delivered_at, %[1]s.created_at`, alias)
+}
+
+func deliveryDest(d *model.WebhookDelivery) []any {
+	return []any{
+		&d.ID, &d.EventID, &d.SubscriptionID, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastStatusCode, &d.LastError,
+		&d.DeliveredAt, &d.CreatedAt,
+	}
+}
+
+// normalizeDeliveriesLimit приводит limit к допустимому диапазону
+func normalizeDeliveriesLimit(limit int) int {
+	if limit <= 0 {
+		return model.DefaultDeliveriesLimit
+	}
+	if limit > model.MaxDeliveriesLimit {
+		return model.MaxDeliveriesLimit
+	}
+	return limit
+}
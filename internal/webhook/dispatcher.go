@@ -0,0 +1,184 @@
+// Package webhook доставляет события outbox подписчикам.
+//
+// Диспетчер периодически раскладывает новые события по подпискам и
+// отправляет доставки, срок которых наступил. Неудачная доставка
+// повторяется с экспоненциальной задержкой; после WebhookMaxAttempts
+// попыток она переходит в DEAD и ждёт ручной переотправки.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fangimal/ITK/internal/config"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/fangimal/ITK/internal/repository"
+)
+
+const (
+	batchSize  = 100
+	maxBackoff = time.Hour
+	// leaseMargin — запас поверх таймаута запроса, на который доставка
+	// откладывается при взятии в работу
+	leaseMargin = 30 * time.Second
+)
+
+type Dispatcher struct {
+	repo         repository.WebhookRepository
+	client       *http.Client
+	pollInterval time.Duration
+	backoff      time.Duration
+	maxAttempts  int
+	lease        time.Duration
+	now          func() time.Time
+}
+
+func NewDispatcher(repo repository.WebhookRepository, cfg *config.Config) *Dispatcher {
+	// Адрес подписчика проверяется при каждом соединении; прокси из окружения
+	// не используется, иначе проверялся бы адрес прокси, а не подписчика
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = NewTargetPolicy(cfg.WebhookAllowedTargets).DialContext
+
+	return &Dispatcher{
+		repo:         repo,
+		client:       &http.Client{Timeout: cfg.WebhookTimeout, Transport: transport},
+		pollInterval: cfg.WebhookPollInterval,
+		backoff:      cfg.WebhookBackoff,
+		maxAttempts:  cfg.WebhookMaxAttempts,
+		lease:        cfg.WebhookTimeout + leaseMargin,
+		now:          func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Run работает до отмены ctx
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := d.RunOnce(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("⚠️ Доставка webhook: %v", err)
+			}
+		}
+	}
+}
+
+// RunOnce раскладывает новые события по подпискам и отправляет одну пачку
+// доставок; возвращает число сделанных попыток
+func (d *Dispatcher) RunOnce(ctx context.Context) (int, error) {
+	for {
+		n, err := d.repo.FanOutEvents(ctx, d.now(), batchSize)
+		if err != nil {
+			return 0, err
+		}
+		if n < batchSize {
+			break
+		}
+	}
+
+	tasks, err := d.repo.ClaimDeliveries(ctx, d.now(), d.lease, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(tasks))
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task model.DeliveryTask) {
+			defer wg.Done()
+			if err := d.repo.RecordDeliveryAttempt(ctx, d.deliver(ctx, task)); err != nil {
+				errs <- err
+			}
+		}(task)
+	}
+	wg.Wait()
+	close(errs)
+
+	// Первая ошибка записи; незаписанная попытка повторится после lease
+	if err, ok := <-errs; ok {
+		return len(tasks), err
+	}
+	return len(tasks), nil
+}
+
+// deliver отправляет событие и решает, что делать с доставкой дальше
+func (d *Dispatcher) deliver(ctx context.Context, task model.DeliveryTask) model.DeliveryAttempt {
+	attempt := model.DeliveryAttempt{DeliveryID: task.Delivery.ID, At: d.now()}
+
+	statusCode, err := d.send(ctx, task)
+	attempt.StatusCode = statusCode
+	if err == nil {
+		attempt.Status = model.DeliveryDelivered
+		attempt.NextAttemptAt = attempt.At
+		return attempt
+	}
+
+	attempt.Error = err.Error()
+	attempts := task.Delivery.Attempts + 1
+	if attempts >= d.maxAttempts {
+		attempt.Status = model.DeliveryDead
+		attempt.NextAttemptAt = attempt.At
+		log.Printf("☠️ Webhook %s → %s: попытки исчерпаны (%d): %v", task.Event.ID, task.URL, attempts, err)
+		return attempt
+	}
+	attempt.Status = model.DeliveryPending
+	attempt.NextAttemptAt = attempt.At.Add(d.backoffAfter(attempts))
+	return attempt
+}
+
+// send — один POST подписчику; успех — любой ответ 2xx
+func (d *Dispatcher) send(ctx context.Context, task model.DeliveryTask) (int, error) {
+	body, err := json.Marshal(task.Event)
+	if err != nil {
+		return 0, fmt.Errorf("marshal event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, task.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, task.Event.ID.String())
+	req.Header.Set(HeaderEventType, task.Event.Type)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(task.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // чтобы соединение переиспользовалось
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoffAfter — задержка после n-й неудачной попытки: backoff · 2^(n−1), не больше часа
+func (d *Dispatcher) backoffAfter(n int) time.Duration {
+	delay := d.backoff
+	for i := 1; i < n; i++ {
+		delay *= 2
+		if delay >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return delay
+}
@@ -0,0 +1,278 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/fangimal/ITK/internal/config"
+	"github.com/fangimal/ITK/internal/errors"
+	"github.com/fangimal/ITK/internal/model"
+	"github.com/fangimal/ITK/internal/repository"
+)
+
+const testSecret = "test-secret"
+
+// receiver — подписчик: проверяет подпись и отвечает заданным кодом
+type receiver struct {
+	t      *testing.T
+	mu     sync.Mutex
+	status int
+	events []model.OutboxEvent
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	require.NoError(rc.t, err)
+	assert.True(rc.t, Verify(testSecret, r.Header.Get(HeaderTimestamp), body, r.Header.Get(HeaderSignature)), "bad signature")
+
+	var event model.OutboxEvent
+	require.NoError(rc.t, json.Unmarshal(body, &event))
+	assert.Equal(rc.t, event.ID.String(), r.Header.Get(HeaderEventID))
+	assert.Equal(rc.t, event.Type, r.Header.Get(HeaderEventType))
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.events = append(rc.events, event)
+	w.WriteHeader(rc.status)
+}
+
+func (rc *receiver) setStatus(code int) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.status = code
+}
+
+func (rc *receiver) received() []model.OutboxEvent {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]model.OutboxEvent(nil), rc.events...)
+}
+
+// setup — хранилище в памяти, подписчик и диспетчер с ручными часами
+func setup(t *testing.T, maxAttempts int) (*repository.MemoryWalletRepository, *Dispatcher, *receiver, *time.Time) {
+	t.Helper()
+	cfg := &config.Config{
+		IdempotencyTTL:      time.Hour,
+		WebhookPollInterval: time.Second,
+		WebhookTimeout:      time.Second,
+		WebhookBackoff:      10 * time.Second,
+		WebhookMaxAttempts:  maxAttempts,
+
+		WebhookAllowedTargets: []string{"127.0.0.1"}, // подписчик — httptest-сервер
+	}
+	repo := repository.NewMemoryWalletRepository(cfg)
+
+	rc := &receiver{t: t, status: http.StatusOK}
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+
+	_, err := repo.CreateSubscription(context.Background(), model.WebhookSubscription{URL: srv.URL, Secret: testSecret})
+	require.NoError(t, err)
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	d := NewDispatcher(repo, cfg)
+	d.now = func() time.Time { return now }
+	return repo, d, rc, &now
+}
+
+func deposit(t *testing.T, repo repository.WalletRepository, amount int64) uuid.UUID {
+	t.Helper()
+	ctx := context.Background()
+	wallet, err := repo.CreateWallet(ctx, model.CreateWalletRequest{})
+	require.NoError(t, err)
+	require.NoError(t, repo.UpdateBalance(ctx, wallet.ID, amount, true))
+	return wallet.ID
+}
+
+func TestDispatcher_Delivers(t *testing.T) {
+	ctx := context.Background()
+	repo, d, rc, _ := setup(t, 3)
+	walletID := deposit(t, repo, 700)
+
+	n, err := d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	events := rc.received()
+	require.Len(t, events, 1)
+	assert.Equal(t, model.EventBalanceChanged, events[0].Type)
+	var data model.BalanceChanged
+	require.NoError(t, json.Unmarshal(events[0].Data, &data))
+	assert.Equal(t, walletID, data.WalletID)
+	assert.Equal(t, string(model.OperationDeposit), data.OperationType)
+	assert.Equal(t, int64(700), data.Amount)
+	assert.Equal(t, int64(700), data.Balance)
+
+	deliveries, err := repo.ListDeliveries(ctx, model.DeliveryFilter{})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, model.DeliveryDelivered, deliveries[0].Status)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.NotNil(t, deliveries[0].DeliveredAt)
+
+	// Доставленное повторно не отправляется
+	n, err = d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestDispatcher_RetriesWithBackoffThenDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	repo, d, rc, now := setup(t, 3)
+	rc.setStatus(http.StatusServiceUnavailable)
+	deposit(t, repo, 100)
+
+	_, err := d.RunOnce(ctx)
+	require.NoError(t, err)
+	deliveries, err := repo.ListDeliveries(ctx, model.DeliveryFilter{})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	first := deliveries[0]
+	assert.Equal(t, model.DeliveryPending, first.Status)
+	assert.Equal(t, 1, first.Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, first.LastStatusCode)
+	assert.Equal(t, now.Add(10*time.Second), first.NextAttemptAt)
+
+	// До наступления срока повтора ничего не отправляется
+	*now = now.Add(5 * time.Second)
+	n, err := d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	// Вторая попытка — задержка удваивается
+	*now = first.NextAttemptAt
+	_, err = d.RunOnce(ctx)
+	require.NoError(t, err)
+	deliveries, err = repo.ListDeliveries(ctx, model.DeliveryFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Equal(t, now.Add(20*time.Second), deliveries[0].NextAttemptAt)
+
+	// Третья неудача исчерпывает попытки
+	*now = deliveries[0].NextAttemptAt
+	_, err = d.RunOnce(ctx)
+	require.NoError(t, err)
+	dead, err := repo.ListDeliveries(ctx, model.DeliveryFilter{Status: model.DeliveryDead})
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Len(t, rc.received(), 3)
+
+	*now = now.Add(time.Hour)
+	n, err = d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n, "dead deliveries must not be retried automatically")
+
+	// Ручная переотправка после починки подписчика
+	rc.setStatus(http.StatusNoContent)
+	redelivered, err := repo.Redeliver(ctx, dead[0].ID, *now)
+	require.NoError(t, err)
+	assert.Equal(t, model.DeliveryPending, redelivered.Status)
+	assert.Zero(t, redelivered.Attempts)
+
+	n, err = d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	delivered, err := repo.ListDeliveries(ctx, model.DeliveryFilter{Status: model.DeliveryDelivered})
+	require.NoError(t, err)
+	assert.Len(t, delivered, 1)
+}
+
+func TestDispatcher_UnreachableSubscriber(t *testing.T) {
+	ctx := context.Background()
+	repo, d, _, _ := setup(t, 5)
+	_, err := repo.CreateSubscription(ctx, model.WebhookSubscription{URL: "http://127.0.0.1:1/hook", Secret: testSecret})
+	require.NoError(t, err)
+	deposit(t, repo, 100)
+
+	n, err := d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	pending, err := repo.ListDeliveries(ctx, model.DeliveryFilter{Status: model.DeliveryPending})
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.NotEmpty(t, pending[0].LastError)
+	assert.Zero(t, pending[0].LastStatusCode)
+}
+
+func TestBackoffAfter(t *testing.T) {
+	d := &Dispatcher{backoff: 5 * time.Second}
+	assert.Equal(t, 5*time.Second, d.backoffAfter(1))
+	assert.Equal(t, 10*time.Second, d.backoffAfter(2))
+	assert.Equal(t, 40*time.Second, d.backoffAfter(4))
+	assert.Equal(t, maxBackoff, d.backoffAfter(30))
+}
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	sig := Sign("k", 1700000000, body)
+	assert.True(t, Verify("k", "1700000000", body, sig))
+	assert.False(t, Verify("other", "1700000000", body, sig))
+	assert.False(t, Verify("k", "1700000001", body, sig))
+	assert.False(t, Verify("k", "1700000000", []byte(`{"id":"2"}`), sig))
+	assert.False(t, Verify("k", "not-a-number", body, sig))
+}
+
+func TestDispatcher_ForbiddenTarget(t *testing.T) {
+	ctx := context.Background()
+	repo, d, rc, _ := setup(t, 5)
+	// Подписка на внутренний адрес, созданная в обход проверки обработчика
+	// (или DNS-имя, сменившее адрес): соединение не устанавливается
+	d.client.Transport.(*http.Transport).DialContext = NewTargetPolicy(nil).DialContext
+	deposit(t, repo, 100)
+
+	_, err := d.RunOnce(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, rc.received())
+
+	pending, err := repo.ListDeliveries(ctx, model.DeliveryFilter{Status: model.DeliveryPending})
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Contains(t, pending[0].LastError, "forbidden address")
+}
+
+func TestTargetPolicy(t *testing.T) {
+	ctx := context.Background()
+	policy := NewTargetPolicy(nil)
+
+	for _, rawURL := range []string{"https://93.184.215.14/hook", "http://[2606:2800:21f:cb07:6820:80da:af6b:8b2c]:8443/hook"} {
+		assert.NoError(t, policy.CheckURL(ctx, rawURL), rawURL)
+	}
+
+	for _, rawURL := range []string{"", "/hook", "ftp://93.184.215.14/hook", "http:///hook", "93.184.215.14/hook"} {
+		assert.ErrorIs(t, policy.CheckURL(ctx, rawURL), errors.InvalidWebhookURL, rawURL)
+	}
+
+	for _, rawURL := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://[::1]/hook",
+		"http://0.0.0.0/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[fe80::1]/hook",
+		"http://10.0.0.5/hook",
+		"http://172.16.3.4/hook",
+		"https://192.168.1.1/hook",
+		"http://[fd00::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+	} {
+		assert.ErrorIs(t, policy.CheckURL(ctx, rawURL), errors.ForbiddenWebhookURL, rawURL)
+	}
+
+	allowing := NewTargetPolicy([]string{"10.1.0.0/16", "127.0.0.1", "hooks.internal"})
+	assert.NoError(t, allowing.CheckURL(ctx, "http://10.1.2.3/hook"))
+	assert.NoError(t, allowing.CheckURL(ctx, "http://127.0.0.1:9000/hook"))
+	assert.NoError(t, allowing.CheckURL(ctx, "http://Hooks.Internal/hook"))
+	assert.ErrorIs(t, allowing.CheckURL(ctx, "http://10.2.0.1/hook"), errors.ForbiddenWebhookURL)
+}
@@ -0,0 +1,45 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// Заголовки запроса к подписчику
+const (
+	HeaderEventID   = "X-Wallet-Event-Id"
+	HeaderEventType = "X-Wallet-Event"
+	HeaderTimestamp = "X-Wallet-Timestamp" // unix-время отправки, входит в подпись
+	HeaderSignature = "X-Wallet-Signature" // "sha256=" + hex(HMAC-SHA256(secret, timestamp + "." + body))
+)
+
+const signaturePrefix = "sha256="
+
+// Sign подписывает тело запроса. Время входит в подпись, чтобы получатель
+// мог отбросить перехваченный и повторённый позже запрос.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify — проверка подписи на стороне получателя
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(signature))
+}
+
+// NewSecret — случайный ключ подписи для новой подписки
+func NewSecret() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b) // crypto/rand.Read не возвращает ошибок
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,112 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+
+	"github.com/fangimal/ITK/internal/errors"
+)
+
+// Подписчик — внешний сервис. Адрес подписки во внутренней сети позволил бы
+// слать запросы от имени сервера (SSRF) на localhost, в метаданные облака
+// (169.254.169.254) и соседним сервисам. Поэтому адрес проверяется при
+// создании подписки и ещё раз при каждом соединении: DNS-имя могут направить
+// на внутренний адрес уже после проверки.
+
+// TargetPolicy — куда можно доставлять вебхуки. Внутренние адреса (loopback,
+// link-local, частные сети) запрещены, кроме хостов и сетей из allow-list
+// (WEBHOOK_ALLOWED_TARGETS).
+type TargetPolicy struct {
+	hosts    map[string]bool // разрешённые имена хостов
+	prefixes []netip.Prefix  // разрешённые адреса и сети
+	resolver *net.Resolver
+}
+
+// NewTargetPolicy — политика с allow-list из имён хостов, IP-адресов и сетей
+// в нотации CIDR ("hooks.internal", "127.0.0.1", "10.1.0.0/16")
+func NewTargetPolicy(allowed []string) *TargetPolicy {
+	p := &TargetPolicy{hosts: make(map[string]bool), resolver: net.DefaultResolver}
+	for _, entry := range allowed {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			p.prefixes = append(p.prefixes, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			p.prefixes = append(p.prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		p.hosts[strings.ToLower(entry)] = true
+	}
+	return p
+}
+
+// CheckURL — URL подписки: абсолютный http(s) с хостом, который не указывает
+// на внутренний адрес. Имя хоста разрешается через DNS, и проверяются все его адреса.
+func (p *TargetPolicy) CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("%w: url must be an absolute http(s) URL", errors.InvalidWebhookURL)
+	}
+
+	host := u.Hostname()
+	if p.hosts[strings.ToLower(host)] {
+		return nil
+	}
+	addrs, err := p.lookup(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: cannot resolve host %q", errors.InvalidWebhookURL, host)
+	}
+	for _, addr := range addrs {
+		if err := p.checkAddr(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DialContext — для http.Transport: соединяется только с разрешёнными
+// адресами. Проверяется адрес, с которым реально устанавливается соединение.
+func (p *TargetPolicy) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Resolver: p.resolver}
+	if !p.hosts[strings.ToLower(host)] {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			return p.checkAddr(addrPort.Addr())
+		}
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+func (p *TargetPolicy) lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr}, nil
+	}
+	return p.resolver.LookupNetIP(ctx, "ip", host)
+}
+
+// checkAddr — ошибка, если адрес внутренний и не входит в allow-list
+func (p *TargetPolicy) checkAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+	for _, prefix := range p.prefixes {
+		if prefix.Contains(addr) {
+			return nil
+		}
+	}
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("%w: %s is a loopback, link-local or private address", errors.ForbiddenWebhookURL, addr)
+	}
+	return nil
+}